@@ -0,0 +1,35 @@
+//go:build emulator
+
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/heci/emulator"
+	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EmulatorStateEnv names the yaml file holding the emulated firmware state.
+// Builds with the emulator tag talk to this firmware instead of /dev/mei0.
+const EmulatorStateEnv = "RPC_EMULATOR_STATE"
+
+func init() {
+	path := os.Getenv(EmulatorStateEnv)
+	if path == "" {
+		path = "rpc-emulator.yaml"
+	}
+	fw, err := emulator.NewFirmwareFromFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// LME reads block on real hardware, keep long running relays from spinning
+	fw.ReadTimeout = 100 * time.Millisecond
+	pthi.NewHeciDriver = fw.NewDevice
+}
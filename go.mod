@@ -12,12 +12,12 @@ require (
 	github.com/open-amt-cloud-toolkit/go-wsman-messages v1.14.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/crypto v0.17.0
 	golang.org/x/sys v0.16.0
 )
 
 require (
 	github.com/geoffgarside/ber v1.1.0 // indirect
-	golang.org/x/crypto v0.17.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
 )
 
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
 	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +36,28 @@ type CodeVersions struct {
 	Versions      [50]AMTVersionType //[VERSIONS_NUMBER]
 }
 
+// FirmwareVersion is one Description/Version pair reported by the ME
+type FirmwareVersion struct {
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// FirmwareVersions holds the BIOS version and every code version reported by the ME
+type FirmwareVersions struct {
+	BiosVersion string            `json:"biosVersion"`
+	Versions    []FirmwareVersion `json:"versions"`
+}
+
+// Get returns the version with the given description, e.g. "AMT", "Build Number" or "Sku"
+func (f FirmwareVersions) Get(description string) (string, bool) {
+	for _, v := range f.Versions {
+		if v.Description == description {
+			return v.Version, true
+		}
+	}
+	return "", false
+}
+
 // InterfaceSettings ...
 type InterfaceSettings struct {
 	IsEnabled   bool   `json:"isEnable"`
@@ -62,12 +85,53 @@ type CertHashEntry struct {
 	IsDefault bool
 }
 
+// SecurityParameters holds the security related AMT settings
+type SecurityParameters struct {
+	EnterpriseMode          bool   `json:"enterpriseMode"`
+	TLSEnabled              bool   `json:"tlsEnabled"`
+	HWCryptoEnabled         bool   `json:"hwCryptoEnabled"`
+	ProvisioningState       string `json:"provisioningState"`
+	NetworkInterfaceEnabled bool   `json:"networkInterfaceEnabled"`
+	SOLEnabled              bool   `json:"solEnabled"`
+	IDEREnabled             bool   `json:"iderEnabled"`
+	FWUpdateEnabled         bool   `json:"fwUpdateEnabled"`
+	LinkIsUp                bool   `json:"linkIsUp"`
+}
+
+// MACAddresses holds the dedicated (AMT) and shared (host) MAC addresses
+type MACAddresses struct {
+	DedicatedMAC string `json:"dedicatedMac"`
+	HostMAC      string `json:"hostMac"`
+}
+
 // LocalSystemAccount holds username and password
 type LocalSystemAccount struct {
 	Username string
 	Password string
 }
 
+// RNGSeedStatus reports whether the firmware random number generator is seeded
+type RNGSeedStatus uint32
+
+const (
+	RNGSeedExists     = RNGSeedStatus(pthi.RNG_STATUS_EXIST)
+	RNGSeedInProgress = RNGSeedStatus(pthi.RNG_STATUS_IN_PROGRESS)
+	RNGSeedNotExists  = RNGSeedStatus(pthi.RNG_STATUS_NOT_EXIST)
+)
+
+func (s RNGSeedStatus) String() string {
+	switch s {
+	case RNGSeedExists:
+		return "ready"
+	case RNGSeedInProgress:
+		return "in progress"
+	case RNGSeedNotExists:
+		return "not generated"
+	default:
+		return "unknown"
+	}
+}
+
 type ChangeEnabledResponse uint8
 
 func (r ChangeEnabledResponse) IsTransitionAllowed() bool {
@@ -86,6 +150,7 @@ type Interface interface {
 	EnableAMT() error
 	DisableAMT() error
 	GetVersionDataFromME(key string, amtTimeout time.Duration) (string, error)
+	GetAllCodeVersions(amtTimeout time.Duration) (FirmwareVersions, error)
 	GetUUID() (string, error)
 	GetControlMode() (int, error)
 	GetOSDNSSuffix() (string, error)
@@ -95,6 +160,16 @@ type Interface interface {
 	GetLANInterfaceSettings(useWireless bool) (InterfaceSettings, error)
 	GetLocalSystemAccount() (LocalSystemAccount, error)
 	Unprovision() (mode int, err error)
+	GetSecurityParameters() (SecurityParameters, error)
+	GetMACAddresses() (MACAddresses, error)
+	GetProvisioningState() (int, error)
+	GetDNSSuffixList() ([]string, error)
+	SetEnterpriseAccess(hostIPAddress string, enterpriseAccess bool) error
+	GenerateRNGSeed() error
+	GetRNGSeedStatus() (RNGSeedStatus, error)
+	SetPkiFQDNSuffix(suffix string) error
+	StartConfigurationHBased(serverCertHash []byte, dnsSuffixes []string) (CertHashEntry, error)
+	StopConfiguration() error
 }
 
 func ANSI2String(ansi pthi.AMTANSIString) string {
@@ -135,9 +210,21 @@ func (amt AMTCommand) Initialize() (utils.ReturnCode, error) {
 
 // GetVersionDataFromME ...
 func (amt AMTCommand) GetVersionDataFromME(key string, amtTimeout time.Duration) (string, error) {
+	versions, err := amt.GetAllCodeVersions(amtTimeout)
+	if err != nil {
+		return "", err
+	}
+	if version, ok := versions.Get(key); ok {
+		return version, nil
+	}
+	return "", errors.New(key + " Not Found")
+}
+
+// GetAllCodeVersions reads the BIOS version and all ME code versions in a single HECI round trip
+func (amt AMTCommand) GetAllCodeVersions(amtTimeout time.Duration) (FirmwareVersions, error) {
 	err1 := amt.PTHI.Open(false)
 	if err1 != nil {
-		return "", err1
+		return FirmwareVersions{}, err1
 	}
 	ticker := time.NewTicker(15 * time.Second)
 	startTime := time.Now()
@@ -158,16 +245,32 @@ func (amt AMTCommand) GetVersionDataFromME(key string, amtTimeout time.Duration)
 	}
 	amt.PTHI.Close()
 	if err != nil {
-		return "", err
+		return FirmwareVersions{}, err
 	}
 
-	for i := 0; i < int(result.CodeVersion.VersionsCount); i++ {
-		if string(result.CodeVersion.Versions[i].Description.String[:result.CodeVersion.Versions[i].Description.Length]) == key {
-			return strings.Replace(string(result.CodeVersion.Versions[i].Version.String[:]), "\u0000", "", -1), nil
-		}
+	versions := FirmwareVersions{
+		BiosVersion: strings.Replace(string(result.CodeVersion.BiosVersion[:]), "\u0000", "", -1),
+		Versions:    []FirmwareVersion{},
+	}
+	count := int(result.CodeVersion.VersionsCount)
+	if count > len(result.CodeVersion.Versions) {
+		count = len(result.CodeVersion.Versions)
+	}
+	for i := 0; i < count; i++ {
+		versions.Versions = append(versions.Versions, FirmwareVersion{
+			Description: unicodeToString(result.CodeVersion.Versions[i].Description),
+			Version:     unicodeToString(result.CodeVersion.Versions[i].Version),
+		})
 	}
+	return versions, nil
+}
 
-	return "", errors.New(key + " Not Found")
+func unicodeToString(s pthi.AMTUnicodeString) string {
+	length := int(s.Length)
+	if length > len(s.String) {
+		length = len(s.String)
+	}
+	return strings.Replace(string(s.String[:length]), "\u0000", "", -1)
 }
 
 func (amt AMTCommand) GetChangeEnabled() (ChangeEnabledResponse, error) {
@@ -369,13 +472,7 @@ func (amt AMTCommand) GetLANInterfaceSettings(useWireless bool) (InterfaceSettin
 
 	settings.IPAddress = strconv.Itoa(int(part1)) + "." + strconv.Itoa(int(part2)) + "." + strconv.Itoa(int(part3)) + "." + strconv.Itoa(int(part4))
 
-	macPart0 := fmt.Sprintf("%02x", int(result.MacAddress[0]))
-	macPart1 := fmt.Sprintf("%02x", int(result.MacAddress[1]))
-	macPart2 := fmt.Sprintf("%02x", int(result.MacAddress[2]))
-	macPart3 := fmt.Sprintf("%02x", int(result.MacAddress[3]))
-	macPart4 := fmt.Sprintf("%02x", int(result.MacAddress[4]))
-	macPart5 := fmt.Sprintf("%02x", int(result.MacAddress[5]))
-	settings.MACAddress = macPart0 + ":" + macPart1 + ":" + macPart2 + ":" + macPart3 + ":" + macPart4 + ":" + macPart5
+	settings.MACAddress = macToString(result.MacAddress)
 
 	return settings, nil
 }
@@ -413,3 +510,230 @@ func (amt AMTCommand) GetLocalSystemAccount() (LocalSystemAccount, error) {
 
 	return lsa, nil
 }
+
+func macToString(mac [6]uint8) string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
+}
+
+func (amt AMTCommand) GetSecurityParameters() (SecurityParameters, error) {
+	err := amt.PTHI.Open(false)
+	emptyParameters := SecurityParameters{}
+	if err != nil {
+		return emptyParameters, err
+	}
+	defer amt.PTHI.Close()
+	result, err := amt.PTHI.GetSecurityParameters()
+	if err != nil {
+		return emptyParameters, err
+	}
+
+	params := result.Parameters
+	return SecurityParameters{
+		EnterpriseMode:          params.EnterpriseMode > 0,
+		TLSEnabled:              params.TLSEnabled > 0,
+		HWCryptoEnabled:         params.HWCryptoEnabled > 0,
+		ProvisioningState:       utils.InterpretProvisioningState(int(params.ProvisioningState)),
+		NetworkInterfaceEnabled: params.NetworkInterfaceEnabled > 0,
+		SOLEnabled:              params.SOLEnabled > 0,
+		IDEREnabled:             params.IDEREnabled > 0,
+		FWUpdateEnabled:         params.FWUpdateEnabled > 0,
+		LinkIsUp:                params.LinkIsUp > 0,
+	}, nil
+}
+
+func (amt AMTCommand) GetMACAddresses() (MACAddresses, error) {
+	err := amt.PTHI.Open(false)
+	emptyAddresses := MACAddresses{}
+	if err != nil {
+		return emptyAddresses, err
+	}
+	defer amt.PTHI.Close()
+	result, err := amt.PTHI.GetMACAddresses()
+	if err != nil {
+		return emptyAddresses, err
+	}
+
+	return MACAddresses{
+		DedicatedMAC: macToString(result.DedicatedMAC),
+		HostMAC:      macToString(result.HostMAC),
+	}, nil
+}
+
+// GetProvisioningState ...
+func (amt AMTCommand) GetProvisioningState() (int, error) {
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return -1, err
+	}
+	defer amt.PTHI.Close()
+	result, err := amt.PTHI.GetProvisioningState()
+	if err != nil {
+		return -1, err
+	}
+
+	return result, nil
+}
+
+func (amt AMTCommand) GetDNSSuffixList() ([]string, error) {
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return []string{}, err
+	}
+	defer amt.PTHI.Close()
+	return amt.PTHI.GetDNSSuffixList()
+}
+
+// SetEnterpriseAccess tells AMT whether the host at hostIPAddress is inside
+// the enterprise network
+func (amt AMTCommand) SetEnterpriseAccess(hostIPAddress string, enterpriseAccess bool) error {
+	ip := net.ParseIP(hostIPAddress)
+	if ip == nil {
+		return errors.New("invalid host IP address: " + hostIPAddress)
+	}
+	var address [16]uint8
+	flags := uint8(pthi.ENTERPRISE_ACCESS_FLAG_IPV6)
+	if ipv4 := ip.To4(); ipv4 != nil {
+		flags = pthi.ENTERPRISE_ACCESS_FLAG_IPV4
+		copy(address[:], ipv4)
+	} else {
+		copy(address[:], ip.To16())
+	}
+	access := uint8(0)
+	if enterpriseAccess {
+		access = 1
+	}
+
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return err
+	}
+	defer amt.PTHI.Close()
+	status, err := amt.PTHI.SetEnterpriseAccess(flags, address, access)
+	if err != nil {
+		return err
+	}
+	if status != pthi.AMT_STATUS_SUCCESS {
+		return errors.New("error setting enterprise access: " + status.String())
+	}
+	return nil
+}
+
+// GenerateRNGSeed asks the firmware to seed its random number generator.
+// A generation that is already running is not an error.
+func (amt AMTCommand) GenerateRNGSeed() error {
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return err
+	}
+	defer amt.PTHI.Close()
+	status, err := amt.PTHI.GenerateRNGSeed()
+	if err != nil {
+		return err
+	}
+	if status != pthi.AMT_STATUS_SUCCESS && status != pthi.AMT_STATUS_RNG_GENERATION_IN_PROGRESS {
+		return errors.New("error generating RNG seed: " + status.String())
+	}
+	return nil
+}
+
+func (amt AMTCommand) GetRNGSeedStatus() (RNGSeedStatus, error) {
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return RNGSeedNotExists, err
+	}
+	defer amt.PTHI.Close()
+	result, err := amt.PTHI.GetRNGSeedStatus()
+	if err != nil {
+		return RNGSeedNotExists, err
+	}
+	return RNGSeedStatus(result), nil
+}
+
+// SetPkiFQDNSuffix sets the DNS suffix AMT matches against the domain of the
+// provisioning certificate during admin control mode activation
+func (amt AMTCommand) SetPkiFQDNSuffix(suffix string) error {
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return err
+	}
+	defer amt.PTHI.Close()
+	status, err := amt.PTHI.SetPkiFQDNSuffix(suffix)
+	if err != nil {
+		return err
+	}
+	if status != pthi.AMT_STATUS_SUCCESS {
+		return errors.New("error setting PKI DNS suffix: " + status.String())
+	}
+	return nil
+}
+
+// certHashAlgorithms maps the hash sizes host based configuration accepts to
+// their algorithm, which uses other values than the certificate hash entries
+var certHashAlgorithms = map[int]pthi.CERT_HASH_ALGORITHM{
+	32: pthi.CERT_HASH_ALGORITHM_SHA256,
+	48: pthi.CERT_HASH_ALGORITHM_SHA384,
+	64: pthi.CERT_HASH_ALGORITHM_SHA512,
+}
+
+var certHashAlgorithmNames = map[pthi.CERT_HASH_ALGORITHM]string{
+	pthi.CERT_HASH_ALGORITHM_SHA256: "SHA256",
+	pthi.CERT_HASH_ALGORITHM_SHA384: "SHA384",
+	pthi.CERT_HASH_ALGORITHM_SHA512: "SHA512",
+}
+
+// StartConfigurationHBased starts host based admin control mode configuration
+// for the server certificate with the given SHA256, SHA384 or SHA512 hash.
+// It returns the hash of the AMT TLS certificate the server connects to.
+func (amt AMTCommand) StartConfigurationHBased(serverCertHash []byte, dnsSuffixes []string) (CertHashEntry, error) {
+	algorithm, ok := certHashAlgorithms[len(serverCertHash)]
+	if !ok {
+		return CertHashEntry{}, fmt.Errorf("unsupported server certificate hash size %d", len(serverCertHash))
+	}
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return CertHashEntry{}, err
+	}
+	defer amt.PTHI.Close()
+	result, err := amt.PTHI.StartConfigurationHBased(algorithm, serverCertHash, false, dnsSuffixes)
+	if err != nil {
+		return CertHashEntry{}, err
+	}
+	if result.Header.Status != pthi.AMT_STATUS_SUCCESS {
+		return CertHashEntry{}, errors.New("error starting host based configuration: " + result.Header.Status.String())
+	}
+	name, ok := certHashAlgorithmNames[result.HashAlgorithm]
+	if !ok {
+		return CertHashEntry{}, fmt.Errorf("unsupported AMT certificate hash algorithm %d", result.HashAlgorithm)
+	}
+	hashString := ""
+	for _, b := range result.AMTCertHash[:hashSize(result.HashAlgorithm)] {
+		hashString = hashString + fmt.Sprintf("%02x", int(b))
+	}
+	return CertHashEntry{Hash: hashString, Algorithm: name}, nil
+}
+
+func hashSize(algorithm pthi.CERT_HASH_ALGORITHM) int {
+	for size, a := range certHashAlgorithms {
+		if a == algorithm {
+			return size
+		}
+	}
+	return 0
+}
+
+// StopConfiguration aborts a configuration that is in progress
+func (amt AMTCommand) StopConfiguration() error {
+	err := amt.PTHI.Open(false)
+	if err != nil {
+		return err
+	}
+	defer amt.PTHI.Close()
+	status, err := amt.PTHI.StopConfiguration()
+	if err != nil {
+		return err
+	}
+	if status != pthi.AMT_STATUS_SUCCESS {
+		return errors.New("error stopping configuration: " + status.String())
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+	"strings"
 	"testing"
 	"time"
 
@@ -146,12 +147,26 @@ func (c MockPTHICommands) GetLocalSystemAccount() (localAccount pthi.GetLocalSys
 	}, nil
 }
 func (c MockPTHICommands) Unprovision() (state int, err error)                { return 0, nil }
-func (c MockPTHICommands) StopConfiguration() (status pthi.Status, err error) { return 0, nil }
+var mockStopConfigurationStatus = pthi.AMT_STATUS_SUCCESS
+
+func (c MockPTHICommands) StopConfiguration() (status pthi.Status, err error) {
+	return mockStopConfigurationStatus, nil
+}
+
+var mockStartConfigurationHBasedResponse = pthi.StartConfigurationHBasedResponse{
+	HashAlgorithm: pthi.CERT_HASH_ALGORITHM_SHA256,
+	AMTCertHash:   [64]byte{0xab, 0xcd, 0x01},
+}
+var mockServerHashAlgorithm pthi.CERT_HASH_ALGORITHM
+
 func (c MockPTHICommands) StartConfigurationHBased(ServerHashAlgorithm pthi.CERT_HASH_ALGORITHM, ServerCertHash []byte, HostVPNEnable bool, NetworkDnsSuffix []string) (response pthi.StartConfigurationHBasedResponse, err error) {
-	return pthi.StartConfigurationHBasedResponse{}, nil
+	mockServerHashAlgorithm = ServerHashAlgorithm
+	return mockStartConfigurationHBasedResponse, nil
 }
+var mockSetPkiFQDNSuffixStatus = pthi.AMT_STATUS_SUCCESS
+
 func (c MockPTHICommands) SetPkiFQDNSuffix(suffix string) (status pthi.Status, err error) {
-	return 0, nil
+	return mockSetPkiFQDNSuffixStatus, nil
 }
 func (c MockPTHICommands) OpenUserInitiatedConnection() (status pthi.Status, err error) {
 	return 0, nil
@@ -159,6 +174,46 @@ func (c MockPTHICommands) OpenUserInitiatedConnection() (status pthi.Status, err
 func (c MockPTHICommands) CloseUserInitiatedConnection() (status pthi.Status, err error) {
 	return 0, nil
 }
+func (c MockPTHICommands) GetSecurityParameters() (response pthi.GetSecurityParametersResponse, err error) {
+	return pthi.GetSecurityParametersResponse{
+		Parameters: pthi.AMTSecurityParameters{
+			EnterpriseMode:          1,
+			TLSEnabled:              0,
+			ProvisioningState:       2,
+			NetworkInterfaceEnabled: 1,
+			LinkIsUp:                1,
+		},
+	}, nil
+}
+func (c MockPTHICommands) GetMACAddresses() (response pthi.GetMACAddressesResponse, err error) {
+	return pthi.GetMACAddressesResponse{
+		DedicatedMAC: [6]uint8{7, 7, 7, 7, 7, 7},
+		HostMAC:      [6]uint8{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f},
+	}, nil
+}
+func (c MockPTHICommands) GetProvisioningState() (state int, err error) { return 2, nil }
+func (c MockPTHICommands) GetDNSSuffixList() (suffixes []string, err error) {
+	return []string{"Test", "Test2"}, nil
+}
+
+var mockEnterpriseAccessFlags uint8
+var mockEnterpriseAccessAddress [16]uint8
+var mockEnterpriseAccessStatus = pthi.AMT_STATUS_SUCCESS
+
+func (c MockPTHICommands) SetEnterpriseAccess(flags uint8, hostIPAddress [16]uint8, enterpriseAccess uint8) (status pthi.Status, err error) {
+	mockEnterpriseAccessFlags = flags
+	mockEnterpriseAccessAddress = hostIPAddress
+	return mockEnterpriseAccessStatus, nil
+}
+
+var mockGenerateRNGSeedStatus = pthi.AMT_STATUS_SUCCESS
+
+func (c MockPTHICommands) GenerateRNGSeed() (status pthi.Status, err error) {
+	return mockGenerateRNGSeedStatus, nil
+}
+func (c MockPTHICommands) GetRNGSeedStatus() (status pthi.AMT_RNG_STATUS, err error) {
+	return pthi.RNG_STATUS_IN_PROGRESS, nil
+}
 
 var amt AMTCommand
 
@@ -187,6 +242,17 @@ func TestGetVersionDataFromME(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "11.8.55", result)
 }
+func TestGetAllCodeVersions(t *testing.T) {
+	result, err := amt.GetAllCodeVersions(1 * time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "Test", result.BiosVersion)
+	assert.Equal(t, []FirmwareVersion{{Description: "Flash", Version: "11.8.55"}}, result.Versions)
+	version, ok := result.Get("Flash")
+	assert.True(t, ok)
+	assert.Equal(t, "11.8.55", version)
+	_, ok = result.Get("AMT")
+	assert.False(t, ok)
+}
 func TestGetVersionDataFromMEError(t *testing.T) {
 	result, err := amt.GetVersionDataFromME("", 1*time.Second)
 	assert.Error(t, err)
@@ -370,3 +436,108 @@ func TestChangeEnabledResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSecurityParameters(t *testing.T) {
+	result, err := amt.GetSecurityParameters()
+	assert.NoError(t, err)
+	assert.True(t, result.EnterpriseMode)
+	assert.False(t, result.TLSEnabled)
+	assert.Equal(t, "post-provisioning", result.ProvisioningState)
+	assert.True(t, result.NetworkInterfaceEnabled)
+	assert.True(t, result.LinkIsUp)
+}
+
+func TestGetMACAddresses(t *testing.T) {
+	result, err := amt.GetMACAddresses()
+	assert.NoError(t, err)
+	assert.Equal(t, "07:07:07:07:07:07", result.DedicatedMAC)
+	assert.Equal(t, "0a:0b:0c:0d:0e:0f", result.HostMAC)
+}
+
+func TestGetProvisioningState(t *testing.T) {
+	result, err := amt.GetProvisioningState()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result)
+}
+
+func TestGetDNSSuffixList(t *testing.T) {
+	result, err := amt.GetDNSSuffixList()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Test", "Test2"}, result)
+}
+
+func TestSetEnterpriseAccess(t *testing.T) {
+	t.Run("encodes an IPv4 address", func(t *testing.T) {
+		err := amt.SetEnterpriseAccess("192.168.1.10", true)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(pthi.ENTERPRISE_ACCESS_FLAG_IPV4), mockEnterpriseAccessFlags)
+		assert.Equal(t, [16]uint8{192, 168, 1, 10}, mockEnterpriseAccessAddress)
+	})
+	t.Run("encodes an IPv6 address", func(t *testing.T) {
+		err := amt.SetEnterpriseAccess("fe80::1", false)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(pthi.ENTERPRISE_ACCESS_FLAG_IPV6), mockEnterpriseAccessFlags)
+		assert.Equal(t, uint8(0xfe), mockEnterpriseAccessAddress[0])
+		assert.Equal(t, uint8(0x01), mockEnterpriseAccessAddress[15])
+	})
+	t.Run("returns error on invalid address", func(t *testing.T) {
+		err := amt.SetEnterpriseAccess("not an ip", true)
+		assert.Error(t, err)
+	})
+	t.Run("returns error on failed status", func(t *testing.T) {
+		mockEnterpriseAccessStatus = pthi.AMT_STATUS_NOT_PERMITTED
+		err := amt.SetEnterpriseAccess("192.168.1.10", true)
+		assert.Error(t, err)
+		mockEnterpriseAccessStatus = pthi.AMT_STATUS_SUCCESS
+	})
+}
+
+func TestGenerateRNGSeed(t *testing.T) {
+	assert.NoError(t, amt.GenerateRNGSeed())
+	mockGenerateRNGSeedStatus = pthi.AMT_STATUS_RNG_GENERATION_IN_PROGRESS
+	assert.NoError(t, amt.GenerateRNGSeed())
+	mockGenerateRNGSeedStatus = pthi.AMT_STATUS_INTERNAL_ERROR
+	assert.Error(t, amt.GenerateRNGSeed())
+	mockGenerateRNGSeedStatus = pthi.AMT_STATUS_SUCCESS
+}
+
+func TestSetPkiFQDNSuffix(t *testing.T) {
+	assert.NoError(t, amt.SetPkiFQDNSuffix("vprodemo.com"))
+	mockSetPkiFQDNSuffixStatus = pthi.AMT_STATUS_NOT_PERMITTED
+	assert.Error(t, amt.SetPkiFQDNSuffix("vprodemo.com"))
+	mockSetPkiFQDNSuffixStatus = pthi.AMT_STATUS_SUCCESS
+}
+
+func TestStartConfigurationHBased(t *testing.T) {
+	t.Run("returns the AMT certificate hash", func(t *testing.T) {
+		result, err := amt.StartConfigurationHBased(make([]byte, 48), []string{"vprodemo.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, pthi.CERT_HASH_ALGORITHM_SHA384, mockServerHashAlgorithm)
+		assert.Equal(t, "SHA256", result.Algorithm)
+		assert.Equal(t, "abcd01"+strings.Repeat("00", 29), result.Hash)
+	})
+	t.Run("returns error on an unsupported server hash size", func(t *testing.T) {
+		_, err := amt.StartConfigurationHBased(make([]byte, 20), nil)
+		assert.Error(t, err)
+	})
+	t.Run("returns error on failed status", func(t *testing.T) {
+		mockStartConfigurationHBasedResponse.Header.Status = pthi.AMT_STATUS_NOT_PERMITTED
+		_, err := amt.StartConfigurationHBased(make([]byte, 32), nil)
+		assert.Error(t, err)
+		mockStartConfigurationHBasedResponse.Header.Status = pthi.AMT_STATUS_SUCCESS
+	})
+}
+
+func TestStopConfiguration(t *testing.T) {
+	assert.NoError(t, amt.StopConfiguration())
+	mockStopConfigurationStatus = pthi.AMT_STATUS_INTERNAL_ERROR
+	assert.Error(t, amt.StopConfiguration())
+	mockStopConfigurationStatus = pthi.AMT_STATUS_SUCCESS
+}
+
+func TestGetRNGSeedStatus(t *testing.T) {
+	result, err := amt.GetRNGSeedStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, RNGSeedInProgress, result)
+	assert.Equal(t, "in progress", result.String())
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// backupMagic starts every backup archive and names its format version
+const backupMagic = "RPC-BACKUP-1\n"
+
+const (
+	backupSaltSize = 16
+	backupKeySize  = 32
+)
+
+// ErrBackupPassphrase is returned for a wrong passphrase or a damaged archive,
+// AES-GCM cannot tell them apart
+var ErrBackupPassphrase = errors.New("wrong passphrase or damaged backup archive")
+
+type (
+	// Backup is what rpc backup reads from AMT. Config has no secrets,
+	// AMT never returns passwords, passphrases or private keys.
+	Backup struct {
+		Created      time.Time           `json:"created"`
+		ControlMode  int                 `json:"controlMode"`
+		Config       Config              `json:"config"`
+		Certificates []BackupCertificate `json:"certificates"`
+	}
+	// BackupCertificate is the public part of a certificate in AMT
+	BackupCertificate struct {
+		InstanceID      string `json:"instanceID"`
+		X509Certificate string `json:"x509Certificate"`
+		TrustedRoot     bool   `json:"trustedRoot"`
+		// HasKeyPair is set when AMT holds the private key, which restore cannot add again
+		HasKeyPair bool   `json:"hasKeyPair,omitempty"`
+		UsedBy     string `json:"usedBy,omitempty"`
+	}
+)
+
+// EncryptBackup seals the backup with AES-256-GCM and a key derived from
+// the passphrase with scrypt
+func EncryptBackup(backup Backup, passphrase string) ([]byte, error) {
+	plaintext, err := json.Marshal(backup)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	archive := append([]byte(backupMagic), salt...)
+	archive = append(archive, nonce...)
+	return gcm.Seal(archive, nonce, plaintext, []byte(backupMagic)), nil
+}
+
+func DecryptBackup(archive []byte, passphrase string) (Backup, error) {
+	var backup Backup
+	if !bytes.HasPrefix(archive, []byte(backupMagic)) {
+		return backup, errors.New("not an rpc backup archive")
+	}
+	archive = archive[len(backupMagic):]
+	if len(archive) < backupSaltSize {
+		return backup, ErrBackupPassphrase
+	}
+	gcm, err := backupCipher(passphrase, archive[:backupSaltSize])
+	if err != nil {
+		return backup, err
+	}
+	archive = archive[backupSaltSize:]
+	if len(archive) < gcm.NonceSize() {
+		return backup, ErrBackupPassphrase
+	}
+	plaintext, err := gcm.Open(nil, archive[:gcm.NonceSize()], archive[gcm.NonceSize():], []byte(backupMagic))
+	if err != nil {
+		return backup, ErrBackupPassphrase
+	}
+	err = json.Unmarshal(plaintext, &backup)
+	return backup, err
+}
+
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, backupKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
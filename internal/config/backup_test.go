@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupArchive(t *testing.T) {
+	backup := Backup{
+		Created:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		ControlMode: 1,
+		Config: Config{
+			Activation:  "ccm",
+			Hostname:    "device01",
+			WifiConfigs: WifiConfigs{{ProfileName: "home", SSID: "ssid", Priority: 1, AuthenticationMethod: 6, EncryptionMethod: 4}},
+		},
+		Certificates: []BackupCertificate{{InstanceID: "Intel(r) AMT Certificate: Handle: 0", X509Certificate: "MIIB", TrustedRoot: true}},
+	}
+	archive, err := EncryptBackup(backup, "passphrase")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(archive), "device01")
+
+	t.Run("opens with the passphrase", func(t *testing.T) {
+		decrypted, err := DecryptBackup(archive, "passphrase")
+		assert.Nil(t, err)
+		assert.Equal(t, backup, decrypted)
+	})
+	t.Run("rejects a wrong passphrase", func(t *testing.T) {
+		_, err := DecryptBackup(archive, "other")
+		assert.Equal(t, ErrBackupPassphrase, err)
+	})
+	t.Run("rejects a damaged archive", func(t *testing.T) {
+		damaged := append([]byte{}, archive...)
+		damaged[len(damaged)-1] ^= 1
+		_, err := DecryptBackup(damaged, "passphrase")
+		assert.Equal(t, ErrBackupPassphrase, err)
+		_, err = DecryptBackup(archive[:len(backupMagic)+4], "passphrase")
+		assert.Equal(t, ErrBackupPassphrase, err)
+	})
+	t.Run("rejects other files", func(t *testing.T) {
+		_, err := DecryptBackup([]byte("password: P@ssw0rd\n"), "passphrase")
+		assert.EqualError(t, err, "not an rpc backup archive")
+	})
+}
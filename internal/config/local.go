@@ -6,6 +6,16 @@ type (
 		WifiConfigs      `yaml:"wifiConfigs"`
 		Ieee8021xConfigs `yaml:"ieee8021xConfigs"`
 		ACMSettings      `yaml:"acmactivate"`
+		CIRA             CIRAConfig        `yaml:"cira"`
+		Wired            WiredConfig       `yaml:"wired"`
+		Redirection      RedirectionConfig `yaml:"redirection"`
+		Users            UserConfigs       `yaml:"users"`
+		// the remaining settings are only used by apply
+		Activation string    `yaml:"activation"`
+		TLS        TLSConfig `yaml:"tls"`
+		Hostname   string    `yaml:"hostname"`
+		DomainName string    `yaml:"domainName"`
+		SyncClock  bool      `yaml:"syncClock"`
 	}
 	WifiConfigs []WifiConfig
 	WifiConfig  struct {
@@ -25,6 +35,7 @@ type (
 		PskPassphrase string `yaml:"pskPassphrase"`
 		PrivateKey    string `yaml:"privateKey"`
 		Password      string `yaml:"password"`
+		Username      string `yaml:"username"`
 	}
 	Ieee8021xConfigs []Ieee8021xConfig
 	Ieee8021xConfig  struct {
@@ -37,9 +48,53 @@ type (
 		PrivateKey             string `yaml:"privateKey"`
 	}
 
+	CIRAConfig struct {
+		MPSAddress           string   `yaml:"mpsAddress"`
+		MPSPort              int      `yaml:"mpsPort"`
+		MPSCert              string   `yaml:"mpsCert"`
+		MPSUsername          string   `yaml:"mpsUsername"`
+		MPSPassword          string   `yaml:"mpsPassword"`
+		CommonName           string   `yaml:"commonName"`
+		EnvironmentDetection []string `yaml:"environmentDetection"`
+	}
+
+	WiredConfig struct {
+		DHCP                 bool   `yaml:"dhcp"`
+		IPSync               bool   `yaml:"ipSync"`
+		IPAddress            string `yaml:"ipAddress"`
+		SubnetMask           string `yaml:"subnetMask"`
+		Gateway              string `yaml:"gateway"`
+		PrimaryDNS           string `yaml:"primaryDNS"`
+		SecondaryDNS         string `yaml:"secondaryDNS"`
+		Ieee8021xProfileName string `yaml:"ieee8021xProfileName"`
+	}
+
+	// RedirectionConfig leaves a feature unchanged when it is nil
+	RedirectionConfig struct {
+		SOL         *bool  `yaml:"sol"`
+		IDER        *bool  `yaml:"ider"`
+		KVM         *bool  `yaml:"kvm"`
+		UserConsent string `yaml:"userConsent"`
+	}
+
+	TLSConfig struct {
+		Mode string `yaml:"mode"`
+	}
+
+	UserConfigs []UserConfig
+	UserConfig  struct {
+		Username         string   `yaml:"username"`
+		Password         string   `yaml:"password"`
+		AccessPermission string   `yaml:"accessPermission"`
+		Realms           []string `yaml:"realms"`
+	}
+
 	ACMSettings struct {
 		AMTPassword         string `yaml:"amtPassword"`
 		ProvisioningCert    string `yaml:"provisioningCert"`
 		ProvisioningCertPwd string `yaml:"provisioningCertPwd"`
+		// SetPkiDNSSuffix sets the AMT PKI DNS suffix from the provisioning
+		// certificate when it matches no DNS suffix known to AMT
+		SetPkiDNSSuffix bool `yaml:"setPkiDnsSuffix"`
 	}
 )
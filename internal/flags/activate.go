@@ -16,6 +16,8 @@ func (f *Flags) handleActivateCommand() utils.ReturnCode {
 	f.amtActivateCommand.BoolVar(&f.Local, "local", false, "activate amt locally")
 	f.amtActivateCommand.BoolVar(&f.UseCCM, "ccm", false, "activate in client control mode (CCM)")
 	f.amtActivateCommand.BoolVar(&f.UseACM, "acm", false, "activate in admin control mode (ACM)")
+	f.amtActivateCommand.BoolVar(&f.UseHBased, "hbased", false, "activate in ACM with host based configuration over TLS, required by newer AMT firmware")
+	f.amtActivateCommand.BoolVar(&f.StopConfiguration, "stopConfiguration", false, "abort a host based configuration that did not complete")
 	// use the Func call rather than StringVar to keep the default value out of the help/usage message
 	f.amtActivateCommand.Func("name", "friendly name to associate with this device", func(flagValue string) error {
 		f.FriendlyName = flagValue
@@ -27,6 +29,7 @@ func (f *Flags) handleActivateCommand() utils.ReturnCode {
 	f.amtActivateCommand.StringVar(&f.LocalConfig.ACMSettings.AMTPassword, "amtPassword", f.lookupEnvOrString("AMT_PASSWORD", ""), "amt password")
 	f.amtActivateCommand.StringVar(&f.LocalConfig.ACMSettings.ProvisioningCert, "provisioningCert", f.lookupEnvOrString("PROVISIONING_CERT", ""), "provisioning certificate")
 	f.amtActivateCommand.StringVar(&f.LocalConfig.ACMSettings.ProvisioningCertPwd, "provisioningCertPwd", f.lookupEnvOrString("PROVISIONING_CERT_PASSWORD", ""), "provisioning certificate password")
+	f.amtActivateCommand.BoolVar(&f.LocalConfig.ACMSettings.SetPkiDNSSuffix, "setPkiDnsSuffix", false, "set the AMT PKI DNS suffix from the provisioning certificate when it does not match")
 
 	if len(f.commandLineArgs) == 2 {
 		f.amtActivateCommand.PrintDefaults()
@@ -53,6 +56,10 @@ func (f *Flags) handleActivateCommand() utils.ReturnCode {
 		fmt.Println("provide either a 'url' or a 'local', but not both")
 		return utils.InvalidParameterCombination
 	}
+	if !f.Local && (f.UseHBased || f.StopConfiguration) {
+		fmt.Println("-hbased and -stopConfiguration require -local")
+		return utils.InvalidParameterCombination
+	}
 
 	if !f.Local {
 		if f.URL == "" {
@@ -73,11 +80,20 @@ func (f *Flags) handleActivateCommand() utils.ReturnCode {
 			}
 			fmt.Println("Warning: Overriding UUID prevents device from connecting to MPS")
 		}
+	} else if f.StopConfiguration {
+		if f.UseCCM || f.UseACM {
+			fmt.Println("-stopConfiguration cannot be used with -ccm or -acm")
+			return utils.InvalidParameterCombination
+		}
 	} else {
 		if !f.UseCCM && !f.UseACM || f.UseCCM && f.UseACM {
 			fmt.Println("must specify -ccm or -acm, but not both")
 			return utils.InvalidParameterCombination
 		}
+		if f.UseHBased && !f.UseACM {
+			fmt.Println("-hbased requires -acm")
+			return utils.InvalidParameterCombination
+		}
 
 		if f.UseACM {
 			rc := f.handleLocalConfig()
@@ -235,6 +235,30 @@ func TestHandleActivateCommandLocal(t *testing.T) {
 				" -provisioningCertPwd " + trickyPassword,
 			wantResult: utils.Success,
 		},
+		"should pass with acm and hbased": {
+			cmdLine:    "./rpc activate -local -acm -hbased -config ../../config.yaml",
+			wantResult: utils.Success,
+		},
+		"should fail with ccm and hbased": {
+			cmdLine:    "./rpc activate -local -ccm -hbased -password " + trickyPassword,
+			wantResult: utils.InvalidParameterCombination,
+		},
+		"should fail with hbased without local": {
+			cmdLine:    "./rpc activate -u wss://localhost -profile profile1 -hbased",
+			wantResult: utils.InvalidParameterCombination,
+		},
+		"should pass with stopConfiguration": {
+			cmdLine:    "./rpc activate -local -stopConfiguration",
+			wantResult: utils.Success,
+		},
+		"should fail with stopConfiguration and acm": {
+			cmdLine:    "./rpc activate -local -acm -stopConfiguration -config ../../config.yaml",
+			wantResult: utils.InvalidParameterCombination,
+		},
+		"should pass with acm and setPkiDnsSuffix": {
+			cmdLine:    "./rpc activate -local -acm -setPkiDnsSuffix -config ../../config.yaml",
+			wantResult: utils.Success,
+		},
 	}
 
 	for name, tc := range tests {
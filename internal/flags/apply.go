@@ -0,0 +1,138 @@
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	log "github.com/sirupsen/logrus"
+)
+
+var activationModes = []string{"ccm", "acm"}
+
+func (f *Flags) printApplyUsage() string {
+	executable := filepath.Base(os.Args[0])
+	usage := "\nRemote Provisioning Client (RPC) - used for activation, deactivation, maintenance and status of AMT\n\n"
+	usage = usage + "Usage: " + executable + " apply -config FILE [OPTIONS]\n\n"
+	usage = usage + "Reads the current AMT configuration and changes only what differs from the config file.\n"
+	usage = usage + "Running it again on a device that matches the config file changes nothing. AMT password is required\n"
+	usage = usage + "  Example: " + executable + " apply -config device.yaml -secrets secrets.yaml -password YourAMTPassword\n"
+	usage = usage + "\nSettings are applied in this order, a setting left out of the config file is not changed:\n"
+	usage = usage + "  activation, syncClock, hostname and domainName, wired, wifiConfigs, redirection, cira, tls\n"
+	fmt.Println(usage)
+	return usage
+}
+
+func (f *Flags) handleApplyCommand() utils.ReturnCode {
+	if len(f.commandLineArgs) == 2 {
+		f.printApplyUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	var configJson string
+	var secretsFilePath string
+	fs := f.NewConfigureFlagSet(utils.CommandApply)
+	fs.StringVar(&f.configContent, "config", "", "specify a config file or smb: file share URL")
+	fs.StringVar(&configJson, "configJson", "", "configuration as a JSON string")
+	fs.StringVar(&secretsFilePath, "secrets", "", "specify a secrets file ")
+	fs.IntVar(&f.ConfigTLSInfo.DelayInSeconds, "delay", 3, "Delay time in seconds after putting remote TLS settings")
+	rc := f.parseAndCheckArgCount(fs, 2, 1)
+	if rc != utils.Success {
+		return rc
+	}
+	rc = f.handleLocalConfig()
+	if rc != utils.Success {
+		return rc
+	}
+	if configJson != "" {
+		err := json.Unmarshal([]byte(configJson), &f.LocalConfig)
+		if err != nil {
+			log.Error(err)
+			return utils.IncorrectCommandLineParameters
+		}
+	}
+	if f.configContent == "" && configJson == "" {
+		log.Error("missing configuration, use -config or -configJson")
+		return utils.MissingOrInvalidConfiguration
+	}
+	if secretsFilePath != "" {
+		var secretConfig config.SecretConfig
+		err := cleanenv.ReadConfig(secretsFilePath, &secretConfig)
+		if err != nil {
+			log.Error("error reading secrets file: ", err)
+			return utils.FailedReadingConfiguration
+		}
+		f.mergeWifiSecrets(secretConfig)
+	}
+	rc = f.handleLocalConfigPassword()
+	if rc != utils.Success {
+		return rc
+	}
+	rc = f.verifyApplyConfiguration()
+	if rc != utils.Success {
+		return rc
+	}
+	f.Local = true
+	return utils.Success
+}
+
+// verifyApplyConfiguration checks every section of the config file that apply changes
+func (f *Flags) verifyApplyConfiguration() utils.ReturnCode {
+	cfg := &f.LocalConfig
+	if cfg.Activation != "" {
+		if !containsString(activationModes, cfg.Activation) {
+			log.Errorf("invalid activation %s, expected one of ccm, acm", cfg.Activation)
+			return utils.MissingOrInvalidConfiguration
+		}
+		if cfg.Activation == "acm" {
+			acm := &cfg.ACMSettings
+			if acm.AMTPassword == "" {
+				acm.AMTPassword = f.Password
+			} else if acm.AMTPassword != f.Password {
+				log.Error("acmactivate amtPassword does not match the AMT password")
+				return utils.MissingOrIncorrectPassword
+			}
+			if acm.ProvisioningCert == "" || acm.ProvisioningCertPwd == "" {
+				log.Error("acm activation requires the acmactivate provisioningCert and provisioningCertPwd")
+				return utils.MissingOrInvalidConfiguration
+			}
+		}
+	}
+	if cfg.TLS.Mode != "" {
+		mode, err := ParseTLSMode(cfg.TLS.Mode)
+		if err != nil {
+			log.Errorf("invalid tls mode %s, expected one of %s", cfg.TLS.Mode, TLSModesToString())
+			return utils.MissingOrInvalidConfiguration
+		}
+		f.ConfigTLSInfo.TLSMode = mode
+	}
+	if cfg.Wired != (config.WiredConfig{}) {
+		if rc := f.verifyWiredConfiguration(); rc != utils.Success {
+			return rc
+		}
+	}
+	if len(cfg.WifiConfigs) > 0 {
+		if rc := f.promptForSecrets(); rc != utils.Success {
+			return rc
+		}
+		if rc := f.verifyWifiConfigurations(); rc != utils.Success {
+			return rc
+		}
+	}
+	redirection := cfg.Redirection
+	if redirection.SOL != nil || redirection.IDER != nil || redirection.KVM != nil || redirection.UserConsent != "" {
+		if rc := f.verifyRedirectionConfiguration(); rc != utils.Success {
+			return rc
+		}
+	}
+	if cfg.CIRA.MPSAddress != "" {
+		if rc := f.verifyCIRAConfiguration(); rc != utils.Success {
+			return rc
+		}
+	}
+	return utils.Success
+}
@@ -0,0 +1,78 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleApplyCommand(t *testing.T) {
+	t.Run("accepts the config and secrets files", func(t *testing.T) {
+		defer userInput(t, "MpsP@ssw0rd")()
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd",
+			"-config", "../../config.yaml", "-secrets", "../../secrets.yaml"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, utils.CommandApply, f.Command)
+		assert.Equal(t, "ccm", f.LocalConfig.Activation)
+		assert.Equal(t, TLSModeServer, f.ConfigTLSInfo.TLSMode)
+		assert.Equal(t, "device01", f.LocalConfig.Hostname)
+		assert.Equal(t, true, f.LocalConfig.SyncClock)
+		assert.Equal(t, "secrectPSK_PASSPHRASE", f.LocalConfig.WifiConfigs[1].PskPassphrase)
+		assert.Equal(t, "MpsP@ssw0rd", f.LocalConfig.CIRA.MPSPassword)
+		assert.Equal(t, "P@ssw0rd", f.LocalConfig.Password)
+	})
+	t.Run("accepts a partial configuration", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd",
+			"-configJson", `{"Hostname":"device01","Redirection":{"KVM":true}}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "", f.LocalConfig.Activation)
+		assert.Equal(t, true, *f.LocalConfig.Redirection.KVM)
+	})
+	t.Run("uses the AMT password for acm activation", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd",
+			"-configJson", `{"Activation":"acm","ProvisioningCert":"cert","ProvisioningCertPwd":"certPwd"}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "P@ssw0rd", f.LocalConfig.ACMSettings.AMTPassword)
+	})
+	t.Run("rejects acm activation without a provisioning certificate", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd", "-configJson", `{"Activation":"acm"}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, result)
+	})
+	t.Run("rejects a mismatched acm password", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd",
+			"-configJson", `{"Activation":"acm","AMTPassword":"other","ProvisioningCert":"cert","ProvisioningCertPwd":"certPwd"}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrIncorrectPassword, result)
+	})
+	t.Run("rejects an unknown activation", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd", "-configJson", `{"Activation":"hbased"}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, result)
+	})
+	t.Run("rejects an unknown tls mode", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd", "-configJson", `{"TLS":{"Mode":"Client"}}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, result)
+	})
+	t.Run("rejects an incomplete static wired configuration", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd", "-configJson", `{"Wired":{"IPAddress":"192.168.1.10"}}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, result)
+	})
+	t.Run("rejects missing configuration", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply", "-password", "P@ssw0rd"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, result)
+	})
+	t.Run("rejects no arguments", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "apply"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
@@ -0,0 +1,133 @@
+package flags
+
+import (
+	"os"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	log "github.com/sirupsen/logrus"
+)
+
+func (f *Flags) handleBackupCommand() utils.ReturnCode {
+	fs := f.NewLocalWsmanFlagSet(utils.CommandBackup)
+	fs.StringVar(&f.BackupFile, "file", "", "archive file to write")
+	fs.StringVar(&f.BackupPassphrase, "passphrase", f.lookupEnvOrString("BACKUP_PASSPHRASE", ""), "passphrase that encrypts the archive")
+	rc := f.parseAndCheckArgCount(fs, 2, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if f.BackupFile == "" {
+		log.Error("missing -file")
+		return utils.IncorrectCommandLineParameters
+	}
+	if f.BackupPassphrase == "" {
+		var confirmation string
+		rc = f.PromptUserInput("Please enter the backup passphrase: ", &f.BackupPassphrase)
+		if rc == utils.Success {
+			rc = f.PromptUserInput("Please enter the backup passphrase again: ", &confirmation)
+		}
+		if rc != utils.Success {
+			return rc
+		}
+		if confirmation != f.BackupPassphrase {
+			log.Error("the backup passphrases do not match")
+			return utils.InvalidUserInput
+		}
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
+
+// handleRestoreCommand turns the archive into an apply configuration, the
+// secrets AMT did not return come from the secrets file or user prompts
+func (f *Flags) handleRestoreCommand() utils.ReturnCode {
+	var secretsFilePath, mpsCert string
+	fs := f.NewConfigureFlagSet(utils.CommandRestore)
+	fs.StringVar(&f.BackupFile, "file", "", "archive file written by rpc backup")
+	fs.StringVar(&f.BackupPassphrase, "passphrase", f.lookupEnvOrString("BACKUP_PASSPHRASE", ""), "passphrase that encrypts the archive")
+	fs.StringVar(&secretsFilePath, "secrets", "", "secrets file with the passphrases, passwords and private keys the archive does not hold")
+	fs.StringVar(&mpsCert, "mpsCert", "", "MPS root certificate when the archive has none, PEM or base64 encoded DER")
+	fs.IntVar(&f.ConfigTLSInfo.DelayInSeconds, "delay", 3, "Delay time in seconds after putting remote TLS settings")
+	rc := f.parseAndCheckArgCount(fs, 2, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if f.BackupFile == "" {
+		log.Error("missing -file")
+		return utils.IncorrectCommandLineParameters
+	}
+	archive, err := os.ReadFile(f.BackupFile)
+	if err != nil {
+		log.Error(err)
+		return utils.FailedReadingConfiguration
+	}
+	if f.BackupPassphrase == "" {
+		rc = f.PromptUserInput("Please enter the backup passphrase: ", &f.BackupPassphrase)
+		if rc != utils.Success {
+			return rc
+		}
+	}
+	backup, err := config.DecryptBackup(archive, f.BackupPassphrase)
+	if err != nil {
+		log.Errorf("%s: %s", f.BackupFile, err)
+		return utils.FailedReadingConfiguration
+	}
+	log.Infof("restoring the backup of %s", backup.Created.Format("2006-01-02T15:04:05Z"))
+	f.LocalConfig = backup.Config
+	f.RestoreCertificates = backup.Certificates
+	if backup.ControlMode == 2 {
+		log.Warn("the backup is of a device in admin control mode, activate this device in ACM before restoring it")
+	}
+	if secretsFilePath != "" {
+		var secretConfig config.SecretConfig
+		err := cleanenv.ReadConfig(secretsFilePath, &secretConfig)
+		if err != nil {
+			log.Error("error reading secrets file: ", err)
+			return utils.FailedReadingConfiguration
+		}
+		f.mergeWifiSecrets(secretConfig)
+		f.mergeUserSecrets(secretConfig)
+	}
+	rc = f.handleLocalConfigPassword()
+	if rc != utils.Success {
+		return rc
+	}
+	cira := &f.LocalConfig.CIRA
+	if mpsCert != "" {
+		cira.MPSCert = mpsCert
+	}
+	if cira.MPSAddress != "" && cira.MPSCert == "" {
+		log.Error("the archive does not hold the MPS root certificate, give it with -mpsCert")
+		return utils.MissingOrInvalidConfiguration
+	}
+	if cira.MPSAddress != "" && cira.MPSUsername == "" {
+		// AMT does not return the MPS user name
+		rc = f.PromptUserInput("Please enter the MPS username: ", &cira.MPSUsername)
+		if rc != utils.Success {
+			return rc
+		}
+	}
+	for i := range f.LocalConfig.Users {
+		item := &f.LocalConfig.Users[i]
+		if item.Password == "" {
+			rc = f.PromptUserInput("Please enter password for "+item.Username+": ", &item.Password)
+			if rc != utils.Success {
+				return rc
+			}
+		}
+	}
+	rc = f.verifyApplyConfiguration()
+	if rc != utils.Success {
+		return rc
+	}
+	f.Local = true
+	return utils.Success
+}
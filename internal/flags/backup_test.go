@@ -0,0 +1,108 @@
+package flags
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleBackupCommand(t *testing.T) {
+	t.Run("runs locally", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "backup", "-password", "P@ssw0rd", "-file", "device01.rpcbak", "-passphrase", "secret"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, utils.CommandBackup, f.Command)
+		assert.Equal(t, "device01.rpcbak", f.BackupFile)
+		assert.Equal(t, "secret", f.BackupPassphrase)
+	})
+	t.Run("reads the passphrase twice", func(t *testing.T) {
+		defer userInput(t, "secret\nsecret\n")()
+		f := NewFlags([]string{"rpc", "backup", "-password", "P@ssw0rd", "-file", "device01.rpcbak"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "secret", f.BackupPassphrase)
+	})
+	t.Run("rejects mismatched passphrases", func(t *testing.T) {
+		defer userInput(t, "secret\nother\n")()
+		f := NewFlags([]string{"rpc", "backup", "-password", "P@ssw0rd", "-file", "device01.rpcbak"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.InvalidUserInput, result)
+	})
+	t.Run("rejects a missing file", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "backup", "-password", "P@ssw0rd", "-passphrase", "secret"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
+
+func TestHandleRestoreCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device01.rpcbak")
+	archive, err := config.EncryptBackup(config.Backup{
+		Created:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		ControlMode: 1,
+		Config: config.Config{
+			Activation:  "ccm",
+			Hostname:    "device01",
+			WifiConfigs: config.WifiConfigs{{ProfileName: "exampleWifiWPA", SSID: "ssid", Priority: 1, AuthenticationMethod: 4, EncryptionMethod: 4}},
+			CIRA:        config.CIRAConfig{MPSAddress: "mps.example.com", MPSPort: 4433, MPSCert: "MIIBmpsroot"},
+			Users:       []config.UserConfig{{Username: "monitor", AccessPermission: "network", Realms: []string{"hardwareAsset"}}},
+		},
+		Certificates: []config.BackupCertificate{{InstanceID: "Intel(r) AMT Certificate: Handle: 0", X509Certificate: "MIIBmpsroot", TrustedRoot: true, UsedBy: "cira"}},
+	}, "secret")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, archive, 0600))
+
+	t.Run("fills in the secrets AMT did not return", func(t *testing.T) {
+		defer userInput(t, "mpsuser\nMpsP@ssw0rd\n")()
+		f := NewFlags([]string{"rpc", "restore", "-password", "P@ssw0rd", "-file", path, "-passphrase", "secret",
+			"-secrets", "../../secrets.yaml"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, utils.CommandRestore, f.Command)
+		assert.Equal(t, "device01", f.LocalConfig.Hostname)
+		assert.Equal(t, "secrectPSK_PASSPHRASE", f.LocalConfig.WifiConfigs[0].PskPassphrase)
+		assert.Equal(t, "secretUSER_PASSWORD", f.LocalConfig.Users[0].Password)
+		assert.Equal(t, "mpsuser", f.LocalConfig.CIRA.MPSUsername)
+		assert.Equal(t, "MpsP@ssw0rd", f.LocalConfig.CIRA.MPSPassword)
+		assert.Equal(t, "P@ssw0rd", f.LocalConfig.Password)
+		assert.Equal(t, 1, len(f.RestoreCertificates))
+	})
+	t.Run("requires the MPS root the archive does not hold", func(t *testing.T) {
+		noRootPath := filepath.Join(t.TempDir(), "device02.rpcbak")
+		archive, err := config.EncryptBackup(config.Backup{
+			ControlMode: 1,
+			Config: config.Config{
+				Activation: "ccm",
+				CIRA:       config.CIRAConfig{MPSAddress: "mps.example.com", MPSPort: 4433, MPSUsername: "mpsuser", MPSPassword: "MpsP@ssw0rd"},
+			},
+		}, "secret")
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(noRootPath, archive, 0600))
+
+		f := NewFlags([]string{"rpc", "restore", "-password", "P@ssw0rd", "-file", noRootPath, "-passphrase", "secret"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, result)
+
+		f = NewFlags([]string{"rpc", "restore", "-password", "P@ssw0rd", "-file", noRootPath, "-passphrase", "secret", "-mpsCert", "MIIBmpsroot"})
+		result = f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "MIIBmpsroot", f.LocalConfig.CIRA.MPSCert)
+	})
+	t.Run("rejects a wrong passphrase", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "restore", "-password", "P@ssw0rd", "-file", path, "-passphrase", "other"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.FailedReadingConfiguration, result)
+	})
+	t.Run("rejects a missing archive", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "restore", "-password", "P@ssw0rd", "-file", "missing.rpcbak", "-passphrase", "secret"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.FailedReadingConfiguration, result)
+	})
+}
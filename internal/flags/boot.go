@@ -0,0 +1,118 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	BootDevicePXE       = "pxe"
+	BootDeviceCD        = "cd"
+	BootDeviceHDD       = "hdd"
+	BootDeviceBIOSSetup = "bios-setup"
+	BootDeviceIDER      = "ider"
+)
+
+var bootDevices = []string{
+	BootDevicePXE,
+	BootDeviceCD,
+	BootDeviceHDD,
+	BootDeviceBIOSSetup,
+	BootDeviceIDER,
+}
+
+// power actions that bring the device up so the next boot settings apply
+var bootPowerActions = []string{
+	utils.SubCommandPowerOn,
+	utils.SubCommandPowerCycle,
+	utils.SubCommandPowerReset,
+}
+
+type BootFlags struct {
+	Device      string
+	BIOSPause   bool
+	PowerAction string
+}
+
+func (f *Flags) printBootUsage() string {
+	executable := filepath.Base(os.Args[0])
+	usage := "\nRemote Provisioning Client (RPC) - used for activation, deactivation, maintenance and status of AMT\n\n"
+	usage = usage + "Usage: " + executable + " boot COMMAND [OPTIONS]\n\n"
+	usage = usage + "Supported Boot Commands:\n"
+	usage = usage + "  list   Lists the boot sources AMT can force. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " boot list -password YourAMTPassword\n"
+	usage = usage + "  status Displays the boot capabilities and the current boot settings. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " boot status -password YourAMTPassword\n"
+	usage = usage + "  set    Sets the device to use for the next boot only. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " boot set -device pxe -power reset -password YourAMTPassword\n"
+	usage = usage + "\nRun '" + executable + " boot COMMAND -h' for more information on a command.\n"
+	fmt.Println(usage)
+	return usage
+}
+
+func (f *Flags) handleBootCommand() utils.ReturnCode {
+	if len(f.commandLineArgs) == 2 {
+		f.printBootUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	f.SubCommand = f.commandLineArgs[2]
+	fs := f.NewLocalWsmanFlagSet(f.SubCommand)
+	switch f.SubCommand {
+	case utils.SubCommandBootList, utils.SubCommandBootStatus:
+	case utils.SubCommandBootSet:
+		f.addDryRunFlag(fs)
+		fs.StringVar(&f.Boot.Device, "device", "", "boot device ("+strings.Join(bootDevices, ", ")+")")
+		fs.BoolVar(&f.Boot.BIOSPause, "biosPause", false, "pause in the BIOS during the boot")
+		fs.StringVar(&f.Boot.PowerAction, "power", "", "power action to run after the settings are applied ("+strings.Join(bootPowerActions, ", ")+")")
+	default:
+		f.printBootUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	rc := f.parseAndCheckArgCount(fs, 3, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if f.SubCommand == utils.SubCommandBootSet {
+		if rc = f.verifyBootFlags(); rc != utils.Success {
+			return rc
+		}
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
+
+func (f *Flags) verifyBootFlags() utils.ReturnCode {
+	if f.Boot.Device == "" && !f.Boot.BIOSPause {
+		log.Error("-device or -biosPause is required")
+		return utils.IncorrectCommandLineParameters
+	}
+	if f.Boot.Device != "" && !containsString(bootDevices, f.Boot.Device) {
+		log.Errorf("invalid boot device %s, expected one of %s", f.Boot.Device, strings.Join(bootDevices, ", "))
+		return utils.IncorrectCommandLineParameters
+	}
+	if f.Boot.PowerAction != "" && !containsString(bootPowerActions, f.Boot.PowerAction) {
+		log.Errorf("invalid power action %s, expected one of %s", f.Boot.PowerAction, strings.Join(bootPowerActions, ", "))
+		return utils.IncorrectCommandLineParameters
+	}
+	return utils.Success
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
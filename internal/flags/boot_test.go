@@ -0,0 +1,59 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleBootCommand(t *testing.T) {
+	for _, subCommand := range []string{utils.SubCommandBootList, utils.SubCommandBootStatus} {
+		t.Run("accepts "+subCommand, func(t *testing.T) {
+			f := NewFlags([]string{"rpc", "boot", subCommand, "-password", "P@ssw0rd", "-json"})
+			result := f.ParseFlags()
+			assert.Equal(t, utils.Success, result)
+			assert.Equal(t, true, f.Local)
+			assert.Equal(t, utils.CommandBoot, f.Command)
+			assert.Equal(t, subCommand, f.SubCommand)
+			assert.Equal(t, true, f.JsonOutput)
+		})
+	}
+	for _, device := range bootDevices {
+		t.Run("accepts device "+device, func(t *testing.T) {
+			f := NewFlags([]string{"rpc", "boot", "set", "-password", "P@ssw0rd", "-device", device})
+			result := f.ParseFlags()
+			assert.Equal(t, utils.Success, result)
+			assert.Equal(t, BootFlags{Device: device}, f.Boot)
+		})
+	}
+	t.Run("accepts bios pause with a power action", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "boot", "set", "-password", "P@ssw0rd", "-biosPause", "-power", "cycle"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, BootFlags{BIOSPause: true, PowerAction: utils.SubCommandPowerCycle}, f.Boot)
+	})
+	t.Run("prompts for password", func(t *testing.T) {
+		defer userInput(t, "P@ssw0rd")()
+		f := NewFlags([]string{"rpc", "boot", "list"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "P@ssw0rd", f.Password)
+	})
+	tests := map[string][]string{
+		"missing command":      {"rpc", "boot"},
+		"unknown command":      {"rpc", "boot", "explode", "-password", "P@ssw0rd"},
+		"set flag with list":   {"rpc", "boot", "list", "-password", "P@ssw0rd", "-device", "pxe"},
+		"missing device":       {"rpc", "boot", "set", "-password", "P@ssw0rd"},
+		"unknown device":       {"rpc", "boot", "set", "-password", "P@ssw0rd", "-device", "floppy"},
+		"unsupported power":    {"rpc", "boot", "set", "-password", "P@ssw0rd", "-device", "pxe", "-power", "off"},
+		"additional arguments": {"rpc", "boot", "set", "-password", "P@ssw0rd", "-device", "pxe", "extra"},
+	}
+	for name, args := range tests {
+		t.Run("rejects "+name, func(t *testing.T) {
+			f := NewFlags(args)
+			result := f.ParseFlags()
+			assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package flags
 
 import (
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"github.com/jc-lab/intel-amt-host-api/internal/config"
 	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
 
@@ -66,6 +72,12 @@ func ParseTLSMode(s string) (TLSMode, error) {
 type ConfigTLSInfo struct {
 	TLSMode        TLSMode
 	DelayInSeconds int
+	// CSR has AMT sign a certificate signing request instead of configuring TLS
+	CSR        bool
+	CSRFile    string
+	CommonName string
+	// CertChain is the CA issued chain of a CSR, base64 encoded DER
+	CertChain []string
 }
 
 func (f *Flags) printConfigurationUsage() string {
@@ -79,6 +91,14 @@ func (f *Flags) printConfigurationUsage() string {
 	usage += "                  Example: " + baseCommand + " " + utils.SubCommandEnableWifiPort + " -password YourAMTPassword\n"
 	usage += "  " + utils.SubCommandConfigureTLS + "             Configures TLS in AMT. AMT password is required.\n"
 	usage += "                  Example: " + baseCommand + " " + utils.SubCommandConfigureTLS + " -mode Server -password YourAMTPassword\n"
+	usage += "                  With a CA: " + baseCommand + " " + utils.SubCommandConfigureTLS + " -csr -csrFile amt.csr -password YourAMTPassword\n"
+	usage += "                             " + baseCommand + " " + utils.SubCommandConfigureTLS + " -cert amt-chain.pem -mode Server -password YourAMTPassword\n"
+	usage += "  " + utils.SubCommandConfigureCIRA + "            Configures CIRA to connect to an MPS. AMT password is required. A config.yml or command line flags must be provided for all settings. This command runs without cloud interaction.\n"
+	usage += "                  Example: " + baseCommand + " " + utils.SubCommandConfigureCIRA + " -password YourAMTPassword -config ciraconfig.yaml\n"
+	usage += "  " + utils.SubCommandConfigureWired + "           Configures the wired network interface of AMT with DHCP or a static IP address and an optional 802.1x profile. AMT password is required.\n"
+	usage += "                  Example: " + baseCommand + " " + utils.SubCommandConfigureWired + " -dhcp -password YourAMTPassword\n"
+	usage += "  " + utils.SubCommandRedirection + "     Enables or disables SOL, IDER and KVM and sets the user consent policy. AMT password is required. Changing user consent requires admin control mode.\n"
+	usage += "                  Example: " + baseCommand + " " + utils.SubCommandRedirection + " -kvm -sol=false -ider=false -userConsent none -password YourAMTPassword\n"
 	usage += "\nRun '" + baseCommand + " COMMAND -h' for more information on a command.\n"
 	fmt.Println(usage)
 	return usage
@@ -100,6 +120,12 @@ func (f *Flags) handleConfigureCommand() utils.ReturnCode {
 		rc = f.handleEnableWifiPort()
 	case utils.SubCommandConfigureTLS:
 		rc = f.handleConfigureTLS()
+	case utils.SubCommandConfigureCIRA:
+		rc = f.handleConfigureCIRA()
+	case utils.SubCommandConfigureWired:
+		rc = f.handleConfigureWired()
+	case utils.SubCommandRedirection:
+		rc = f.handleConfigureRedirection()
 	default:
 		f.printConfigurationUsage()
 		rc = utils.IncorrectCommandLineParameters
@@ -109,11 +135,16 @@ func (f *Flags) handleConfigureCommand() utils.ReturnCode {
 	}
 
 	f.Local = true
+	return f.handleLocalConfigPassword()
+}
+
+// handleLocalConfigPassword reconciles the -password flag with the config file password
+func (f *Flags) handleLocalConfigPassword() utils.ReturnCode {
 	if f.Password == "" {
 		if f.LocalConfig.Password != "" {
 			f.Password = f.LocalConfig.Password
 		} else {
-			if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			if _, rc := f.ReadPasswordFromUser(); rc != utils.Success {
 				return utils.MissingOrIncorrectPassword
 			}
 			f.LocalConfig.Password = f.Password
@@ -136,6 +167,8 @@ func (f *Flags) NewConfigureFlagSet(subCommand string) *flag.FlagSet {
 	fs.StringVar(&f.LogLevel, "l", "info", "Log level (panic,fatal,error,warn,info,debug,trace)")
 	fs.BoolVar(&f.JsonOutput, "json", false, "JSON output")
 	fs.StringVar(&f.Password, "password", f.lookupEnvOrString("AMT_PASSWORD", ""), "AMT password")
+	f.addDryRunFlag(fs)
+	fs.StringVar(&f.JournalFile, "journal", "", "file that records the changes to AMT until the command finishes, for rpc recover")
 	return fs
 }
 
@@ -148,7 +181,310 @@ func (f *Flags) handleConfigureTLS() utils.ReturnCode {
 		return e
 	})
 	fs.IntVar(&f.ConfigTLSInfo.DelayInSeconds, "delay", 3, "Delay time in seconds after putting remote TLS settings")
-	return f.parseAndCheckArgCount(fs, 3, 0)
+	fs.BoolVar(&f.ConfigTLSInfo.CSR, "csr", false, "generate a key pair in AMT and write a certificate signing request for your CA instead of a self-signed certificate")
+	fs.StringVar(&f.ConfigTLSInfo.CSRFile, "csrFile", "", "file the certificate signing request is written to (default stdout)")
+	fs.StringVar(&f.ConfigTLSInfo.CommonName, "commonName", "", "common name of the certificate signing request (default the AMT host and domain name)")
+	certFile := fs.String("cert", "", "PEM file with the certificate your CA issued for the -csr request and its CA certificates")
+	rc := f.parseAndCheckArgCount(fs, 3, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	tlsInfo := &f.ConfigTLSInfo
+	if tlsInfo.CSR && *certFile != "" {
+		log.Error("-csr and -cert are separate steps, run -csr first and -cert with the issued certificate")
+		return utils.IncorrectCommandLineParameters
+	}
+	if !tlsInfo.CSR && (tlsInfo.CSRFile != "" || tlsInfo.CommonName != "") {
+		log.Error("-csrFile and -commonName require -csr")
+		return utils.IncorrectCommandLineParameters
+	}
+	if *certFile != "" {
+		return f.readTLSCertChain(*certFile)
+	}
+	return utils.Success
+}
+
+// readTLSCertChain reads the certificates of a PEM file, AMT takes them as base64 encoded DER
+func (f *Flags) readTLSCertChain(path string) utils.ReturnCode {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Error(err)
+		return utils.FailedReadingConfiguration
+	}
+	for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			log.Errorf("%s: %s", path, err)
+			return utils.MissingOrInvalidConfiguration
+		}
+		f.ConfigTLSInfo.CertChain = append(f.ConfigTLSInfo.CertChain, base64.StdEncoding.EncodeToString(block.Bytes))
+	}
+	if len(f.ConfigTLSInfo.CertChain) == 0 {
+		log.Errorf("%s has no PEM encoded certificate", path)
+		return utils.MissingOrInvalidConfiguration
+	}
+	return utils.Success
+}
+
+func (f *Flags) handleConfigureCIRA() utils.ReturnCode {
+	var configJson string
+	cira := &f.LocalConfig.CIRA
+	fs := f.NewConfigureFlagSet(utils.SubCommandConfigureCIRA)
+	fs.StringVar(&f.configContent, "config", "", "specify a config file or smb: file share URL")
+	fs.StringVar(&configJson, "configJson", "", "configuration as a JSON string")
+	fs.StringVar(&cira.MPSAddress, "mpsAddress", "", "MPS FQDN or IP address")
+	fs.IntVar(&cira.MPSPort, "mpsPort", 0, "MPS port (default 4433)")
+	fs.StringVar(&cira.MPSCert, "mpsCert", "", "MPS root certificate, PEM or base64 encoded DER")
+	fs.StringVar(&cira.MPSUsername, "mpsUsername", "", "MPS username")
+	fs.StringVar(&cira.MPSPassword, "mpsPassword", f.lookupEnvOrString("MPS_PASSWORD", ""), "MPS password")
+	fs.StringVar(&cira.CommonName, "commonName", "", "common name of the MPS server certificate (default mpsAddress)")
+	fs.Func("environmentDetection", "intranet domain suffix, can be repeated", func(flagValue string) error {
+		cira.EnvironmentDetection = append(cira.EnvironmentDetection, flagValue)
+		return nil
+	})
+	rc := f.parseAndCheckArgCount(fs, 3, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	rc = f.handleLocalConfig()
+	if rc != utils.Success {
+		return rc
+	}
+	if configJson != "" {
+		err := json.Unmarshal([]byte(configJson), &f.LocalConfig)
+		if err != nil {
+			log.Error(err)
+			return utils.IncorrectCommandLineParameters
+		}
+	}
+	return f.verifyCIRAConfiguration()
+}
+
+func (f *Flags) verifyCIRAConfiguration() utils.ReturnCode {
+	cira := &f.LocalConfig.CIRA
+	if cira.MPSAddress == "" {
+		log.Error("missing mpsAddress")
+		return utils.MissingOrInvalidConfiguration
+	}
+	if cira.MPSCert == "" {
+		log.Error("missing mpsCert")
+		return utils.MissingOrInvalidConfiguration
+	}
+	if cira.MPSUsername == "" {
+		log.Error("missing mpsUsername")
+		return utils.MissingOrInvalidConfiguration
+	}
+	if cira.MPSPassword == "" {
+		rc := f.PromptUserInput("Please enter the MPS password: ", &cira.MPSPassword)
+		if rc != utils.Success {
+			return rc
+		}
+	}
+	if cira.MPSPort == 0 {
+		cira.MPSPort = 4433
+	}
+	if cira.MPSPort < 0 || cira.MPSPort > 65535 {
+		log.Error("invalid mpsPort: ", cira.MPSPort)
+		return utils.MissingOrInvalidConfiguration
+	}
+	if cira.CommonName == "" {
+		cira.CommonName = cira.MPSAddress
+	}
+	return utils.Success
+}
+
+func (f *Flags) handleConfigureWired() utils.ReturnCode {
+	var configJson string
+	var dhcp, static bool
+	wiredCfg := config.WiredConfig{}
+	fs := f.NewConfigureFlagSet(utils.SubCommandConfigureWired)
+	fs.StringVar(&f.configContent, "config", "", "specify a config file or smb: file share URL")
+	fs.StringVar(&configJson, "configJson", "", "configuration as a JSON string")
+	fs.BoolVar(&dhcp, "dhcp", false, "get the IP address from DHCP")
+	fs.BoolVar(&static, "static", false, "use a static IP address")
+	fs.BoolVar(&wiredCfg.IPSync, "ipsync", false, "sync the static IP address with the OS")
+	fs.StringVar(&wiredCfg.IPAddress, "ipAddress", "", "static IP address")
+	fs.StringVar(&wiredCfg.SubnetMask, "subnetMask", "", "static subnet mask")
+	fs.StringVar(&wiredCfg.Gateway, "gateway", "", "static default gateway")
+	fs.StringVar(&wiredCfg.PrimaryDNS, "primaryDNS", "", "static primary DNS server")
+	fs.StringVar(&wiredCfg.SecondaryDNS, "secondaryDNS", "", "static secondary DNS server")
+	fs.StringVar(&wiredCfg.Ieee8021xProfileName, "ieee8021xProfileName", "", "name of an ieee8021xConfigs profile in the config file")
+	rc := f.parseAndCheckArgCount(fs, 3, 1)
+	if rc != utils.Success {
+		return rc
+	}
+	if dhcp && static {
+		log.Error("-dhcp and -static cannot be used together")
+		return utils.InvalidParameterCombination
+	}
+	rc = f.handleLocalConfig()
+	if rc != utils.Success {
+		return rc
+	}
+	if configJson != "" {
+		err := json.Unmarshal([]byte(configJson), &f.LocalConfig)
+		if err != nil {
+			log.Error(err)
+			return utils.IncorrectCommandLineParameters
+		}
+	}
+	if !dhcp && !static && f.configContent == "" && configJson == "" {
+		log.Error("either -dhcp or -static is required")
+		return utils.MissingOrInvalidConfiguration
+	}
+
+	// command line flags override the configuration
+	wired := &f.LocalConfig.Wired
+	if dhcp || static {
+		wired.DHCP = dhcp
+	}
+	wired.IPSync = wired.IPSync || wiredCfg.IPSync
+	for _, field := range []struct{ value, flag *string }{
+		{&wired.IPAddress, &wiredCfg.IPAddress},
+		{&wired.SubnetMask, &wiredCfg.SubnetMask},
+		{&wired.Gateway, &wiredCfg.Gateway},
+		{&wired.PrimaryDNS, &wiredCfg.PrimaryDNS},
+		{&wired.SecondaryDNS, &wiredCfg.SecondaryDNS},
+		{&wired.Ieee8021xProfileName, &wiredCfg.Ieee8021xProfileName},
+	} {
+		if *field.flag != "" {
+			*field.value = *field.flag
+		}
+	}
+	return f.verifyWiredConfiguration()
+}
+
+func (f *Flags) verifyWiredConfiguration() utils.ReturnCode {
+	wired := &f.LocalConfig.Wired
+	hasStaticSettings := wired.IPAddress != "" || wired.SubnetMask != "" || wired.Gateway != "" ||
+		wired.PrimaryDNS != "" || wired.SecondaryDNS != ""
+	if wired.DHCP {
+		// AMT follows the OS when the address comes from DHCP
+		wired.IPSync = true
+		if hasStaticSettings {
+			log.Error("static IP settings cannot be used with dhcp")
+			return utils.InvalidParameterCombination
+		}
+	} else if wired.IPSync {
+		if hasStaticSettings {
+			log.Error("static IP settings cannot be used with ipsync, AMT takes them from the OS")
+			return utils.InvalidParameterCombination
+		}
+	} else {
+		for _, setting := range []struct {
+			name, value string
+			required    bool
+		}{
+			{"ipAddress", wired.IPAddress, true},
+			{"subnetMask", wired.SubnetMask, true},
+			{"gateway", wired.Gateway, true},
+			{"primaryDNS", wired.PrimaryDNS, true},
+			{"secondaryDNS", wired.SecondaryDNS, false},
+		} {
+			if setting.value == "" {
+				if setting.required {
+					log.Errorf("missing %s for a static IP address", setting.name)
+					return utils.MissingOrInvalidConfiguration
+				}
+				continue
+			}
+			if net.ParseIP(setting.value).To4() == nil {
+				log.Errorf("invalid %s: %s", setting.name, setting.value)
+				return utils.MissingOrInvalidConfiguration
+			}
+		}
+	}
+	if wired.Ieee8021xProfileName != "" {
+		rc := f.promptForSecrets()
+		if rc != utils.Success {
+			return rc
+		}
+		return f.verifyMatchingIeee8021xConfig(wired.Ieee8021xProfileName)
+	}
+	return utils.Success
+}
+
+// optionalBool is a boolean flag that stays nil unless it is on the command line
+type optionalBool struct {
+	value **bool
+}
+
+func (b optionalBool) String() string {
+	if b.value == nil || *b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(**b.value)
+}
+
+func (b optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*b.value = &v
+	return nil
+}
+
+func (b optionalBool) IsBoolFlag() bool { return true }
+
+var userConsentValues = []string{"none", "kvm", "all"}
+
+func (f *Flags) handleConfigureRedirection() utils.ReturnCode {
+	var configJson string
+	redirectionCfg := config.RedirectionConfig{}
+	fs := f.NewConfigureFlagSet(utils.SubCommandRedirection)
+	fs.StringVar(&f.configContent, "config", "", "specify a config file or smb: file share URL")
+	fs.StringVar(&configJson, "configJson", "", "configuration as a JSON string")
+	fs.Var(optionalBool{&redirectionCfg.SOL}, "sol", "enable Serial-over-LAN, -sol=false disables it")
+	fs.Var(optionalBool{&redirectionCfg.IDER}, "ider", "enable IDE redirection, -ider=false disables it")
+	fs.Var(optionalBool{&redirectionCfg.KVM}, "kvm", "enable KVM, -kvm=false disables it")
+	fs.StringVar(&redirectionCfg.UserConsent, "userConsent", "", "user consent policy ("+strings.Join(userConsentValues, ", ")+")")
+	rc := f.parseAndCheckArgCount(fs, 3, 1)
+	if rc != utils.Success {
+		return rc
+	}
+	rc = f.handleLocalConfig()
+	if rc != utils.Success {
+		return rc
+	}
+	if configJson != "" {
+		err := json.Unmarshal([]byte(configJson), &f.LocalConfig)
+		if err != nil {
+			log.Error(err)
+			return utils.IncorrectCommandLineParameters
+		}
+	}
+
+	// command line flags override the configuration
+	redirection := &f.LocalConfig.Redirection
+	for _, field := range []struct{ value, flag **bool }{
+		{&redirection.SOL, &redirectionCfg.SOL},
+		{&redirection.IDER, &redirectionCfg.IDER},
+		{&redirection.KVM, &redirectionCfg.KVM},
+	} {
+		if *field.flag != nil {
+			*field.value = *field.flag
+		}
+	}
+	if redirectionCfg.UserConsent != "" {
+		redirection.UserConsent = redirectionCfg.UserConsent
+	}
+	return f.verifyRedirectionConfiguration()
+}
+
+func (f *Flags) verifyRedirectionConfiguration() utils.ReturnCode {
+	redirection := f.LocalConfig.Redirection
+	if redirection.SOL == nil && redirection.IDER == nil && redirection.KVM == nil && redirection.UserConsent == "" {
+		log.Error("at least one of -sol, -ider, -kvm or -userConsent is required")
+		return utils.MissingOrInvalidConfiguration
+	}
+	if redirection.UserConsent != "" && !containsString(userConsentValues, redirection.UserConsent) {
+		log.Errorf("invalid userConsent %s, expected one of %s", redirection.UserConsent, strings.Join(userConsentValues, ", "))
+		return utils.IncorrectCommandLineParameters
+	}
+	return utils.Success
 }
 
 func (f *Flags) handleEnableWifiPort() utils.ReturnCode {
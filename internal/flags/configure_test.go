@@ -3,6 +3,8 @@ package flags
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"github.com/jc-lab/intel-amt-host-api/internal/certs"
 	"github.com/jc-lab/intel-amt-host-api/internal/config"
 	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
 	"strings"
@@ -241,6 +243,76 @@ func TestConfigureTLS(t *testing.T) {
 		rc := f.ParseFlags()
 		assert.Equal(t, utils.IncorrectCommandLineParameters, rc)
 	})
+	t.Run("expect Success for a certificate signing request", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureTLS,
+			`-csr`, `-csrFile`, `amt.csr`, `-commonName`, `amt.example.com`,
+			`-password`, `cliP@ss0rd!`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, true, f.ConfigTLSInfo.CSR)
+		assert.Equal(t, "amt.csr", f.ConfigTLSInfo.CSRFile)
+		assert.Equal(t, "amt.example.com", f.ConfigTLSInfo.CommonName)
+	})
+	t.Run("expect IncorrectCommandLineParameters for -csr with -cert", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureTLS,
+			`-csr`, `-cert`, `amt-chain.pem`,
+			`-password`, `cliP@ss0rd!`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, rc)
+	})
+	t.Run("expect IncorrectCommandLineParameters for -commonName without -csr", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureTLS,
+			`-commonName`, `amt.example.com`,
+			`-password`, `cliP@ss0rd!`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, rc)
+	})
+	t.Run("expect the chain of -cert", func(t *testing.T) {
+		root, err := certs.NewRootComposite()
+		assert.Nil(t, err)
+		path := filepath.Join(t.TempDir(), "amt-chain.pem")
+		assert.Nil(t, os.WriteFile(path, []byte(root.Pem+root.Pem), 0600))
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureTLS,
+			`-cert`, path,
+			`-password`, `cliP@ss0rd!`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, []string{root.StripPem(), root.StripPem()}, f.ConfigTLSInfo.CertChain)
+	})
+	t.Run("expect FailedReadingConfiguration for a missing -cert file", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureTLS,
+			`-cert`, filepath.Join(t.TempDir(), "missing.pem"),
+			`-password`, `cliP@ss0rd!`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.FailedReadingConfiguration, rc)
+	})
+	t.Run("expect MissingOrInvalidConfiguration for a -cert file without certificates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "amt-chain.pem")
+		assert.Nil(t, os.WriteFile(path, []byte("not a certificate\n"), 0600))
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureTLS,
+			`-cert`, path,
+			`-password`, `cliP@ss0rd!`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, rc)
+	})
 	t.Run("expect error from unknown string", func(t *testing.T) {
 		mode, e := ParseTLSMode("unkown")
 		assert.NotNil(t, e)
@@ -252,6 +324,295 @@ func TestConfigureTLS(t *testing.T) {
 	})
 }
 
+func TestConfigureCIRA(t *testing.T) {
+	t.Run("expect Success from config file", func(t *testing.T) {
+		defer userInput(t, "mpsPassw0rd!")()
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureCIRA,
+			`-password`, `cliP@ss0rd!`,
+			`-config`, `../../config.yaml`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, utils.SubCommandConfigureCIRA, f.SubCommand)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, config.CIRAConfig{
+			MPSAddress:           "mps.example.com",
+			MPSPort:              4433,
+			MPSCert:              "testMpsCertString",
+			MPSUsername:          "exampleMpsUser",
+			MPSPassword:          "mpsPassw0rd!",
+			CommonName:           "mps.example.com",
+			EnvironmentDetection: []string{"intranet.example.com"},
+		}, f.LocalConfig.CIRA)
+	})
+	t.Run("expect Success from command line", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureCIRA,
+			`-password`, `cliP@ss0rd!`,
+			`-mpsAddress`, `192.168.1.10`,
+			`-mpsCert`, `testMpsCertString`,
+			`-mpsUsername`, `user`,
+			`-mpsPassword`, `mpsPassw0rd!`,
+			`-environmentDetection`, `one.example.com`,
+			`-environmentDetection`, `two.example.com`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, 4433, f.LocalConfig.CIRA.MPSPort)
+		assert.Equal(t, "192.168.1.10", f.LocalConfig.CIRA.CommonName)
+		assert.Equal(t, []string{"one.example.com", "two.example.com"}, f.LocalConfig.CIRA.EnvironmentDetection)
+	})
+	t.Run("expect Success from configJson", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureCIRA,
+			`-password`, `cliP@ss0rd!`,
+			`-configJson`, `{"CIRA":{"MPSAddress":"mps.example.com","MPSPort":8443,"MPSCert":"cert","MPSUsername":"user","MPSPassword":"pass","CommonName":"mps"}}`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, 8443, f.LocalConfig.CIRA.MPSPort)
+		assert.Equal(t, "mps", f.LocalConfig.CIRA.CommonName)
+	})
+	tests := map[string][]string{
+		"mpsAddress":  {`-mpsCert`, `cert`, `-mpsUsername`, `user`, `-mpsPassword`, `pass`},
+		"mpsCert":     {`-mpsAddress`, `mps.example.com`, `-mpsUsername`, `user`, `-mpsPassword`, `pass`},
+		"mpsUsername": {`-mpsAddress`, `mps.example.com`, `-mpsCert`, `cert`, `-mpsPassword`, `pass`},
+		"mpsPort":     {`-mpsAddress`, `mps.example.com`, `-mpsCert`, `cert`, `-mpsUsername`, `user`, `-mpsPassword`, `pass`, `-mpsPort`, `70000`},
+	}
+	for name, args := range tests {
+		t.Run(fmt.Sprintf("expect MissingOrInvalidConfiguration for %s", name), func(t *testing.T) {
+			cmdLine := append([]string{`rpc`, `configure`, utils.SubCommandConfigureCIRA, `-password`, `cliP@ss0rd!`}, args...)
+			f := NewFlags(cmdLine)
+			rc := f.ParseFlags()
+			assert.Equal(t, utils.MissingOrInvalidConfiguration, rc)
+		})
+	}
+	t.Run("expect error from additional arguments", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureCIRA,
+			`-password`, `cliP@ss0rd!`,
+			`extra`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, rc)
+	})
+}
+
+func TestConfigureWired(t *testing.T) {
+	t.Run("expect Success from config file", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureWired,
+			`-password`, `cliP@ss0rd!`,
+			`-config`, `../../config.yaml`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, utils.SubCommandConfigureWired, f.SubCommand)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, config.WiredConfig{DHCP: true, IPSync: true}, f.LocalConfig.Wired)
+	})
+	t.Run("expect Success for dhcp", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureWired,
+			`-password`, `cliP@ss0rd!`,
+			`-dhcp`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, config.WiredConfig{DHCP: true, IPSync: true}, f.LocalConfig.Wired)
+	})
+	t.Run("expect Success for static", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureWired,
+			`-password`, `cliP@ss0rd!`,
+			`-static`,
+			`-ipAddress`, `192.168.1.10`,
+			`-subnetMask`, `255.255.255.0`,
+			`-gateway`, `192.168.1.1`,
+			`-primaryDNS`, `192.168.1.2`,
+			`-secondaryDNS`, `192.168.1.3`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, config.WiredConfig{
+			IPAddress:    "192.168.1.10",
+			SubnetMask:   "255.255.255.0",
+			Gateway:      "192.168.1.1",
+			PrimaryDNS:   "192.168.1.2",
+			SecondaryDNS: "192.168.1.3",
+		}, f.LocalConfig.Wired)
+	})
+	t.Run("expect Success for static with ipsync", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureWired,
+			`-password`, `cliP@ss0rd!`,
+			`-static`, `-ipsync`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, config.WiredConfig{IPSync: true}, f.LocalConfig.Wired)
+	})
+	t.Run("expect static flag to override dhcp from config file", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureWired,
+			`-password`, `cliP@ss0rd!`,
+			`-configJson`, `{"Wired":{"DHCP":true,"IPSync":true}}`,
+			`-static`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, config.WiredConfig{IPSync: true}, f.LocalConfig.Wired)
+	})
+	t.Run("expect Success with ieee8021x profile", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureWired,
+			`-password`, `cliP@ss0rd!`,
+			`-configJson`, `{"Ieee8021xConfigs":[{"ProfileName":"wired8021x","Username":"user","AuthenticationProtocol":0,"ClientCert":"cert","CACert":"ca","PrivateKey":"key"}]}`,
+			`-dhcp`,
+			`-ieee8021xProfileName`, `wired8021x`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "wired8021x", f.LocalConfig.Wired.Ieee8021xProfileName)
+	})
+	t.Run("expect MissingOrInvalidConfiguration for missing ieee8021x profile", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandConfigureWired,
+			`-password`, `cliP@ss0rd!`,
+			`-dhcp`,
+			`-ieee8021xProfileName`, `missing`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, rc)
+	})
+	tests := map[string]struct {
+		args     []string
+		expected utils.ReturnCode
+	}{
+		"dhcp with static": {
+			args:     []string{`-dhcp`, `-static`},
+			expected: utils.InvalidParameterCombination,
+		},
+		"dhcp with static settings": {
+			args:     []string{`-dhcp`, `-ipAddress`, `192.168.1.10`},
+			expected: utils.InvalidParameterCombination,
+		},
+		"ipsync with static settings": {
+			args:     []string{`-static`, `-ipsync`, `-ipAddress`, `192.168.1.10`},
+			expected: utils.InvalidParameterCombination,
+		},
+		"missing mode": {
+			args:     []string{},
+			expected: utils.MissingOrInvalidConfiguration,
+		},
+		"missing static settings": {
+			args:     []string{`-static`, `-ipAddress`, `192.168.1.10`, `-subnetMask`, `255.255.255.0`},
+			expected: utils.MissingOrInvalidConfiguration,
+		},
+		"invalid ipAddress": {
+			args:     []string{`-static`, `-ipAddress`, `192.168.1`, `-subnetMask`, `255.255.255.0`, `-gateway`, `192.168.1.1`, `-primaryDNS`, `192.168.1.2`},
+			expected: utils.MissingOrInvalidConfiguration,
+		},
+		"invalid secondaryDNS": {
+			args:     []string{`-static`, `-ipAddress`, `192.168.1.10`, `-subnetMask`, `255.255.255.0`, `-gateway`, `192.168.1.1`, `-primaryDNS`, `192.168.1.2`, `-secondaryDNS`, `dns.example.com`},
+			expected: utils.MissingOrInvalidConfiguration,
+		},
+		"additional arguments": {
+			args:     []string{`-dhcp`, `extra`},
+			expected: utils.IncorrectCommandLineParameters,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(fmt.Sprintf("expect error for %s", name), func(t *testing.T) {
+			cmdLine := append([]string{`rpc`, `configure`, utils.SubCommandConfigureWired, `-password`, `cliP@ss0rd!`}, tc.args...)
+			f := NewFlags(cmdLine)
+			rc := f.ParseFlags()
+			assert.Equal(t, tc.expected, rc)
+		})
+	}
+}
+
+func TestConfigureRedirection(t *testing.T) {
+	enabled, disabled := true, false
+	t.Run("expect Success from config file", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandRedirection,
+			`-password`, `cliP@ss0rd!`,
+			`-config`, `../../config.yaml`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, utils.SubCommandRedirection, f.SubCommand)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, config.RedirectionConfig{SOL: &enabled, IDER: &enabled, KVM: &enabled, UserConsent: "kvm"}, f.LocalConfig.Redirection)
+	})
+	t.Run("expect only the flags given to be set", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandRedirection,
+			`-password`, `cliP@ss0rd!`,
+			`-kvm`, `-sol=false`, `-userConsent`, `none`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, config.RedirectionConfig{SOL: &disabled, KVM: &enabled, UserConsent: "none"}, f.LocalConfig.Redirection)
+	})
+	t.Run("expect flags to override the config", func(t *testing.T) {
+		cmdLine := []string{
+			`rpc`, `configure`, utils.SubCommandRedirection,
+			`-password`, `cliP@ss0rd!`,
+			`-configJson`, `{"Redirection":{"KVM":true,"UserConsent":"all"}}`,
+			`-kvm=false`,
+		}
+		f := NewFlags(cmdLine)
+		rc := f.ParseFlags()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, config.RedirectionConfig{KVM: &disabled, UserConsent: "all"}, f.LocalConfig.Redirection)
+	})
+	tests := map[string]struct {
+		args     []string
+		expected utils.ReturnCode
+	}{
+		"missing settings": {
+			args:     []string{},
+			expected: utils.MissingOrInvalidConfiguration,
+		},
+		"invalid userConsent": {
+			args:     []string{`-userConsent`, `sometimes`},
+			expected: utils.IncorrectCommandLineParameters,
+		},
+		"invalid kvm value": {
+			args:     []string{`-kvm=maybe`},
+			expected: utils.IncorrectCommandLineParameters,
+		},
+		"additional arguments": {
+			args:     []string{`-kvm`, `extra`},
+			expected: utils.IncorrectCommandLineParameters,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(fmt.Sprintf("expect error for %s", name), func(t *testing.T) {
+			cmdLine := append([]string{`rpc`, `configure`, utils.SubCommandRedirection, `-password`, `cliP@ss0rd!`}, tc.args...)
+			f := NewFlags(cmdLine)
+			rc := f.ParseFlags()
+			assert.Equal(t, tc.expected, rc)
+		})
+	}
+}
+
 func TestConfigJson(t *testing.T) {
 	cmdLine := `rpc configure addwifisettings -secrets ../../secrets.yaml -password test -configJson {"Password":"","FilePath":"../../config.yaml","WifiConfigs":[{"ProfileName":"wifiWPA2","SSID":"ssid","Priority":1,"AuthenticationMethod":6,"EncryptionMethod":4,"PskPassphrase":"","Ieee8021xProfileName":""},{"ProfileName":"wifi8021x","SSID":"ssid","Priority":2,"AuthenticationMethod":7,"EncryptionMethod":4,"PskPassphrase":"","Ieee8021xProfileName":"ieee8021xEAP-TLS"}],"Ieee8021xConfigs":[{"ProfileName":"ieee8021xEAP-TLS","Username":"test","Password":"","AuthenticationProtocol":0,"ClientCert":"test","CACert":"test","PrivateKey":""},{"ProfileName":"ieee8021xPEAPv0","Username":"test","Password":"","AuthenticationProtocol":2,"ClientCert":"testClientCert","CACert":"testCaCert","PrivateKey":"testPrivateKey"}],"AMTPassword":"","ProvisioningCert":"","ProvisioningCertPwd":""}`
 	defer userInput(t, "userInput\nuserInput\nuserInput")()
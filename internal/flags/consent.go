@@ -0,0 +1,71 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+var consentCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+
+func (f *Flags) printConsentUsage() string {
+	executable := filepath.Base(os.Args[0])
+	usage := "\nRemote Provisioning Client (RPC) - used for activation, deactivation, maintenance and status of AMT\n\n"
+	usage = usage + "Usage: " + executable + " consent COMMAND [OPTIONS]\n\n"
+	usage = usage + "Supported Consent Commands:\n"
+	usage = usage + "  start  Requests a user consent code to be displayed on the screen of this device. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " consent start -password YourAMTPassword\n"
+	usage = usage + "  send   Sends the six digit user consent code displayed on the screen. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " consent send 123456 -password YourAMTPassword\n"
+	usage = usage + "  cancel Cancels the user consent request or session. AMT password is required\n"
+	usage = usage + "  status Displays the user consent state and policy. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " consent status -json -password YourAMTPassword\n"
+	usage = usage + "\nRun '" + executable + " consent COMMAND -h' for more information on a command.\n"
+	fmt.Println(usage)
+	return usage
+}
+
+func (f *Flags) handleConsentCommand() utils.ReturnCode {
+	if len(f.commandLineArgs) == 2 {
+		f.printConsentUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	f.SubCommand = f.commandLineArgs[2]
+	parseIndex := 3
+	switch f.SubCommand {
+	case utils.SubCommandConsentStart, utils.SubCommandConsentCancel, utils.SubCommandConsentStatus:
+	case utils.SubCommandConsentSend:
+		// the code is the only positional argument and comes before the flags
+		if len(f.commandLineArgs) == 3 || !consentCodePattern.MatchString(f.commandLineArgs[3]) {
+			log.Error("send requires the six digit user consent code displayed on the screen")
+			f.printConsentUsage()
+			return utils.IncorrectCommandLineParameters
+		}
+		f.ConsentCode, _ = strconv.Atoi(f.commandLineArgs[3])
+		parseIndex = 4
+	default:
+		f.printConsentUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	fs := f.NewLocalWsmanFlagSet(f.SubCommand)
+	if f.SubCommand != utils.SubCommandConsentStatus {
+		f.addDryRunFlag(fs)
+	}
+	rc := f.parseAndCheckArgCount(fs, parseIndex, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
@@ -0,0 +1,65 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleConsentCommand(t *testing.T) {
+	for _, action := range []string{
+		utils.SubCommandConsentStart,
+		utils.SubCommandConsentCancel,
+		utils.SubCommandConsentStatus,
+	} {
+		t.Run("accepts "+action, func(t *testing.T) {
+			f := NewFlags([]string{"rpc", "consent", action, "-password", "P@ssw0rd"})
+			result := f.ParseFlags()
+			assert.Equal(t, utils.Success, result)
+			assert.Equal(t, true, f.Local)
+			assert.Equal(t, utils.CommandConsent, f.Command)
+			assert.Equal(t, action, f.SubCommand)
+		})
+	}
+	t.Run("accepts send with a code", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "consent", "send", "012345", "-password", "P@ssw0rd", "-json"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, utils.SubCommandConsentSend, f.SubCommand)
+		assert.Equal(t, 12345, f.ConsentCode)
+		assert.Equal(t, true, f.JsonOutput)
+	})
+	t.Run("prompts for password", func(t *testing.T) {
+		defer userInput(t, "P@ssw0rd")()
+		f := NewFlags([]string{"rpc", "consent", "status"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "P@ssw0rd", f.Password)
+	})
+	t.Run("rejects send without a code", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "consent", "send", "-password", "P@ssw0rd"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects send with a malformed code", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "consent", "send", "12a456", "-password", "P@ssw0rd"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects missing action", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "consent"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects unknown action", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "consent", "accept", "-password", "P@ssw0rd"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects additional arguments", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "consent", "start", "-password", "P@ssw0rd", "extra"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
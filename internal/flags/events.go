@@ -0,0 +1,41 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+)
+
+func (f *Flags) printEventsUsage() string {
+	executable := filepath.Base(os.Args[0])
+	usage := "\nRemote Provisioning Client (RPC) - used for activation, deactivation, maintenance and status of AMT\n\n"
+	usage = usage + "Usage: " + executable + " events COMMAND [OPTIONS]\n\n"
+	usage = usage + "Supported Events Commands:\n"
+	usage = usage + "  listen Prints the events AMT delivers to event subscriptions on this host as JSON lines.\n"
+	usage = usage + "         The local AMT ports are served the same way as the lms command while listening.\n"
+	usage = usage + "         Example: " + executable + " events listen\n"
+	usage = usage + "\nRun '" + executable + " events COMMAND -h' for more information on a command.\n"
+	fmt.Println(usage)
+	return usage
+}
+
+func (f *Flags) handleEventsCommand() utils.ReturnCode {
+	if len(f.commandLineArgs) == 2 {
+		f.printEventsUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	f.SubCommand = f.commandLineArgs[2]
+	switch f.SubCommand {
+	case utils.SubCommandListen:
+		if err := f.eventsListenCommand.Parse(f.commandLineArgs[3:]); err != nil {
+			return utils.IncorrectCommandLineParameters
+		}
+	default:
+		f.printEventsUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
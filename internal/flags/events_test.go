@@ -0,0 +1,40 @@
+package flags
+
+import (
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHandleEventsCommand(t *testing.T) {
+	t.Run("listen defaults to localhost", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "events", "listen"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, utils.SubCommandListen, f.SubCommand)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, utils.LMSAddress, f.LMSAddress)
+	})
+	t.Run("listen on the given address", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "events", "listen", "-lmsaddress", "127.0.0.1"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "127.0.0.1", f.LMSAddress)
+	})
+	t.Run("requires a subcommand", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "events"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects unknown subcommands", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "events", "nope"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+		assert.Equal(t, false, f.Local)
+	})
+	t.Run("rejects unknown flags", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "events", "listen", "-nope"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
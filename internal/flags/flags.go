@@ -63,6 +63,12 @@ type Flags struct {
 	JsonOutput                          bool
 	RandomPassword                      bool
 	Local                               bool
+	DryRun                              bool
+	JournalFile                         string
+	Replay                              bool
+	BackupFile                          string
+	BackupPassphrase                    string
+	RestoreCertificates                 []config.BackupCertificate
 	StaticPassword                      string
 	Password                            string
 	LogLevel                            string
@@ -70,6 +76,8 @@ type Flags struct {
 	TenantID                            string
 	UseCCM                              bool
 	UseACM                              bool
+	UseHBased                           bool
+	StopConfiguration                   bool
 	configContent                       string
 	UUID                                string
 	LocalConfig                         config.Config
@@ -82,6 +90,8 @@ type Flags struct {
 	amtMaintenanceChangePasswordCommand *flag.FlagSet
 	amtMaintenanceSyncDeviceInfoCommand *flag.FlagSet
 	versionCommand                      *flag.FlagSet
+	lmsCommand                          *flag.FlagSet
+	eventsListenCommand                 *flag.FlagSet
 	amtCommand                          amt.AMTCommand
 	netEnumerator                       NetEnumerator
 	IpConfiguration                     IPConfiguration
@@ -92,6 +102,10 @@ type Flags struct {
 	SkipIPRenew                         bool
 	SambaService                        smb.ServiceInterface
 	ConfigTLSInfo                       ConfigTLSInfo
+	Boot                                BootFlags
+	Logs                                LogsFlags
+	InventoryFile                       string
+	ConsentCode                         int
 }
 
 func NewFlags(args []string) *Flags {
@@ -112,6 +126,16 @@ func NewFlags(args []string) *Flags {
 	flags.versionCommand = flag.NewFlagSet(utils.CommandVersion, flag.ContinueOnError)
 	flags.versionCommand.BoolVar(&flags.JsonOutput, "json", false, "json output")
 
+	flags.lmsCommand = flag.NewFlagSet(utils.CommandLMS, flag.ContinueOnError)
+	flags.lmsCommand.StringVar(&flags.LMSAddress, "lmsaddress", utils.LMSAddress, "Address to listen on for local AMT connections")
+	flags.lmsCommand.BoolVar(&flags.Verbose, "v", false, "Verbose output")
+	flags.lmsCommand.StringVar(&flags.LogLevel, "l", "info", "Log level (panic,fatal,error,warn,info,debug,trace)")
+
+	flags.eventsListenCommand = flag.NewFlagSet(utils.SubCommandListen, flag.ContinueOnError)
+	flags.eventsListenCommand.StringVar(&flags.LMSAddress, "lmsaddress", utils.LMSAddress, "Address to listen on for local AMT connections")
+	flags.eventsListenCommand.BoolVar(&flags.Verbose, "v", false, "Verbose output")
+	flags.eventsListenCommand.StringVar(&flags.LogLevel, "l", "info", "Log level (panic,fatal,error,warn,info,debug,trace)")
+
 	flags.amtCommand = amt.NewAMTCommand()
 	flags.netEnumerator = NetEnumerator{}
 	flags.netEnumerator.Interfaces = net.Interfaces
@@ -142,10 +166,38 @@ func (f *Flags) ParseFlags() utils.ReturnCode {
 		rc = f.handleVersionCommand()
 	case utils.CommandConfigure:
 		rc = f.handleConfigureCommand()
+	case utils.CommandLMS:
+		rc = f.handleLMSCommand()
+	case utils.CommandEvents:
+		rc = f.handleEventsCommand()
+	case utils.CommandPower:
+		rc = f.handlePowerCommand()
+	case utils.CommandBoot:
+		rc = f.handleBootCommand()
+	case utils.CommandLogs:
+		rc = f.handleLogsCommand()
+	case utils.CommandInventory:
+		rc = f.handleInventoryCommand()
+	case utils.CommandConsent:
+		rc = f.handleConsentCommand()
+	case utils.CommandUsers:
+		rc = f.handleUsersCommand()
+	case utils.CommandApply:
+		rc = f.handleApplyCommand()
+	case utils.CommandRecover:
+		rc = f.handleRecoverCommand()
+	case utils.CommandBackup:
+		rc = f.handleBackupCommand()
+	case utils.CommandRestore:
+		rc = f.handleRestoreCommand()
 	default:
 		rc = utils.IncorrectCommandLineParameters
 		f.printUsage()
 	}
+	if rc == utils.Success && f.DryRun && !f.Local {
+		log.Error("-dry-run only applies to commands that run locally")
+		rc = utils.IncorrectCommandLineParameters
+	}
 	return rc
 }
 
@@ -158,14 +210,39 @@ func (f *Flags) printUsage() string {
 	usage = usage + "              Example: " + executable + " activate -u wss://server/activate --profile acmprofile\n"
 	usage = usage + "  amtinfo     Displays information about AMT status and configuration\n"
 	usage = usage + "              Example: " + executable + " amtinfo\n"
+	usage = usage + "  apply       Changes this device to match a config file and skips what already matches. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " apply -config device.yaml\n"
+	usage = usage + "  backup      Saves the AMT configuration of this device to an encrypted archive. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " backup -file device01.rpcbak\n"
+	usage = usage + "  boot        Controls the next boot of this device. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " boot set -device pxe -power reset\n"
 	usage = usage + "  configure   Local configuration of a feature on this device. AMT password is required\n"
 	usage = usage + "              Example: " + executable + " configure addwifisettings ...\n"
+	usage = usage + "  consent     Requests, sends, cancels or displays the user consent code. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " consent send 123456\n"
 	usage = usage + "  deactivate  Deactivates this device. AMT password is required\n"
 	usage = usage + "              Example: " + executable + " deactivate -u wss://server/activate\n"
+	usage = usage + "  events      Receives the events AMT delivers to the host over the MEI\n"
+	usage = usage + "              Example: " + executable + " events listen\n"
+	usage = usage + "  inventory   Collects the hardware inventory of this device from AMT as JSON. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " inventory -output inventory.json\n"
+	usage = usage + "  lms         Serves the local AMT ports over the MEI without Intel LMS installed\n"
+	usage = usage + "              Example: " + executable + " lms\n"
+	usage = usage + "  logs        Reads the AMT audit log or event log. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " logs audit -format csv\n"
 	usage = usage + "  maintenance Execute a maintenance task for the device. AMT password is required\n"
 	usage = usage + "              Example: " + executable + " maintenance syncclock -u wss://server/activate \n"
+	usage = usage + "  power       Displays or changes the power state of the device. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " power reset\n"
+	usage = usage + "  recover     Undoes the AMT changes of a configure, apply or restore command that did not finish. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " recover -secrets secrets.yaml\n"
+	usage = usage + "  restore     Changes this device to match a backup archive, such as after a motherboard swap. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " restore -file device01.rpcbak -secrets secrets.yaml\n"
+	usage = usage + "  users       Lists, adds, removes or updates the AMT digest users. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " users add -config users.yaml -secrets secrets.yaml\n"
 	usage = usage + "  version     Displays the current version of RPC and the RPC Protocol version\n"
 	usage = usage + "              Example: " + executable + " version\n"
+	usage = usage + "\nCommands that change AMT locally accept -dry-run, which reads AMT and prints the changes without making them.\n"
 	usage = usage + "\nRun '" + executable + " COMMAND' for more information on a command.\n"
 	fmt.Println(usage)
 	return usage
@@ -191,6 +268,7 @@ func (f *Flags) setupCommonFlags() {
 		fs.StringVar(&f.LogLevel, "l", "info", "Log level (panic,fatal,error,warn,info,debug,trace)")
 		fs.BoolVar(&f.JsonOutput, "json", false, "JSON output")
 		fs.StringVar(&f.Password, "password", f.lookupEnvOrString("AMT_PASSWORD", ""), "AMT password")
+		f.addDryRunFlag(fs)
 		fs.DurationVar(&f.AMTTimeoutDuration, "t", 2*time.Minute, "AMT timeout - time to wait until AMT is ready (ex. '2m' or '30s')")
 		if fs.Name() != utils.CommandActivate { // activate does not use the -f flag
 			fs.BoolVar(&f.Force, "f", false, "Force even if device is not registered with a server")
@@ -198,9 +276,30 @@ func (f *Flags) setupCommonFlags() {
 		if fs.Name() != utils.CommandDeactivate { // activate does not use the -f flag
 			fs.StringVar(&f.UUID, "uuid", "", "override AMT device uuid for use with non-CIRA workflow")
 		}
+		if fs.Name() != utils.CommandActivate && fs.Name() != utils.CommandDeactivate { // activate and deactivate define their own -local flag
+			fs.BoolVar(&f.Local, "local", false, "Execute the maintenance task directly on AMT without RPS")
+		}
 	}
 }
 
+// NewLocalWsmanFlagSet has the flags of the commands that only run locally
+// and reach AMT over WS-Man
+func (f *Flags) NewLocalWsmanFlagSet(subCommand string) *flag.FlagSet {
+	fs := flag.NewFlagSet(subCommand, flag.ContinueOnError)
+	fs.BoolVar(&f.Verbose, "v", false, "Verbose output")
+	fs.StringVar(&f.LogLevel, "l", "info", "Log level (panic,fatal,error,warn,info,debug,trace)")
+	fs.BoolVar(&f.JsonOutput, "json", false, "JSON output")
+	fs.StringVar(&f.Password, "password", f.lookupEnvOrString("AMT_PASSWORD", ""), "AMT password")
+	fs.StringVar(&f.LMSAddress, "lmsaddress", utils.LMSAddress, "Address of the AMT WS-Man endpoint, such as a device reached through rpc lms")
+	fs.StringVar(&f.LMSPort, "lmsport", utils.LMSPort, "Port of the AMT WS-Man endpoint")
+	return fs
+}
+
+// addDryRunFlag is for the commands that change AMT
+func (f *Flags) addDryRunFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&f.DryRun, "dry-run", false, "Print the changes to AMT without making them")
+}
+
 func (f *Flags) parseAndCheckArgCount(fs *flag.FlagSet, parseIndex int, minNumReq int) utils.ReturnCode {
 	if len(f.commandLineArgs) < (parseIndex + minNumReq) {
 		fs.Usage()
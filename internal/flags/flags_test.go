@@ -114,6 +114,23 @@ func (c MockPTHICommands) OpenUserInitiatedConnection() (status pthi.Status, err
 func (c MockPTHICommands) CloseUserInitiatedConnection() (status pthi.Status, err error) {
 	return 0, nil
 }
+func (c MockPTHICommands) GetSecurityParameters() (response pthi.GetSecurityParametersResponse, err error) {
+	return pthi.GetSecurityParametersResponse{}, nil
+}
+func (c MockPTHICommands) GetMACAddresses() (response pthi.GetMACAddressesResponse, err error) {
+	return pthi.GetMACAddressesResponse{}, nil
+}
+func (c MockPTHICommands) GetProvisioningState() (state int, err error) { return 0, nil }
+func (c MockPTHICommands) GetDNSSuffixList() (suffixes []string, err error) {
+	return []string{}, nil
+}
+func (c MockPTHICommands) SetEnterpriseAccess(flags uint8, hostIPAddress [16]uint8, enterpriseAccess uint8) (status pthi.Status, err error) {
+	return 0, nil
+}
+func (c MockPTHICommands) GenerateRNGSeed() (status pthi.Status, err error) { return 0, nil }
+func (c MockPTHICommands) GetRNGSeedStatus() (status pthi.AMT_RNG_STATUS, err error) {
+	return pthi.RNG_STATUS_EXIST, nil
+}
 
 var testNetEnumerator = NetEnumerator{
 	Interfaces: func() ([]net.Interface, error) {
@@ -195,14 +212,39 @@ func TestPrintUsage(t *testing.T) {
 	usage = usage + "              Example: " + executable + " activate -u wss://server/activate --profile acmprofile\n"
 	usage = usage + "  amtinfo     Displays information about AMT status and configuration\n"
 	usage = usage + "              Example: " + executable + " amtinfo\n"
+	usage = usage + "  apply       Changes this device to match a config file and skips what already matches. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " apply -config device.yaml\n"
+	usage = usage + "  backup      Saves the AMT configuration of this device to an encrypted archive. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " backup -file device01.rpcbak\n"
+	usage = usage + "  boot        Controls the next boot of this device. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " boot set -device pxe -power reset\n"
 	usage = usage + "  configure   Local configuration of a feature on this device. AMT password is required\n"
 	usage = usage + "              Example: " + executable + " configure addwifisettings ...\n"
+	usage = usage + "  consent     Requests, sends, cancels or displays the user consent code. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " consent send 123456\n"
 	usage = usage + "  deactivate  Deactivates this device. AMT password is required\n"
 	usage = usage + "              Example: " + executable + " deactivate -u wss://server/activate\n"
+	usage = usage + "  events      Receives the events AMT delivers to the host over the MEI\n"
+	usage = usage + "              Example: " + executable + " events listen\n"
+	usage = usage + "  inventory   Collects the hardware inventory of this device from AMT as JSON. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " inventory -output inventory.json\n"
+	usage = usage + "  lms         Serves the local AMT ports over the MEI without Intel LMS installed\n"
+	usage = usage + "              Example: " + executable + " lms\n"
+	usage = usage + "  logs        Reads the AMT audit log or event log. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " logs audit -format csv\n"
 	usage = usage + "  maintenance Execute a maintenance task for the device. AMT password is required\n"
 	usage = usage + "              Example: " + executable + " maintenance syncclock -u wss://server/activate \n"
+	usage = usage + "  power       Displays or changes the power state of the device. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " power reset\n"
+	usage = usage + "  recover     Undoes the AMT changes of a configure, apply or restore command that did not finish. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " recover -secrets secrets.yaml\n"
+	usage = usage + "  restore     Changes this device to match a backup archive, such as after a motherboard swap. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " restore -file device01.rpcbak -secrets secrets.yaml\n"
+	usage = usage + "  users       Lists, adds, removes or updates the AMT digest users. AMT password is required\n"
+	usage = usage + "              Example: " + executable + " users add -config users.yaml -secrets secrets.yaml\n"
 	usage = usage + "  version     Displays the current version of RPC and the RPC Protocol version\n"
 	usage = usage + "              Example: " + executable + " version\n"
+	usage = usage + "\nCommands that change AMT locally accept -dry-run, which reads AMT and prints the changes without making them.\n"
 	usage = usage + "\nRun '" + executable + " COMMAND' for more information on a command.\n"
 	assert.Equal(t, usage, output)
 }
@@ -256,6 +298,43 @@ func TestParseFlagsActivate(t *testing.T) {
 	assert.EqualValues(t, result, utils.IncorrectCommandLineParameters)
 	assert.Equal(t, flags.Command, utils.CommandActivate)
 }
+func TestParseFlagsDryRun(t *testing.T) {
+	t.Run("local commands accept -dry-run", func(t *testing.T) {
+		flags := NewFlags([]string{"./rpc", "deactivate", "-local", "--dry-run"})
+		result := flags.ParseFlags()
+		assert.EqualValues(t, utils.Success, result)
+		assert.Equal(t, true, flags.DryRun)
+		flags = NewFlags([]string{"./rpc", "configure", "enablewifiport", "-password", "P@ssw0rd", "-dry-run"})
+		result = flags.ParseFlags()
+		assert.EqualValues(t, utils.Success, result)
+		assert.Equal(t, true, flags.DryRun)
+	})
+	t.Run("only local commands that change AMT accept -dry-run", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"./rpc", "power", "on", "-password", "P@ssw0rd", "-dry-run"},
+			{"./rpc", "boot", "set", "-device", "pxe", "-password", "P@ssw0rd", "-dry-run"},
+		} {
+			flags := NewFlags(args)
+			assert.EqualValues(t, utils.Success, flags.ParseFlags(), args)
+			assert.Equal(t, true, flags.DryRun)
+		}
+		for _, args := range [][]string{
+			{"./rpc", "power", "state", "-password", "P@ssw0rd", "-dry-run"},
+			{"./rpc", "boot", "status", "-password", "P@ssw0rd", "-dry-run"},
+			{"./rpc", "logs", "audit", "-password", "P@ssw0rd", "-dry-run"},
+			{"./rpc", "inventory", "-password", "P@ssw0rd", "-dry-run"},
+		} {
+			flags := NewFlags(args)
+			assert.EqualValues(t, utils.IncorrectCommandLineParameters, flags.ParseFlags(), args)
+		}
+	})
+	t.Run("commands run by RPS reject -dry-run", func(t *testing.T) {
+		flags := NewFlags([]string{"./rpc", "activate", "-u", "wss://localhost", "-profile", "profileName", "-dry-run"})
+		result := flags.ParseFlags()
+		assert.EqualValues(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
+
 func TestParseFlagsVersion(t *testing.T) {
 	args := []string{"./rpc", "version"}
 	flags := NewFlags(args)
@@ -6,18 +6,23 @@ import (
 )
 
 type AmtInfoFlags struct {
-	Ver      bool
-	Bld      bool
-	Sku      bool
-	UUID     bool
-	Mode     bool
-	DNS      bool
-	Cert     bool
-	UserCert bool
-	Ras      bool
-	Lan      bool
-	Hostname bool
-	OpState  bool
+	Ver       bool
+	Bld       bool
+	Sku       bool
+	UUID      bool
+	Mode      bool
+	DNS       bool
+	Cert      bool
+	UserCert  bool
+	Ras       bool
+	Lan       bool
+	Hostname  bool
+	OpState   bool
+	MAC       bool
+	ProvState bool
+	Security  bool
+	// Redirection requires the AMT password
+	Redirection bool
 }
 
 func (f *Flags) handleAMTInfo(amtInfoCommand *flag.FlagSet) utils.ReturnCode {
@@ -36,6 +41,10 @@ func (f *Flags) handleAMTInfo(amtInfoCommand *flag.FlagSet) utils.ReturnCode {
 	amtInfoCommand.BoolVar(&f.AmtInfo.Lan, "lan", false, "LAN Settings")
 	amtInfoCommand.BoolVar(&f.AmtInfo.Hostname, "hostname", false, "OS Hostname")
 	amtInfoCommand.BoolVar(&f.AmtInfo.OpState, "operationalState", false, "AMT Operational State")
+	amtInfoCommand.BoolVar(&f.AmtInfo.MAC, "mac", false, "Dedicated and Shared MAC Addresses")
+	amtInfoCommand.BoolVar(&f.AmtInfo.ProvState, "provisioningState", false, "Provisioning State")
+	amtInfoCommand.BoolVar(&f.AmtInfo.Security, "security", false, "Security Parameters")
+	amtInfoCommand.BoolVar(&f.AmtInfo.Redirection, "redirection", false, "SOL, IDER, KVM and User Consent state. AMT password is required")
 	amtInfoCommand.StringVar(&f.Password, "password", f.lookupEnvOrString("AMT_PASSWORD", ""), "AMT Password")
 
 	if err := amtInfoCommand.Parse(f.commandLineArgs[2:]); err != nil {
@@ -57,6 +66,11 @@ func (f *Flags) handleAMTInfo(amtInfoCommand *flag.FlagSet) utils.ReturnCode {
 		f.AmtInfo.Lan = true
 		f.AmtInfo.Hostname = true
 		f.AmtInfo.OpState = true
+		f.AmtInfo.MAC = true
+		f.AmtInfo.ProvState = true
+		f.AmtInfo.Security = true
+		// redirection state needs the wsman connection, only include it when a password is available
+		f.AmtInfo.Redirection = f.Password != ""
 	}
 
 	// no password - same behavior only cert hashes
@@ -9,16 +9,19 @@ import (
 
 func TestParseFlagsAmtInfo(t *testing.T) {
 	defaultFlags := AmtInfoFlags{
-		Ver:      true,
-		Bld:      true,
-		Sku:      true,
-		UUID:     true,
-		Mode:     true,
-		DNS:      true,
-		Ras:      true,
-		Lan:      true,
-		Hostname: true,
-		OpState:  true,
+		Ver:       true,
+		Bld:       true,
+		Sku:       true,
+		UUID:      true,
+		Mode:      true,
+		DNS:       true,
+		Ras:       true,
+		Lan:       true,
+		Hostname:  true,
+		OpState:   true,
+		MAC:       true,
+		ProvState: true,
+		Security:  true,
 	}
 
 	tests := map[string]struct {
@@ -74,6 +77,13 @@ func TestParseFlagsAmtInfo(t *testing.T) {
 			},
 			userInput: "testPassword",
 		},
+		"expect Success for redirection with password": {
+			cmdLine:    "./rpc amtinfo -redirection -password testPassword",
+			wantResult: utils.Success,
+			wantFlags: AmtInfoFlags{
+				Redirection: true,
+			},
+		},
 	}
 
 	for name, tc := range tests {
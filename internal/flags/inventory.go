@@ -0,0 +1,22 @@
+package flags
+
+import (
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+)
+
+func (f *Flags) handleInventoryCommand() utils.ReturnCode {
+	fs := f.NewLocalWsmanFlagSet(utils.CommandInventory)
+	fs.StringVar(&f.InventoryFile, "output", "", "file to write the inventory JSON to instead of the console")
+	rc := f.parseAndCheckArgCount(fs, 2, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
@@ -0,0 +1,32 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleInventoryCommand(t *testing.T) {
+	t.Run("accepts password and output", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "inventory", "-password", "P@ssw0rd", "-output", "inventory.json"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, utils.CommandInventory, f.Command)
+		assert.Equal(t, "inventory.json", f.InventoryFile)
+	})
+	t.Run("prompts for password", func(t *testing.T) {
+		defer userInput(t, "P@ssw0rd")()
+		f := NewFlags([]string{"rpc", "inventory"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "P@ssw0rd", f.Password)
+		assert.Equal(t, "", f.InventoryFile)
+	})
+	t.Run("rejects additional arguments", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "inventory", "-password", "P@ssw0rd", "extra"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
@@ -0,0 +1,14 @@
+package flags
+
+import (
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+)
+
+func (f *Flags) handleLMSCommand() utils.ReturnCode {
+	if err := f.lmsCommand.Parse(f.commandLineArgs[2:]); err != nil {
+		return utils.IncorrectCommandLineParameters
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
@@ -0,0 +1,28 @@
+package flags
+
+import (
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHandleLMSCommand(t *testing.T) {
+	t.Run("defaults to localhost", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "lms"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, utils.LMSAddress, f.LMSAddress)
+	})
+	t.Run("listens on the given address", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "lms", "-lmsaddress", "127.0.0.1"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "127.0.0.1", f.LMSAddress)
+	})
+	t.Run("rejects unknown flags", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "lms", "-nope"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
@@ -0,0 +1,102 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	LogsFormatText = "text"
+	LogsFormatJSON = "json"
+	LogsFormatCSV  = "csv"
+)
+
+var logsFormats = []string{
+	LogsFormatText,
+	LogsFormatJSON,
+	LogsFormatCSV,
+}
+
+type LogsFlags struct {
+	Format string
+	Since  time.Time
+	Clear  bool
+}
+
+func (f *Flags) printLogsUsage() string {
+	executable := filepath.Base(os.Args[0])
+	usage := "\nRemote Provisioning Client (RPC) - used for activation, deactivation, maintenance and status of AMT\n\n"
+	usage = usage + "Usage: " + executable + " logs COMMAND [OPTIONS]\n\n"
+	usage = usage + "Supported Logs Commands:\n"
+	usage = usage + "  audit  Reads the AMT audit log. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " logs audit -format csv -since 2024-01-01T00:00:00Z -password YourAMTPassword\n"
+	usage = usage + "  events Reads the AMT event log. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " logs events -format json -since 24h -password YourAMTPassword\n"
+	usage = usage + "\nThe log is cleared after it is read with -clear. Clearing requires the device to be in admin control mode.\n"
+	usage = usage + "\nRun '" + executable + " logs COMMAND -h' for more information on a command.\n"
+	fmt.Println(usage)
+	return usage
+}
+
+func (f *Flags) handleLogsCommand() utils.ReturnCode {
+	if len(f.commandLineArgs) == 2 {
+		f.printLogsUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	f.SubCommand = f.commandLineArgs[2]
+	switch f.SubCommand {
+	case utils.SubCommandLogsAudit, utils.SubCommandLogsEvents:
+	default:
+		f.printLogsUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	fs := f.NewLocalWsmanFlagSet(f.SubCommand)
+	var since string
+	fs.StringVar(&f.Logs.Format, "format", "", "output format ("+strings.Join(logsFormats, ", ")+")")
+	fs.StringVar(&since, "since", "", "only records at or after this time, as RFC3339 or a duration before now such as 24h")
+	fs.BoolVar(&f.Logs.Clear, "clear", false, "clear the log after it is read")
+	rc := f.parseAndCheckArgCount(fs, 3, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if f.Logs.Format == "" {
+		f.Logs.Format = LogsFormatText
+		if f.JsonOutput {
+			f.Logs.Format = LogsFormatJSON
+		}
+	}
+	if !containsString(logsFormats, f.Logs.Format) {
+		log.Errorf("invalid format %s, expected one of %s", f.Logs.Format, strings.Join(logsFormats, ", "))
+		return utils.IncorrectCommandLineParameters
+	}
+	if since != "" {
+		if f.Logs.Since, rc = parseSince(since, time.Now()); rc != utils.Success {
+			return rc
+		}
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
+
+func parseSince(since string, now time.Time) (time.Time, utils.ReturnCode) {
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, utils.Success
+	}
+	if d, err := time.ParseDuration(since); err == nil && d >= 0 {
+		return now.Add(-d), utils.Success
+	}
+	log.Errorf("invalid -since %s, expected RFC3339 or a duration such as 24h", since)
+	return time.Time{}, utils.IncorrectCommandLineParameters
+}
@@ -0,0 +1,69 @@
+package flags
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleLogsCommand(t *testing.T) {
+	for _, subCommand := range []string{utils.SubCommandLogsAudit, utils.SubCommandLogsEvents} {
+		t.Run("accepts "+subCommand, func(t *testing.T) {
+			f := NewFlags([]string{"rpc", "logs", subCommand, "-password", "P@ssw0rd"})
+			result := f.ParseFlags()
+			assert.Equal(t, utils.Success, result)
+			assert.Equal(t, true, f.Local)
+			assert.Equal(t, utils.CommandLogs, f.Command)
+			assert.Equal(t, subCommand, f.SubCommand)
+			assert.Equal(t, LogsFlags{Format: LogsFormatText}, f.Logs)
+		})
+	}
+	t.Run("accepts format, since and clear", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "logs", "audit", "-password", "P@ssw0rd", "-format", "csv", "-since", "2024-01-02T03:04:05Z", "-clear"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, LogsFlags{
+			Format: LogsFormatCSV,
+			Since:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Clear:  true,
+		}, f.Logs)
+	})
+	t.Run("json flag selects the json format", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "logs", "events", "-password", "P@ssw0rd", "-json"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, LogsFormatJSON, f.Logs.Format)
+	})
+	t.Run("prompts for password", func(t *testing.T) {
+		defer userInput(t, "P@ssw0rd")()
+		f := NewFlags([]string{"rpc", "logs", "audit"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "P@ssw0rd", f.Password)
+	})
+	tests := map[string][]string{
+		"missing command":      {"rpc", "logs"},
+		"unknown command":      {"rpc", "logs", "system", "-password", "P@ssw0rd"},
+		"unknown format":       {"rpc", "logs", "audit", "-password", "P@ssw0rd", "-format", "xml"},
+		"invalid since":        {"rpc", "logs", "audit", "-password", "P@ssw0rd", "-since", "yesterday"},
+		"additional arguments": {"rpc", "logs", "audit", "-password", "P@ssw0rd", "extra"},
+	}
+	for name, args := range tests {
+		t.Run("rejects "+name, func(t *testing.T) {
+			f := NewFlags(args)
+			result := f.ParseFlags()
+			assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	since, rc := parseSince("24h", now)
+	assert.Equal(t, utils.Success, rc)
+	assert.Equal(t, time.Date(2024, 5, 5, 12, 0, 0, 0, time.UTC), since)
+	_, rc = parseSince("-24h", now)
+	assert.Equal(t, utils.IncorrectCommandLineParameters, rc)
+}
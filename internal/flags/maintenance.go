@@ -29,6 +29,9 @@ func (f *Flags) printMaintenanceUsage() string {
 	usage = usage + "  syncip         Sync the IP configuration of the host OS to AMT Network Settings. AMT password is required\n"
 	usage = usage + "                 Example: " + executable + " maintenance syncip -staticip 192.168.1.7 -netmask 255.255.255.0 -gateway 192.168.1.1 -primarydns 8.8.8.8 -secondarydns 4.4.4.4 -u wss://server/activate\n"
 	usage = usage + "                 If a static ip is not specified, the ip address and netmask of the host OS is used\n"
+	usage = usage + "\nUse -local instead of -u to run changepassword, syncclock, synchostname or syncip directly on AMT without RPS\n"
+	usage = usage + "                 Example: " + executable + " maintenance syncclock -local -password YourAMTPassword\n"
+	usage = usage + "                 syncdeviceinfo -local prints the device information RPS would receive\n"
 	usage = usage + "\nRun '" + executable + " maintenance COMMAND -h' for more information on a command.\n"
 	fmt.Println(usage)
 	return usage
@@ -75,6 +78,10 @@ func (f *Flags) handleMaintenanceCommand() utils.ReturnCode {
 		}
 	}
 
+	if f.Local {
+		return utils.Success
+	}
+
 	if f.URL == "" {
 		fmt.Print("\n-u flag is required and cannot be empty\n\n")
 		f.printMaintenanceUsage()
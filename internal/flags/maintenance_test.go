@@ -29,6 +29,9 @@ func TestPrintMaintenanceUsage(t *testing.T) {
 	usage = usage + "  syncip         Sync the IP configuration of the host OS to AMT Network Settings. AMT password is required\n"
 	usage = usage + "                 Example: " + executable + " maintenance syncip -staticip 192.168.1.7 -netmask 255.255.255.0 -gateway 192.168.1.1 -primarydns 8.8.8.8 -secondarydns 4.4.4.4 -u wss://server/activate\n"
 	usage = usage + "                 If a static ip is not specified, the ip address and netmask of the host OS is used\n"
+	usage = usage + "\nUse -local instead of -u to run changepassword, syncclock, synchostname or syncip directly on AMT without RPS\n"
+	usage = usage + "                 Example: " + executable + " maintenance syncclock -local -password YourAMTPassword\n"
+	usage = usage + "                 syncdeviceinfo -local prints the device information RPS would receive\n"
 	usage = usage + "\nRun '" + executable + " maintenance COMMAND -h' for more information on a command.\n"
 	assert.Equal(t, usage, output)
 }
@@ -183,6 +186,18 @@ func TestParseFlagsMaintenance(t *testing.T) {
 			wantResult: utils.Success,
 			userInput:  trickyPassword,
 		},
+		"should pass - syncclock local without URL": {
+			cmdLine:    cmdBase + " " + utils.SubCommandSyncClock + " -local " + argCurPw,
+			wantResult: utils.Success,
+		},
+		"should pass - changepassword local": {
+			cmdLine:    cmdBase + " " + utils.SubCommandChangePassword + " -local -static " + newPassword + " " + argCurPw,
+			wantResult: utils.Success,
+		},
+		"should pass - syncdeviceinfo local": {
+			cmdLine:    cmdBase + " " + utils.SubCommandSyncDeviceInfo + " -local " + argCurPw,
+			wantResult: utils.Success,
+		},
 		"should pass - UUID Override": {
 			cmdLine:    cmdBase + " " + utils.SubCommandSyncClock + " " + argUrl + " " + argCurPw + " -uuid 4c2e8db8-1c7a-00ea-279c-d17395b1f584",
 			wantResult: utils.Success,
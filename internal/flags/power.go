@@ -0,0 +1,66 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+)
+
+func (f *Flags) printPowerUsage() string {
+	executable := filepath.Base(os.Args[0])
+	usage := "\nRemote Provisioning Client (RPC) - used for activation, deactivation, maintenance and status of AMT\n\n"
+	usage = usage + "Usage: " + executable + " power COMMAND [OPTIONS]\n\n"
+	usage = usage + "Supported Power Commands:\n"
+	usage = usage + "  state     Displays the current power state. AMT password is required\n"
+	usage = usage + "            Example: " + executable + " power state -password YourAMTPassword\n"
+	usage = usage + "  on        Powers the device on. AMT password is required\n"
+	usage = usage + "  off       Powers the device off without waiting for the OS. AMT password is required\n"
+	usage = usage + "  cycle     Powers the device off and back on. AMT password is required\n"
+	usage = usage + "  reset     Resets the device. AMT password is required\n"
+	usage = usage + "  sleep     Puts the device into sleep. AMT password is required\n"
+	usage = usage + "  hibernate Puts the device into hibernation. AMT password is required\n"
+	usage = usage + "  soft-off  Asks the OS to shut down gracefully. AMT password is required\n"
+	usage = usage + "            Example: " + executable + " power reset -password YourAMTPassword\n"
+	usage = usage + "\nRun '" + executable + " power COMMAND -h' for more information on a command.\n"
+	fmt.Println(usage)
+	return usage
+}
+
+func (f *Flags) handlePowerCommand() utils.ReturnCode {
+	if len(f.commandLineArgs) == 2 {
+		f.printPowerUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	f.SubCommand = f.commandLineArgs[2]
+	switch f.SubCommand {
+	case utils.SubCommandPowerState,
+		utils.SubCommandPowerOn,
+		utils.SubCommandPowerOff,
+		utils.SubCommandPowerCycle,
+		utils.SubCommandPowerReset,
+		utils.SubCommandPowerSleep,
+		utils.SubCommandPowerHibernate,
+		utils.SubCommandPowerSoftOff:
+	default:
+		f.printPowerUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	fs := f.NewLocalWsmanFlagSet(f.SubCommand)
+	if f.SubCommand != utils.SubCommandPowerState {
+		f.addDryRunFlag(fs)
+	}
+	rc := f.parseAndCheckArgCount(fs, 3, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
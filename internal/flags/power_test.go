@@ -0,0 +1,62 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlePowerCommand(t *testing.T) {
+	for _, action := range []string{
+		utils.SubCommandPowerState,
+		utils.SubCommandPowerOn,
+		utils.SubCommandPowerOff,
+		utils.SubCommandPowerCycle,
+		utils.SubCommandPowerReset,
+		utils.SubCommandPowerSleep,
+		utils.SubCommandPowerHibernate,
+		utils.SubCommandPowerSoftOff,
+	} {
+		t.Run("accepts "+action, func(t *testing.T) {
+			f := NewFlags([]string{"rpc", "power", action, "-password", "P@ssw0rd"})
+			result := f.ParseFlags()
+			assert.Equal(t, utils.Success, result)
+			assert.Equal(t, true, f.Local)
+			assert.Equal(t, utils.CommandPower, f.Command)
+			assert.Equal(t, action, f.SubCommand)
+			assert.Equal(t, utils.LMSAddress, f.LMSAddress)
+			assert.Equal(t, utils.LMSPort, f.LMSPort)
+		})
+	}
+	t.Run("accepts json and endpoint", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "power", "state", "-password", "P@ssw0rd", "-json", "-lmsaddress", "192.168.1.10", "-lmsport", "16993"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.JsonOutput)
+		assert.Equal(t, "192.168.1.10", f.LMSAddress)
+		assert.Equal(t, "16993", f.LMSPort)
+	})
+	t.Run("prompts for password", func(t *testing.T) {
+		defer userInput(t, "P@ssw0rd")()
+		f := NewFlags([]string{"rpc", "power", "on"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "P@ssw0rd", f.Password)
+	})
+	t.Run("rejects missing action", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "power"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects unknown action", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "power", "explode", "-password", "P@ssw0rd"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects additional arguments", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "power", "on", "-password", "P@ssw0rd", "extra"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+}
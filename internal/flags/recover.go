@@ -0,0 +1,84 @@
+package flags
+
+import (
+	"strings"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	log "github.com/sirupsen/logrus"
+)
+
+func (f *Flags) handleRecoverCommand() utils.ReturnCode {
+	var secretsFilePath string
+	fs := f.NewConfigureFlagSet(utils.CommandRecover)
+	fs.StringVar(&secretsFilePath, "secrets", "", "secrets file with the pskPassphrase of the wifi profiles to add again")
+	fs.BoolVar(&f.Replay, "replay", false, "run the interrupted command again after undoing it, from the same directory")
+	rc := f.parseAndCheckArgCount(fs, 2, 0)
+	if rc != utils.Success {
+		return rc
+	}
+	if secretsFilePath != "" {
+		var secretConfig config.SecretConfig
+		err := cleanenv.ReadConfig(secretsFilePath, &secretConfig)
+		if err != nil {
+			log.Error("error reading secrets file: ", err)
+			return utils.FailedReadingConfiguration
+		}
+		// there is no config file, the passphrases go to the profiles recover adds again
+		for _, secret := range secretConfig.Secrets {
+			if secret.ProfileName != "" && secret.PskPassphrase != "" {
+				f.LocalConfig.WifiConfigs = append(f.LocalConfig.WifiConfigs,
+					config.WifiConfig{ProfileName: secret.ProfileName, PskPassphrase: secret.PskPassphrase})
+			}
+		}
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
+
+// secretFlags are the flags the journal must not store, lower case.
+// -configJson may hold any of the secrets of a configuration file.
+var secretFlags = map[string]bool{
+	"amtpassword":         true,
+	"configjson":          true,
+	"ieee8021xpassword":   true,
+	"mpspassword":         true,
+	"passphrase":          true,
+	"password":            true,
+	"privatekey":          true,
+	"provisioningcert":    true,
+	"provisioningcertpwd": true,
+	"pskpassphrase":       true,
+	"static":              true,
+	"token":               true,
+	"userpassword":        true,
+}
+
+// ReplayArgs returns the command line without the secret flags and their
+// values, which the journal must not store
+func (f *Flags) ReplayArgs() []string {
+	var args []string
+	for i := 0; i < len(f.commandLineArgs); i++ {
+		arg := f.commandLineArgs[i]
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		name = strings.ToLower(name)
+		// -static is also the bool of configure wired, only changepassword gives it a password
+		secret := secretFlags[name] && (name != "static" || f.StaticPassword != "")
+		if !strings.HasPrefix(arg, "-") || !secret {
+			args = append(args, arg)
+			continue
+		}
+		if !hasValue && i+1 < len(f.commandLineArgs) {
+			i++
+		}
+	}
+	return args
+}
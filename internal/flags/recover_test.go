@@ -0,0 +1,57 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleRecoverCommand(t *testing.T) {
+	t.Run("runs locally with the passphrases of the secrets file", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "recover", "-password", "P@ssw0rd", "-secrets", "../../secrets.yaml", "-replay"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, true, f.Replay)
+		assert.Equal(t, utils.CommandRecover, f.Command)
+		assert.Equal(t, "secrectPSK_PASSPHRASE", f.LocalConfig.WifiConfigs[0].PskPassphrase)
+	})
+	t.Run("reads the password", func(t *testing.T) {
+		defer userInput(t, "P@ssw0rd")()
+		f := NewFlags([]string{"rpc", "recover", "-journal", "journal.json"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "P@ssw0rd", f.Password)
+		assert.Equal(t, "journal.json", f.JournalFile)
+	})
+	t.Run("rejects a missing secrets file", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "recover", "-password", "P@ssw0rd", "-secrets", "missing.yaml"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.FailedReadingConfiguration, result)
+	})
+}
+
+func TestReplayArgs(t *testing.T) {
+	t.Run("drops the passwords and passphrases", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "configure", "wireless", "-password", "P@ssw0rd", "-journal", "journal.json",
+			"-pskPassphrase=secret", "-profileName", "home", "--mpspassword", "mps"})
+		assert.Equal(t, []string{"rpc", "configure", "wireless", "-journal", "journal.json",
+			"-profileName", "home"}, f.ReplayArgs())
+	})
+	t.Run("drops the private key in both forms", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "configure", "wireless", "-profileName", "corp", "-privateKey", "MIIEkey",
+			"-ieee8021xPassword", "secret", "-journal", "journal.json", "-privateKey=MIIEkey"})
+		assert.Equal(t, []string{"rpc", "configure", "wireless", "-profileName", "corp",
+			"-journal", "journal.json"}, f.ReplayArgs())
+	})
+	t.Run("drops configJson and the changepassword password", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "maintenance", "changepassword", "-local", "-static", "N3wP@ss", "-configJson", `{"password":"P@ssw0rd"}`})
+		f.StaticPassword = "N3wP@ss"
+		assert.Equal(t, []string{"rpc", "maintenance", "changepassword", "-local"}, f.ReplayArgs())
+	})
+	t.Run("keeps the static bool of configure wired", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "configure", "wired", "-static", "-ipAddress", "192.168.1.10"})
+		assert.Equal(t, []string{"rpc", "configure", "wired", "-static", "-ipAddress", "192.168.1.10"}, f.ReplayArgs())
+	})
+}
@@ -0,0 +1,216 @@
+package flags
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/authorization"
+	log "github.com/sirupsen/logrus"
+)
+
+// AMT limits digest user names to 16 characters
+const maxUsernameLength = 16
+
+var UserAccessPermissions = map[string]authorization.AccessPermission{
+	"local":   authorization.LocalAccessOnly,
+	"network": authorization.NetworkAccessOnly,
+	"any":     authorization.LocalAndNetworkAccess,
+}
+
+var UserRealms = map[string]authorization.RealmValues{
+	"redirection":                authorization.RedirectionRealm,
+	"ptAdministration":           authorization.PTAdministrationRealm,
+	"hardwareAsset":              authorization.HardwareAssetRealm,
+	"remoteControl":              authorization.RemoteControlRealm,
+	"storage":                    authorization.StorageRealm,
+	"eventManager":               authorization.EventManagerRealm,
+	"storageAdmin":               authorization.StorageAdminRealm,
+	"agentPresenceLocal":         authorization.AgentPresenceLocalRealm,
+	"agentPresenceRemote":        authorization.AgentPresenceRemoteRealm,
+	"circuitBreaker":             authorization.CircuitBreakerRealm,
+	"networkTime":                authorization.NetworkTimeRealm,
+	"generalInfo":                authorization.GeneralInfoRealm,
+	"endpointAccessControl":      authorization.EndpointAccessControlRealm,
+	"endpointAccessControlAdmin": authorization.EndpointAccessControlAdminRealm,
+	"eventLogReader":             authorization.EventLogReaderRealm,
+	"auditLog":                   authorization.AuditLogRealm,
+	"acl":                        authorization.ACLRealm,
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *Flags) printUsersUsage() string {
+	executable := filepath.Base(os.Args[0])
+	usage := "\nRemote Provisioning Client (RPC) - used for activation, deactivation, maintenance and status of AMT\n\n"
+	usage = usage + "Usage: " + executable + " users COMMAND [OPTIONS]\n\n"
+	usage = usage + "Supported Users Commands:\n"
+	usage = usage + "  list   Lists the AMT digest users. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " users list -json -password YourAMTPassword\n"
+	usage = usage + "  add    Adds digest users. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " users add -username monitor -access network -realms hardwareAsset,generalInfo -password YourAMTPassword\n"
+	usage = usage + "         Example: " + executable + " users add -config users.yaml -secrets secrets.yaml -password YourAMTPassword\n"
+	usage = usage + "  remove Removes digest users. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " users remove -username monitor -password YourAMTPassword\n"
+	usage = usage + "  update Replaces the access and realms of digest users, and the password when one is given. AMT password is required\n"
+	usage = usage + "         Example: " + executable + " users update -username monitor -access any -realms hardwareAsset -password YourAMTPassword\n"
+	usage = usage + "\nAccess: " + strings.Join(sortedKeys(UserAccessPermissions), ", ") + "\n"
+	usage = usage + "Realms: " + strings.Join(sortedKeys(UserRealms), ", ") + "\n"
+	usage = usage + "\nRun '" + executable + " users COMMAND -h' for more information on a command.\n"
+	fmt.Println(usage)
+	return usage
+}
+
+func (f *Flags) handleUsersCommand() utils.ReturnCode {
+	if len(f.commandLineArgs) == 2 {
+		f.printUsersUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	f.SubCommand = f.commandLineArgs[2]
+	fs := f.NewLocalWsmanFlagSet(f.SubCommand)
+	var rc utils.ReturnCode
+	switch f.SubCommand {
+	case utils.SubCommandUsersList:
+		rc = f.parseAndCheckArgCount(fs, 3, 0)
+	case utils.SubCommandUsersAdd, utils.SubCommandUsersRemove, utils.SubCommandUsersUpdate:
+		f.addDryRunFlag(fs)
+		rc = f.handleUsersConfig(fs)
+	default:
+		f.printUsersUsage()
+		return utils.IncorrectCommandLineParameters
+	}
+	if rc != utils.Success {
+		return rc
+	}
+	if f.Password == "" {
+		if _, rc = f.ReadPasswordFromUser(); rc != utils.Success {
+			return utils.MissingOrIncorrectPassword
+		}
+	}
+	// runs locally
+	f.Local = true
+	return utils.Success
+}
+
+func (f *Flags) handleUsersConfig(fs *flag.FlagSet) utils.ReturnCode {
+	var configJson string
+	var secretsFilePath string
+	var realms string
+	userCfg := config.UserConfig{}
+	fs.StringVar(&f.configContent, "config", "", "specify a config file or smb: file share URL")
+	fs.StringVar(&configJson, "configJson", "", "configuration as a JSON string")
+	fs.StringVar(&secretsFilePath, "secrets", "", "specify a secrets file ")
+	fs.StringVar(&userCfg.Username, "username", "", "digest user name")
+	fs.StringVar(&userCfg.Password, "userPassword", f.lookupEnvOrString("AMT_USER_PASSWORD", ""), "digest user password")
+	fs.StringVar(&userCfg.AccessPermission, "access", "", "access permission ("+strings.Join(sortedKeys(UserAccessPermissions), ", ")+")")
+	fs.StringVar(&realms, "realms", "", "comma separated realms the user can access")
+	rc := f.parseAndCheckArgCount(fs, 3, 1)
+	if rc != utils.Success {
+		return rc
+	}
+	rc = f.handleLocalConfig()
+	if rc != utils.Success {
+		return rc
+	}
+	if configJson != "" {
+		err := json.Unmarshal([]byte(configJson), &f.LocalConfig)
+		if err != nil {
+			log.Error(err)
+			return utils.IncorrectCommandLineParameters
+		}
+	}
+	if userCfg.Username != "" {
+		if realms != "" {
+			userCfg.Realms = strings.Split(realms, ",")
+		}
+		f.LocalConfig.Users = append(f.LocalConfig.Users, userCfg)
+	}
+	if len(f.LocalConfig.Users) == 0 {
+		log.Error("missing user configuration, use -username or -config")
+		return utils.MissingOrInvalidConfiguration
+	}
+	if secretsFilePath != "" {
+		var secretConfig config.SecretConfig
+		err := cleanenv.ReadConfig(secretsFilePath, &secretConfig)
+		if err != nil {
+			log.Error("error reading secrets file: ", err)
+			return utils.FailedReadingConfiguration
+		}
+		f.mergeUserSecrets(secretConfig)
+	}
+	if f.SubCommand == utils.SubCommandUsersAdd {
+		for i := range f.LocalConfig.Users {
+			item := &f.LocalConfig.Users[i]
+			if item.Password == "" {
+				rc = f.PromptUserInput("Please enter password for "+item.Username+": ", &item.Password)
+				if rc != utils.Success {
+					return rc
+				}
+			}
+		}
+	}
+	return f.verifyUserConfigurations()
+}
+
+func (f *Flags) mergeUserSecrets(secretConfig config.SecretConfig) {
+	for _, secret := range secretConfig.Secrets {
+		if secret.Username == "" || secret.Password == "" {
+			continue
+		}
+		for i := range f.LocalConfig.Users {
+			item := &f.LocalConfig.Users[i]
+			if item.Username == secret.Username {
+				item.Password = secret.Password
+			}
+		}
+	}
+}
+
+func (f *Flags) verifyUserConfigurations() utils.ReturnCode {
+	usernames := make(map[string]bool)
+	for _, cfg := range f.LocalConfig.Users {
+		if cfg.Username == "" || len(cfg.Username) > maxUsernameLength || strings.Contains(cfg.Username, ":") {
+			log.Errorf("invalid username %q, expected 1 to %d characters without ':'", cfg.Username, maxUsernameLength)
+			return utils.MissingOrInvalidConfiguration
+		}
+		if usernames[cfg.Username] {
+			log.Error("duplicate username: ", cfg.Username)
+			return utils.MissingOrInvalidConfiguration
+		}
+		usernames[cfg.Username] = true
+		// remove only needs to know the user
+		if f.SubCommand == utils.SubCommandUsersRemove {
+			continue
+		}
+		if _, ok := UserAccessPermissions[cfg.AccessPermission]; !ok {
+			log.Errorf("invalid access permission %q for %s, expected one of %s", cfg.AccessPermission, cfg.Username, strings.Join(sortedKeys(UserAccessPermissions), ", "))
+			return utils.MissingOrInvalidConfiguration
+		}
+		if len(cfg.Realms) == 0 {
+			log.Error("missing realms for ", cfg.Username)
+			return utils.MissingOrInvalidConfiguration
+		}
+		for _, realm := range cfg.Realms {
+			if _, ok := UserRealms[realm]; !ok {
+				log.Errorf("invalid realm %q for %s, expected one of %s", realm, cfg.Username, strings.Join(sortedKeys(UserRealms), ", "))
+				return utils.MissingOrInvalidConfiguration
+			}
+		}
+	}
+	return utils.Success
+}
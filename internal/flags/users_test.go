@@ -0,0 +1,118 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleUsersCommand(t *testing.T) {
+	t.Run("accepts list", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "list", "-password", "P@ssw0rd", "-json"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, true, f.Local)
+		assert.Equal(t, utils.CommandUsers, f.Command)
+		assert.Equal(t, utils.SubCommandUsersList, f.SubCommand)
+		assert.Equal(t, true, f.JsonOutput)
+	})
+	t.Run("accepts add from the command line", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "add", "-password", "P@ssw0rd",
+			"-username", "monitor", "-userPassword", "Us3r!Pass", "-access", "network", "-realms", "hardwareAsset,generalInfo"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, config.UserConfigs{{
+			Username:         "monitor",
+			Password:         "Us3r!Pass",
+			AccessPermission: "network",
+			Realms:           []string{"hardwareAsset", "generalInfo"},
+		}}, f.LocalConfig.Users)
+	})
+	t.Run("accepts add from the config and secrets files", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "add", "-password", "P@ssw0rd",
+			"-config", "../../config.yaml", "-secrets", "../../secrets.yaml"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Len(t, f.LocalConfig.Users, 1)
+		assert.Equal(t, "monitor", f.LocalConfig.Users[0].Username)
+		assert.Equal(t, "secretUSER_PASSWORD", f.LocalConfig.Users[0].Password)
+		assert.Equal(t, []string{"hardwareAsset", "generalInfo", "eventLogReader"}, f.LocalConfig.Users[0].Realms)
+	})
+	t.Run("prompts for the user password on add", func(t *testing.T) {
+		defer userInput(t, "Us3r!Pass")()
+		f := NewFlags([]string{"rpc", "users", "add", "-password", "P@ssw0rd",
+			"-configJson", `{"Users":[{"Username":"monitor","AccessPermission":"any","Realms":["auditLog"]}]}`})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "Us3r!Pass", f.LocalConfig.Users[0].Password)
+	})
+	t.Run("keeps the password empty on update", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "update", "-password", "P@ssw0rd",
+			"-username", "monitor", "-access", "local", "-realms", "redirection"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, "", f.LocalConfig.Users[0].Password)
+	})
+	t.Run("accepts remove with only a username", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "remove", "-password", "P@ssw0rd", "-username", "monitor"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.Success, result)
+		assert.Equal(t, utils.SubCommandUsersRemove, f.SubCommand)
+	})
+	t.Run("rejects missing action", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects unknown action", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "rename", "-password", "P@ssw0rd"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, result)
+	})
+	t.Run("rejects remove without users", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "remove", "-password", "P@ssw0rd"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, result)
+	})
+	t.Run("rejects a missing secrets file", func(t *testing.T) {
+		f := NewFlags([]string{"rpc", "users", "remove", "-password", "P@ssw0rd", "-username", "monitor", "-secrets", "missing.yaml"})
+		result := f.ParseFlags()
+		assert.Equal(t, utils.FailedReadingConfiguration, result)
+	})
+}
+
+func TestVerifyUserConfigurations(t *testing.T) {
+	valid := config.UserConfig{Username: "monitor", Password: "Us3r!Pass", AccessPermission: "any", Realms: []string{"hardwareAsset"}}
+	tests := map[string]struct {
+		subCommand string
+		users      config.UserConfigs
+		want       utils.ReturnCode
+	}{
+		"valid user": {utils.SubCommandUsersAdd, config.UserConfigs{valid}, utils.Success},
+		"username too long": {utils.SubCommandUsersAdd, config.UserConfigs{
+			{Username: "monitoringaccount", AccessPermission: "any", Realms: []string{"hardwareAsset"}},
+		}, utils.MissingOrInvalidConfiguration},
+		"username with colon": {utils.SubCommandUsersRemove, config.UserConfigs{{Username: "mon:itor"}}, utils.MissingOrInvalidConfiguration},
+		"duplicate username":  {utils.SubCommandUsersAdd, config.UserConfigs{valid, valid}, utils.MissingOrInvalidConfiguration},
+		"invalid access": {utils.SubCommandUsersUpdate, config.UserConfigs{
+			{Username: "monitor", AccessPermission: "everywhere", Realms: []string{"hardwareAsset"}},
+		}, utils.MissingOrInvalidConfiguration},
+		"missing realms": {utils.SubCommandUsersAdd, config.UserConfigs{
+			{Username: "monitor", AccessPermission: "local"},
+		}, utils.MissingOrInvalidConfiguration},
+		"invalid realm": {utils.SubCommandUsersAdd, config.UserConfigs{
+			{Username: "monitor", AccessPermission: "local", Realms: []string{"localSystem"}},
+		}, utils.MissingOrInvalidConfiguration},
+		"remove ignores access and realms": {utils.SubCommandUsersRemove, config.UserConfigs{{Username: "monitor"}}, utils.Success},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := Flags{}
+			f.SubCommand = tc.subCommand
+			f.LocalConfig.Users = tc.users
+			assert.Equal(t, tc.want, f.verifyUserConfigurations())
+		})
+	}
+}
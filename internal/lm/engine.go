@@ -9,17 +9,27 @@ import (
 	"encoding/binary"
 	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
 	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// lmeResponseTimeout is how long Listen waits for more data before it hands over
+// a response that neither its HTTP framing nor AMT closing the channel ended
+var lmeResponseTimeout = 30 * time.Second
+
 // LMConnection is struct for managing connection to LMS
 type LMEConnection struct {
 	Command    pthi.Command
 	Session    *apf.LMESession
 	ourChannel int
 	retries    int
+	// lock guards Session.Tempdata, framer and respond, which are shared by
+	// every Listen loop reading from the device and the fallback timer
+	lock    sync.Mutex
+	framer  httpFramer
+	respond func()
 }
 
 func NewLMEConnection(data chan []byte, errors chan error, status chan bool) *LMEConnection {
@@ -32,6 +42,7 @@ func NewLMEConnection(data chan []byte, errors chan error, status chan bool) *LM
 		ErrorBuffer: errors,
 		Tempdata:    []byte{},
 		Status:      status,
+		Channels:    apf.NewSessionTable(),
 	}
 
 	return lme
@@ -59,16 +70,15 @@ func (lme *LMEConnection) Initialize() error {
 // Connect initializes connection to LME via MEI Driver
 func (lme *LMEConnection) Connect() error {
 	log.Debug("Sending APF_CHANNEL_OPEN")
-	channel := ((lme.ourChannel + 1) % 32)
-	if channel == 0 {
-		lme.ourChannel = 1
-	} else {
-		lme.ourChannel = channel
+	if lme.Session.Channels == nil {
+		lme.Session.Channels = apf.NewSessionTable()
 	}
+	lme.ourChannel = int(lme.Session.Channels.Open().ID)
 
 	bin_buf := apf.ChannelOpen(lme.ourChannel)
 	err := lme.Command.Send(bin_buf.Bytes(), uint32(bin_buf.Len()))
 	if err != nil {
+		lme.Session.Channels.Remove(uint32(lme.ourChannel))
 		lme.retries = lme.retries + 1
 		if lme.retries < 3 && (err.Error() == "no such device" || err.Error() == "The device is not connected.") {
 			log.Warn(err.Error())
@@ -87,20 +97,36 @@ func (lme *LMEConnection) Connect() error {
 	return nil
 }
 
-// Send writes data to LMS TCP Socket
+// Send writes data to the open channel, splitting it to fit the MEI buffer and the window AMT granted
 func (lme *LMEConnection) Send(data []byte) error {
 	log.Debug("sending message to LME")
-	var bin_buf bytes.Buffer
-
-	channelData := apf.ChannelData(lme.Session.SenderChannel, data)
-	binary.Write(&bin_buf, binary.BigEndian, channelData.MessageType)
-	binary.Write(&bin_buf, binary.BigEndian, channelData.RecipientChannel)
-	binary.Write(&bin_buf, binary.BigEndian, channelData.DataLength)
-	binary.Write(&bin_buf, binary.BigEndian, channelData.Data)
-	lme.Session.TXWindow -= lme.Session.TXWindow // hmmm
-	err := lme.Command.Send(bin_buf.Bytes(), uint32(bin_buf.Len()))
-	if err != nil {
-		return err
+	send := func(message []byte) error {
+		return lme.Command.Send(message, uint32(len(message)))
+	}
+	maxPayload := int(lme.Command.Heci.GetBufferSize()) - apf.APF_CHANNEL_DATA_HEADER_SIZE
+	var channel *apf.Channel
+	if lme.Session.Channels != nil {
+		channel = lme.Session.Channels.Get(uint32(lme.ourChannel))
+	}
+	if channel != nil {
+		err := channel.Send(data, maxPayload, nil, send)
+		if err != nil {
+			return err
+		}
+		log.Debug("sent message to LME")
+		return nil
+	}
+	// the channel was not opened through the session table so AMT's window is unknown
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxPayload {
+			n = maxPayload
+		}
+		err := send(apf.EncodeChannelData(apf.ChannelData(lme.Session.SenderChannel, data[:n])))
+		if err != nil {
+			return err
+		}
+		data = data[n:]
 	}
 	log.Debug("sent message to LME")
 	return nil
@@ -124,29 +150,48 @@ func (lme *LMEConnection) execute(bin_buf bytes.Buffer) error {
 	return nil
 }
 
-// Listen reads data from the LMS socket connection
+// Listen reads data from AMT and hands the response to DataBuffer as soon as
+// it is complete, or once no more data arrived within lmeResponseTimeout
 func (lme *LMEConnection) Listen() {
+	var once sync.Once
+	responded := make(chan struct{})
+	respond := func() {
+		once.Do(func() {
+			close(responded)
+			lme.lock.Lock()
+			data := lme.Session.Tempdata
+			if length, ok := lme.framer.feed(data); ok {
+				data = data[:length]
+			}
+			lme.Session.Tempdata = []byte{}
+			lme.framer.reset()
+			lme.lock.Unlock()
+			lme.Session.DataBuffer <- data
+
+			var bin_buf bytes.Buffer
+			channelData := apf.ChannelClose(lme.Session.SenderChannel)
+			binary.Write(&bin_buf, binary.BigEndian, channelData.MessageType)
+			binary.Write(&bin_buf, binary.BigEndian, channelData.RecipientChannel)
+
+			lme.Command.Send(bin_buf.Bytes(), uint32(bin_buf.Len()))
+			if lme.Session.Channels != nil {
+				lme.Session.Channels.Remove(uint32(lme.ourChannel))
+			}
+			lme.Session.Status <- true
+		})
+	}
+	timer := time.NewTimer(lmeResponseTimeout)
+	lme.lock.Lock()
+	lme.respond = respond
+	lme.Session.Timer = timer
+	lme.lock.Unlock()
 	go func() {
-		lme.Session.Timer = time.NewTimer(2 * time.Second)
-		<-lme.Session.Timer.C
-		lme.Session.DataBuffer <- lme.Session.Tempdata
-		lme.Session.Tempdata = []byte{}
-		var bin_buf bytes.Buffer
-		// var windowAdjust apf.APF_CHANNEL_WINDOW_ADJUST_MESSAGE
-		// if lme.Session.RXWindow > 1024 { // TODO: Check this
-		// 	windowAdjust = apf.ChannelWindowAdjust(lme.Session.RecipientChannel, lme.Session.RXWindow)
-		// 	lme.Session.RXWindow = 0
-		// 	binary.Write(&bin_buf, binary.BigEndian, windowAdjust.MessageType)
-		// 	binary.Write(&bin_buf, binary.BigEndian, windowAdjust.RecipientChannel)
-		// 	lme.Command.Call(bin_buf.Bytes(), uint32(bin_buf.Len()))
-		// }
-
-		channelData := apf.ChannelClose(lme.Session.SenderChannel)
-		binary.Write(&bin_buf, binary.BigEndian, channelData.MessageType)
-		binary.Write(&bin_buf, binary.BigEndian, channelData.RecipientChannel)
-
-		lme.Command.Send(bin_buf.Bytes(), uint32(bin_buf.Len()))
-		lme.Session.Status <- true
+		select {
+		case <-timer.C:
+			respond()
+		case <-responded:
+			timer.Stop()
+		}
 	}()
 	for {
 
@@ -155,14 +200,41 @@ func (lme *LMEConnection) Listen() {
 			log.Trace("NO MORE DATA TO READ")
 			break
 		} else {
-			result := apf.Process(result2, lme.Session)
+			var result bytes.Buffer
+			var pending func()
+			complete := false
+			if result2[0] == apf.APF_CHANNEL_DATA {
+				// an earlier Listen may still be reading, so the pending response is taken from lme rather than this call
+				lme.lock.Lock()
+				result = apf.Process(result2[:bytesRead], lme.Session)
+				pending = lme.respond
+				_, complete = lme.framer.feed(lme.Session.Tempdata)
+				if !complete && lme.Session.Timer != nil {
+					lme.Session.Timer.Reset(lmeResponseTimeout)
+				}
+				lme.lock.Unlock()
+			} else {
+				// other messages may block on Status or ErrorBuffer until the executor reads them
+				result = apf.Process(result2[:bytesRead], lme.Session)
+				if result2[0] == apf.APF_CHANNEL_CLOSE && bytesRead >= 5 && binary.BigEndian.Uint32(result2[1:5]) == uint32(lme.ourChannel) {
+					// AMT closing the channel ends responses that have no HTTP framing
+					lme.lock.Lock()
+					pending = lme.respond
+					lme.lock.Unlock()
+					complete = true
+				}
+			}
 			if result.Len() != 0 {
-				err2 = lme.execute(result)
+				// replies such as window adjusts are sent without waiting, the next message is read by this loop
+				err2 = lme.Command.Send(result.Bytes(), uint32(result.Len()))
 				if err2 != nil {
 					log.Trace(err2)
 				}
 				log.Trace(result)
 			}
+			if complete && pending != nil {
+				pending()
+			}
 		}
 	}
 }
@@ -171,8 +243,10 @@ func (lme *LMEConnection) Listen() {
 func (lme *LMEConnection) Close() error {
 	log.Debug("closing connection to lme")
 	lme.Command.Close()
+	lme.lock.Lock()
 	if lme.Session.Timer != nil {
 		lme.Session.Timer.Stop()
 	}
+	lme.lock.Unlock()
 	return nil
 }
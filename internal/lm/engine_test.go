@@ -5,10 +5,17 @@
 package lm
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
+	"github.com/jc-lab/intel-amt-host-api/pkg/heci/emulator"
 	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -163,6 +170,92 @@ func Test_Listen(t *testing.T) {
 	go lme.Listen()
 }
 
+func Test_ListenDeliversCompleteResponse(t *testing.T) {
+	fw := emulator.NewFirmware(emulator.DefaultState())
+	fw.ReadTimeout = time.Second
+	// larger than the receive window so the response arrives over several window adjusts
+	body := strings.Repeat("x", 10000)
+	fw.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	})
+	lmDataChannel := make(chan []byte)
+	lmStatusChannel := make(chan bool)
+	lme := &LMEConnection{
+		Command: pthi.Command{Heci: fw.NewDevice()},
+		Session: &apf.LMESession{
+			DataBuffer:  lmDataChannel,
+			ErrorBuffer: make(chan error),
+			Tempdata:    []byte{},
+			Status:      lmStatusChannel,
+			Channels:    apf.NewSessionTable(),
+		},
+	}
+	defer lme.Close()
+	assert.NoError(t, lme.Initialize())
+	assert.NoError(t, lme.Connect())
+	go lme.Listen()
+	<-lmStatusChannel
+
+	assert.NoError(t, lme.Send([]byte("GET /wsman HTTP/1.1\r\nHost: localhost\r\n\r\n")))
+	select {
+	case data := <-lmDataChannel:
+		assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 200 OK\r\n"))
+		assert.True(t, strings.HasSuffix(string(data), "\r\n\r\n"+body))
+	case <-time.After(lmeResponseTimeout / 2):
+		t.Fatal("response was not delivered before the fallback timeout")
+	}
+	<-lmStatusChannel
+	assert.Equal(t, 0, lme.Session.Channels.Len())
+}
+
+// scriptedHECI returns the queued messages in order and then no data
+type scriptedHECI struct {
+	MockHECICommands
+	messages [][]byte
+}
+
+func (c *scriptedHECI) GetBufferSize() uint32 { return 5120 }
+func (c *scriptedHECI) SendMessage(buffer []byte, done *uint32) (bytesWritten uint32, err error) {
+	return uint32(len(buffer)), nil
+}
+func (c *scriptedHECI) ReceiveMessage(buffer []byte, done *uint32) (bytesRead uint32, err error) {
+	if len(c.messages) == 0 {
+		return 0, nil
+	}
+	n := copy(buffer, c.messages[0])
+	c.messages = c.messages[1:]
+	return uint32(n), nil
+}
+
+func Test_ListenDeliversCloseDelimitedResponse(t *testing.T) {
+	response := "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nhello"
+	var closeMessage bytes.Buffer
+	binary.Write(&closeMessage, binary.BigEndian, apf.ChannelClose(1))
+	heci := &scriptedHECI{messages: [][]byte{
+		apf.EncodeChannelData(apf.ChannelData(1, []byte(response))),
+		closeMessage.Bytes(),
+	}}
+	lmDataChannel := make(chan []byte)
+	lme := &LMEConnection{
+		Command: pthi.Command{Heci: heci},
+		Session: &apf.LMESession{
+			DataBuffer:  lmDataChannel,
+			ErrorBuffer: make(chan error),
+			Tempdata:    []byte{},
+			Status:      make(chan bool, 1),
+		},
+		ourChannel: 1,
+	}
+	defer lme.Close()
+	go lme.Listen()
+	select {
+	case data := <-lmDataChannel:
+		assert.Equal(t, response, string(data))
+	case <-time.After(lmeResponseTimeout / 2):
+		t.Fatal("the channel close did not end the response")
+	}
+}
+
 func Test_Close(t *testing.T) {
 	resetMock()
 	lme := &LMEConnection{
@@ -0,0 +1,145 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package lm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event is a WS-Man event, such as a CIM_AlertIndication, that AMT delivered
+// for an event subscription
+type Event struct {
+	Time time.Time `json:"time"`
+	// Address is the delivery address of the subscription the event was sent to
+	Address   string `json:"address"`
+	Path      string `json:"path"`
+	Action    string `json:"action,omitempty"`
+	MessageID string `json:"messageId,omitempty"`
+	// Indication is the class of the event, the element name of the SOAP body
+	Indication string `json:"indication"`
+	// Properties holds the indication's properties. Array properties hold a []string.
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// EventHandler is a ChannelHandler that acknowledges the WS-Man event
+// deliveries AMT sends over its channels and passes each event to OnEvent
+type EventHandler struct {
+	OnEvent func(event Event)
+}
+
+func (h EventHandler) ServeChannel(request apf.ChannelOpenRequest, conn net.Conn) {
+	defer conn.Close()
+	address := net.JoinHostPort(request.ConnectedAddress, fmt.Sprint(request.ConnectedPort))
+	reader := bufio.NewReader(conn)
+	for {
+		httpRequest, err := http.ReadRequest(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Debug("reading event delivery: ", err)
+			}
+			return
+		}
+		body, err := io.ReadAll(httpRequest.Body)
+		status := http.StatusOK
+		if err == nil {
+			var event Event
+			event, err = ParseEvent(body)
+			if err == nil {
+				event.Address = address
+				event.Path = httpRequest.URL.Path
+				h.OnEvent(event)
+			}
+		}
+		if err != nil {
+			log.Warn("invalid event delivery: ", err)
+			status = http.StatusBadRequest
+		}
+		response := &http.Response{
+			StatusCode:    status,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Request:       httpRequest,
+			ContentLength: 0,
+			Close:         httpRequest.Close,
+		}
+		if err := response.Write(conn); err != nil || httpRequest.Close {
+			return
+		}
+	}
+}
+
+// ParseEvent reads the addressing headers and the indication in the body of a WS-Man event envelope
+func ParseEvent(body []byte) (Event, error) {
+	event := Event{
+		Time:       time.Now(),
+		Properties: map[string]interface{}{},
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	path := []string{}
+	var text strings.Builder
+	leaf := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return event, err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			path = append(path, element.Name.Local)
+			text.Reset()
+			leaf = true
+			if len(path) == 3 && path[1] == "Body" {
+				event.Indication = element.Name.Local
+			}
+		case xml.CharData:
+			text.Write(element)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			switch {
+			case len(path) == 3 && path[1] == "Header" && path[2] == "Action":
+				event.Action = value
+			case len(path) == 3 && path[1] == "Header" && path[2] == "MessageID":
+				event.MessageID = value
+			case len(path) == 4 && path[1] == "Body" && leaf:
+				addProperty(event.Properties, path[3], value)
+			}
+			path = path[:len(path)-1]
+			text.Reset()
+			leaf = false
+		}
+	}
+	if event.Indication == "" {
+		return event, errors.New("event has no indication in its body")
+	}
+	return event, nil
+}
+
+// addProperty stores value, turning properties that repeat into a []string
+func addProperty(properties map[string]interface{}, name string, value string) {
+	switch existing := properties[name].(type) {
+	case nil:
+		properties[name] = value
+	case string:
+		properties[name] = []string{existing, value}
+	case []string:
+		properties[name] = append(existing, value)
+	}
+}
@@ -0,0 +1,79 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package lm
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
+	"github.com/stretchr/testify/assert"
+)
+
+const alertIndication = `<?xml version="1.0" encoding="UTF-8"?>
+<a:Envelope xmlns:a="http://www.w3.org/2003/05/soap-envelope" xmlns:b="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:c="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd" xmlns:e="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_AlertIndication">
+<a:Header>
+<b:To>http://127.0.0.1:16997/events</b:To>
+<b:Action a:mustUnderstand="true">http://schemas.dmtf.org/wbem/wsman/1/wsman/Event</b:Action>
+<b:MessageID>uuid:00000000-8086-8086-8086-000000000042</b:MessageID>
+</a:Header>
+<a:Body>
+<e:CIM_AlertIndication>
+<e:AlertType>8</e:AlertType>
+<e:IndicationTime><c:Datetime>2024-01-02T03:04:05Z</c:Datetime></e:IndicationTime>
+<e:MessageArguments>0</e:MessageArguments>
+<e:MessageArguments>Intel(r) AMT</e:MessageArguments>
+<e:MessageID>iAMT0052</e:MessageID>
+<e:PerceivedSeverity>2</e:PerceivedSeverity>
+</e:CIM_AlertIndication>
+</a:Body>
+</a:Envelope>`
+
+func TestParseEvent(t *testing.T) {
+	event, err := ParseEvent([]byte(alertIndication))
+	assert.NoError(t, err)
+	assert.Equal(t, "CIM_AlertIndication", event.Indication)
+	assert.Equal(t, "http://schemas.dmtf.org/wbem/wsman/1/wsman/Event", event.Action)
+	assert.Equal(t, "uuid:00000000-8086-8086-8086-000000000042", event.MessageID)
+	assert.Equal(t, "iAMT0052", event.Properties["MessageID"])
+	assert.Equal(t, "2", event.Properties["PerceivedSeverity"])
+	assert.Equal(t, []string{"0", "Intel(r) AMT"}, event.Properties["MessageArguments"])
+	assert.NotContains(t, event.Properties, "IndicationTime")
+
+	_, err = ParseEvent([]byte("<a:Envelope xmlns:a=\"x\"><a:Body></a:Body></a:Envelope>"))
+	assert.Error(t, err)
+	_, err = ParseEvent([]byte("<a:Envelope"))
+	assert.Error(t, err)
+}
+
+func TestEventHandler(t *testing.T) {
+	events := make(chan Event, 1)
+	handler := EventHandler{OnEvent: func(event Event) { events <- event }}
+	local, remote := net.Pipe()
+	go handler.ServeChannel(apf.ChannelOpenRequest{ConnectedAddress: "127.0.0.1", ConnectedPort: 16997}, remote)
+	defer local.Close()
+	reader := bufio.NewReader(local)
+
+	t.Run("acknowledges events", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1:16997/events", strings.NewReader(alertIndication))
+		go request.Write(local)
+		event := <-events
+		assert.Equal(t, "127.0.0.1:16997", event.Address)
+		assert.Equal(t, "/events", event.Path)
+		response, err := http.ReadResponse(reader, request)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+	t.Run("rejects bodies that are not events", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1:16997/events", strings.NewReader("hello"))
+		go request.Write(local)
+		response, err := http.ReadResponse(reader, request)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+}
@@ -0,0 +1,130 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package lm
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// httpFramer finds the end of an HTTP/1.1 response while its data arrives.
+// It keeps its place between calls so every byte is only looked at once.
+type httpFramer struct {
+	// headerEnd is the offset of the body, zero until the header is complete
+	headerEnd int
+	// scanned is how far the search for the end of the header got
+	scanned int
+	// bodyEnd is the end of a Content-Length body, -1 for chunked bodies
+	bodyEnd int
+	// cursor is the offset of the next chunk size line of a chunked body
+	cursor int
+	// closeDelimited is set when only the channel closing ends the response
+	closeDelimited bool
+	length         int
+}
+
+// feed takes the response received so far, which only ever grows, and
+// returns its length once it is complete. ok stays false for malformed
+// responses and for those delimited by the connection closing.
+func (f *httpFramer) feed(data []byte) (length int, ok bool) {
+	if f.length > 0 {
+		return f.length, true
+	}
+	if f.headerEnd == 0 && !f.readHeader(data) {
+		return 0, false
+	}
+	if f.closeDelimited {
+		return 0, false
+	}
+	if f.bodyEnd >= 0 {
+		if len(data) < f.bodyEnd {
+			return 0, false
+		}
+		f.length = f.bodyEnd
+		return f.length, true
+	}
+	return f.readChunks(data)
+}
+
+// reset prepares the framer for the next response
+func (f *httpFramer) reset() {
+	*f = httpFramer{}
+}
+
+func (f *httpFramer) readHeader(data []byte) bool {
+	start := f.scanned - 3
+	if start < 0 {
+		start = 0
+	}
+	end := bytes.Index(data[start:], []byte("\r\n\r\n"))
+	if end < 0 {
+		f.scanned = len(data)
+		return false
+	}
+	f.headerEnd = start + end + 4
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data[:f.headerEnd])), nil)
+	if err != nil {
+		f.closeDelimited = true
+		return true
+	}
+	response.Body.Close()
+	switch {
+	case isChunked(response.TransferEncoding):
+		f.bodyEnd = -1
+		f.cursor = f.headerEnd
+	case response.ContentLength >= 0:
+		f.bodyEnd = f.headerEnd + int(response.ContentLength)
+	case response.StatusCode == http.StatusNoContent || response.StatusCode == http.StatusNotModified:
+		f.bodyEnd = f.headerEnd
+	default:
+		f.closeDelimited = true
+	}
+	return true
+}
+
+func (f *httpFramer) readChunks(data []byte) (int, bool) {
+	for {
+		line := bytes.Index(data[f.cursor:], []byte("\r\n"))
+		if line < 0 {
+			return 0, false
+		}
+		sizeField, _, _ := strings.Cut(string(data[f.cursor:f.cursor+line]), ";")
+		size, err := strconv.ParseUint(strings.TrimSpace(sizeField), 16, 31)
+		if err != nil {
+			f.closeDelimited = true
+			return 0, false
+		}
+		next := f.cursor + line + 2
+		if size == 0 {
+			// the last chunk is followed by optional trailers and an empty line
+			if bytes.HasPrefix(data[next:], []byte("\r\n")) {
+				f.length = next + 2
+				return f.length, true
+			}
+			trailers := bytes.Index(data[next:], []byte("\r\n\r\n"))
+			if trailers < 0 {
+				return 0, false
+			}
+			f.length = next + trailers + 4
+			return f.length, true
+		}
+		if len(data) < next+int(size)+2 {
+			return 0, false
+		}
+		f.cursor = next + int(size) + 2
+	}
+}
+
+func isChunked(transferEncoding []string) bool {
+	for _, encoding := range transferEncoding {
+		if encoding == "chunked" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package lm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPFramer(t *testing.T) {
+	contentLength := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"
+	chunked := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6;ext=1\r\n world\r\n0\r\n\r\n"
+	trailers := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\nX-Trailer: 1\r\n\r\n"
+	tests := []struct {
+		name   string
+		data   string
+		length int
+		ok     bool
+	}{
+		{"empty", "", 0, false},
+		{"incomplete headers", "HTTP/1.1 200 OK\r\nContent-Len", 0, false},
+		{"content length", contentLength, len(contentLength), true},
+		{"incomplete content length body", contentLength[:len(contentLength)-1], 0, false},
+		{"trailing data", contentLength + "HTTP/1.1", len(contentLength), true},
+		{"chunked", chunked, len(chunked), true},
+		{"incomplete chunked body", chunked[:len(chunked)-2], 0, false},
+		{"chunked with trailers", trailers, len(trailers), true},
+		{"chunked trailing data", chunked + "HTTP/1.1", len(chunked), true},
+		{"no body", "HTTP/1.1 204 No Content\r\n\r\n", 27, true},
+		{"delimited by connection close", "HTTP/1.1 200 OK\r\n\r\nhello", 0, false},
+		{"not http", "hello", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var framer httpFramer
+			length, ok := framer.feed([]byte(tt.data))
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.length, length)
+		})
+		t.Run(tt.name+" a byte at a time", func(t *testing.T) {
+			var framer httpFramer
+			length, ok := 0, false
+			for i := 0; i <= len(tt.data) && !ok; i++ {
+				length, ok = framer.feed([]byte(tt.data[:i]))
+			}
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.length, length)
+		})
+	}
+}
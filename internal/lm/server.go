@@ -0,0 +1,600 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package lm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
+	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// time to wait for AMT to request the first port forward after the protocol version exchange
+var lmsHandshakeTimeout = 10 * time.Second
+
+// time a client waits for AMT to confirm its channel
+var lmsChannelOpenTimeout = 10 * time.Second
+
+// time a closed client waits for AMT to confirm the channel close before it is dropped
+var lmsChannelCloseTimeout = 10 * time.Second
+
+// ChannelHandler serves the channels AMT opens towards the host, such as
+// WS-Man event deliveries
+type ChannelHandler interface {
+	// ServeChannel is called on its own goroutine for every channel AMT opens.
+	// conn relays the channel data and closing it closes the channel.
+	ServeChannel(request apf.ChannelOpenRequest, conn net.Conn)
+}
+
+// ChannelHandlerFunc adapts a function to a ChannelHandler
+type ChannelHandlerFunc func(request apf.ChannelOpenRequest, conn net.Conn)
+
+func (f ChannelHandlerFunc) ServeChannel(request apf.ChannelOpenRequest, conn net.Conn) {
+	f(request, conn)
+}
+
+// LMSServer listens on the local AMT ports and relays every TCP client to
+// AMT through its own APF channel over the LME, the same way Intel's LMS
+// service does.
+type LMSServer struct {
+	Command pthi.Command
+	// Ports maps the AMT ports that may be forwarded to the local address
+	// they are served on
+	Ports map[uint32]string
+	// ChannelHandler accepts the channels AMT opens. They are refused when nil.
+	ChannelHandler ChannelHandler
+
+	sendLock  sync.Mutex // serializes writes to the MEI
+	lock      sync.Mutex // guards listeners and channels
+	listeners map[uint32]net.Listener
+	sessions  *apf.SessionTable
+	channels  map[uint32]*lmsChannel
+	forwarded chan uint32
+	done      chan struct{}
+	clients   sync.WaitGroup
+	reader    sync.WaitGroup
+}
+
+// lmsChannel is one TCP client, or one channel opened by AMT, relayed through an APF channel
+type lmsChannel struct {
+	*apf.Channel
+	port   uint32
+	conn   net.Conn
+	opened chan bool
+	// rx holds the data from AMT the writer has not taken yet, the receive
+	// window bounds it so queueing never blocks the reader
+	rx        [][]byte
+	rxReady   chan struct{}
+	lock      sync.Mutex
+	closeSent bool
+}
+
+func newLMSChannel(channel *apf.Channel, port uint32, conn net.Conn) *lmsChannel {
+	return &lmsChannel{
+		Channel: channel,
+		port:    port,
+		conn:    conn,
+		rxReady: make(chan struct{}, 1),
+	}
+}
+
+// queue hands data from AMT to the writer without waiting for it
+func (c *lmsChannel) queue(data []byte) {
+	c.lock.Lock()
+	c.rx = append(c.rx, data)
+	c.lock.Unlock()
+	select {
+	case c.rxReady <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the queued data from AMT and empties the queue
+func (c *lmsChannel) take() [][]byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	rx := c.rx
+	c.rx = nil
+	return rx
+}
+
+// NewLMSServer creates a server that serves AMT's 16992 and 16993 ports on the given address
+func NewLMSServer(address string) *LMSServer {
+	return &LMSServer{
+		Command: pthi.NewCommand(),
+		Ports: map[uint32]string{
+			16992: net.JoinHostPort(address, "16992"),
+			16993: net.JoinHostPort(address, "16993"),
+		},
+	}
+}
+
+// Start connects to the LME and negotiates the APF session. It returns once
+// AMT has requested at least one port to be forwarded.
+func (s *LMSServer) Start() error {
+	s.listeners = make(map[uint32]net.Listener)
+	s.sessions = apf.NewSessionTable()
+	s.channels = make(map[uint32]*lmsChannel)
+	s.forwarded = make(chan uint32, 1)
+	s.done = make(chan struct{})
+
+	err := s.Command.Open(true)
+	if err != nil {
+		return err
+	}
+	s.reader.Add(1)
+	go s.receive()
+
+	err = s.reply(apf.ProtocolVersion(1, 0, 9))
+	if err != nil {
+		s.Close()
+		return err
+	}
+	select {
+	case <-s.forwarded:
+		return nil
+	case <-s.done:
+		return errors.New("LME session closed during the APF handshake")
+	case <-time.After(lmsHandshakeTimeout):
+		s.Close()
+		return errors.New("timed out waiting for AMT to request port forwarding")
+	}
+}
+
+// Done is closed when the server stops, either from Close or because the LME connection was lost
+func (s *LMSServer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Addr returns the local address the AMT port is served on, or nil if AMT has not forwarded it
+func (s *LMSServer) Addr(port uint32) net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	listener, ok := s.listeners[port]
+	if !ok {
+		return nil
+	}
+	return listener.Addr()
+}
+
+// Close stops the listeners, drops every client and closes the LME connection
+func (s *LMSServer) Close() error {
+	s.lock.Lock()
+	select {
+	case <-s.done:
+		s.lock.Unlock()
+		return nil
+	default:
+	}
+	close(s.done)
+	for port, listener := range s.listeners {
+		listener.Close()
+		delete(s.listeners, port)
+	}
+	for _, channel := range s.channels {
+		channel.conn.Close()
+	}
+	s.lock.Unlock()
+
+	s.clients.Wait()
+	s.sendLock.Lock()
+	s.Command.Close()
+	s.sendLock.Unlock()
+	s.reader.Wait()
+	return nil
+}
+
+func (s *LMSServer) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *LMSServer) send(message []byte) error {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	if s.isClosed() {
+		return errors.New("lms server is closed")
+	}
+	return s.Command.Send(message, uint32(len(message)))
+}
+
+func (s *LMSServer) reply(message interface{}) error {
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.BigEndian, message)
+	return s.send(bin_buf.Bytes())
+}
+
+// receive reads APF messages from the LME until the server is closed
+func (s *LMSServer) receive() {
+	defer s.reader.Done()
+	for {
+		result, bytesRead, err := s.Command.Receive()
+		if s.isClosed() {
+			return
+		}
+		if err != nil {
+			log.Error("lost connection to LME: ", err)
+			go s.Close()
+			return
+		}
+		if bytesRead == 0 {
+			continue
+		}
+		s.process(result[:bytesRead])
+	}
+}
+
+func (s *LMSServer) process(message []byte) {
+	var err error
+	switch message[0] {
+	case apf.APF_PROTOCOLVERSION:
+		log.Debug("received APF_PROTOCOLVERSION")
+		err = s.reply(apf.ProcessProtocolVersion(message))
+	case apf.APF_SERVICE_REQUEST:
+		log.Debug("received APF_SERVICE_REQUEST")
+		accept := apf.ProcessServiceRequest(message)
+		if accept.MessageType == apf.APF_SERVICE_ACCEPT {
+			err = s.reply(accept)
+		}
+	case apf.APF_GLOBAL_REQUEST:
+		log.Debug("received APF_GLOBAL_REQUEST")
+		err = s.globalRequest(message)
+	case apf.APF_CHANNEL_OPEN:
+		log.Debug("received APF_CHANNEL_OPEN")
+		err = s.acceptChannel(message)
+	case apf.APF_CHANNEL_OPEN_CONFIRMATION:
+		log.Debug("received APF_CHANNEL_OPEN_CONFIRMATION")
+		confirmation := apf.APF_CHANNEL_OPEN_CONFIRMATION_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &confirmation)
+		// channels opened by AMT are already confirmed and have no opened channel
+		if channel := s.channel(confirmation.RecipientChannel); channel != nil && channel.opened != nil {
+			channel.Confirm(confirmation.SenderChannel, confirmation.InitialWindowSize)
+			channel.opened <- true
+		}
+	case apf.APF_CHANNEL_OPEN_FAILURE:
+		log.Debug("received APF_CHANNEL_OPEN_FAILURE")
+		failure := apf.APF_CHANNEL_OPEN_FAILURE_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &failure)
+		if channel := s.channel(failure.RecipientChannel); channel != nil && channel.opened != nil {
+			channel.opened <- false
+		}
+	case apf.APF_CHANNEL_DATA:
+		s.channelData(message)
+	case apf.APF_CHANNEL_WINDOW_ADJUST:
+		adjust := apf.APF_CHANNEL_WINDOW_ADJUST_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &adjust)
+		if channel := s.channel(adjust.RecipientChannel); channel != nil {
+			channel.AddTXWindow(adjust.BytesToAdd)
+		}
+	case apf.APF_CHANNEL_CLOSE:
+		log.Debug("received APF_CHANNEL_CLOSE")
+		closeMessage := apf.APF_CHANNEL_CLOSE_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &closeMessage)
+		err = s.remoteClose(closeMessage.RecipientChannel)
+	case apf.APF_DISCONNECT:
+		log.Warn("AMT disconnected the APF session")
+		go s.Close()
+	default:
+		log.Debug("ignoring APF message ", message[0])
+	}
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// globalRequest starts or stops serving a port when AMT asks for it to be forwarded
+func (s *LMSServer) globalRequest(message []byte) error {
+	header, request := apf.ParseGlobalRequest(message)
+	switch header.String {
+	case apf.APF_GLOBAL_REQUEST_STR_TCP_FORWARD_REQUEST:
+		err := s.listen(request.Port)
+		if err != nil {
+			log.Warn(err)
+			if request.WantReply == 0 {
+				return nil
+			}
+			return s.reply(uint8(apf.APF_REQUEST_FAILURE))
+		}
+		select {
+		case s.forwarded <- request.Port:
+		default:
+		}
+		if request.WantReply == 0 {
+			return nil
+		}
+		return s.reply(apf.TcpForwardReplySuccess(request.Port))
+	case apf.APF_GLOBAL_REQUEST_STR_TCP_FORWARD_CANCEL_REQUEST:
+		s.lock.Lock()
+		if listener, ok := s.listeners[request.Port]; ok {
+			listener.Close()
+			delete(s.listeners, request.Port)
+		}
+		s.lock.Unlock()
+		if request.WantReply == 0 {
+			return nil
+		}
+		return s.reply(uint8(apf.APF_REQUEST_SUCCESS))
+	default:
+		if request.WantReply == 0 {
+			return nil
+		}
+		return s.reply(uint8(apf.APF_REQUEST_FAILURE))
+	}
+}
+
+func (s *LMSServer) listen(port uint32) error {
+	address, ok := s.Ports[port]
+	if !ok {
+		return fmt.Errorf("AMT requested port %d which is not served", port)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.isClosed() {
+		return errors.New("lms server is closed")
+	}
+	if _, ok := s.listeners[port]; ok {
+		return nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	log.Info("forwarding ", listener.Addr().String(), " to AMT port ", port)
+	s.listeners[port] = listener
+	s.clients.Add(1)
+	go s.accept(listener, port)
+	return nil
+}
+
+func (s *LMSServer) accept(listener net.Listener, port uint32) {
+	defer s.clients.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		s.clients.Add(1)
+		go s.serve(conn, port)
+	}
+}
+
+// serve opens a channel for the TCP client and relays it until the client disconnects
+func (s *LMSServer) serve(conn net.Conn, port uint32) {
+	defer s.clients.Done()
+	channel, err := s.openChannel(conn, port)
+	if err != nil {
+		log.Warn(err)
+		conn.Close()
+		return
+	}
+	s.relay(channel)
+}
+
+// relay copies data from the channel's connection to AMT until it is closed
+func (s *LMSServer) relay(channel *lmsChannel) {
+	conn := channel.conn
+	s.clients.Add(1)
+	go s.write(channel)
+
+	buf := make([]byte, s.maxPayload())
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if sendErr := channel.Send(buf[:n], s.maxPayload(), s.done, s.send); sendErr != nil {
+				log.Debug(sendErr)
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	s.localClose(channel)
+}
+
+func (s *LMSServer) openChannel(conn net.Conn, port uint32) (*lmsChannel, error) {
+	s.lock.Lock()
+	if s.isClosed() {
+		s.lock.Unlock()
+		return nil, errors.New("lms server is closed")
+	}
+	channel := newLMSChannel(s.sessions.Open(), port, conn)
+	channel.opened = make(chan bool, 1)
+	s.channels[channel.ID] = channel
+	s.lock.Unlock()
+
+	open := apf.ChannelOpenPort(int(channel.ID), port)
+	err := s.send(open.Bytes())
+	if err == nil {
+		select {
+		case ok := <-channel.opened:
+			if ok {
+				return channel, nil
+			}
+			err = fmt.Errorf("AMT refused to open a channel to port %d", port)
+		case <-time.After(lmsChannelOpenTimeout):
+			err = fmt.Errorf("timed out opening a channel to port %d", port)
+		case <-s.done:
+			err = errors.New("lms server is closed")
+		}
+	}
+	s.removeChannel(channel)
+	return nil, err
+}
+
+// acceptChannel hands a channel opened by AMT to the ChannelHandler
+func (s *LMSServer) acceptChannel(message []byte) error {
+	request, err := apf.ParseChannelOpen(message)
+	if err != nil {
+		return err
+	}
+	if request.ChannelType != apf.APF_OPEN_CHANNEL_REQUEST_FORWARDED && request.ChannelType != apf.APF_OPEN_CHANNEL_REQUEST_DIRECT {
+		return s.reply(apf.ChannelOpenReplyFailure(request.SenderChannel, apf.OPEN_FAILURE_REASON_UNKNOWN_CHANNEL_TYPE))
+	}
+	if s.ChannelHandler == nil {
+		log.Debug("refusing channel to ", net.JoinHostPort(request.ConnectedAddress, fmt.Sprint(request.ConnectedPort)))
+		return s.reply(apf.ChannelOpenReplyFailure(request.SenderChannel, apf.OPEN_FAILURE_REASON_ADMINISTRATIVELY_PROHIBITED))
+	}
+
+	local, remote := net.Pipe()
+	s.lock.Lock()
+	if s.isClosed() {
+		s.lock.Unlock()
+		return errors.New("lms server is closed")
+	}
+	channel := newLMSChannel(s.sessions.Open(), request.ConnectedPort, local)
+	channel.Confirm(request.SenderChannel, request.InitialWindowSize)
+	s.channels[channel.ID] = channel
+	// registered with the lock held so Close waits for the handler
+	s.clients.Add(2)
+	s.lock.Unlock()
+
+	err = s.reply(apf.ChannelOpenReplySuccess(request.SenderChannel, channel.ID))
+	if err != nil {
+		s.removeChannel(channel)
+		local.Close()
+		remote.Close()
+		s.clients.Add(-2)
+		return err
+	}
+	go func() {
+		defer s.clients.Done()
+		s.relay(channel)
+	}()
+	go func() {
+		defer s.clients.Done()
+		s.ChannelHandler.ServeChannel(request, remote)
+	}()
+	return nil
+}
+
+func (s *LMSServer) channel(id uint32) *lmsChannel {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.channels[id]
+}
+
+func (s *LMSServer) removeChannel(channel *lmsChannel) {
+	s.lock.Lock()
+	delete(s.channels, channel.ID)
+	s.lock.Unlock()
+	s.sessions.Remove(channel.ID)
+}
+
+// maxPayload is the largest channel data that fits in a single MEI message
+func (s *LMSServer) maxPayload() int {
+	size := int(s.Command.Heci.GetBufferSize()) - apf.APF_CHANNEL_DATA_HEADER_SIZE
+	if size <= 0 {
+		size = apf.LME_RX_WINDOW_SIZE
+	}
+	return size
+}
+
+func (s *LMSServer) channelData(message []byte) {
+	if len(message) < 9 {
+		return
+	}
+	recipientChannel := binary.BigEndian.Uint32(message[1:5])
+	dataLength := binary.BigEndian.Uint32(message[5:9])
+	if int(dataLength) > len(message)-apf.APF_CHANNEL_DATA_HEADER_SIZE {
+		log.Warn("truncated APF_CHANNEL_DATA message")
+		return
+	}
+	channel := s.channel(recipientChannel)
+	if channel == nil {
+		return
+	}
+	if !channel.Received(dataLength) {
+		// the queue is only bounded while AMT keeps to the window
+		log.Warn("AMT exceeded the receive window on channel ", recipientChannel, ", closing it")
+		channel.conn.Close()
+		return
+	}
+	data := make([]byte, dataLength)
+	copy(data, message[apf.APF_CHANNEL_DATA_HEADER_SIZE:])
+	channel.queue(data)
+}
+
+// write relays data from AMT to the TCP client, returning the window to
+// AMT as the client consumes it
+func (s *LMSServer) write(channel *lmsChannel) {
+	defer s.clients.Done()
+	defer channel.conn.Close()
+	failed := false
+	for {
+		select {
+		case <-channel.rxReady:
+			for _, data := range channel.take() {
+				if !failed {
+					if _, err := channel.conn.Write(data); err != nil {
+						// keep taking the data so AMT's window is still returned
+						failed = true
+						channel.conn.Close()
+					}
+				}
+				if bytesToAdd := channel.Consumed(uint32(len(data))); bytesToAdd > 0 {
+					s.reply(apf.ChannelWindowAdjust(channel.RemoteChannel(), bytesToAdd))
+				}
+			}
+		case <-channel.Closed():
+			if !failed {
+				for _, data := range channel.take() {
+					channel.conn.Write(data)
+				}
+			}
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// localClose tells AMT the client has gone. The channel is released once
+// AMT confirms, or after lmsChannelCloseTimeout if it never does.
+func (s *LMSServer) localClose(channel *lmsChannel) {
+	channel.lock.Lock()
+	sendClose := !channel.closeSent
+	channel.closeSent = true
+	channel.lock.Unlock()
+	if sendClose {
+		s.reply(apf.ChannelClose(channel.RemoteChannel()))
+	}
+	select {
+	case <-channel.Closed():
+	case <-time.After(lmsChannelCloseTimeout):
+		log.Warn("AMT did not confirm closing channel ", channel.ID)
+		s.removeChannel(channel)
+	case <-s.done:
+	}
+}
+
+// remoteClose handles AMT closing a channel, or confirming our close
+func (s *LMSServer) remoteClose(id uint32) error {
+	channel := s.channel(id)
+	if channel == nil {
+		return nil
+	}
+	channel.lock.Lock()
+	sendClose := !channel.closeSent
+	channel.closeSent = true
+	channel.lock.Unlock()
+	s.removeChannel(channel)
+	if sendClose {
+		return s.reply(apf.ChannelClose(channel.RemoteChannel()))
+	}
+	return nil
+}
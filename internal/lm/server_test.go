@@ -0,0 +1,211 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package lm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
+	"github.com/jc-lab/intel-amt-host-api/pkg/heci/emulator"
+	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLMSServer(t *testing.T, handler http.Handler) *LMSServer {
+	fw := emulator.NewFirmware(emulator.DefaultState())
+	fw.ReadTimeout = 10 * time.Millisecond
+	fw.Handler = handler
+	server := &LMSServer{
+		Command: pthi.Command{Heci: fw.NewDevice()},
+		Ports: map[uint32]string{
+			16992: "127.0.0.1:0",
+			16993: "127.0.0.1:0",
+		},
+	}
+	assert.NoError(t, server.Start())
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestLMSServer(t *testing.T) {
+	server := newTestLMSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %d %s", r.URL.Path, len(body), strings.Repeat("x", 5000))
+	}))
+
+	t.Run("serves both forwarded ports", func(t *testing.T) {
+		assert.NotNil(t, server.Addr(16992))
+		assert.Eventually(t, func() bool { return server.Addr(16993) != nil }, time.Second, 10*time.Millisecond)
+		assert.Nil(t, server.Addr(623))
+	})
+	t.Run("relays concurrent clients over separate channels", func(t *testing.T) {
+		url := "http://" + server.Addr(16992).String()
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+				// larger than the window AMT grants so the send has to wait for window adjusts
+				body := bytes.Repeat([]byte("y"), 10000+i)
+				response, err := client.Post(fmt.Sprintf("%s/client%d", url, i), "text/plain", bytes.NewReader(body))
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer response.Body.Close()
+				result, err := io.ReadAll(response.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("/client%d %d %s", i, len(body), strings.Repeat("x", 5000)), string(result))
+			}(i)
+		}
+		wg.Wait()
+		assert.Eventually(t, func() bool {
+			server.lock.Lock()
+			defer server.lock.Unlock()
+			return len(server.channels) == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestLMSServerClose(t *testing.T) {
+	server := newTestLMSServer(t, http.NotFoundHandler())
+	address := server.Addr(16992).String()
+	assert.NoError(t, server.Close())
+	assert.NoError(t, server.Close())
+	_, err := http.Get("http://" + address)
+	assert.Error(t, err)
+	select {
+	case <-server.Done():
+	default:
+		t.Error("expected Done to be closed")
+	}
+}
+
+func TestLMSServerGlobalRequest(t *testing.T) {
+	server := newTestLMSServer(t, http.NotFoundHandler())
+
+	t.Run("rejects ports that are not served", func(t *testing.T) {
+		err := server.globalRequest(tcpForwardMessage(apf.APF_GLOBAL_REQUEST_STR_TCP_FORWARD_REQUEST, 5900))
+		assert.NoError(t, err)
+		assert.Nil(t, server.Addr(5900))
+	})
+	t.Run("cancel stops serving the port", func(t *testing.T) {
+		err := server.globalRequest(tcpForwardMessage(apf.APF_GLOBAL_REQUEST_STR_TCP_FORWARD_CANCEL_REQUEST, 16992))
+		assert.NoError(t, err)
+		assert.Nil(t, server.Addr(16992))
+	})
+}
+
+func TestLMSServerChannelFromAMT(t *testing.T) {
+	t.Run("hands the channel to the handler", func(t *testing.T) {
+		fw := emulator.NewFirmware(emulator.DefaultState())
+		fw.ReadTimeout = 10 * time.Millisecond
+		events := make(chan Event, 1)
+		server := &LMSServer{
+			Command:        pthi.Command{Heci: fw.NewDevice()},
+			Ports:          map[uint32]string{16992: "127.0.0.1:0"},
+			ChannelHandler: EventHandler{OnEvent: func(event Event) { events <- event }},
+		}
+		assert.NoError(t, server.Start())
+		defer server.Close()
+
+		assert.NoError(t, fw.DeliverEvent("http://127.0.0.1:16997/events", []byte(alertIndication)))
+		select {
+		case event := <-events:
+			assert.Equal(t, "127.0.0.1:16997", event.Address)
+			assert.Equal(t, "CIM_AlertIndication", event.Indication)
+		case <-time.After(time.Second):
+			t.Fatal("event was not delivered")
+		}
+		// the firmware closes the channel once the delivery is acknowledged
+		assert.Eventually(t, func() bool {
+			server.lock.Lock()
+			defer server.lock.Unlock()
+			return len(server.channels) == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+	t.Run("refuses channels without a handler", func(t *testing.T) {
+		server := newTestLMSServer(t, http.NotFoundHandler())
+		err := server.acceptChannel(apf.EncodeChannelOpen(apf.ChannelOpenRequest{ChannelType: apf.APF_OPEN_CHANNEL_REQUEST_FORWARDED, SenderChannel: 9}))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(server.channels))
+	})
+	t.Run("rejects malformed opens", func(t *testing.T) {
+		server := newTestLMSServer(t, http.NotFoundHandler())
+		err := server.acceptChannel([]byte{apf.APF_CHANNEL_OPEN, 0, 0})
+		assert.Error(t, err)
+	})
+}
+
+func tcpForwardMessage(request string, port uint32) []byte {
+	message := []byte{apf.APF_GLOBAL_REQUEST, 0, 0, 0, byte(len(request))}
+	message = append(message, request...)
+	message = append(message, 1, 0, 0, 0, 0)
+	return append(message, byte(port>>24), byte(port>>16), byte(port>>8), byte(port))
+}
+
+// addTestChannel registers a channel AMT knows nothing about whose client is the returned conn
+func addTestChannel(server *LMSServer) (*lmsChannel, net.Conn) {
+	local, remote := net.Pipe()
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	channel := newLMSChannel(server.sessions.Open(), 16992, local)
+	channel.Confirm(99, apf.LME_RX_WINDOW_SIZE)
+	server.channels[channel.ID] = channel
+	return channel, remote
+}
+
+func TestLMSServerChannelData(t *testing.T) {
+	t.Run("queues data for a slow client without blocking the reader", func(t *testing.T) {
+		server := newTestLMSServer(t, http.NotFoundHandler())
+		channel, _ := addTestChannel(server)
+		done := make(chan struct{})
+		go func() {
+			// many small messages within the window and nobody reading the client
+			for i := 0; i < 200; i++ {
+				server.channelData(apf.EncodeChannelData(apf.ChannelData(channel.ID, []byte("0123456789"))))
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the reader blocked on a slow client")
+		}
+		assert.Len(t, channel.take(), 200)
+	})
+	t.Run("closes the channel when AMT exceeds the window", func(t *testing.T) {
+		server := newTestLMSServer(t, http.NotFoundHandler())
+		channel, client := addTestChannel(server)
+		server.channelData(apf.EncodeChannelData(apf.ChannelData(channel.ID, make([]byte, apf.LME_RX_WINDOW_SIZE+1))))
+		assert.Empty(t, channel.take())
+		_, err := client.Read(make([]byte, 1))
+		assert.Error(t, err)
+	})
+}
+
+func TestLMSServerLocalClose(t *testing.T) {
+	orig := lmsChannelCloseTimeout
+	lmsChannelCloseTimeout = 10 * time.Millisecond
+	defer func() { lmsChannelCloseTimeout = orig }()
+	server := newTestLMSServer(t, http.NotFoundHandler())
+	// the emulator never confirms closing a channel it does not know
+	channel, _ := addTestChannel(server)
+	server.localClose(channel)
+	assert.Nil(t, server.channel(channel.ID))
+	select {
+	case <-channel.Closed():
+	default:
+		t.Error("expected the channel to be closed")
+	}
+}
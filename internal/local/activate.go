@@ -5,14 +5,19 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/pem"
 	"encoding/xml"
 	"errors"
+	"github.com/jc-lab/intel-amt-host-api/internal/amt"
 	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"io"
 	"strings"
+	"time"
 
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/general"
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/ips/hostbasedsetup"
@@ -21,6 +26,9 @@ import (
 )
 
 func (service *ProvisioningService) Activate() utils.ReturnCode {
+	if service.flags.StopConfiguration {
+		return service.StopConfiguration()
+	}
 
 	controlMode, err := service.amtCommand.GetControlMode()
 	if err != nil {
@@ -44,7 +52,9 @@ func (service *ProvisioningService) Activate() utils.ReturnCode {
 
 	rc := utils.Success
 
-	if service.flags.UseACM {
+	if service.flags.UseACM && service.flags.UseHBased {
+		rc = service.ActivateACMHBased(lsa)
+	} else if service.flags.UseACM {
 		rc = service.ActivateACM()
 	} else if service.flags.UseCCM {
 		rc = service.ActivateCCM()
@@ -54,23 +64,144 @@ func (service *ProvisioningService) Activate() utils.ReturnCode {
 }
 
 func (service *ProvisioningService) ActivateACM() utils.ReturnCode {
-	checkErrorAndLog := func(err error) bool {
-		if err != nil {
-			log.Error(err)
-			return true
+	certObject, rc := service.checkProvisioningCert()
+	if rc != utils.Success {
+		return rc
+	}
+	return service.adminSetup(certObject)
+}
+
+// ActivateACMHBased activates in admin control mode with host based
+// configuration, which AMT 16 and later expect. AMT returns the hash of its
+// TLS certificate and admin setup continues over TLS pinned to that hash.
+func (service *ProvisioningService) ActivateACMHBased(lsa amt.LocalSystemAccount) utils.ReturnCode {
+	certObject, rc := service.checkProvisioningCert()
+	if rc != utils.Success {
+		return rc
+	}
+	leaf, err := base64.StdEncoding.DecodeString(certObject.certChain[0])
+	if err != nil {
+		log.Error(err)
+		return utils.ActivationFailed
+	}
+	serverCertHash := sha256.Sum256(leaf)
+	dnsSuffixes := []string{}
+	for _, domain := range certObject.domains {
+		if suffix := pkiDNSSuffix(domain); strings.Contains(domain, ".") && !containsString(dnsSuffixes, suffix) {
+			dnsSuffixes = append(dnsSuffixes, suffix)
 		}
-		return false
 	}
-	// Extract the provisioning certificate
-	certObject, fingerPrint, err := service.GetProvisioningCertObj()
-	if checkErrorAndLog(err) {
+	log.Info("starting host based configuration")
+	amtCertHash, err := service.amtCommand.StartConfigurationHBased(serverCertHash[:], dnsSuffixes)
+	if err != nil {
+		log.Error(err)
 		return utils.ActivationFailed
 	}
-	// Check provisioning certificate is accepted by AMT
-	if checkErrorAndLog(service.CompareCertHashes(fingerPrint)) {
+	log.Infof("AMT TLS certificate hash: %s %s", amtCertHash.Algorithm, amtCertHash.Hash)
+	tlsConfig, err := provisioningTLSConfig(certObject, amtCertHash)
+	if err != nil {
+		log.Error(err)
+		service.abortConfiguration()
 		return utils.ActivationFailed
 	}
+	service.setupTLSWsmanClient(lsa.Username, lsa.Password, tlsConfig)
+	rc = service.adminSetup(certObject)
+	if rc != utils.Success {
+		service.abortConfiguration()
+	}
+	return rc
+}
 
+// StopConfiguration aborts a host based configuration that did not complete
+func (service *ProvisioningService) StopConfiguration() utils.ReturnCode {
+	log.Info("stopping configuration")
+	if err := service.amtCommand.StopConfiguration(); err != nil {
+		log.Error(err)
+		return utils.ActivationFailed
+	}
+	log.Info("configuration stopped")
+	return utils.Success
+}
+
+func (service *ProvisioningService) abortConfiguration() {
+	log.Warn("aborting host based configuration")
+	if err := service.amtCommand.StopConfiguration(); err != nil {
+		log.Error(err)
+	}
+}
+
+// provisioningTLSConfig authenticates with the provisioning certificate and
+// accepts only the AMT certificate that host based configuration returned
+func provisioningTLSConfig(certObject ProvisioningCertObj, amtCertHash amt.CertHashEntry) (*tls.Config, error) {
+	var hashFunc func([]byte) []byte
+	switch amtCertHash.Algorithm {
+	case "SHA256":
+		hashFunc = func(b []byte) []byte { h := sha256.Sum256(b); return h[:] }
+	case "SHA384":
+		hashFunc = func(b []byte) []byte { h := sha512.Sum384(b); return h[:] }
+	case "SHA512":
+		hashFunc = func(b []byte) []byte { h := sha512.Sum512(b); return h[:] }
+	default:
+		return nil, errors.New("unsupported AMT certificate hash algorithm " + amtCertHash.Algorithm)
+	}
+	clientCert := tls.Certificate{PrivateKey: certObject.privateKey}
+	for _, cert := range certObject.certChain {
+		der, err := base64.StdEncoding.DecodeString(cert)
+		if err != nil {
+			return nil, err
+		}
+		clientCert.Certificate = append(clientCert.Certificate, der)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		// AMT uses a self signed certificate, it is verified by its hash instead
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("AMT did not present a TLS certificate")
+			}
+			if hash := hex.EncodeToString(hashFunc(rawCerts[0])); !strings.EqualFold(hash, amtCertHash.Hash) {
+				return errors.New("AMT TLS certificate hash " + hash + " does not match " + amtCertHash.Hash)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// checkProvisioningCert extracts the provisioning certificate and makes sure
+// AMT trusts its root and domain
+func (service *ProvisioningService) checkProvisioningCert() (ProvisioningCertObj, utils.ReturnCode) {
+	certObject, fingerPrint, err := service.GetProvisioningCertObj()
+	if err != nil {
+		log.Error(err)
+		return ProvisioningCertObj{}, utils.ActivationFailed
+	}
+	trustedRoot, err := service.CompareCertHashes(fingerPrint)
+	if err != nil {
+		log.Error(err)
+		return ProvisioningCertObj{}, utils.UntrustedProvisioningCertificate
+	}
+	log.Infof("provisioning certificate chain is anchored by trusted root %q (%s %s)", trustedRoot.Name, trustedRoot.Algorithm, trustedRoot.Hash)
+	if rc := service.MatchPKIDNSSuffix(certObject.domains); rc != utils.Success {
+		return ProvisioningCertObj{}, rc
+	}
+	if err := service.CheckRNGSeed(); err != nil {
+		log.Error(err)
+		return ProvisioningCertObj{}, utils.ActivationFailed
+	}
+	return certObject, utils.Success
+}
+
+// adminSetup injects the provisioning certificate chain and signs the AMT
+// nonce to switch to admin control mode
+func (service *ProvisioningService) adminSetup(certObject ProvisioningCertObj) utils.ReturnCode {
+	checkErrorAndLog := func(err error) bool {
+		if err != nil {
+			log.Error(err)
+			return true
+		}
+		return false
+	}
 	generalSettings, err := service.GetGeneralSettings()
 	if checkErrorAndLog(err) {
 		return utils.ActivationFailed
@@ -182,6 +313,8 @@ type CertificateObject struct {
 type ProvisioningCertObj struct {
 	certChain  []string
 	privateKey crypto.PrivateKey
+	commonName string
+	domains    []string
 }
 
 func cleanPEM(pem string) string {
@@ -228,6 +361,8 @@ func dumpPfx(pfxobj CertsAndKeys) (ProvisioningCertObj, string, error) {
 	}
 	provisioningCertificateObj.certChain = append(provisioningCertificateObj.certChain, root.pem)
 	provisioningCertificateObj.privateKey = pfxobj.keys[0]
+	provisioningCertificateObj.commonName = pfxobj.certs[0].Subject.CommonName
+	provisioningCertificateObj.domains = certificateDomains(pfxobj.certs[0])
 
 	return provisioningCertificateObj, fingerprint, nil
 }
@@ -260,17 +395,146 @@ func (service *ProvisioningService) GetProvisioningCertObj() (ProvisioningCertOb
 	return result, fingerprint, nil
 }
 
-func (service *ProvisioningService) CompareCertHashes(fingerPrint string) error {
+// certificateDomains lists the common name and the DNS names of the subject
+// alternative name without duplicates
+func certificateDomains(cert *x509.Certificate) []string {
+	domains := []string{}
+	for _, name := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+		if name != "" && !containsString(domains, name) {
+			domains = append(domains, name)
+		}
+	}
+	return domains
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareCertHashes returns the trusted root certificate hash in AMT that
+// matches the root of the provisioning certificate
+func (service *ProvisioningService) CompareCertHashes(fingerPrint string) (amt.CertHashEntry, error) {
 	result, err := service.amtCommand.GetCertificateHashes()
 	if err != nil {
-		log.Error(err)
+		return amt.CertHashEntry{}, err
 	}
 	for _, v := range result {
-		if v.Hash == fingerPrint {
+		if strings.EqualFold(v.Hash, fingerPrint) {
+			return v, nil
+		}
+	}
+	return amt.CertHashEntry{}, errors.New("the root of the provisioning certificate (SHA256 " + fingerPrint + ") does not match any of the trusted root hashes in AMT")
+}
+
+// MatchPKIDNSSuffix makes sure AMT accepts the domain of the provisioning
+// certificate. On a mismatch it sets the PKI DNS suffix when the ACM
+// settings allow it and otherwise fails before AdminSetup does.
+func (service *ProvisioningService) MatchPKIDNSSuffix(domains []string) utils.ReturnCode {
+	err := service.CheckPKIDNSSuffix(domains...)
+	if err == nil {
+		return utils.Success
+	}
+	if !service.config.ACMSettings.SetPkiDNSSuffix {
+		log.Error(err)
+		log.Error("set the PKI DNS suffix in MEBx or use -setPkiDnsSuffix to set it from the provisioning certificate")
+		return utils.PkiDNSSuffixMismatch
+	}
+	log.Warn(err)
+	suffix := ""
+	for _, domain := range domains {
+		// a common name like "RPC Provisioning Certificate" is not a domain
+		if strings.Contains(domain, ".") && !strings.Contains(domain, " ") {
+			suffix = pkiDNSSuffix(domain)
+			break
+		}
+	}
+	if suffix == "" {
+		log.Error("provisioning certificate has no domain name to take the PKI DNS suffix from")
+		return utils.PkiDNSSuffixMismatch
+	}
+	log.Infof("setting AMT PKI DNS suffix to %s", suffix)
+	if err := service.amtCommand.SetPkiFQDNSuffix(suffix); err != nil {
+		log.Error(err)
+		return utils.PkiDNSSuffixMismatch
+	}
+	return utils.Success
+}
+
+// pkiDNSSuffix is the domain of the host named by a certificate domain
+func pkiDNSSuffix(domain string) string {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "*.")
+	if labels := strings.SplitN(domain, ".", 2); len(labels) == 2 && strings.Contains(labels[1], ".") {
+		return labels[1]
+	}
+	return domain
+}
+
+// CheckPKIDNSSuffix reports an error when none of the provisioning certificate
+// domains matches the DNS suffixes AMT compares them against
+func (service *ProvisioningService) CheckPKIDNSSuffix(domains ...string) error {
+	suffixes := []string{}
+	suffix, err := service.amtCommand.GetDNSSuffix()
+	if err != nil {
+		log.Error(err)
+	} else if suffix != "" {
+		suffixes = append(suffixes, suffix)
+	}
+	suffixList, err := service.amtCommand.GetDNSSuffixList()
+	if err != nil {
+		log.Error(err)
+	} else {
+		suffixes = append(suffixes, suffixList...)
+	}
+	osSuffix, err := service.amtCommand.GetOSDNSSuffix()
+	if err != nil {
+		log.Error(err)
+	} else if osSuffix != "" {
+		suffixes = append(suffixes, osSuffix)
+	}
+
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), "*.")
+		for _, s := range suffixes {
+			s = strings.ToLower(s)
+			if domain == s || strings.HasSuffix(domain, "."+s) {
+				return nil
+			}
+		}
+	}
+	return errors.New("provisioning certificate " + strings.Join(domains, ", ") + " does not match any DNS suffix known to AMT (" + strings.Join(suffixes, ", ") + ")")
+}
+
+var rngSeedPollInterval = 2 * time.Second
+var rngSeedPollAttempts = 15
+
+// CheckRNGSeed makes sure the AMT random number generator is seeded,
+// generating the seed when needed. Without it AdminSetup fails with
+// AMT_STATUS_RNG_NOT_READY.
+func (service *ProvisioningService) CheckRNGSeed() error {
+	for i := 0; ; i++ {
+		status, err := service.amtCommand.GetRNGSeedStatus()
+		if err != nil {
+			return err
+		}
+		if status == amt.RNGSeedExists {
 			return nil
 		}
+		if status == amt.RNGSeedNotExists && i == 0 {
+			log.Info("generating AMT RNG seed")
+			if err := service.amtCommand.GenerateRNGSeed(); err != nil {
+				return err
+			}
+		}
+		if i >= rngSeedPollAttempts {
+			return errors.New("AMT RNG seed is " + status.String() + ", wait a few minutes after the device powers on and retry activation")
+		}
+		time.Sleep(rngSeedPollInterval)
 	}
-	return errors.New("The root of the provisioning certificate does not match any of the trusted roots in AMT.")
 }
 
 func (service *ProvisioningService) injectCertificate(certChain []string) error {
@@ -362,7 +626,8 @@ func (service *ProvisioningService) sendAdminSetup(digestRealm string, nonce []b
 	password := service.config.ACMSettings.AMTPassword
 	message := service.ipsMessages.HostBasedSetupService.AdminSetup(hostbasedsetup.AdminPassEncryptionTypeHTTPDigestMD5A1, digestRealm, password, base64.StdEncoding.EncodeToString(nonce), hostbasedsetup.SigningAlgorithmRSASHA2256, signature)
 	response, err := service.client.Post(message)
-	if err != nil && err.Error() != "Post \"http://localhost:16992/wsman\": EOF" {
+	// AMT may close the connection when it switches to admin control mode
+	if err != nil && !errors.Is(err, io.EOF) {
 		log.Error(err)
 		return utils.ActivationFailed, err
 	}
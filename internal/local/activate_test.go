@@ -1,13 +1,20 @@
 package local
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	amt2 "github.com/jc-lab/intel-amt-host-api/internal/amt"
 	"github.com/jc-lab/intel-amt-host-api/internal/certs"
 	"github.com/jc-lab/intel-amt-host-api/internal/flags"
 	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"software.sslmate.com/src/go-pkcs12"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,6 +30,27 @@ func getTestCerts() *certs.CompositeChain {
 	return sortaSingletonCerts
 }
 
+var sortaSingletonProvisioningCerts *certs.CompositeChain = nil
+
+// getProvisioningCerts returns a provisioning certificate whose leaf has a
+// domain, which ACM activation matches against the PKI DNS suffix
+func getProvisioningCerts() *certs.CompositeChain {
+	if sortaSingletonProvisioningCerts == nil {
+		chain := certs.CompositeChain{PfxPassword: "P@ssw0rd"}
+		rootKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		rootTemplate := certs.GetRootCATemplate()
+		chain.Root.GenerateCert(&rootTemplate, &rootTemplate, &rootKey.PublicKey, rootKey)
+		leafKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		leafTemplate := certs.GetLeafTemplate()
+		leafTemplate.DNSNames = []string{"provisioning.vprodemo.com"}
+		chain.Leaf.GenerateCert(&leafTemplate, chain.Root.Cert, &leafKey.PublicKey, rootKey)
+		chain.PfxData, _ = pkcs12.Legacy.Encode(leafKey, chain.Leaf.Cert, []*x509.Certificate{chain.Root.Cert}, chain.PfxPassword)
+		chain.Pfxb64 = base64.StdEncoding.EncodeToString(chain.PfxData)
+		sortaSingletonProvisioningCerts = &chain
+	}
+	return sortaSingletonProvisioningCerts
+}
+
 func TestActivation(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		respondServerError(w)
@@ -219,12 +247,14 @@ func TestGetGeneralSettings(t *testing.T) {
 }
 
 func TestActivateACM(t *testing.T) {
-	f := &flags.Flags{}
-	f.LocalConfig.ACMSettings.AMTPassword = "P@ssw0rd"
-	testCerts := getTestCerts()
-	f.LocalConfig.ACMSettings.ProvisioningCert = testCerts.Pfxb64
-	f.LocalConfig.ACMSettings.ProvisioningCertPwd = testCerts.PfxPassword
-
+	testCerts := getProvisioningCerts()
+	newFlags := func() *flags.Flags {
+		f := &flags.Flags{}
+		f.LocalConfig.ACMSettings.AMTPassword = "P@ssw0rd"
+		f.LocalConfig.ACMSettings.ProvisioningCert = testCerts.Pfxb64
+		f.LocalConfig.ACMSettings.ProvisioningCertPwd = testCerts.PfxPassword
+		return f
+	}
 	mockCertHashes = []amt2.CertHashEntry{
 		{
 			Hash:      testCerts.Root.Fingerprint,
@@ -234,21 +264,140 @@ func TestActivateACM(t *testing.T) {
 			IsDefault: true,
 		},
 	}
+	activate := func(f *flags.Flags) utils.ReturnCode {
+		calls := 0
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "POST", r.Method)
+			calls++
+			if calls == 1 {
+				respondGeneralSettings(t, w)
+			} else {
+				respondHostBasedSetup(t, w)
+			}
+		})
+		lps := setupWithWsmanClient(f, handler)
+		return lps.ActivateACM()
+	}
+
+	t.Run("returns Success when the PKI DNS suffix matches", func(t *testing.T) {
+		mockDNSSuffix = "vprodemo.com"
+		defer func() { mockDNSSuffix = "dns.org" }()
+		mockPkiFQDNSuffix = ""
+		rc := activate(newFlags())
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "", mockPkiFQDNSuffix)
+	})
+	t.Run("sets the PKI DNS suffix from the certificate when allowed", func(t *testing.T) {
+		f := newFlags()
+		f.LocalConfig.ACMSettings.SetPkiDNSSuffix = true
+		rc := activate(f)
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "vprodemo.com", mockPkiFQDNSuffix)
+		mockPkiFQDNSuffix = ""
+	})
+	t.Run("returns PkiDNSSuffixMismatch when not allowed", func(t *testing.T) {
+		rc := activate(newFlags())
+		assert.Equal(t, utils.PkiDNSSuffixMismatch, rc)
+	})
+	t.Run("returns PkiDNSSuffixMismatch when setting fails", func(t *testing.T) {
+		f := newFlags()
+		f.LocalConfig.ACMSettings.SetPkiDNSSuffix = true
+		mockSetPkiFQDNSuffixErr = mockStandardErr
+		defer func() { mockSetPkiFQDNSuffixErr = nil }()
+		rc := activate(f)
+		assert.Equal(t, utils.PkiDNSSuffixMismatch, rc)
+	})
+	t.Run("returns UntrustedProvisioningCertificate without a matching root hash", func(t *testing.T) {
+		mockCertHashes = mockCertHashesDefault
+		defer func() { mockCertHashes = nil }()
+		rc := activate(newFlags())
+		assert.Equal(t, utils.UntrustedProvisioningCertificate, rc)
+	})
+}
+
+func TestActivateACMHBased(t *testing.T) {
+	testCerts := getProvisioningCerts()
+	f := &flags.Flags{UseACM: true, UseHBased: true}
+	f.LocalConfig.ACMSettings.AMTPassword = "P@ssw0rd"
+	f.LocalConfig.ACMSettings.ProvisioningCert = testCerts.Pfxb64
+	f.LocalConfig.ACMSettings.ProvisioningCertPwd = testCerts.PfxPassword
+	mockCertHashes = []amt2.CertHashEntry{{Hash: testCerts.Root.Fingerprint, IsActive: true}}
+	defer func() { mockCertHashes = nil }()
+	mockDNSSuffix = "vprodemo.com"
+	defer func() { mockDNSSuffix = "dns.org" }()
+	lsa := amt2.LocalSystemAccount{Username: "Username", Password: "Password"}
+
 	calls := 0
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "POST", r.Method)
-		var err error
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		calls++
 		if calls == 1 {
 			respondGeneralSettings(t, w)
 		} else {
 			respondHostBasedSetup(t, w)
 		}
-		assert.Nil(t, err)
+	}))
+	defer server.Close()
+	serverHash := sha256.Sum256(server.Certificate().Raw)
+	newService := func() ProvisioningService {
+		calls = 0
+		lps := setupService(f)
+		lps.tlsServerURL = server.URL
+		return lps
+	}
+
+	t.Run("returns Success pinned to the AMT certificate", func(t *testing.T) {
+		mockAMTCertHash = amt2.CertHashEntry{Algorithm: "SHA256", Hash: hex.EncodeToString(serverHash[:])}
+		stopCalls := mockStopConfigurationCalls
+		lps := newService()
+		rc := lps.ActivateACMHBased(lsa)
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, []string{"vprodemo.com"}, mockHBasedDNSSuffixes)
+		assert.Greater(t, calls, 2)
+		assert.Equal(t, stopCalls, mockStopConfigurationCalls)
+	})
+	t.Run("aborts when the AMT certificate does not match", func(t *testing.T) {
+		mockAMTCertHash = amt2.CertHashEntry{Algorithm: "SHA256", Hash: "00"}
+		stopCalls := mockStopConfigurationCalls
+		lps := newService()
+		rc := lps.ActivateACMHBased(lsa)
+		assert.Equal(t, utils.ActivationFailed, rc)
+		assert.Equal(t, 0, calls)
+		assert.Equal(t, stopCalls+1, mockStopConfigurationCalls)
+	})
+	t.Run("aborts on an unsupported AMT certificate hash", func(t *testing.T) {
+		mockAMTCertHash = amt2.CertHashEntry{Algorithm: "MD5", Hash: "00"}
+		stopCalls := mockStopConfigurationCalls
+		lps := newService()
+		rc := lps.ActivateACMHBased(lsa)
+		assert.Equal(t, utils.ActivationFailed, rc)
+		assert.Equal(t, stopCalls+1, mockStopConfigurationCalls)
+	})
+	t.Run("returns ActivationFailed when host based configuration does not start", func(t *testing.T) {
+		mockStartConfigurationHBasedErr = mockStandardErr
+		defer func() { mockStartConfigurationHBasedErr = nil }()
+		stopCalls := mockStopConfigurationCalls
+		lps := newService()
+		rc := lps.ActivateACMHBased(lsa)
+		assert.Equal(t, utils.ActivationFailed, rc)
+		assert.Equal(t, stopCalls, mockStopConfigurationCalls)
+	})
+}
+
+func TestStopConfiguration(t *testing.T) {
+	f := &flags.Flags{StopConfiguration: true}
+	lps := setupService(f)
+	t.Run("returns Success", func(t *testing.T) {
+		stopCalls := mockStopConfigurationCalls
+		rc := lps.Activate()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, stopCalls+1, mockStopConfigurationCalls)
+	})
+	t.Run("returns ActivationFailed on error", func(t *testing.T) {
+		mockStopConfigurationErr = mockStandardErr
+		defer func() { mockStopConfigurationErr = nil }()
+		rc := lps.Activate()
+		assert.Equal(t, utils.ActivationFailed, rc)
 	})
-	lps := setupWithWsmanClient(f, handler)
-	rc := lps.ActivateACM()
-	assert.Equal(t, utils.Success, rc)
 }
 
 func TestInjectCertsErrors(t *testing.T) {
@@ -284,3 +433,90 @@ func TestDumpPfx(t *testing.T) {
 	_, _, err = dumpPfx(certsAndKeys)
 	assert.NotNil(t, err)
 }
+
+func TestCheckRNGSeed(t *testing.T) {
+	f := &flags.Flags{}
+	lps := setupService(f)
+	origInterval := rngSeedPollInterval
+	rngSeedPollInterval = 0
+	defer func() { rngSeedPollInterval = origInterval }()
+
+	t.Run("returns nil when seed exists", func(t *testing.T) {
+		mockRNGSeedStatus = amt2.RNGSeedExists
+		assert.NoError(t, lps.CheckRNGSeed())
+	})
+	t.Run("generates a missing seed", func(t *testing.T) {
+		mockRNGSeedStatus = amt2.RNGSeedNotExists
+		assert.NoError(t, lps.CheckRNGSeed())
+		assert.Equal(t, amt2.RNGSeedExists, mockRNGSeedStatus)
+	})
+	t.Run("returns error when generation fails", func(t *testing.T) {
+		mockRNGSeedStatus = amt2.RNGSeedNotExists
+		mockGenerateRNGSeedErr = mockStandardErr
+		assert.Error(t, lps.CheckRNGSeed())
+		mockGenerateRNGSeedErr = nil
+	})
+	t.Run("returns error when seed stays in progress", func(t *testing.T) {
+		mockRNGSeedStatus = amt2.RNGSeedInProgress
+		err := lps.CheckRNGSeed()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "in progress")
+	})
+	t.Run("returns error when status fails", func(t *testing.T) {
+		mockRNGSeedStatusErr = mockStandardErr
+		assert.Error(t, lps.CheckRNGSeed())
+		mockRNGSeedStatusErr = nil
+	})
+	mockRNGSeedStatus = amt2.RNGSeedExists
+}
+
+func TestCheckPKIDNSSuffix(t *testing.T) {
+	f := &flags.Flags{}
+	lps := setupService(f)
+
+	t.Run("matches the PKI DNS suffix", func(t *testing.T) {
+		assert.NoError(t, lps.CheckPKIDNSSuffix("provisioning.dns.org"))
+	})
+	t.Run("matches an entry in the DNS suffix list", func(t *testing.T) {
+		assert.NoError(t, lps.CheckPKIDNSSuffix("PROVISIONING.OTHER.ORG"))
+	})
+	t.Run("matches the OS DNS suffix", func(t *testing.T) {
+		assert.NoError(t, lps.CheckPKIDNSSuffix("os.dns.org"))
+	})
+	t.Run("returns error when nothing matches", func(t *testing.T) {
+		assert.Error(t, lps.CheckPKIDNSSuffix("provisioning.vprodemo.com"))
+	})
+	t.Run("does not match a partial label", func(t *testing.T) {
+		assert.Error(t, lps.CheckPKIDNSSuffix("notdns.org"))
+	})
+	t.Run("matches a subject alternative name", func(t *testing.T) {
+		assert.NoError(t, lps.CheckPKIDNSSuffix("RPC Provisioning Certificate", "*.dns.org"))
+	})
+}
+
+func TestPkiDNSSuffix(t *testing.T) {
+	assert.Equal(t, "vprodemo.com", pkiDNSSuffix("provisioning.vprodemo.com"))
+	assert.Equal(t, "vprodemo.com", pkiDNSSuffix("*.VPRODEMO.com"))
+	assert.Equal(t, "vprodemo.com", pkiDNSSuffix("vprodemo.com"))
+}
+
+func TestCompareCertHashes(t *testing.T) {
+	lps := setupService(&flags.Flags{})
+	mockCertHashes = mockCertHashesDefault
+	defer func() { mockCertHashes = nil }()
+	t.Run("returns the matching trusted root", func(t *testing.T) {
+		entry, err := lps.CompareCertHashes("424242")
+		assert.NoError(t, err)
+		assert.Equal(t, "Cert 02 Small Important CA", entry.Name)
+	})
+	t.Run("returns error without a match", func(t *testing.T) {
+		_, err := lps.CompareCertHashes("000000")
+		assert.Error(t, err)
+	})
+	t.Run("returns error when the hashes are not available", func(t *testing.T) {
+		mockCertHashesErr = mockStandardErr
+		defer func() { mockCertHashesErr = nil }()
+		_, err := lps.CompareCertHashes("424242")
+		assert.Error(t, err)
+	})
+}
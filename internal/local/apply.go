@@ -0,0 +1,381 @@
+package local
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/remoteaccess"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/tls"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/wifiportconfiguration"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/wifi"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/ips/ieee8021x"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxClockDrift is how far the AMT clock may be from the OS clock before apply synchronizes it
+const maxClockDrift = 5 * time.Second
+
+// wifiPortEnabled is the CIM_WiFiPort state EnableWifi requests, enabled in S0 and Sx/AC
+const wifiPortEnabled = 32769
+
+type wifiPortResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		WiFiPort struct {
+			EnabledState int `xml:"EnabledState"`
+		} `xml:"CIM_WiFiPort"`
+	} `xml:"Body"`
+}
+
+// applyStep changes one part of the configuration when check finds it differs
+type applyStep struct {
+	name  string
+	check func() (bool, utils.ReturnCode)
+	apply func() utils.ReturnCode
+}
+
+// Apply converges the device to the configuration. Every step reads the
+// current state first and only the steps that differ make changes, in the
+// order later steps depend on.
+func (service *ProvisioningService) Apply() utils.ReturnCode {
+	service.setupWsmanClient("admin", service.flags.Password)
+	changes := []string{}
+	for _, step := range service.applySteps() {
+		inSync, rc := step.check()
+		if rc != utils.Success {
+			return rc
+		}
+		if inSync {
+			log.Infof("%s is up to date", step.name)
+			continue
+		}
+		log.Infof("applying %s", step.name)
+		rc = step.apply()
+		if rc != utils.Success {
+			log.Errorf("failed applying %s", step.name)
+			return rc
+		}
+		changes = append(changes, step.name)
+		if step.name == "activation" && service.plan != nil {
+			log.Warn("dry run stops after activation, the other settings can only be read from an activated device")
+			break
+		}
+	}
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{"changes": changes})
+	}
+	if len(changes) == 0 {
+		log.Info("device already matches the configuration")
+	} else {
+		log.Infof("applied %s", strings.Join(changes, ", "))
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) applySteps() []applyStep {
+	cfg := service.flags.LocalConfig
+	steps := []applyStep{{"activation", service.checkActivation, service.applyActivation}}
+	if cfg.SyncClock {
+		steps = append(steps, applyStep{"clock", service.checkClock, service.SynchronizeTime})
+	}
+	if cfg.Hostname != "" || cfg.DomainName != "" {
+		var hostname, domainName string
+		steps = append(steps, applyStep{"hostname", func() (bool, utils.ReturnCode) {
+			current, rc := service.getGeneralSettings()
+			hostname, domainName = valueOr(cfg.Hostname, current.HostName), valueOr(cfg.DomainName, current.DomainName)
+			return hostname == current.HostName && domainName == current.DomainName, rc
+		}, func() utils.ReturnCode {
+			return service.PutHostname(hostname, domainName)
+		}})
+	}
+	if cfg.Wired != (config.WiredConfig{}) {
+		steps = append(steps, applyStep{"wired network", service.checkWired, func() utils.ReturnCode {
+			return service.PutEthernetPortSettings(cfg.Wired)
+		}})
+		if cfg.Wired.Ieee8021xProfileName != "" {
+			steps = append(steps, applyStep{"wired 802.1x", service.checkWiredIeee8021x, func() utils.ReturnCode {
+				return service.ConfigureWiredIeee8021x(cfg.Wired.Ieee8021xProfileName)
+			}})
+		}
+	}
+	if len(cfg.WifiConfigs) > 0 {
+		steps = append(steps, applyStep{"wifi", service.checkWifi, service.AddWifiSettings})
+	}
+	redirection := cfg.Redirection
+	if redirection.SOL != nil || redirection.IDER != nil || redirection.KVM != nil || redirection.UserConsent != "" {
+		steps = append(steps, applyStep{"redirection", service.checkRedirection, service.ConfigureRedirection})
+	}
+	if cfg.CIRA.MPSAddress != "" {
+		steps = append(steps, service.ciraStep())
+	}
+	// TLS goes last, enabling it changes how AMT accepts connections
+	if cfg.TLS.Mode != "" {
+		var tlsEnabled bool
+		steps = append(steps, applyStep{"tls", func() (bool, utils.ReturnCode) {
+			var inSync bool
+			var rc utils.ReturnCode
+			tlsEnabled, inSync, rc = service.checkTLS()
+			return inSync, rc
+		}, func() utils.ReturnCode {
+			if tlsEnabled {
+				return service.EnableTLS()
+			}
+			return service.ConfigureTLS()
+		}})
+	}
+	return steps
+}
+
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func (service *ProvisioningService) checkActivation() (bool, utils.ReturnCode) {
+	controlMode, err := service.amtCommand.GetControlMode()
+	if err != nil {
+		log.Error(err)
+		return false, utils.AMTConnectionFailed
+	}
+	activation := service.flags.LocalConfig.Activation
+	if controlMode == 0 {
+		if activation == "" {
+			log.Error("device is not activated and the configuration has no activation")
+			return false, utils.UnableToActivate
+		}
+		return false, utils.Success
+	}
+	if activation == "" || activation == "ccm" && controlMode == 1 || activation == "acm" && controlMode == 2 {
+		return true, utils.Success
+	}
+	log.Errorf("device is %s, apply cannot change it to %s without a deactivation", utils.InterpretControlMode(controlMode), activation)
+	return false, utils.ControlModeMismatch
+}
+
+func (service *ProvisioningService) applyActivation() utils.ReturnCode {
+	service.flags.UseCCM = service.flags.LocalConfig.Activation == "ccm"
+	service.flags.UseACM = service.flags.LocalConfig.Activation == "acm"
+	rc := service.Activate()
+	// activation connects with the local system account
+	service.setupWsmanClient("admin", service.flags.Password)
+	return rc
+}
+
+func (service *ProvisioningService) checkClock() (bool, utils.ReturnCode) {
+	ta0, rc := service.GetLowAccuracyTimeSynch()
+	if rc != utils.Success {
+		return false, rc
+	}
+	drift := time.Since(time.Unix(ta0, 0))
+	if drift < 0 {
+		drift = -drift
+	}
+	log.Debugf("AMT clock drift: %s", drift)
+	return drift <= maxClockDrift, utils.Success
+}
+
+func (service *ProvisioningService) checkWired() (bool, utils.ReturnCode) {
+	current, rc := service.getEthernetPortSettings()
+	if rc != utils.Success {
+		return false, rc
+	}
+	return ethernetPortSettingsMatch(current, getEthernetPortSettingsPutData(current, service.flags.LocalConfig.Wired)), utils.Success
+}
+
+func ethernetPortSettingsMatch(current ethernetPortSettings, desired ethernetPortSettingsPut) bool {
+	if current.DHCPEnabled != desired.DHCPEnabled || current.IpSyncEnabled != desired.IpSyncEnabled {
+		return false
+	}
+	if desired.DHCPEnabled {
+		return true
+	}
+	if current.SharedStaticIp != desired.SharedStaticIp {
+		return false
+	}
+	if desired.IpSyncEnabled {
+		return true
+	}
+	return current.IPAddress == desired.IPAddress &&
+		current.SubnetMask == desired.SubnetMask &&
+		current.DefaultGateway == desired.DefaultGateway &&
+		current.PrimaryDNS == desired.PrimaryDNS &&
+		current.SecondaryDNS == desired.SecondaryDNS
+}
+
+// checkWiredIeee8021x compares what AMT returns, the certificates and password cannot be read back
+func (service *ProvisioningService) checkWiredIeee8021x() (bool, utils.ReturnCode) {
+	profileName := service.flags.LocalConfig.Wired.Ieee8021xProfileName
+	var ieee8021xConfig *config.Ieee8021xConfig
+	for i, cfg := range service.flags.LocalConfig.Ieee8021xConfigs {
+		if cfg.ProfileName == profileName {
+			ieee8021xConfig = &service.flags.LocalConfig.Ieee8021xConfigs[i]
+			break
+		}
+	}
+	if ieee8021xConfig == nil {
+		log.Errorf("missing Ieee8021xConfig %s", profileName)
+		return false, utils.MissingIeee8021xConfiguration
+	}
+	var getRsp ieee8021xSettingsResponse
+	rc := service.PostAndUnmarshal(service.ipsMessages.IEEE8021xSettings.Get(), &getRsp)
+	if rc != utils.Success {
+		return false, rc
+	}
+	current := getRsp.Body.IEEE8021xSettings
+	return current.Enabled == int(ieee8021x.EnabledWithCertificates) &&
+		current.AuthenticationProtocol == ieee8021xConfig.AuthenticationProtocol &&
+		current.Username == ieee8021xConfig.Username, utils.Success
+}
+
+// checkWifi compares the wifi profiles by name, the passphrases and 802.1x secrets cannot be read back
+func (service *ProvisioningService) checkWifi() (bool, utils.ReturnCode) {
+	var portCfgRsp wifiportconfiguration.Response
+	rc := service.PostAndUnmarshal(service.amtMessages.WiFiPortConfigurationService.Get(), &portCfgRsp)
+	if rc != utils.Success {
+		return false, rc
+	}
+	if portCfgRsp.Body.WiFiPortConfigurationService.LocalProfileSynchronizationEnabled == wifiportconfiguration.LocalSyncDisabled {
+		return false, utils.Success
+	}
+	var portRsp wifiPortResponse
+	rc = service.PostAndUnmarshal(service.cimMessages.WiFiPort.Get(), &portRsp)
+	if rc != utils.Success {
+		return false, rc
+	}
+	if portRsp.Body.WiFiPort.EnabledState != wifiPortEnabled {
+		return false, utils.Success
+	}
+	var pullRspEnv wifi.PullResponseEnvelope
+	rc = service.EnumPullUnmarshal(
+		service.cimMessages.WiFiEndpointSettings.Enumerate,
+		service.cimMessages.WiFiEndpointSettings.Pull,
+		&pullRspEnv,
+	)
+	if rc != utils.Success {
+		return false, rc
+	}
+	current := make(map[string]wifi.CIMWiFiEndpointSettings)
+	for _, wifiSetting := range pullRspEnv.Body.PullResponse.Items {
+		if wifiSetting.InstanceID != "" {
+			current[wifiSetting.ElementName] = wifiSetting
+		}
+	}
+	if len(current) != len(service.flags.LocalConfig.WifiConfigs) {
+		return false, utils.Success
+	}
+	for _, cfg := range service.flags.LocalConfig.WifiConfigs {
+		wifiSetting, ok := current[cfg.ProfileName]
+		if !ok || wifiSetting.SSID != cfg.SSID || wifiSetting.Priority != cfg.Priority ||
+			wifiSetting.AuthenticationMethod != cfg.AuthenticationMethod || wifiSetting.EncryptionMethod != cfg.EncryptionMethod {
+			return false, utils.Success
+		}
+	}
+	return true, utils.Success
+}
+
+func (service *ProvisioningService) checkRedirection() (bool, utils.ReturnCode) {
+	current, rc := service.GetRedirectionState()
+	if rc != utils.Success {
+		return false, rc
+	}
+	return redirectionMatches(current, service.flags.LocalConfig.Redirection), utils.Success
+}
+
+// redirectionMatches follows ConfigureRedirection, which also enables the
+// listener for any enabled feature
+func redirectionMatches(current redirectionState, cfg config.RedirectionConfig) bool {
+	sol, ider, kvm := current.SOL, current.IDER, current.KVM
+	for _, setting := range []struct {
+		value  *bool
+		config *bool
+	}{{&sol, cfg.SOL}, {&ider, cfg.IDER}, {&kvm, cfg.KVM}} {
+		if setting.config != nil {
+			*setting.value = *setting.config
+		}
+	}
+	if sol != current.SOL || ider != current.IDER || kvm != current.KVM {
+		return false
+	}
+	if current.ListenerEnabled != (sol || ider || kvm) {
+		return false
+	}
+	return cfg.UserConsent == "" || cfg.UserConsent == current.UserConsent
+}
+
+// ciraStep replaces MPS servers and policy rules that differ from the
+// configuration, and only updates environment detection when the MPS matches
+func (service *ProvisioningService) ciraStep() applyStep {
+	cfg := service.flags.LocalConfig.CIRA
+	var servers []mpServer
+	var rules []policyRule
+	var mpsInSync bool
+	return applyStep{"cira", func() (bool, utils.ReturnCode) {
+		var rc utils.ReturnCode
+		if servers, rc = service.GetMPServers(); rc != utils.Success {
+			return false, rc
+		}
+		if rules, rc = service.GetRemoteAccessPolicyRules(); rc != utils.Success {
+			return false, rc
+		}
+		mpsInSync = len(servers) == 1 && servers[0].AccessInfo == cfg.MPSAddress &&
+			servers[0].Port == cfg.MPSPort && servers[0].CN == cfg.CommonName
+		hasPeriodicRule := false
+		for _, rule := range rules {
+			hasPeriodicRule = hasPeriodicRule || rule.Trigger == int(remoteaccess.Periodic)
+		}
+		mpsInSync = mpsInSync && hasPeriodicRule
+		if !mpsInSync || len(cfg.EnvironmentDetection) == 0 {
+			return mpsInSync, utils.Success
+		}
+		var getRsp environmentDetectionResponse
+		rc = service.PostAndUnmarshal(service.amtMessages.EnvironmentDetectionSettingData.Get(), &getRsp)
+		current := getRsp.Body.SettingData.DetectionStrings
+		return strings.Join(current, ",") == strings.Join(cfg.EnvironmentDetection, ","), rc
+	}, func() utils.ReturnCode {
+		if mpsInSync {
+			return service.SetEnvironmentDetection(cfg.EnvironmentDetection)
+		}
+		rc := service.RemoveCIRAConfiguration(rules, servers)
+		if rc != utils.Success {
+			return rc
+		}
+		return service.ConfigureCIRA()
+	}}
+}
+
+// checkTLS also returns whether remote TLS is enabled, when it is only the
+// settings need to change and the certificates stay
+func (service *ProvisioningService) checkTLS() (tlsEnabled bool, inSync bool, rc utils.ReturnCode) {
+	var pullRsp tls.Response
+	rc = service.EnumPullUnmarshal(
+		service.amtMessages.TLSSettingData.Enumerate,
+		service.amtMessages.TLSSettingData.Pull,
+		&pullRsp,
+	)
+	if rc != utils.Success {
+		return false, false, rc
+	}
+	tlsMode := service.flags.ConfigTLSInfo.TLSMode
+	mutual := tlsMode == flags.TLSModeMutual || tlsMode == flags.TLSModeMutualAndNonTLS
+	nonTLS := tlsMode == flags.TLSModeServerAndNonTLS || tlsMode == flags.TLSModeMutualAndNonTLS
+	inSync = true
+	for _, item := range pullRsp.Body.PullResponse.TlsSettingItems {
+		switch item.InstanceID {
+		case RemoteTLSInstanceId:
+			tlsEnabled = item.Enabled
+			nonTLSSupported := item.NonSecureConnectionsSupported == nil || *item.NonSecureConnectionsSupported
+			inSync = inSync && item.Enabled && item.MutualAuthentication == mutual &&
+				(!nonTLSSupported || item.AcceptNonSecureConnections == nonTLS)
+		case LocalTLSInstanceId:
+			inSync = inSync && item.Enabled
+		}
+	}
+	return tlsEnabled, inSync && tlsEnabled, utils.Success
+}
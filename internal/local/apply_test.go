@@ -0,0 +1,98 @@
+package local
+
+import (
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	orig := mockControlMode
+	defer func() { mockControlMode = orig }()
+	t.Run("expect Success without changes when in sync", func(t *testing.T) {
+		mockControlMode = 1
+		f := &flags.Flags{}
+		f.LocalConfig.Hostname = "client01"
+		f.LocalConfig.Redirection = config.RedirectionConfig{SOL: boolPtr(true), IDER: boolPtr(true), KVM: boolPtr(false)}
+		var requests []string
+		responses := ResponseFuncArray{
+			respondCaptureFunc(t, generalSettingsHostnameXMLResponse("client01", "vprodemo.com"), &requests),
+		}
+		responses = append(responses, redirectionStateResponses(t, 32771, true, kvmDisabled, true, 0, &requests)...)
+		lps := setupWsmanResponses(t, f, responses)
+		rc := lps.Apply()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, requests, 5)
+	})
+	t.Run("expect Success applying only what differs", func(t *testing.T) {
+		mockControlMode = 1
+		f := &flags.Flags{}
+		f.LocalConfig.Hostname = "client02"
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, generalSettingsHostnameXMLResponse("client01", "vprodemo.com"), &requests),
+			respondCaptureFunc(t, generalSettingsHostnameXMLResponse("client01", "vprodemo.com"), &requests),
+			respondCaptureFunc(t, generalSettingsHostnameXMLResponse("client02", "vprodemo.com"), &requests),
+		})
+		rc := lps.Apply()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[2], "<h:HostName>client02</h:HostName><h:DomainName>vprodemo.com</h:DomainName>")
+	})
+	t.Run("expect ControlModeMismatch", func(t *testing.T) {
+		mockControlMode = 1
+		f := &flags.Flags{}
+		f.LocalConfig.Activation = "acm"
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.Apply()
+		assert.Equal(t, utils.ControlModeMismatch, rc)
+	})
+	t.Run("expect UnableToActivate without activation", func(t *testing.T) {
+		mockControlMode = 0
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.Apply()
+		assert.Equal(t, utils.UnableToActivate, rc)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		mockControlMode = 2
+		f := &flags.Flags{}
+		f.LocalConfig.Hostname = "client01"
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		rc := lps.Apply()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestEthernetPortSettingsMatch(t *testing.T) {
+	current := ethernetPortSettings{
+		IPAddress:      "192.168.1.10",
+		SubnetMask:     "255.255.255.0",
+		DefaultGateway: "192.168.1.1",
+		PrimaryDNS:     "192.168.1.2",
+	}
+	static := config.WiredConfig{
+		IPAddress:  "192.168.1.10",
+		SubnetMask: "255.255.255.0",
+		Gateway:    "192.168.1.1",
+		PrimaryDNS: "192.168.1.2",
+	}
+	assert.True(t, ethernetPortSettingsMatch(current, getEthernetPortSettingsPutData(current, static)))
+	static.PrimaryDNS = "192.168.1.3"
+	assert.False(t, ethernetPortSettingsMatch(current, getEthernetPortSettingsPutData(current, static)))
+	assert.False(t, ethernetPortSettingsMatch(current, getEthernetPortSettingsPutData(current, config.WiredConfig{DHCP: true})))
+}
+
+func TestRedirectionMatches(t *testing.T) {
+	current := redirectionState{SOL: true, IDER: false, KVM: true, ListenerEnabled: true, UserConsent: "kvm"}
+	assert.True(t, redirectionMatches(current, config.RedirectionConfig{SOL: boolPtr(true)}))
+	assert.True(t, redirectionMatches(current, config.RedirectionConfig{UserConsent: "kvm"}))
+	assert.False(t, redirectionMatches(current, config.RedirectionConfig{IDER: boolPtr(true)}))
+	assert.False(t, redirectionMatches(current, config.RedirectionConfig{UserConsent: "all"}))
+	assert.False(t, redirectionMatches(current, config.RedirectionConfig{SOL: boolPtr(false), KVM: boolPtr(false)}))
+	current.ListenerEnabled = false
+	assert.False(t, redirectionMatches(current, config.RedirectionConfig{SOL: boolPtr(true)}))
+}
@@ -0,0 +1,523 @@
+package local
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publickey"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/tls"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/models"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/wifi"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/ips/ieee8021x"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	publicKeyCertificateURI = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate"
+	publicPrivateKeyPairURI = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicPrivateKeyPair"
+)
+
+// wiredIeee8021xProfileName names the wired 802.1x profile of a backup, the secrets file uses it
+const wiredIeee8021xProfileName = "wired"
+
+// go-wsman-messages has no response type for CIM_IEEE8021xSettings, the 802.1x
+// settings of the wifi profiles
+type wifiIeee8021xSettingsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		PullResponse struct {
+			Items []wifiIeee8021xSettings `xml:"Items>CIM_IEEE8021xSettings"`
+		} `xml:"PullResponse"`
+	} `xml:"Body"`
+}
+
+type wifiIeee8021xSettings struct {
+	ElementName            string `xml:"ElementName"`
+	InstanceID             string `xml:"InstanceID"`
+	AuthenticationProtocol int    `xml:"AuthenticationProtocol"`
+	Username               string `xml:"Username"`
+}
+
+// backupState is the archive the backup steps fill in, with the certificates
+// by InstanceID and the certificates of each 802.1x settings instance
+type backupState struct {
+	config.Backup
+	certificates          map[string]*config.BackupCertificate
+	ieee8021xCertificates map[string][]string
+	mpsCertificates       map[string]string
+}
+
+// Backup reads everything this tool configures into an encrypted archive.
+// The certificates are read first, the 802.1x and CIRA steps refer to them.
+func (service *ProvisioningService) Backup() utils.ReturnCode {
+	controlMode, err := service.amtCommand.GetControlMode()
+	if err != nil {
+		log.Error(err)
+		return utils.AMTConnectionFailed
+	}
+	if controlMode == 0 {
+		log.Error("device is not activated, there is no configuration to back up")
+		return utils.BackupFailed
+	}
+	service.setupWsmanClient("admin", service.flags.Password)
+	state := backupState{
+		Backup:                config.Backup{Created: time.Now().UTC(), ControlMode: controlMode},
+		certificates:          make(map[string]*config.BackupCertificate),
+		ieee8021xCertificates: make(map[string][]string),
+		mpsCertificates:       make(map[string]string),
+	}
+	// ACM needs the provisioning certificate, restore leaves it to rpc activate
+	if controlMode == 1 {
+		state.Config.Activation = "ccm"
+	}
+	for _, step := range []func(*backupState) utils.ReturnCode{
+		service.backupCertificates,
+		service.backupGeneralSettings,
+		service.backupWired,
+		service.backupWifi,
+		service.backupRedirection,
+		service.backupCIRA,
+		service.backupTLS,
+		service.backupUsers,
+	} {
+		if rc := step(&state); rc != utils.Success {
+			return rc
+		}
+	}
+	archive, err := config.EncryptBackup(state.Backup, service.flags.BackupPassphrase)
+	if err != nil {
+		log.Error(err)
+		return utils.BackupFailed
+	}
+	if err := os.WriteFile(service.flags.BackupFile, archive, 0600); err != nil {
+		log.Error(err)
+		return utils.BackupFailed
+	}
+	cfg := state.Config
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{
+			"file":         service.flags.BackupFile,
+			"wifiProfiles": len(cfg.WifiConfigs),
+			"certificates": len(state.Certificates),
+			"users":        len(cfg.Users),
+		})
+	}
+	log.Infof("saved %d wifi profiles, %d certificates and %d users to %s",
+		len(cfg.WifiConfigs), len(state.Certificates), len(cfg.Users), service.flags.BackupFile)
+	return utils.Success
+}
+
+// backupCertificates reads the public part of every certificate, which
+// settings use it, and whether AMT holds its private key
+func (service *ProvisioningService) backupCertificates(state *backupState) utils.ReturnCode {
+	var certs []publickey.PublicKeyCertificate
+	rc := service.GetPublicKeyCerts(&certs)
+	if rc != utils.Success {
+		return rc
+	}
+	credentials, rc := service.GetCredentialRelationships()
+	if rc != utils.Success {
+		return rc
+	}
+	dependencies, rc := service.GetConcreteDependencies()
+	if rc != utils.Success {
+		return rc
+	}
+	usedBy := make(map[string]string)
+	for i := range credentials {
+		inContext := &credentials[i].ElementInContext.ReferenceParameters
+		providing := &credentials[i].ElementProvidingContext.ReferenceParameters
+		if inContext.ResourceURI != publicKeyCertificateURI {
+			continue
+		}
+		id := inContext.GetSelectorValue("InstanceID")
+		usedBy[id] = providing.ResourceURI[strings.LastIndex(providing.ResourceURI, "/")+1:]
+		if strings.HasSuffix(providing.ResourceURI, "IEEE8021xSettings") {
+			settingsID := providing.GetSelectorValue("InstanceID")
+			state.ieee8021xCertificates[settingsID] = append(state.ieee8021xCertificates[settingsID], id)
+		}
+		if strings.HasSuffix(providing.ResourceURI, "AMT_ManagementPresenceRemoteSAP") {
+			state.mpsCertificates[providing.GetSelectorValue("Name")] = id
+		}
+	}
+	keyPairs := make(map[string]bool)
+	for i := range dependencies {
+		antecedent := &dependencies[i].Antecedent.ReferenceParameters
+		if antecedent.ResourceURI == publicKeyCertificateURI && dependencies[i].Dependent.ReferenceParameters.ResourceURI == publicPrivateKeyPairURI {
+			keyPairs[antecedent.GetSelectorValue("InstanceID")] = true
+		}
+	}
+	state.Certificates = make([]config.BackupCertificate, 0, len(certs))
+	for _, cert := range certs {
+		state.Certificates = append(state.Certificates, config.BackupCertificate{
+			InstanceID:      cert.InstanceID,
+			X509Certificate: cert.X509Certificate,
+			TrustedRoot:     cert.TrustedRootCertficate,
+			HasKeyPair:      keyPairs[cert.InstanceID],
+			UsedBy:          usedBy[cert.InstanceID],
+		})
+	}
+	for i := range state.Certificates {
+		state.certificates[state.Certificates[i].InstanceID] = &state.Certificates[i]
+	}
+	markIssuers(state.Certificates)
+	return utils.Success
+}
+
+// markIssuers marks the trusted roots that signed a certificate AMT holds
+// the key of, such as the TLS certificate, so backupCIRA does not take them
+// for the MPS root
+func markIssuers(certs []config.BackupCertificate) {
+	parse := func(cert config.BackupCertificate) *x509.Certificate {
+		der, err := base64.StdEncoding.DecodeString(cert.X509Certificate)
+		if err != nil {
+			return nil
+		}
+		parsed, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil
+		}
+		return parsed
+	}
+	for i := range certs {
+		if !certs[i].HasKeyPair {
+			continue
+		}
+		issued := parse(certs[i])
+		for j := range certs {
+			if !certs[j].TrustedRoot || certs[j].UsedBy != "" || issued == nil {
+				continue
+			}
+			if root := parse(certs[j]); root != nil && issued.CheckSignatureFrom(root) == nil {
+				certs[j].UsedBy = "issuer of " + certs[i].InstanceID
+			}
+		}
+	}
+}
+
+// useIeee8021xCertificates sets the certificates of an 802.1x settings instance in the profile
+func (state *backupState) useIeee8021xCertificates(settingsID string, profile *config.Ieee8021xConfig, usedBy string) {
+	for _, id := range state.ieee8021xCertificates[settingsID] {
+		cert, ok := state.certificates[id]
+		if !ok {
+			continue
+		}
+		cert.UsedBy = usedBy
+		if cert.TrustedRoot {
+			profile.CACert = cert.X509Certificate
+		} else {
+			profile.ClientCert = cert.X509Certificate
+		}
+	}
+}
+
+func (service *ProvisioningService) backupGeneralSettings(state *backupState) utils.ReturnCode {
+	current, rc := service.getGeneralSettings()
+	if rc != utils.Success {
+		return rc
+	}
+	state.Config.Hostname = current.HostName
+	state.Config.DomainName = current.DomainName
+	return utils.Success
+}
+
+func (service *ProvisioningService) backupWired(state *backupState) utils.ReturnCode {
+	current, rc := service.getEthernetPortSettings()
+	if rc != utils.Success {
+		return rc
+	}
+	wired := config.WiredConfig{DHCP: current.DHCPEnabled, IPSync: current.IpSyncEnabled}
+	if !wired.DHCP && !wired.IPSync {
+		if current.IPAddress == "" {
+			log.Warn("skipping the wired network settings, they have no static IP address")
+			return utils.Success
+		}
+		wired.IPAddress = current.IPAddress
+		wired.SubnetMask = current.SubnetMask
+		wired.Gateway = current.DefaultGateway
+		wired.PrimaryDNS = current.PrimaryDNS
+		wired.SecondaryDNS = current.SecondaryDNS
+	}
+	var getRsp ieee8021xSettingsResponse
+	rc = service.PostAndUnmarshal(service.ipsMessages.IEEE8021xSettings.Get(), &getRsp)
+	if rc != utils.Success {
+		return rc
+	}
+	settings := getRsp.Body.IEEE8021xSettings
+	if settings.Enabled == int(ieee8021x.EnabledWithCertificates) {
+		profile := config.Ieee8021xConfig{
+			ProfileName:            wiredIeee8021xProfileName,
+			Username:               settings.Username,
+			AuthenticationProtocol: settings.AuthenticationProtocol,
+		}
+		state.useIeee8021xCertificates(settings.InstanceID, &profile, "wired 802.1x")
+		state.Config.Ieee8021xConfigs = append(state.Config.Ieee8021xConfigs, profile)
+		wired.Ieee8021xProfileName = wiredIeee8021xProfileName
+	}
+	state.Config.Wired = wired
+	return utils.Success
+}
+
+// backupWifi finds the 802.1x settings of a profile by name, AMT names them after the profile
+func (service *ProvisioningService) backupWifi(state *backupState) utils.ReturnCode {
+	var pullRspEnv wifi.PullResponseEnvelope
+	rc := service.EnumPullUnmarshal(
+		service.cimMessages.WiFiEndpointSettings.Enumerate,
+		service.cimMessages.WiFiEndpointSettings.Pull,
+		&pullRspEnv,
+	)
+	if rc != utils.Success {
+		return rc
+	}
+	var ieee8021xRsp wifiIeee8021xSettingsResponse
+	for _, wifiSetting := range pullRspEnv.Body.PullResponse.Items {
+		authenticationMethod := models.AuthenticationMethod(wifiSetting.AuthenticationMethod)
+		if authenticationMethod == models.AuthenticationMethod_WPA_IEEE8021x || authenticationMethod == models.AuthenticationMethod_WPA2_IEEE8021x {
+			rc = service.EnumPullUnmarshal(
+				service.cimMessages.IEEE8021xSettings.Enumerate,
+				service.cimMessages.IEEE8021xSettings.Pull,
+				&ieee8021xRsp,
+			)
+			if rc != utils.Success {
+				return rc
+			}
+			break
+		}
+	}
+	for _, wifiSetting := range pullRspEnv.Body.PullResponse.Items {
+		if wifiSetting.InstanceID == "" {
+			continue
+		}
+		wifiCfg := config.WifiConfig{
+			ProfileName:          wifiSetting.ElementName,
+			SSID:                 wifiSetting.SSID,
+			Priority:             wifiSetting.Priority,
+			AuthenticationMethod: wifiSetting.AuthenticationMethod,
+			EncryptionMethod:     wifiSetting.EncryptionMethod,
+		}
+		authenticationMethod := models.AuthenticationMethod(wifiSetting.AuthenticationMethod)
+		if authenticationMethod == models.AuthenticationMethod_WPA_IEEE8021x || authenticationMethod == models.AuthenticationMethod_WPA2_IEEE8021x {
+			var settings *wifiIeee8021xSettings
+			for i, item := range ieee8021xRsp.Body.PullResponse.Items {
+				if item.ElementName == wifiCfg.ProfileName || strings.HasSuffix(item.InstanceID, " "+wifiCfg.ProfileName) {
+					settings = &ieee8021xRsp.Body.PullResponse.Items[i]
+					break
+				}
+			}
+			if settings == nil {
+				log.Warnf("skipping wifi profile %s, its 802.1x settings were not found", wifiCfg.ProfileName)
+				continue
+			}
+			profile := config.Ieee8021xConfig{
+				ProfileName:            wifiCfg.ProfileName,
+				Username:               settings.Username,
+				AuthenticationProtocol: settings.AuthenticationProtocol,
+			}
+			state.useIeee8021xCertificates(settings.InstanceID, &profile, "wifi profile "+wifiCfg.ProfileName)
+			state.Config.Ieee8021xConfigs = append(state.Config.Ieee8021xConfigs, profile)
+			wifiCfg.Ieee8021xProfileName = profile.ProfileName
+		}
+		state.Config.WifiConfigs = append(state.Config.WifiConfigs, wifiCfg)
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) backupRedirection(state *backupState) utils.ReturnCode {
+	current, rc := service.GetRedirectionState()
+	if rc != utils.Success {
+		return rc
+	}
+	sol, ider, kvm := current.SOL, current.IDER, current.KVM
+	state.Config.Redirection = config.RedirectionConfig{SOL: &sol, IDER: &ider, KVM: &kvm}
+	if _, ok := userConsentPolicies[current.UserConsent]; ok {
+		state.Config.Redirection.UserConsent = current.UserConsent
+	}
+	return utils.Success
+}
+
+// backupCIRA takes the MPS root from the credential context AddMpServer
+// created, without one the restore needs the root with -mpsCert
+func (service *ProvisioningService) backupCIRA(state *backupState) utils.ReturnCode {
+	servers, rc := service.GetMPServers()
+	if rc != utils.Success || len(servers) == 0 {
+		return rc
+	}
+	if len(servers) > 1 {
+		log.Warnf("backing up the first of %d MPS servers", len(servers))
+	}
+	cira := config.CIRAConfig{
+		MPSAddress: servers[0].AccessInfo,
+		MPSPort:    servers[0].Port,
+		CommonName: servers[0].CN,
+	}
+	if cert := state.certificates[state.mpsCertificates[servers[0].Name]]; cert != nil {
+		cert.UsedBy = "cira"
+		cira.MPSCert = cert.X509Certificate
+	} else {
+		log.Warn("AMT does not link the MPS to its root certificate, restore needs it with -mpsCert")
+	}
+	var getRsp environmentDetectionResponse
+	rc = service.PostAndUnmarshal(service.amtMessages.EnvironmentDetectionSettingData.Get(), &getRsp)
+	if rc != utils.Success {
+		return rc
+	}
+	cira.EnvironmentDetection = getRsp.Body.SettingData.DetectionStrings
+	state.Config.CIRA = cira
+	return utils.Success
+}
+
+func (service *ProvisioningService) backupTLS(state *backupState) utils.ReturnCode {
+	var pullRsp tls.Response
+	rc := service.EnumPullUnmarshal(
+		service.amtMessages.TLSSettingData.Enumerate,
+		service.amtMessages.TLSSettingData.Pull,
+		&pullRsp,
+	)
+	if rc != utils.Success {
+		return rc
+	}
+	for _, item := range pullRsp.Body.PullResponse.TlsSettingItems {
+		if item.InstanceID != RemoteTLSInstanceId || !item.Enabled {
+			continue
+		}
+		nonTLS := (item.NonSecureConnectionsSupported == nil || *item.NonSecureConnectionsSupported) && item.AcceptNonSecureConnections
+		mode := flags.TLSModeServer
+		switch {
+		case item.MutualAuthentication && nonTLS:
+			mode = flags.TLSModeMutualAndNonTLS
+		case item.MutualAuthentication:
+			mode = flags.TLSModeMutual
+		case nonTLS:
+			mode = flags.TLSModeServerAndNonTLS
+		}
+		state.Config.TLS.Mode = mode.String()
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) backupUsers(state *backupState) utils.ReturnCode {
+	entries, rc := service.GetUserAclEntries()
+	if rc != utils.Success {
+		return rc
+	}
+	for _, entry := range entries {
+		if entry.Username == "" {
+			log.Warnf("skipping Kerberos user %s, only digest users are backed up", entry.KerberosUserSid)
+			continue
+		}
+		state.Config.Users = append(state.Config.Users, config.UserConfig{
+			Username:         entry.Username,
+			AccessPermission: entry.AccessPermission,
+			Realms:           entry.Realms,
+		})
+	}
+	return utils.Success
+}
+
+// Restore applies the configuration of the archive, then adds the
+// certificates and users apply does not manage
+func (service *ProvisioningService) Restore() utils.ReturnCode {
+	rc := service.Apply()
+	if rc != utils.Success {
+		return rc
+	}
+	if service.plan != nil {
+		// the dry run stopped after activation
+		if controlMode, err := service.amtCommand.GetControlMode(); err == nil && controlMode == 0 {
+			return utils.Success
+		}
+	}
+	certificatesRc := service.restoreCertificates()
+	usersRc := service.restoreUsers()
+	if certificatesRc != utils.Success || usersRc != utils.Success {
+		return utils.RestoreFailed
+	}
+	log.Info("restored the backup")
+	return utils.Success
+}
+
+// restoreCertificates adds the trusted roots and client certificates the
+// profiles did not add again. A certificate AMT held the private key of
+// stays out, the TLS step made a new one.
+func (service *ProvisioningService) restoreCertificates() utils.ReturnCode {
+	var current []publickey.PublicKeyCertificate
+	rc := service.GetPublicKeyCerts(&current)
+	if rc != utils.Success {
+		return rc
+	}
+	present := make(map[string]bool)
+	for _, cert := range current {
+		present[cert.X509Certificate] = true
+	}
+	service.handlesWithCerts = make(map[string]string)
+	var failed []string
+	for _, cert := range service.flags.RestoreCertificates {
+		if present[cert.X509Certificate] {
+			continue
+		}
+		if cert.HasKeyPair {
+			log.Warnf("not restoring certificate %s, AMT kept its private key", cert.InstanceID)
+			continue
+		}
+		log.Infof("adding certificate %s", cert.InstanceID)
+		if cert.TrustedRoot {
+			_, rc = service.AddTrustedRootCert(cert.X509Certificate)
+		} else {
+			_, rc = service.AddClientCert(cert.X509Certificate)
+		}
+		if rc != utils.Success {
+			failed = append(failed, cert.InstanceID)
+		}
+	}
+	if len(failed) > 0 {
+		log.Errorf("failed restoring certificates %s", strings.Join(failed, ", "))
+		return utils.RestoreFailed
+	}
+	return utils.Success
+}
+
+// restoreUsers adds the missing users and updates the others, AMT sets the
+// passwords from the secrets file or prompts
+func (service *ProvisioningService) restoreUsers() utils.ReturnCode {
+	if len(service.flags.LocalConfig.Users) == 0 {
+		return utils.Success
+	}
+	entries, rc := service.GetUserAclEntries()
+	if rc != utils.Success {
+		return rc
+	}
+	generalSettings, err := service.GetGeneralSettings()
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	digestRealm := generalSettings.Body.AMTGeneralSettings.DigestRealm
+	handles := make(map[string]int)
+	for _, entry := range entries {
+		handles[entry.Username] = entry.Handle
+	}
+	var failed []string
+	for _, user := range service.flags.LocalConfig.Users {
+		if handle, exists := handles[user.Username]; exists {
+			rc = service.UpdateUser(handle, user, digestRealm)
+		} else {
+			rc = service.AddUser(user, digestRealm)
+		}
+		if rc != utils.Success {
+			failed = append(failed, user.Username)
+		}
+	}
+	if len(failed) > 0 {
+		log.Errorf("failed restoring users %s", strings.Join(failed, ", "))
+		return utils.RestoreFailed
+	}
+	return utils.Success
+}
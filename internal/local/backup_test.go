@@ -0,0 +1,219 @@
+package local
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publickey"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/concrete"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/wifi"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var mpsCredentialContextXMLResponse = wsmanEnvelope("http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_CredentialContext", `<g:PullResponse><g:Items><h:CIM_CredentialContext><h:ElementInContext><b:Address>/wsman</b:Address><b:ReferenceParameters><c:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate</c:ResourceURI><c:SelectorSet><c:Selector Name="InstanceID">%s</c:Selector></c:SelectorSet></b:ReferenceParameters></h:ElementInContext><h:ElementProvidingContext><b:Address>/wsman</b:Address><b:ReferenceParameters><c:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_ManagementPresenceRemoteSAP</c:ResourceURI><c:SelectorSet><c:Selector Name="CreationClassName">AMT_ManagementPresenceRemoteSAP</c:Selector><c:Selector Name="Name">`+mpsHandle+`</c:Selector><c:Selector Name="SystemCreationClassName">CIM_ComputerSystem</c:Selector><c:Selector Name="SystemName">Intel(r) AMT</c:Selector></c:SelectorSet></b:ReferenceParameters></h:ElementProvidingContext></h:CIM_CredentialContext></g:Items><g:EndOfSequence></g:EndOfSequence></g:PullResponse>`)
+var mpServerPullXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_ManagementPresenceRemoteSAP", `<g:PullResponse><g:Items><h:AMT_ManagementPresenceRemoteSAP><h:AccessInfo>mps.example.com</h:AccessInfo><h:CN>mps.example.com</h:CN><h:InfoFormat>201</h:InfoFormat><h:Name>`+mpsHandle+`</h:Name><h:Port>4433</h:Port></h:AMT_ManagementPresenceRemoteSAP></g:Items></g:PullResponse>`)
+
+func publicKeyCertsResponse(items ...publickey.PublicKeyCertificate) publickey.PullResponseEnvelope {
+	pullRspEnv := publickey.PullResponseEnvelope{}
+	pullRspEnv.Body.PullResponse.Items = items
+	return pullRspEnv
+}
+
+func TestMarkIssuers(t *testing.T) {
+	chain := getTestCerts()
+	backupCerts := []config.BackupCertificate{
+		{InstanceID: "root", X509Certificate: chain.Root.StripPem(), TrustedRoot: true},
+		{InstanceID: "intermediate", X509Certificate: chain.Intermediate.StripPem(), TrustedRoot: true},
+		{InstanceID: "leaf", X509Certificate: chain.Leaf.StripPem(), HasKeyPair: true},
+		{InstanceID: "broken", X509Certificate: "not base64", TrustedRoot: true},
+	}
+	markIssuers(backupCerts)
+	assert.Equal(t, "", backupCerts[0].UsedBy)
+	assert.Equal(t, "issuer of leaf", backupCerts[1].UsedBy)
+	assert.Equal(t, "", backupCerts[3].UsedBy)
+}
+
+func TestBackup(t *testing.T) {
+	orig := mockControlMode
+	defer func() { mockControlMode = orig }()
+	mpsRoot := getTestCerts().Root.StripPem()
+	otherRoot := getTestCerts().Intermediate.StripPem()
+	backupResponses := func(t *testing.T, credentials string, requests *[]string, certs ...publickey.PublicKeyCertificate) ResponseFuncArray {
+		wifiPullRspEnv := wifi.PullResponseEnvelope{}
+		wifiPullRspEnv.Body.PullResponse.Items = []wifi.CIMWiFiEndpointSettings{
+			{InstanceID: "Intel(r) AMT:WiFi Endpoint Settings home", ElementName: "home", SSID: "ssid", Priority: 1, AuthenticationMethod: 6, EncryptionMethod: 4},
+		}
+		responses := ResponseFuncArray{
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondMsgFunc(t, publicKeyCertsResponse(certs...)),
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, credentials),
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondMsgFunc(t, concrete.DependencyPullResponseEnvelope{}),
+			respondStringFunc(t, generalSettingsHostnameXMLResponse("device01", "vprodemo.com")),
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+			respondStringFunc(t, ieee8021xSettingsXMLResponse),
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondMsgFunc(t, wifiPullRspEnv),
+		}
+		responses = append(responses, redirectionStateResponses(t, 32771, true, kvmDisabled, true, 0, requests)...)
+		responses = append(responses,
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, mpServerPullXMLResponse),
+			respondStringFunc(t, environmentDetectionXMLResponse),
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, tlsSettingsXMLResponse),
+		)
+		return append(responses, userAclEntriesResponses(t, requests)...)
+	}
+	t.Run("expect Success writing the archive", func(t *testing.T) {
+		mockControlMode = 1
+		f := &flags.Flags{BackupFile: filepath.Join(t.TempDir(), "device01.rpcbak"), BackupPassphrase: "secret"}
+		var requests []string
+		lps := setupWsmanResponses(t, f, backupResponses(t, fmt.Sprintf(mpsCredentialContextXMLResponse, "Intel(r) AMT Certificate: Handle: 1"), &requests,
+			publickey.PublicKeyCertificate{InstanceID: "Intel(r) AMT Certificate: Handle: 0", X509Certificate: otherRoot, TrustedRootCertficate: true},
+			publickey.PublicKeyCertificate{InstanceID: "Intel(r) AMT Certificate: Handle: 1", X509Certificate: mpsRoot, TrustedRootCertficate: true},
+		))
+		rc := lps.Backup()
+		assert.Equal(t, utils.Success, rc)
+
+		archive, err := os.ReadFile(f.BackupFile)
+		assert.Nil(t, err)
+		backup, err := config.DecryptBackup(archive, "secret")
+		assert.Nil(t, err)
+		cfg := backup.Config
+		assert.Equal(t, 1, backup.ControlMode)
+		assert.Equal(t, "ccm", cfg.Activation)
+		assert.Equal(t, "device01", cfg.Hostname)
+		assert.Equal(t, config.WiredConfig{DHCP: true, IPSync: true}, cfg.Wired)
+		assert.Equal(t, config.WifiConfigs{{ProfileName: "home", SSID: "ssid", Priority: 1, AuthenticationMethod: 6, EncryptionMethod: 4}}, cfg.WifiConfigs)
+		assert.Equal(t, true, *cfg.Redirection.SOL)
+		assert.Equal(t, false, *cfg.Redirection.KVM)
+		assert.Equal(t, "mps.example.com", cfg.CIRA.MPSAddress)
+		assert.Equal(t, 4433, cfg.CIRA.MPSPort)
+		assert.Equal(t, mpsRoot, cfg.CIRA.MPSCert)
+		assert.Equal(t, "Server", cfg.TLS.Mode)
+		assert.Equal(t, "monitor", cfg.Users[0].Username)
+		assert.Equal(t, "", backup.Certificates[0].UsedBy)
+		assert.Equal(t, "cira", backup.Certificates[1].UsedBy)
+	})
+	t.Run("expect no MPS root without the credential context of the MPS", func(t *testing.T) {
+		mockControlMode = 1
+		f := &flags.Flags{BackupFile: filepath.Join(t.TempDir(), "device01.rpcbak"), BackupPassphrase: "secret"}
+		var requests []string
+		lps := setupWsmanResponses(t, f, backupResponses(t, wsmanEnvelope("http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_CredentialContext", `<g:PullResponse><g:Items></g:Items><g:EndOfSequence></g:EndOfSequence></g:PullResponse>`), &requests,
+			publickey.PublicKeyCertificate{InstanceID: "Intel(r) AMT Certificate: Handle: 0", X509Certificate: otherRoot, TrustedRootCertficate: true},
+			publickey.PublicKeyCertificate{InstanceID: "Intel(r) AMT Certificate: Handle: 1", X509Certificate: mpsRoot, TrustedRootCertficate: true},
+		))
+		rc := lps.Backup()
+		assert.Equal(t, utils.Success, rc)
+
+		archive, err := os.ReadFile(f.BackupFile)
+		assert.Nil(t, err)
+		backup, err := config.DecryptBackup(archive, "secret")
+		assert.Nil(t, err)
+		assert.Equal(t, "mps.example.com", backup.Config.CIRA.MPSAddress)
+		assert.Equal(t, "", backup.Config.CIRA.MPSCert)
+		assert.Equal(t, "", backup.Certificates[0].UsedBy)
+		assert.Equal(t, "", backup.Certificates[1].UsedBy)
+	})
+	t.Run("expect BackupFailed before activation", func(t *testing.T) {
+		mockControlMode = 0
+		f := &flags.Flags{BackupFile: filepath.Join(t.TempDir(), "device01.rpcbak")}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.Backup()
+		assert.Equal(t, utils.BackupFailed, rc)
+		_, err := os.Stat(f.BackupFile)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		mockControlMode = 1
+		f := &flags.Flags{BackupFile: filepath.Join(t.TempDir(), "device01.rpcbak")}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		rc := lps.Backup()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+		_, err := os.Stat(f.BackupFile)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestRestoreCertificates(t *testing.T) {
+	f := &flags.Flags{RestoreCertificates: []config.BackupCertificate{
+		{InstanceID: "Intel(r) AMT Certificate: Handle: 0", X509Certificate: "MIIBmpsroot", TrustedRoot: true, UsedBy: "cira"},
+		{InstanceID: "Intel(r) AMT Certificate: Handle: 1", X509Certificate: "MIIBtlscert", HasKeyPair: true},
+		{InstanceID: "Intel(r) AMT Certificate: Handle: 2", X509Certificate: "MIIBrootcert", TrustedRoot: true},
+		{InstanceID: "Intel(r) AMT Certificate: Handle: 3", X509Certificate: "MIIBclientcert"},
+	}}
+	t.Run("expect Success adding the missing certificates", func(t *testing.T) {
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondMsgFunc(t, publicKeyCertsResponse(publickey.PublicKeyCertificate{InstanceID: "Intel(r) AMT Certificate: Handle: 0", X509Certificate: "MIIBmpsroot"})),
+			respondCaptureFunc(t, trustedRootXMLResponse, &requests),
+			respondCaptureFunc(t, clientCertXMLResponse, &requests),
+		})
+		rc := lps.restoreCertificates()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, requests, 2)
+		assert.Contains(t, requests[0], "<h:CertificateBlob>MIIBrootcert</h:CertificateBlob>")
+		assert.Contains(t, requests[1], "<h:CertificateBlob>MIIBclientcert</h:CertificateBlob>")
+	})
+	t.Run("expect RestoreFailed when a certificate is not added", func(t *testing.T) {
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondMsgFunc(t, publickey.PullResponseEnvelope{}),
+			respondServerErrFunc(),
+			respondStringFunc(t, trustedRootXMLResponse),
+			respondStringFunc(t, clientCertXMLResponse),
+		})
+		rc := lps.restoreCertificates()
+		assert.Equal(t, utils.RestoreFailed, rc)
+	})
+}
+
+func TestRestoreUsers(t *testing.T) {
+	t.Run("expect Success updating and adding users", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Users = config.UserConfigs{
+			{Username: "monitor", Password: "Us3r!Pass", AccessPermission: "network", Realms: []string{"hardwareAsset"}},
+			{Username: "operator", Password: "Us3r!Pass", AccessPermission: "any", Realms: []string{"redirection"}},
+		}
+		var requests []string
+		rfa := append(userAclEntriesResponses(t, &requests),
+			respondCaptureFunc(t, generalSettingsXML, &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("UpdateUserAclEntryEx", 7, 0), &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("AddUserAclEntryEx", 8, 0), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.restoreUsers()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[3], "AMT_AuthorizationService/UpdateUserAclEntryEx</a:Action>")
+		assert.Contains(t, requests[3], "<h:Handle>7</h:Handle>")
+		assert.Contains(t, requests[4], "AMT_AuthorizationService/AddUserAclEntryEx</a:Action>")
+		assert.Contains(t, requests[4], "<h:DigestUsername>operator</h:DigestUsername>")
+	})
+	t.Run("expect RestoreFailed when a user is not added", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Users = config.UserConfigs{{Username: "operator", Password: "Us3r!Pass", AccessPermission: "any", Realms: []string{"redirection"}}}
+		var requests []string
+		rfa := append(userAclEntriesResponses(t, &requests),
+			respondCaptureFunc(t, generalSettingsXML, &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("AddUserAclEntryEx", 0, 2054), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.restoreUsers()
+		assert.Equal(t, utils.RestoreFailed, rc)
+	})
+	t.Run("expect Success without users", func(t *testing.T) {
+		lps := setupWsmanResponses(t, &flags.Flags{}, ResponseFuncArray{})
+		rc := lps.restoreUsers()
+		assert.Equal(t, utils.Success, rc)
+	})
+}
@@ -0,0 +1,329 @@
+package local
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/boot"
+	cimBoot "github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/boot"
+	log "github.com/sirupsen/logrus"
+)
+
+const BootConfigurationInstanceId = `Intel(r) AMT: Boot Configuration 0`
+
+// boot sources forced through CIM_BootConfigSetting ChangeBootOrder
+var bootSources = map[string]string{
+	flags.BootDevicePXE: "Intel(r) AMT: Force PXE Boot",
+	flags.BootDeviceCD:  "Intel(r) AMT: Force CD/DVD Boot",
+	flags.BootDeviceHDD: "Intel(r) AMT: Force Hard-drive Boot",
+}
+
+// go-wsman-messages has no envelopes for the boot classes
+type bootSettingDataResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		BootSettingData bootSettingData `xml:"AMT_BootSettingData"`
+	} `xml:"Body"`
+}
+
+type bootSettingData struct {
+	XMLName                xml.Name               `xml:"AMT_BootSettingData"`
+	H                      string                 `xml:"-"`
+	ElementName            string                 `xml:"ElementName"`
+	InstanceID             string                 `xml:"InstanceID"`
+	OwningEntity           string                 `xml:"OwningEntity"`
+	UseSOL                 bool                   `xml:"UseSOL"`
+	UseSafeMode            bool                   `xml:"UseSafeMode"`
+	ReflashBIOS            bool                   `xml:"ReflashBIOS"`
+	BIOSSetup              bool                   `xml:"BIOSSetup"`
+	BIOSPause              bool                   `xml:"BIOSPause"`
+	LockPowerButton        bool                   `xml:"LockPowerButton"`
+	LockResetButton        bool                   `xml:"LockResetButton"`
+	LockKeyboard           bool                   `xml:"LockKeyboard"`
+	LockSleepButton        bool                   `xml:"LockSleepButton"`
+	UserPasswordBypass     bool                   `xml:"UserPasswordBypass"`
+	ForcedProgressEvents   bool                   `xml:"ForcedProgressEvents"`
+	FirmwareVerbosity      boot.FirmwareVerbosity `xml:"FirmwareVerbosity"`
+	ConfigurationDataReset bool                   `xml:"ConfigurationDataReset"`
+	IDERBootDevice         boot.IDERBootDevice    `xml:"IDERBootDevice"`
+	UseIDER                bool                   `xml:"UseIDER"`
+	EnforceSecureBoot      bool                   `xml:"EnforceSecureBoot"`
+	BootMediaIndex         int                    `xml:"BootMediaIndex"`
+	SecureErase            bool                   `xml:"SecureErase"`
+	UEFIHTTPSBootEnabled   bool                   `xml:"UEFIHTTPSBootEnabled"`
+	BIOSLastStatus         []int                  `xml:"BIOSLastStatus"`
+}
+
+// bootSettingDataPut converts from bootSettingData and leaves out the read only properties
+type bootSettingDataPut struct {
+	XMLName                xml.Name               `xml:"h:AMT_BootSettingData"`
+	H                      string                 `xml:"xmlns:h,attr"`
+	ElementName            string                 `xml:"h:ElementName"`
+	InstanceID             string                 `xml:"h:InstanceID"`
+	OwningEntity           string                 `xml:"h:OwningEntity"`
+	UseSOL                 bool                   `xml:"h:UseSOL"`
+	UseSafeMode            bool                   `xml:"h:UseSafeMode"`
+	ReflashBIOS            bool                   `xml:"h:ReflashBIOS"`
+	BIOSSetup              bool                   `xml:"h:BIOSSetup"`
+	BIOSPause              bool                   `xml:"h:BIOSPause"`
+	LockPowerButton        bool                   `xml:"h:LockPowerButton"`
+	LockResetButton        bool                   `xml:"h:LockResetButton"`
+	LockKeyboard           bool                   `xml:"h:LockKeyboard"`
+	LockSleepButton        bool                   `xml:"h:LockSleepButton"`
+	UserPasswordBypass     bool                   `xml:"h:UserPasswordBypass"`
+	ForcedProgressEvents   bool                   `xml:"h:ForcedProgressEvents"`
+	FirmwareVerbosity      boot.FirmwareVerbosity `xml:"h:FirmwareVerbosity"`
+	ConfigurationDataReset bool                   `xml:"h:ConfigurationDataReset"`
+	IDERBootDevice         boot.IDERBootDevice    `xml:"h:IDERBootDevice"`
+	UseIDER                bool                   `xml:"h:UseIDER"`
+	EnforceSecureBoot      bool                   `xml:"h:EnforceSecureBoot"`
+	BootMediaIndex         int                    `xml:"h:BootMediaIndex"`
+	SecureErase            bool                   `xml:"h:SecureErase"`
+	UEFIHTTPSBootEnabled   bool                   `xml:"-"`
+	BIOSLastStatus         []int                  `xml:"-"`
+}
+
+type bootCapabilitiesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		BootCapabilities bootCapabilities `xml:"AMT_BootCapabilities"`
+	} `xml:"Body"`
+}
+
+type bootCapabilities struct {
+	ElementName            string
+	InstanceID             string
+	IDER                   bool
+	SOL                    bool
+	BIOSReflash            bool
+	BIOSSetup              bool
+	BIOSPause              bool
+	ForcePXEBoot           bool
+	ForceHardDriveBoot     bool
+	ForceCDorDVDBoot       bool
+	ForceUEFIHTTPSBoot     bool
+	UserPasswordBypass     bool
+	ConfigurationDataReset bool
+	BIOSSecureBoot         bool
+	SecureErase            bool
+}
+
+type bootSourceSettingResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		PullResponse struct {
+			Items []bootSourceSetting `xml:"Items>CIM_BootSourceSetting"`
+		} `xml:"PullResponse"`
+	} `xml:"Body"`
+}
+
+type bootSourceSetting struct {
+	InstanceID           string `xml:"InstanceID" json:"instanceId"`
+	ElementName          string `xml:"ElementName" json:"elementName"`
+	StructuredBootString string `xml:"StructuredBootString" json:"structuredBootString"`
+	BIOSBootString       string `xml:"BIOSBootString" json:"biosBootString"`
+	BootString           string `xml:"BootString" json:"bootString"`
+	FailThroughSupported int    `xml:"FailThroughSupported" json:"failThroughSupported"`
+}
+
+type bootConfigResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		SetBootConfigRole_OUTPUT struct {
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:"SetBootConfigRole_OUTPUT"`
+		ChangeBootOrder_OUTPUT struct {
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:"ChangeBootOrder_OUTPUT"`
+	} `xml:"Body"`
+}
+
+func (service *ProvisioningService) RunBoot() utils.ReturnCode {
+	service.setupWsmanClient("admin", service.flags.Password)
+	switch service.flags.SubCommand {
+	case utils.SubCommandBootList:
+		return service.DisplayBootSources()
+	case utils.SubCommandBootStatus:
+		return service.DisplayBootStatus()
+	case utils.SubCommandBootSet:
+		return service.SetNextBoot(service.flags.Boot)
+	}
+	return utils.IncorrectCommandLineParameters
+}
+
+func (service *ProvisioningService) GetBootSources() ([]bootSourceSetting, utils.ReturnCode) {
+	var pullRspEnv bootSourceSettingResponse
+	rc := service.EnumPullUnmarshal(
+		service.cimMessages.BootSourceSetting.Enumerate,
+		service.cimMessages.BootSourceSetting.Pull,
+		&pullRspEnv,
+	)
+	return pullRspEnv.Body.PullResponse.Items, rc
+}
+
+func (service *ProvisioningService) GetBootCapabilities() (bootCapabilities, utils.ReturnCode) {
+	var rsp bootCapabilitiesResponse
+	rc := service.PostAndUnmarshal(service.amtMessages.BootCapabilities.Get(), &rsp)
+	return rsp.Body.BootCapabilities, rc
+}
+
+func (service *ProvisioningService) GetBootSettingData() (bootSettingData, utils.ReturnCode) {
+	var rsp bootSettingDataResponse
+	rc := service.PostAndUnmarshal(service.amtMessages.BootSettingData.Get(), &rsp)
+	return rsp.Body.BootSettingData, rc
+}
+
+func (service *ProvisioningService) DisplayBootSources() utils.ReturnCode {
+	sources, rc := service.GetBootSources()
+	if rc != utils.Success {
+		return rc
+	}
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{"bootSources": sources})
+		return utils.Success
+	}
+	if len(sources) == 0 {
+		fmt.Println("---No Boot Sources Found---")
+		return utils.Success
+	}
+	fmt.Println("---Boot Sources---")
+	for _, source := range sources {
+		fmt.Printf("%s\n", source.InstanceID)
+		fmt.Printf("   BIOS Boot String	: %s\n", source.BIOSBootString)
+		fmt.Printf("   Boot String		: %s\n", source.BootString)
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) DisplayBootStatus() utils.ReturnCode {
+	capabilities, rc := service.GetBootCapabilities()
+	if rc != utils.Success {
+		return rc
+	}
+	settings, rc := service.GetBootSettingData()
+	if rc != utils.Success {
+		return rc
+	}
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{
+			"capabilities": capabilities,
+			"settings": map[string]interface{}{
+				"biosSetup":            settings.BIOSSetup,
+				"biosPause":            settings.BIOSPause,
+				"useIDER":              settings.UseIDER,
+				"iderBootDevice":       settings.IDERBootDevice,
+				"useSOL":               settings.UseSOL,
+				"uefiHttpsBootEnabled": settings.UEFIHTTPSBootEnabled,
+				"biosLastStatus":       settings.BIOSLastStatus,
+			},
+		})
+		return utils.Success
+	}
+	fmt.Println("---Boot Capabilities---")
+	fmt.Printf("Force PXE Boot		: %t\n", capabilities.ForcePXEBoot)
+	fmt.Printf("Force CD/DVD Boot	: %t\n", capabilities.ForceCDorDVDBoot)
+	fmt.Printf("Force Hard-drive Boot	: %t\n", capabilities.ForceHardDriveBoot)
+	fmt.Printf("Force UEFI HTTPS Boot	: %t\n", capabilities.ForceUEFIHTTPSBoot)
+	fmt.Printf("BIOS Setup		: %t\n", capabilities.BIOSSetup)
+	fmt.Printf("BIOS Pause		: %t\n", capabilities.BIOSPause)
+	fmt.Printf("IDE-R			: %t\n", capabilities.IDER)
+	fmt.Println("---Boot Settings---")
+	fmt.Printf("BIOS Setup		: %t\n", settings.BIOSSetup)
+	fmt.Printf("BIOS Pause		: %t\n", settings.BIOSPause)
+	fmt.Printf("Use IDE-R		: %t\n", settings.UseIDER)
+	fmt.Printf("Use SOL			: %t\n", settings.UseSOL)
+	return utils.Success
+}
+
+func (service *ProvisioningService) SetNextBoot(bootFlags flags.BootFlags) utils.ReturnCode {
+	capabilities, rc := service.GetBootCapabilities()
+	if rc != utils.Success {
+		return rc
+	}
+	rc = checkBootCapabilities(capabilities, bootFlags)
+	if rc != utils.Success {
+		return rc
+	}
+	settings, rc := service.GetBootSettingData()
+	if rc != utils.Success {
+		return rc
+	}
+	log.Infof("setting the next boot device: %s", bootFlags.Device)
+	putData := getBootSettingDataPutData(settings, bootFlags)
+	xmlMsg, err := putMessage(service.amtMessages.BootSettingData.Put(boot.BootSettingData{}), putData, putData.InstanceID)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	var putRsp bootSettingDataResponse
+	rc = service.PostAndUnmarshal(xmlMsg, &putRsp)
+	if rc != utils.Success {
+		return rc
+	}
+	var roleRsp bootConfigResponse
+	xmlMsg = service.cimMessages.BootService.SetBootConfigRole(BootConfigurationInstanceId, cimBoot.IsNextSingleUse)
+	rc = service.PostAndUnmarshal(xmlMsg, &roleRsp)
+	if rc != utils.Success {
+		return rc
+	}
+	if returnValue := roleRsp.Body.SetBootConfigRole_OUTPUT.ReturnValue; returnValue != 0 {
+		log.Errorf("failed SetBootConfigRole with ReturnValue: %d", returnValue)
+		return utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+	}
+	if source, ok := bootSources[bootFlags.Device]; ok {
+		var orderRsp bootConfigResponse
+		rc = service.PostAndUnmarshal(service.cimMessages.BootConfigSetting.ChangeBootOrder(source), &orderRsp)
+		if rc != utils.Success {
+			return rc
+		}
+		if returnValue := orderRsp.Body.ChangeBootOrder_OUTPUT.ReturnValue; returnValue != 0 {
+			log.Errorf("failed ChangeBootOrder with ReturnValue: %d", returnValue)
+			return utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+		}
+	}
+	log.Info("next boot settings applied successfully")
+	if bootFlags.PowerAction != "" {
+		return service.RequestPowerAction(bootFlags.PowerAction)
+	}
+	return utils.Success
+}
+
+func checkBootCapabilities(caps bootCapabilities, bootFlags flags.BootFlags) utils.ReturnCode {
+	supported := map[string]bool{
+		"":                        true,
+		flags.BootDevicePXE:       caps.ForcePXEBoot,
+		flags.BootDeviceCD:        caps.ForceCDorDVDBoot,
+		flags.BootDeviceHDD:       caps.ForceHardDriveBoot,
+		flags.BootDeviceBIOSSetup: caps.BIOSSetup,
+		flags.BootDeviceIDER:      caps.IDER,
+	}
+	if !supported[bootFlags.Device] {
+		log.Errorf("AMT does not support booting to %s on this device", bootFlags.Device)
+		return utils.BootConfigurationFailed
+	}
+	if bootFlags.BIOSPause && !caps.BIOSPause {
+		log.Error("AMT does not support pausing in the BIOS on this device")
+		return utils.BootConfigurationFailed
+	}
+	return utils.Success
+}
+
+func getBootSettingDataPutData(current bootSettingData, bootFlags flags.BootFlags) bootSettingDataPut {
+	settings := bootSettingDataPut(current)
+	settings.H = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootSettingData"
+	// only the settings of the given flags change, the rest stay as AMT has them
+	if bootFlags.Device != "" {
+		settings.BIOSSetup = bootFlags.Device == flags.BootDeviceBIOSSetup
+		settings.UseIDER = bootFlags.Device == flags.BootDeviceIDER
+		if settings.UseIDER {
+			settings.IDERBootDevice = boot.CDBoot
+		}
+	}
+	if bootFlags.BIOSPause {
+		settings.BIOSPause = true
+	}
+	return settings
+}
@@ -0,0 +1,209 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/boot"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/common"
+	"github.com/stretchr/testify/assert"
+)
+
+const bootCapabilitiesXML = `<h:AMT_BootCapabilities><h:BIOSPause>true</h:BIOSPause><h:BIOSSetup>true</h:BIOSSetup><h:ElementName>Intel(r) AMT: Boot Capabilities</h:ElementName><h:ForceCDorDVDBoot>true</h:ForceCDorDVDBoot><h:ForceHardDriveBoot>true</h:ForceHardDriveBoot><h:ForcePXEBoot>true</h:ForcePXEBoot><h:ForceUEFIHTTPSBoot>%t</h:ForceUEFIHTTPSBoot><h:IDER>true</h:IDER><h:InstanceID>Intel(r) AMT:BootCapabilities 0</h:InstanceID></h:AMT_BootCapabilities>`
+const bootSettingDataXML = `<h:AMT_BootSettingData><h:BIOSLastStatus>2</h:BIOSLastStatus><h:BIOSLastStatus>0</h:BIOSLastStatus><h:BIOSPause>false</h:BIOSPause><h:BIOSSetup>false</h:BIOSSetup><h:ElementName>Intel(r) AMT Boot Configuration Settings</h:ElementName><h:IDERBootDevice>0</h:IDERBootDevice><h:InstanceID>Intel(r) AMT:BootSettingData 0</h:InstanceID><h:UseIDER>false</h:UseIDER><h:UseSOL>true</h:UseSOL></h:AMT_BootSettingData>`
+const bootSourcesXML = `<g:PullResponse><g:Items><h:CIM_BootSourceSetting><h:BIOSBootString>Intel(r) AMT: Force PXE Boot</h:BIOSBootString><h:BootString>Intel(r) AMT: Force PXE Boot</h:BootString><h:ElementName>Intel(r) AMT: Boot Source</h:ElementName><h:FailThroughSupported>2</h:FailThroughSupported><h:InstanceID>Intel(r) AMT: Force PXE Boot</h:InstanceID><h:StructuredBootString>CIM:Network:1</h:StructuredBootString></h:CIM_BootSourceSetting><h:CIM_BootSourceSetting><h:InstanceID>Intel(r) AMT: Force Hard-drive Boot</h:InstanceID></h:CIM_BootSourceSetting></g:Items><g:EndOfSequence></g:EndOfSequence></g:PullResponse>`
+const setBootConfigRoleXML = `<h:SetBootConfigRole_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:SetBootConfigRole_OUTPUT>`
+const changeBootOrderXML = `<h:ChangeBootOrder_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:ChangeBootOrder_OUTPUT>`
+
+func bootXMLResponse(format string, a ...any) string {
+	return wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootSettingData", fmt.Sprintf(format, a...))
+}
+
+func TestGetBootSources(t *testing.T) {
+	f := &flags.Flags{}
+	t.Run("expect Success", func(t *testing.T) {
+		rfa := ResponseFuncArray{
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, bootXMLResponse(bootSourcesXML)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		sources, rc := lps.GetBootSources()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, sources, 2)
+		assert.Equal(t, "Intel(r) AMT: Force PXE Boot", sources[0].InstanceID)
+		assert.Equal(t, "CIM:Network:1", sources[0].StructuredBootString)
+		assert.Equal(t, "Intel(r) AMT: Force Hard-drive Boot", sources[1].InstanceID)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		_, rc := lps.GetBootSources()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestDisplayBoot(t *testing.T) {
+	for _, jsonOutput := range []bool{false, true} {
+		t.Run(fmt.Sprintf("expect Success for list with json %t", jsonOutput), func(t *testing.T) {
+			f := &flags.Flags{JsonOutput: jsonOutput, SubCommand: utils.SubCommandBootList}
+			rfa := ResponseFuncArray{
+				respondMsgFunc(t, common.EnumerationResponse{}),
+				respondStringFunc(t, bootXMLResponse(bootSourcesXML)),
+			}
+			lps := setupWsmanResponses(t, f, rfa)
+			rc := lps.RunBoot()
+			assert.Equal(t, utils.Success, rc)
+		})
+		t.Run(fmt.Sprintf("expect Success for status with json %t", jsonOutput), func(t *testing.T) {
+			f := &flags.Flags{JsonOutput: jsonOutput, SubCommand: utils.SubCommandBootStatus}
+			rfa := ResponseFuncArray{
+				respondStringFunc(t, bootXMLResponse(bootCapabilitiesXML, true)),
+				respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			}
+			lps := setupWsmanResponses(t, f, rfa)
+			rc := lps.RunBoot()
+			assert.Equal(t, utils.Success, rc)
+		})
+	}
+	t.Run("expect error for status", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandBootStatus}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, bootXMLResponse(bootCapabilitiesXML, true)),
+			respondServerErrFunc(),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunBoot()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestSetNextBoot(t *testing.T) {
+	t.Run("expect Success for pxe with a power action", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandBootSet}
+		f.Boot = flags.BootFlags{Device: flags.BootDevicePXE, PowerAction: utils.SubCommandPowerReset}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, bootXMLResponse(bootCapabilitiesXML, false)),
+			respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			respondCaptureFunc(t, bootXMLResponse(bootSettingDataXML), &requests),
+			respondCaptureFunc(t, bootXMLResponse(setBootConfigRoleXML, 0), &requests),
+			respondCaptureFunc(t, bootXMLResponse(changeBootOrderXML, 0), &requests),
+			respondCaptureFunc(t, fmt.Sprintf(requestPowerStateChangeXMLResponse, 0), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunBoot()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, requests, 4)
+		assert.Contains(t, requests[0], `<h:AMT_BootSettingData xmlns:h="http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootSettingData">`)
+		assert.Contains(t, requests[0], `<w:Selector Name="InstanceID">Intel(r) AMT:BootSettingData 0</w:Selector>`)
+		assert.Contains(t, requests[0], "<h:BIOSSetup>false</h:BIOSSetup>")
+		assert.Contains(t, requests[0], "<h:UseSOL>true</h:UseSOL>")
+		assert.NotContains(t, requests[0], "BIOSLastStatus")
+		assert.Contains(t, requests[1], "<h:Role>1</h:Role>")
+		assert.Contains(t, requests[2], "Intel(r) AMT: Force PXE Boot")
+		assert.Contains(t, requests[3], "<h:PowerState>10</h:PowerState>")
+	})
+	t.Run("expect Success for bios setup without ChangeBootOrder", func(t *testing.T) {
+		f := &flags.Flags{}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, bootXMLResponse(bootCapabilitiesXML, false)),
+			respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			respondCaptureFunc(t, bootXMLResponse(bootSettingDataXML), &requests),
+			respondCaptureFunc(t, bootXMLResponse(setBootConfigRoleXML, 0), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.SetNextBoot(flags.BootFlags{Device: flags.BootDeviceBIOSSetup, BIOSPause: true})
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, requests, 2)
+		assert.Contains(t, requests[0], "<h:BIOSSetup>true</h:BIOSSetup>")
+		assert.Contains(t, requests[0], "<h:BIOSPause>true</h:BIOSPause>")
+	})
+	t.Run("expect BootConfigurationFailed when ider is not supported", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, bootXMLResponse(strings.Replace(bootCapabilitiesXML, "<h:IDER>true</h:IDER>", "<h:IDER>false</h:IDER>", 1), false)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.SetNextBoot(flags.BootFlags{Device: flags.BootDeviceIDER})
+		assert.Equal(t, utils.BootConfigurationFailed, rc)
+	})
+	t.Run("expect AmtPtStatusCodeBase when SetBootConfigRole fails", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, bootXMLResponse(bootCapabilitiesXML, true)),
+			respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			respondStringFunc(t, bootXMLResponse(setBootConfigRoleXML, 1)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.SetNextBoot(flags.BootFlags{Device: flags.BootDevicePXE})
+		assert.Equal(t, utils.AmtPtStatusCodeBase+1, rc)
+	})
+	t.Run("expect AmtPtStatusCodeBase when ChangeBootOrder fails", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, bootXMLResponse(bootCapabilitiesXML, true)),
+			respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			respondStringFunc(t, bootXMLResponse(setBootConfigRoleXML, 0)),
+			respondStringFunc(t, bootXMLResponse(changeBootOrderXML, 2)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.SetNextBoot(flags.BootFlags{Device: flags.BootDeviceCD})
+		assert.Equal(t, utils.AmtPtStatusCodeBase+2, rc)
+	})
+	t.Run("expect WSMANMessageError at Put", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, bootXMLResponse(bootCapabilitiesXML, true)),
+			respondStringFunc(t, bootXMLResponse(bootSettingDataXML)),
+			respondServerErrFunc(),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.SetNextBoot(flags.BootFlags{Device: flags.BootDeviceHDD})
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestCheckBootCapabilities(t *testing.T) {
+	capabilities := bootCapabilities{}
+	capabilities.ForcePXEBoot = true
+	assert.Equal(t, utils.Success, checkBootCapabilities(capabilities, flags.BootFlags{Device: flags.BootDevicePXE}))
+	assert.Equal(t, utils.BootConfigurationFailed, checkBootCapabilities(capabilities, flags.BootFlags{Device: flags.BootDeviceIDER}))
+	assert.Equal(t, utils.BootConfigurationFailed, checkBootCapabilities(capabilities, flags.BootFlags{BIOSPause: true}))
+	capabilities.BIOSPause = true
+	assert.Equal(t, utils.Success, checkBootCapabilities(capabilities, flags.BootFlags{BIOSPause: true}))
+}
+
+func TestGetBootSettingDataPutData(t *testing.T) {
+	current := bootSettingData{BIOSSetup: true, BIOSPause: true, UseIDER: true, IDERBootDevice: boot.CDBoot, UseSOL: true}
+	t.Run("expect overrides cleared for pxe", func(t *testing.T) {
+		settings := getBootSettingDataPutData(current, flags.BootFlags{Device: flags.BootDevicePXE})
+		assert.False(t, settings.BIOSSetup)
+		assert.False(t, settings.UseIDER)
+		assert.True(t, settings.BIOSPause)
+		assert.True(t, settings.UseSOL)
+	})
+	t.Run("expect only BIOSPause set without a device", func(t *testing.T) {
+		settings := getBootSettingDataPutData(bootSettingData{UseIDER: true, IDERBootDevice: boot.CDBoot}, flags.BootFlags{BIOSPause: true})
+		assert.True(t, settings.BIOSPause)
+		assert.False(t, settings.BIOSSetup)
+		assert.True(t, settings.UseIDER)
+		assert.Equal(t, boot.CDBoot, settings.IDERBootDevice)
+	})
+	t.Run("expect ider from cd", func(t *testing.T) {
+		settings := getBootSettingDataPutData(bootSettingData{}, flags.BootFlags{Device: flags.BootDeviceIDER})
+		assert.True(t, settings.UseIDER)
+		assert.Equal(t, boot.CDBoot, settings.IDERBootDevice)
+		assert.False(t, settings.BIOSSetup)
+	})
+	t.Run("expect bios setup", func(t *testing.T) {
+		settings := getBootSettingDataPutData(bootSettingData{}, flags.BootFlags{Device: flags.BootDeviceBIOSSetup})
+		assert.True(t, settings.BIOSSetup)
+		assert.False(t, settings.UseIDER)
+	})
+}
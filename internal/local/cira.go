@@ -0,0 +1,366 @@
+package local
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"net"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/environmentdetection"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publickey"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/remoteaccess"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/userinitiatedconnection"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// periodic connection every 25 seconds, as RPS configures it
+const ciraPeriodicExtendedData = "AAAAAAAAABk="
+
+// go-wsman-messages has no response types for these AMT_RemoteAccessService
+// methods and AMT_EnvironmentDetectionSettingData
+type remoteAccessResponse struct {
+	XMLName xml.Name         `xml:"Envelope"`
+	Body    remoteAccessBody `xml:"Body"`
+}
+
+type remoteAccessBody struct {
+	AddMpServer_OUTPUT               addMpServer_OUTPUT               `xml:"AddMpServer_OUTPUT"`
+	AddRemoteAccessPolicyRule_OUTPUT addRemoteAccessPolicyRule_OUTPUT `xml:"AddRemoteAccessPolicyRule_OUTPUT"`
+}
+
+type addMpServer_OUTPUT struct {
+	MpServer    publickey.CreatedCertificate `xml:"MpServer"`
+	ReturnValue int                          `xml:"ReturnValue"`
+}
+
+type addRemoteAccessPolicyRule_OUTPUT struct {
+	PolicyRule  publickey.CreatedCertificate `xml:"PolicyRule"`
+	ReturnValue int                          `xml:"ReturnValue"`
+}
+
+type environmentDetectionResponse struct {
+	XMLName xml.Name                 `xml:"Envelope"`
+	Body    environmentDetectionBody `xml:"Body"`
+}
+
+type environmentDetectionBody struct {
+	SettingData environmentDetectionSettingData `xml:"AMT_EnvironmentDetectionSettingData"`
+}
+
+type environmentDetectionSettingData struct {
+	ElementName                string   `xml:"ElementName,omitempty"`
+	InstanceID                 string   `xml:"InstanceID,omitempty"`
+	DetectionAlgorithm         int      `xml:"DetectionAlgorithm"`
+	DetectionStrings           []string `xml:"DetectionStrings,omitempty"`
+	DetectionIPv6LocalPrefixes []string `xml:"DetectionIPv6LocalPrefixes,omitempty"`
+}
+
+type environmentDetectionSettingDataPut struct {
+	XMLName                    xml.Name `xml:"h:AMT_EnvironmentDetectionSettingData"`
+	H                          string   `xml:"xmlns:h,attr"`
+	ElementName                string   `xml:"h:ElementName,omitempty"`
+	InstanceID                 string   `xml:"h:InstanceID"`
+	DetectionAlgorithm         int      `xml:"h:DetectionAlgorithm"`
+	DetectionStrings           []string `xml:"h:DetectionStrings,omitempty"`
+	DetectionIPv6LocalPrefixes []string `xml:"h:DetectionIPv6LocalPrefixes,omitempty"`
+}
+
+type ciraPullResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		PullResponse struct {
+			MPServers   []mpServer   `xml:"Items>AMT_ManagementPresenceRemoteSAP"`
+			PolicyRules []policyRule `xml:"Items>AMT_RemoteAccessPolicyRule"`
+		} `xml:"PullResponse"`
+	} `xml:"Body"`
+}
+
+type mpServer struct {
+	Name       string `xml:"Name"`
+	AccessInfo string `xml:"AccessInfo"`
+	InfoFormat int    `xml:"InfoFormat"`
+	Port       int    `xml:"Port"`
+	CN         string `xml:"CN"`
+}
+
+type policyRule struct {
+	PolicyRuleName string `xml:"PolicyRuleName"`
+	Trigger        int    `xml:"Trigger"`
+}
+
+type requestStateChangeResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		RequestStateChange_OUTPUT struct {
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:"RequestStateChange_OUTPUT"`
+	} `xml:"Body"`
+}
+
+// wsmanSelector matches the unexported selector type of AddRemoteAccessPolicyRule
+type wsmanSelector interface {
+	~struct {
+		XMLName xml.Name `xml:"w:Selector,omitempty"`
+		Name    string   `xml:"Name,attr"`
+		Value   string   `xml:",chardata"`
+	}
+}
+
+func addPolicyRuleMessage[S wsmanSelector](add func(remoteaccess.RemoteAccessPolicyRule, S) string, rule remoteaccess.RemoteAccessPolicyRule, mpsName string) string {
+	return add(rule, S{Name: "Name", Value: mpsName})
+}
+
+func (service *ProvisioningService) ConfigureCIRA() (rc utils.ReturnCode) {
+	log.Info("configuring CIRA")
+	cfg := service.flags.LocalConfig.CIRA
+	var handles Handles
+	defer func() {
+		if rc != utils.Success {
+			service.RollbackAddedItems(&handles)
+		}
+	}()
+
+	rootCert, err := stripPemCertificate(cfg.MPSCert)
+	if err != nil {
+		log.Error("invalid MPS root certificate: ", err)
+		return utils.CIRAConfigurationFailed
+	}
+	handles.rootCertHandle, rc = service.AddTrustedRootCert(rootCert)
+	if rc != utils.Success {
+		return rc
+	}
+
+	handles.mpsHandle, rc = service.AddMPS(cfg)
+	if rc != utils.Success {
+		return rc
+	}
+
+	handles.policyRuleHandle, rc = service.AddPeriodicPolicyRule(handles.mpsHandle)
+	if rc != utils.Success {
+		return rc
+	}
+
+	previous, rc := service.GetEnvironmentDetection()
+	if rc != utils.Success {
+		return rc
+	}
+	rc = service.setDetectionDomains(previous, cfg.EnvironmentDetection)
+	if rc != utils.Success {
+		return rc
+	}
+	defer func() {
+		if rc != utils.Success {
+			service.RestoreEnvironmentDetection(previous)
+		}
+	}()
+
+	rc = service.EnableUserInitiatedConnection()
+	if rc == utils.Success {
+		log.Info("configuring CIRA completed successfully")
+	}
+	return rc
+}
+
+func (service *ProvisioningService) AddMPS(cfg config.CIRAConfig) (string, utils.ReturnCode) {
+	log.Info("adding MPS ", cfg.MPSAddress)
+	infoFormat := remoteaccess.FQDN
+	if ip := net.ParseIP(cfg.MPSAddress); ip != nil {
+		infoFormat = remoteaccess.IPv6Address
+		if ip.To4() != nil {
+			infoFormat = remoteaccess.IPv4Address
+		}
+	}
+	xmlMsg := service.amtMessages.RemoteAccessService.AddMPS(remoteaccess.MPServer{
+		AccessInfo: cfg.MPSAddress,
+		InfoFormat: infoFormat,
+		Port:       cfg.MPSPort,
+		AuthMethod: remoteaccess.UsernamePasswordAuthentication,
+		Username:   cfg.MPSUsername,
+		Password:   cfg.MPSPassword,
+		CommonName: cfg.CommonName,
+	})
+	var rspEnv remoteAccessResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rspEnv)
+	if rc != utils.Success {
+		return "", rc
+	}
+	output := rspEnv.Body.AddMpServer_OUTPUT
+	rc = checkReturnValue(utils.ReturnCode(output.ReturnValue), "MPS")
+	if rc != utils.Success {
+		return "", rc
+	}
+	handle := selectorValue(output.MpServer.ReferenceParameters, "Name")
+	if handle == "" {
+		log.Error("AddMpServer did not return a valid handle")
+		return "", utils.CIRAConfigurationFailed
+	}
+	return handle, utils.Success
+}
+
+func (service *ProvisioningService) AddPeriodicPolicyRule(mpsHandle string) (string, utils.ReturnCode) {
+	log.Info("adding periodic remote access policy rule")
+	rule := remoteaccess.RemoteAccessPolicyRule{
+		Trigger:        remoteaccess.Periodic,
+		TunnelLifeTime: 0,
+		ExtendedData:   ciraPeriodicExtendedData,
+	}
+	xmlMsg := addPolicyRuleMessage(service.amtMessages.RemoteAccessService.AddRemoteAccessPolicyRule, rule, mpsHandle)
+	var rspEnv remoteAccessResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rspEnv)
+	if rc != utils.Success {
+		return "", rc
+	}
+	output := rspEnv.Body.AddRemoteAccessPolicyRule_OUTPUT
+	rc = checkReturnValue(utils.ReturnCode(output.ReturnValue), "remote access policy rule")
+	if rc != utils.Success {
+		return "", rc
+	}
+	handle := selectorValue(output.PolicyRule.ReferenceParameters, "PolicyRuleName")
+	if handle == "" {
+		log.Error("AddRemoteAccessPolicyRule did not return a valid handle")
+		return "", utils.CIRAConfigurationFailed
+	}
+	return handle, utils.Success
+}
+
+// SetEnvironmentDetection sets the domains AMT treats as the intranet, where
+// it does not connect to the MPS. Without any, a random domain that never
+// matches makes AMT always connect.
+func (service *ProvisioningService) SetEnvironmentDetection(domains []string) utils.ReturnCode {
+	current, rc := service.GetEnvironmentDetection()
+	if rc != utils.Success {
+		return rc
+	}
+	return service.setDetectionDomains(current, domains)
+}
+
+func (service *ProvisioningService) GetEnvironmentDetection() (environmentDetectionSettingData, utils.ReturnCode) {
+	var getRsp environmentDetectionResponse
+	rc := service.PostAndUnmarshal(service.amtMessages.EnvironmentDetectionSettingData.Get(), &getRsp)
+	return getRsp.Body.SettingData, rc
+}
+
+// RestoreEnvironmentDetection puts back the settings read before CIRA was
+// configured, failures are only logged like the rest of the rollback
+func (service *ProvisioningService) RestoreEnvironmentDetection(previous environmentDetectionSettingData) {
+	log.Info("restoring environment detection domains: ", previous.DetectionStrings)
+	if rc := service.putEnvironmentDetection(previous); rc != utils.Success {
+		log.Errorf("failed restoring environment detection settings: %d", rc)
+	}
+}
+
+func (service *ProvisioningService) setDetectionDomains(current environmentDetectionSettingData, domains []string) utils.ReturnCode {
+	if len(domains) == 0 {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			log.Error(err)
+			return utils.CIRAConfigurationFailed
+		}
+		domains = []string{hex.EncodeToString(random) + ".com"}
+	}
+	log.Info("setting environment detection domains: ", domains)
+	settings := current
+	settings.DetectionAlgorithm = int(environmentdetection.LocalDomains)
+	settings.DetectionStrings = domains
+	return service.putEnvironmentDetection(settings)
+}
+
+func (service *ProvisioningService) putEnvironmentDetection(settings environmentDetectionSettingData) utils.ReturnCode {
+	putData := environmentDetectionSettingDataPut{
+		H:                          "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EnvironmentDetectionSettingData",
+		ElementName:                settings.ElementName,
+		InstanceID:                 settings.InstanceID,
+		DetectionAlgorithm:         settings.DetectionAlgorithm,
+		DetectionStrings:           settings.DetectionStrings,
+		DetectionIPv6LocalPrefixes: settings.DetectionIPv6LocalPrefixes,
+	}
+	// the library Put marshals a ManagedElement and selects no instance
+	xmlMsg, err := putMessage(service.amtMessages.EnvironmentDetectionSettingData.Put(environmentdetection.EnvironmentDetectionSettingData{}), putData, settings.InstanceID)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	var putRsp environmentDetectionResponse
+	return service.PostAndUnmarshal(xmlMsg, &putRsp)
+}
+
+func (service *ProvisioningService) EnableUserInitiatedConnection() utils.ReturnCode {
+	xmlMsg := service.amtMessages.UserInitiatedConnectionService.RequestStateChange(userinitiatedconnection.BIOSandOSInterfacesEnabled)
+	var rspEnv requestStateChangeResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rspEnv)
+	if rc != utils.Success {
+		return rc
+	}
+	rc = utils.ReturnCode(rspEnv.Body.RequestStateChange_OUTPUT.ReturnValue)
+	if rc != utils.Success {
+		log.Errorf("UserInitiatedConnectionService.RequestStateChange ReturnValue: %d", rc)
+		return utils.AmtPtStatusCodeBase + rc
+	}
+	return utils.Success
+}
+
+func selectorValue(parameters models.ReferenceParameters_OUTPUT, name string) string {
+	for _, selector := range parameters.SelectorSet.Selector {
+		if selector.Name == name {
+			return selector.Value
+		}
+	}
+	return ""
+}
+
+// stripPemCertificate returns the base64 DER AMT expects from a PEM or base64 certificate
+func stripPemCertificate(cert string) (string, error) {
+	if block, _ := pem.Decode([]byte(cert)); block != nil {
+		return base64.StdEncoding.EncodeToString(block.Bytes), nil
+	}
+	if _, err := base64.StdEncoding.DecodeString(cert); err != nil {
+		return "", errors.New("certificate is neither PEM nor base64")
+	}
+	return cert, nil
+}
+
+func (service *ProvisioningService) GetMPServers() ([]mpServer, utils.ReturnCode) {
+	var rsp ciraPullResponse
+	rc := service.EnumPullUnmarshal(
+		service.amtMessages.ManagementPresenceRemoteSAP.Enumerate,
+		service.amtMessages.ManagementPresenceRemoteSAP.Pull,
+		&rsp,
+	)
+	return rsp.Body.PullResponse.MPServers, rc
+}
+
+func (service *ProvisioningService) GetRemoteAccessPolicyRules() ([]policyRule, utils.ReturnCode) {
+	var rsp ciraPullResponse
+	rc := service.EnumPullUnmarshal(
+		service.amtMessages.RemoteAccessPolicyRule.Enumerate,
+		service.amtMessages.RemoteAccessPolicyRule.Pull,
+		&rsp,
+	)
+	return rsp.Body.PullResponse.PolicyRules, rc
+}
+
+// RemoveCIRAConfiguration deletes the policy rules before the MPS servers they refer to
+func (service *ProvisioningService) RemoveCIRAConfiguration(rules []policyRule, servers []mpServer) utils.ReturnCode {
+	for _, rule := range rules {
+		log.Infof("deleting remote access policy rule %s", rule.PolicyRuleName)
+		if _, err := service.client.Post(service.amtMessages.RemoteAccessPolicyRule.Delete(rule.PolicyRuleName)); err != nil {
+			log.Errorf("unable to delete remote access policy rule %s: %s", rule.PolicyRuleName, err)
+			return utils.CIRAConfigurationFailed
+		}
+	}
+	for _, server := range servers {
+		log.Infof("deleting MPS %s", server.AccessInfo)
+		if _, err := service.client.Post(service.amtMessages.ManagementPresenceRemoteSAP.Delete(server.Name)); err != nil {
+			log.Errorf("unable to delete MPS %s: %s", server.AccessInfo, err)
+			return utils.CIRAConfigurationFailed
+		}
+	}
+	return utils.Success
+}
@@ -0,0 +1,211 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const mpsHandle = "Intel(r) AMT:Management Presence Server 0"
+const policyRuleHandle = "Periodic"
+
+var addMpServerXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RemoteAccessService", `<h:AddMpServer_OUTPUT><h:MpServer><b:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</b:Address><b:ReferenceParameters><c:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_ManagementPresenceRemoteSAP</c:ResourceURI><c:SelectorSet><c:Selector Name="CreationClassName">AMT_ManagementPresenceRemoteSAP</c:Selector><c:Selector Name="Name">`+mpsHandle+`</c:Selector><c:Selector Name="SystemCreationClassName">CIM_ComputerSystem</c:Selector><c:Selector Name="SystemName">Intel(r) AMT</c:Selector></c:SelectorSet></b:ReferenceParameters></h:MpServer><h:ReturnValue>0</h:ReturnValue></h:AddMpServer_OUTPUT>`)
+var addPolicyRuleXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RemoteAccessService", `<h:AddRemoteAccessPolicyRule_OUTPUT><h:PolicyRule><b:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</b:Address><b:ReferenceParameters><c:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RemoteAccessPolicyRule</c:ResourceURI><c:SelectorSet><c:Selector Name="CreationClassName">AMT_RemoteAccessPolicyRule</c:Selector><c:Selector Name="PolicyRuleName">`+policyRuleHandle+`</c:Selector><c:Selector Name="SystemCreationClassName">CIM_ComputerSystem</c:Selector><c:Selector Name="SystemName">Intel(r) AMT</c:Selector></c:SelectorSet></b:ReferenceParameters></h:PolicyRule><h:ReturnValue>0</h:ReturnValue></h:AddRemoteAccessPolicyRule_OUTPUT>`)
+var environmentDetectionXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EnvironmentDetectionSettingData", `<h:AMT_EnvironmentDetectionSettingData><h:DetectionAlgorithm>0</h:DetectionAlgorithm><h:ElementName>Intel(r) AMT Environment Detection Settings</h:ElementName><h:InstanceID>Intel(r) AMT Environment Detection Settings</h:InstanceID></h:AMT_EnvironmentDetectionSettingData>`)
+var userInitiatedConnectionXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_UserInitiatedConnectionService", `<h:RequestStateChange_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:RequestStateChange_OUTPUT>`)
+
+var ciraCfg = config.CIRAConfig{
+	MPSAddress:           "mps.example.com",
+	MPSPort:              4433,
+	MPSCert:              "dGVzdA==",
+	MPSUsername:          "user",
+	MPSPassword:          "password",
+	CommonName:           "mps.example.com",
+	EnvironmentDetection: []string{"intranet.example.com"},
+}
+
+// respondCaptureFunc records the request body before responding with msg
+func respondCaptureFunc(t *testing.T, msg string, requests *[]string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		*requests = append(*requests, string(body))
+		_, err = w.Write([]byte(msg))
+		assert.Nil(t, err)
+	}
+}
+
+func ciraResponsers(t *testing.T, requests *[]string) ResponseFuncArray {
+	return ResponseFuncArray{
+		respondCaptureFunc(t, trustedRootXMLResponse, requests),
+		respondCaptureFunc(t, addMpServerXMLResponse, requests),
+		respondCaptureFunc(t, addPolicyRuleXMLResponse, requests),
+		respondCaptureFunc(t, environmentDetectionXMLResponse, requests),
+		respondCaptureFunc(t, environmentDetectionXMLResponse, requests),
+		respondCaptureFunc(t, fmt.Sprintf(userInitiatedConnectionXMLResponse, 0), requests),
+	}
+}
+
+func TestConfigureCIRA(t *testing.T) {
+	f := &flags.Flags{}
+	f.LocalConfig.CIRA = ciraCfg
+
+	t.Run("expect Success on happy path", func(t *testing.T) {
+		var requests []string
+		lps := setupWsmanResponses(t, f, ciraResponsers(t, &requests))
+		rc := lps.ConfigureCIRA()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, requests, 6)
+		assert.Contains(t, requests[0], "<h:CertificateBlob>dGVzdA==</h:CertificateBlob>")
+		assert.Contains(t, requests[1], "<h:AccessInfo>mps.example.com</h:AccessInfo><h:InfoFormat>201</h:InfoFormat><h:Port>4433</h:Port><h:AuthMethod>2</h:AuthMethod><h:Username>user</h:Username><h:Password>password</h:Password><h:CN>mps.example.com</h:CN>")
+		assert.Contains(t, requests[2], "<h:Trigger>2</h:Trigger>")
+		assert.Contains(t, requests[2], `<Selector Name="Name">`+mpsHandle+`</Selector>`)
+		assert.Contains(t, requests[4], "intranet.example.com")
+		assert.Contains(t, requests[5], "<h:RequestedState>32771</h:RequestedState>")
+	})
+	t.Run("expect CIRAConfigurationFailed for invalid root certificate", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.CIRA = ciraCfg
+		f.LocalConfig.CIRA.MPSCert = "not a certificate"
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.ConfigureCIRA()
+		assert.Equal(t, utils.CIRAConfigurationFailed, rc)
+	})
+	t.Run("expect error at AddTrustedRootCert", func(t *testing.T) {
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.ConfigureCIRA()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+	t.Run("expect root certificate rolled back after error at AddMPS", func(t *testing.T) {
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondCaptureFunc(t, trustedRootXMLResponse, &requests),
+			respondServerErrFunc(),
+			respondCaptureFunc(t, "", &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureCIRA()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+		assert.Len(t, requests, 2)
+		assert.Contains(t, requests[1], "Intel(r) AMT Certificate: Handle: 2")
+	})
+	t.Run("expect everything rolled back after error at EnableUserInitiatedConnection", func(t *testing.T) {
+		var requests []string
+		rfa := ciraResponsers(t, &requests)
+		previous := strings.Replace(environmentDetectionXMLResponse, "<h:DetectionAlgorithm>0</h:DetectionAlgorithm>",
+			"<h:DetectionAlgorithm>0</h:DetectionAlgorithm><h:DetectionStrings>previous.example.com</h:DetectionStrings>", 1)
+		rfa[3] = respondCaptureFunc(t, previous, &requests)
+		rfa[5] = respondCaptureFunc(t, fmt.Sprintf(userInitiatedConnectionXMLResponse, 1), &requests)
+		rfa = append(rfa,
+			respondCaptureFunc(t, environmentDetectionXMLResponse, &requests),
+			respondCaptureFunc(t, "", &requests),
+			respondCaptureFunc(t, "", &requests),
+			respondCaptureFunc(t, "", &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureCIRA()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+1, rc)
+		assert.Len(t, requests, 10)
+		assert.Contains(t, requests[6], "<h:DetectionStrings>previous.example.com</h:DetectionStrings>")
+		assert.NotContains(t, requests[6], "intranet.example.com")
+		assert.Contains(t, requests[6], `<w:Selector Name="InstanceID">Intel(r) AMT Environment Detection Settings</w:Selector>`)
+		assert.Contains(t, requests[7], "AMT_RemoteAccessPolicyRule")
+		assert.Contains(t, requests[7], policyRuleHandle)
+		assert.Contains(t, requests[8], "AMT_ManagementPresenceRemoteSAP")
+		assert.Contains(t, requests[8], mpsHandle)
+		assert.Contains(t, requests[9], "Intel(r) AMT Certificate: Handle: 2")
+	})
+	t.Run("expect environment detection left alone after error at its Put", func(t *testing.T) {
+		var requests []string
+		rfa := ciraResponsers(t, &requests)[:4]
+		rfa = append(rfa,
+			respondServerErrFunc(),
+			respondCaptureFunc(t, "", &requests),
+			respondCaptureFunc(t, "", &requests),
+			respondCaptureFunc(t, "", &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureCIRA()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+		assert.Len(t, requests, 7)
+		assert.Contains(t, requests[4], "AMT_RemoteAccessPolicyRule")
+		assert.Contains(t, requests[5], "AMT_ManagementPresenceRemoteSAP")
+		assert.Contains(t, requests[6], "Intel(r) AMT Certificate: Handle: 2")
+	})
+}
+
+func TestAddMPS(t *testing.T) {
+	f := &flags.Flags{}
+	tests := map[string]string{
+		"mps.example.com": "<h:InfoFormat>201</h:InfoFormat>",
+		"192.168.1.10":    "<h:InfoFormat>3</h:InfoFormat>",
+		"fd00::10":        "<h:InfoFormat>4</h:InfoFormat>",
+	}
+	for address, expected := range tests {
+		t.Run(fmt.Sprintf("expect %s for %s", expected, address), func(t *testing.T) {
+			var requests []string
+			lps := setupWsmanResponses(t, f, ResponseFuncArray{respondCaptureFunc(t, addMpServerXMLResponse, &requests)})
+			cfg := ciraCfg
+			cfg.MPSAddress = address
+			handle, rc := lps.AddMPS(cfg)
+			assert.Equal(t, utils.Success, rc)
+			assert.Equal(t, mpsHandle, handle)
+			assert.Contains(t, requests[0], expected)
+		})
+	}
+	t.Run("expect error for non-zero ReturnValue", func(t *testing.T) {
+		rsp := strings.Replace(addMpServerXMLResponse, "<h:ReturnValue>0</h:ReturnValue>", "<h:ReturnValue>2058</h:ReturnValue>", 1)
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondStringFunc(t, rsp)})
+		_, rc := lps.AddMPS(ciraCfg)
+		assert.Equal(t, utils.AmtPtStatusCodeBase+2058, rc)
+	})
+	t.Run("expect CIRAConfigurationFailed without a handle", func(t *testing.T) {
+		rsp := wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RemoteAccessService", `<h:AddMpServer_OUTPUT><h:ReturnValue>0</h:ReturnValue></h:AddMpServer_OUTPUT>`)
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondStringFunc(t, rsp)})
+		_, rc := lps.AddMPS(ciraCfg)
+		assert.Equal(t, utils.CIRAConfigurationFailed, rc)
+	})
+}
+
+func TestSetEnvironmentDetection(t *testing.T) {
+	f := &flags.Flags{}
+	t.Run("expect a random domain without any configured", func(t *testing.T) {
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondCaptureFunc(t, environmentDetectionXMLResponse, &requests),
+			respondCaptureFunc(t, environmentDetectionXMLResponse, &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.SetEnvironmentDetection(nil)
+		assert.Equal(t, utils.Success, rc)
+		assert.Regexp(t, `<h:DetectionStrings>[0-9a-f]{32}\.com</h:DetectionStrings>`, requests[1])
+		assert.Contains(t, requests[1], `<h:AMT_EnvironmentDetectionSettingData xmlns:h="http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EnvironmentDetectionSettingData">`)
+		assert.Contains(t, requests[1], `<w:Selector Name="InstanceID">Intel(r) AMT Environment Detection Settings</w:Selector>`)
+		assert.NotContains(t, requests[1], "ManagedElement")
+	})
+	t.Run("expect error at Get", func(t *testing.T) {
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.SetEnvironmentDetection(ciraCfg.EnvironmentDetection)
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestStripPemCertificate(t *testing.T) {
+	pemCert := "-----BEGIN CERTIFICATE-----\ndGVzdA==\n-----END CERTIFICATE-----\n"
+	cert, err := stripPemCertificate(pemCert)
+	assert.Nil(t, err)
+	assert.Equal(t, "dGVzdA==", cert)
+	cert, err = stripPemCertificate("dGVzdA==")
+	assert.Nil(t, err)
+	assert.Equal(t, "dGVzdA==", cert)
+	_, err = stripPemCertificate("not a certificate")
+	assert.NotNil(t, err)
+}
@@ -24,7 +24,19 @@ func (service *ProvisioningService) Configure() utils.ReturnCode {
 	case utils.SubCommandEnableWifiPort:
 		return service.EnableWifiPort()
 	case utils.SubCommandConfigureTLS:
+		if service.flags.ConfigTLSInfo.CSR {
+			return service.GenerateTLSCSR()
+		}
+		if len(service.flags.ConfigTLSInfo.CertChain) > 0 {
+			return service.ConfigureTLSWithCertChain()
+		}
 		return service.ConfigureTLS()
+	case utils.SubCommandConfigureCIRA:
+		return service.ConfigureCIRA()
+	case utils.SubCommandConfigureWired:
+		return service.ConfigureWired()
+	case utils.SubCommandRedirection:
+		return service.ConfigureRedirection()
 	default:
 	}
 	return utils.IncorrectCommandLineParameters
@@ -342,9 +354,31 @@ type Handles struct {
 	keyPairHandle    string
 	clientCertHandle string
 	rootCertHandle   string
+	mpsHandle        string
+	policyRuleHandle string
 }
 
 func (service *ProvisioningService) RollbackAddedItems(handles *Handles) {
+	if handles.policyRuleHandle != "" {
+		log.Infof("rolling back remote access policy rule %s", handles.policyRuleHandle)
+		xmlMsg := service.amtMessages.RemoteAccessPolicyRule.Delete(handles.policyRuleHandle)
+		_, err := service.client.Post(xmlMsg)
+		if err != nil {
+			log.Errorf("failed deleting remote access policy rule: %s", handles.policyRuleHandle)
+		} else {
+			log.Debugf("successfully deleted remote access policy rule: %s", handles.policyRuleHandle)
+		}
+	}
+	if handles.mpsHandle != "" {
+		log.Infof("rolling back MPS %s", handles.mpsHandle)
+		xmlMsg := service.amtMessages.ManagementPresenceRemoteSAP.Delete(handles.mpsHandle)
+		_, err := service.client.Post(xmlMsg)
+		if err != nil {
+			log.Errorf("failed deleting MPS: %s", handles.mpsHandle)
+		} else {
+			log.Debugf("successfully deleted MPS: %s", handles.mpsHandle)
+		}
+	}
 	if handles.privateKeyHandle != "" {
 		log.Infof("rolling back private key %s", handles.privateKeyHandle)
 		xmlMsg := service.amtMessages.PublicPrivateKeyPair.Delete(handles.privateKeyHandle)
@@ -118,6 +118,8 @@ func TestConfigure(t *testing.T) {
 		utils.SubCommandAddWifiSettings,
 		utils.SubCommandEnableWifiPort,
 		utils.SubCommandConfigureTLS,
+		utils.SubCommandConfigureCIRA,
+		utils.SubCommandConfigureWired,
 	}
 	for _, sc := range subCommands {
 		t.Run(fmt.Sprintf("expect error for %s", sc), func(t *testing.T) {
@@ -523,6 +525,8 @@ func TestRollbackAddedItems(t *testing.T) {
 		privateKeyHandle: "privateKeyHandle",
 		clientCertHandle: "clientCertHandle",
 		rootCertHandle:   "rootCertHandle",
+		mpsHandle:        "mpsHandle",
+		policyRuleHandle: "policyRuleHandle",
 	}
 
 	t.Run("expect all error paths traversed for coverage", func(t *testing.T) {
@@ -0,0 +1,104 @@
+package local
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var optInStateNames = map[int]string{
+	0: "Not Started",
+	1: "Requested",
+	2: "Displayed",
+	3: "Received",
+	4: "In Session",
+}
+
+func optInStateName(state int) string {
+	if name, ok := optInStateNames[state]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+var optInReturnValues = map[int]string{
+	1:    "internal error",
+	2:    "invalid state for the request",
+	3:    "user consent is blocked",
+	16:   "not permitted",
+	2066: "incorrect user consent code",
+	2067: "too many incorrect user consent codes, request a new code",
+}
+
+// optInOutputResponse holds the StartOptIn, SendOptInCode or CancelOptIn output
+type optInOutputResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Output struct {
+			XMLName     xml.Name
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+func (service *ProvisioningService) RunConsent() utils.ReturnCode {
+	service.setupWsmanClient("admin", service.flags.Password)
+	var rc utils.ReturnCode
+	switch service.flags.SubCommand {
+	case utils.SubCommandConsentStart:
+		log.Info("requesting the user consent code")
+		rc = service.optInAction("StartOptIn", service.ipsMessages.OptInService.StartOptIn())
+	case utils.SubCommandConsentSend:
+		log.Info("sending the user consent code")
+		rc = service.optInAction("SendOptInCode", service.ipsMessages.OptInService.SendOptInCode(service.flags.ConsentCode))
+	case utils.SubCommandConsentCancel:
+		log.Info("canceling user consent")
+		rc = service.optInAction("CancelOptIn", service.ipsMessages.OptInService.CancelOptIn())
+	}
+	if rc != utils.Success {
+		return rc
+	}
+	return service.DisplayConsentState()
+}
+
+func (service *ProvisioningService) optInAction(method string, xmlMsg string) utils.ReturnCode {
+	var rsp optInOutputResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rsp)
+	if rc != utils.Success {
+		return rc
+	}
+	if rsp.Body.Output.XMLName.Local != method+"_OUTPUT" {
+		log.Errorf("unexpected %s response: %s", method, rsp.Body.Output.XMLName.Local)
+		return utils.UnmarshalMessageFailed
+	}
+	returnValue := rsp.Body.Output.ReturnValue
+	if returnValue != 0 {
+		if reason, ok := optInReturnValues[returnValue]; ok {
+			log.Errorf("failed %s: %s", method, reason)
+		}
+		log.Errorf("failed %s with ReturnValue: %d", method, returnValue)
+		return utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) DisplayConsentState() utils.ReturnCode {
+	optIn, rc := service.getOptInService()
+	if rc != utils.Success {
+		return rc
+	}
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{
+			"optInState":     optIn.OptInState,
+			"optInStateName": optInStateName(optIn.OptInState),
+			"userConsent":    userConsentName(optIn.OptInRequired),
+		})
+		return utils.Success
+	}
+	fmt.Printf("User Consent State	: %s (%d)\n", optInStateName(optIn.OptInState), optIn.OptInState)
+	fmt.Printf("User Consent Policy	: %s\n", userConsentName(optIn.OptInRequired))
+	return utils.Success
+}
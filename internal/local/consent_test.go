@@ -0,0 +1,80 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const optInOutputXML = `<h:%s_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:%s_OUTPUT>`
+
+func optInOutputResponseXML(method string, returnValue int) string {
+	return redirectionXMLResponse(optInOutputXML, method, returnValue, method)
+}
+
+func TestRunConsent(t *testing.T) {
+	for subCommand, method := range map[string]string{
+		utils.SubCommandConsentStart:  "StartOptIn",
+		utils.SubCommandConsentSend:   "SendOptInCode",
+		utils.SubCommandConsentCancel: "CancelOptIn",
+	} {
+		t.Run(fmt.Sprintf("expect Success for %s", subCommand), func(t *testing.T) {
+			f := &flags.Flags{SubCommand: subCommand, ConsentCode: 123456}
+			var requests []string
+			rfa := ResponseFuncArray{
+				respondCaptureFunc(t, optInOutputResponseXML(method, 0), &requests),
+				respondCaptureFunc(t, redirectionXMLResponse(optInServiceXML, 4294967295), &requests),
+			}
+			lps := setupWsmanResponses(t, f, rfa)
+			rc := lps.RunConsent()
+			assert.Equal(t, utils.Success, rc)
+			assert.Contains(t, requests[0], method+"_INPUT")
+			if subCommand == utils.SubCommandConsentSend {
+				assert.Contains(t, requests[0], "<h:OptInCode>123456</h:OptInCode>")
+			}
+		})
+	}
+	t.Run("expect AmtPtStatusCodeBase for an incorrect code", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandConsentSend, ConsentCode: 111111}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, optInOutputResponseXML("SendOptInCode", 2066)),
+		})
+		rc := lps.RunConsent()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+2066, rc)
+	})
+	t.Run("expect UnmarshalMessageFailed for an unexpected output", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandConsentStart}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, optInOutputResponseXML("CancelOptIn", 0)),
+		})
+		rc := lps.RunConsent()
+		assert.Equal(t, utils.UnmarshalMessageFailed, rc)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandConsentCancel}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		rc := lps.RunConsent()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestDisplayConsentState(t *testing.T) {
+	for _, jsonOutput := range []bool{false, true} {
+		t.Run(fmt.Sprintf("expect Success with json %t", jsonOutput), func(t *testing.T) {
+			f := &flags.Flags{JsonOutput: jsonOutput, SubCommand: utils.SubCommandConsentStatus}
+			lps := setupWsmanResponses(t, f, ResponseFuncArray{
+				respondStringFunc(t, redirectionXMLResponse(optInServiceXML, 1)),
+			})
+			rc := lps.RunConsent()
+			assert.Equal(t, utils.Success, rc)
+		})
+	}
+	t.Run("expect Unknown for an undefined state", func(t *testing.T) {
+		assert.Equal(t, "In Session", optInStateName(4))
+		assert.Equal(t, "Unknown", optInStateName(9))
+	})
+}
@@ -0,0 +1,291 @@
+package local
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	internalAMT "github.com/jc-lab/intel-amt-host-api/internal/amt"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/wsman"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	wsTransferAction    = "http://schemas.xmlsoap.org/ws/2004/09/transfer/"
+	wsEnumerationAction = "http://schemas.xmlsoap.org/ws/2004/09/enumeration/"
+)
+
+// methods with these prefixes only read, so dry run lets them through
+var readMethodPrefixes = []string{"Get", "Enumerate", "Read", "PositionTo"}
+
+// createdOutputs names the output reference of the methods that create an
+// instance and the selector the caller reads the new handle from
+var createdOutputs = map[string]struct{ element, selector string }{
+	"AddTrustedRootCertificate": {"CreatedCertificate", "InstanceID"},
+	"AddCertificate":            {"CreatedCertificate", "InstanceID"},
+	"AddKey":                    {"CreatedKey", "InstanceID"},
+	"GenerateKeyPair":           {"KeyPair", "InstanceID"},
+	"AddMpServer":               {"MpServer", "Name"},
+	"AddRemoteAccessPolicyRule": {"PolicyRule", "PolicyRuleName"},
+}
+
+var selectorPattern = regexp.MustCompile(`<(?:\w+:)?Selector Name="(\w+)">([^<]*)</`)
+
+var errDryRunHBased = errors.New("dry run cannot start host based configuration, admin setup needs the AMT TLS certificate it returns")
+
+// plannedChange is a call that would change AMT, Handle is the placeholder
+// dry run returned for an instance the call creates
+type plannedChange struct {
+	Operation  string   `json:"operation"`
+	Class      string   `json:"class"`
+	Method     string   `json:"method,omitempty"`
+	Instance   string   `json:"instance,omitempty"`
+	Handle     string   `json:"handle,omitempty"`
+	References []string `json:"references,omitempty"`
+}
+
+func (change plannedChange) String() string {
+	text := change.Operation + " " + change.Class
+	if change.Method != "" {
+		text = text + "." + change.Method
+	}
+	if change.Instance != "" {
+		text = text + " " + change.Instance
+	}
+	if change.Handle != "" {
+		text = text + ", creates " + change.Handle
+	}
+	if len(change.References) > 0 {
+		text = text + ", references " + strings.Join(change.References, ", ")
+	}
+	return text
+}
+
+type dryRunPlan struct {
+	changes []plannedChange
+	handles int
+}
+
+// wsmanRequest holds the parts of a WS-Man request dry run and the journal read
+type wsmanRequest struct {
+	Header struct {
+		Action      string `xml:"Action"`
+		ResourceURI string `xml:"ResourceURI"`
+		Selectors   []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"SelectorSet>Selector"`
+	} `xml:"Header"`
+	Body struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// intercept records a call that changes AMT and returns the response AMT
+// would give when it succeeds, reads return false and go to AMT
+func (plan *dryRunPlan) intercept(msg []byte) (string, bool) {
+	var request wsmanRequest
+	if err := xml.Unmarshal(msg, &request); err != nil {
+		log.Debugf("dry run passes through a request it cannot read: %s", err)
+		return "", false
+	}
+	action := request.Header.Action
+	resourceURI := request.Header.ResourceURI
+	change := plannedChange{Class: resourceURI[strings.LastIndex(resourceURI, "/")+1:]}
+	for _, selector := range request.Header.Selectors {
+		change.Instance = selector.Name + "=" + selector.Value
+	}
+	for _, match := range selectorPattern.FindAllStringSubmatch(request.Body.Inner, -1) {
+		change.References = append(change.References, match[1]+"="+match[2])
+	}
+	body := ""
+	switch {
+	case strings.HasPrefix(action, wsEnumerationAction) || action == wsTransferAction+"Get":
+		return "", false
+	case action == wsTransferAction+"Put":
+		change.Operation = "change"
+		// AMT returns the instance it stored
+		body = request.Body.Inner
+	case action == wsTransferAction+"Create":
+		change.Operation = "create"
+		change.Handle = plan.newHandle()
+		body = fmt.Sprintf(`<g:ResourceCreated xmlns:g="http://schemas.xmlsoap.org/ws/2004/09/transfer">%s</g:ResourceCreated>`,
+			referenceXML(resourceURI, "Name", change.Handle))
+	case action == wsTransferAction+"Delete":
+		change.Operation = "delete"
+	default:
+		change.Method = action[strings.LastIndex(action, "/")+1:]
+		for _, prefix := range readMethodPrefixes {
+			if strings.HasPrefix(change.Method, prefix) {
+				return "", false
+			}
+		}
+		change.Operation = "invoke"
+		output := ""
+		if created, ok := createdOutputs[change.Method]; ok {
+			change.Handle = plan.newHandle()
+			output = fmt.Sprintf("<h:%s>%s</h:%s>", created.element, referenceXML("", created.selector, change.Handle), created.element)
+		}
+		body = fmt.Sprintf(`<h:%s_OUTPUT xmlns:h="%s">%s<h:ReturnValue>0</h:ReturnValue></h:%s_OUTPUT>`,
+			change.Method, resourceURI, output, change.Method)
+	}
+	plan.changes = append(plan.changes, change)
+	log.Infof("dry run: %s", change)
+	return `<?xml version="1.0" encoding="UTF-8"?><a:Envelope xmlns:a="http://www.w3.org/2003/05/soap-envelope" xmlns:b="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:c="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"><a:Header></a:Header><a:Body>` +
+		body + `</a:Body></a:Envelope>`, true
+}
+
+func (plan *dryRunPlan) newHandle() string {
+	plan.handles++
+	return fmt.Sprintf("dry-run-handle-%d", plan.handles)
+}
+
+func (plan *dryRunPlan) addHECI(method string, references ...string) {
+	change := plannedChange{Operation: "invoke", Class: "HECI", Method: method, References: references}
+	plan.changes = append(plan.changes, change)
+	log.Infof("dry run: %s", change)
+}
+
+func referenceXML(resourceURI string, selector string, handle string) string {
+	return fmt.Sprintf(`<b:Address>/wsman</b:Address><b:ReferenceParameters><c:ResourceURI>%s</c:ResourceURI><c:SelectorSet><c:Selector Name="%s">%s</c:Selector></c:SelectorSet></b:ReferenceParameters>`,
+		resourceURI, selector, handle)
+}
+
+// dryRunTransport sits under the wsman client, so every caller is covered
+// without knowing about dry run
+type dryRunTransport struct {
+	next http.RoundTripper
+	plan *dryRunPlan
+}
+
+func (transport *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	msg, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response, planned := transport.plan.intercept(msg)
+	if !planned {
+		next := req.Clone(req.Context())
+		next.Body = io.NopCloser(bytes.NewReader(msg))
+		return transport.next.RoundTrip(next)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/soap+xml; charset=UTF-8"}},
+		Body:          io.NopCloser(strings.NewReader(response)),
+		ContentLength: int64(len(response)),
+		Request:       req,
+	}, nil
+}
+
+// dryRunAMTCommand records the HECI calls that change AMT and passes the reads through
+type dryRunAMTCommand struct {
+	internalAMT.Interface
+	plan *dryRunPlan
+}
+
+func (amtCommand dryRunAMTCommand) EnableAMT() error {
+	amtCommand.plan.addHECI("EnableAMT")
+	return nil
+}
+
+func (amtCommand dryRunAMTCommand) DisableAMT() error {
+	amtCommand.plan.addHECI("DisableAMT")
+	return nil
+}
+
+func (amtCommand dryRunAMTCommand) Unprovision() (int, error) {
+	amtCommand.plan.addHECI("Unprovision")
+	return 0, nil
+}
+
+func (amtCommand dryRunAMTCommand) SetEnterpriseAccess(hostIPAddress string, enterpriseAccess bool) error {
+	amtCommand.plan.addHECI("SetEnterpriseAccess", hostIPAddress)
+	return nil
+}
+
+func (amtCommand dryRunAMTCommand) GenerateRNGSeed() error {
+	amtCommand.plan.addHECI("GenerateRNGSeed")
+	return nil
+}
+
+func (amtCommand dryRunAMTCommand) SetPkiFQDNSuffix(suffix string) error {
+	amtCommand.plan.addHECI("SetPkiFQDNSuffix", suffix)
+	return nil
+}
+
+func (amtCommand dryRunAMTCommand) StartConfigurationHBased(serverCertHash []byte, dnsSuffixes []string) (internalAMT.CertHashEntry, error) {
+	amtCommand.plan.addHECI("StartConfigurationHBased", dnsSuffixes...)
+	return internalAMT.CertHashEntry{}, errDryRunHBased
+}
+
+func (amtCommand dryRunAMTCommand) StopConfiguration() error {
+	amtCommand.plan.addHECI("StopConfiguration")
+	return nil
+}
+
+type dryRunNetworker struct {
+	plan *dryRunPlan
+}
+
+func (networker dryRunNetworker) RenewDHCPLease() utils.ReturnCode {
+	change := plannedChange{Operation: "invoke", Class: "OS", Method: "RenewDHCPLease"}
+	networker.plan.changes = append(networker.plan.changes, change)
+	log.Infof("dry run: %s", change)
+	return utils.Success
+}
+
+// enableDryRun lets reads reach AMT and plans everything else
+func (service *ProvisioningService) enableDryRun() {
+	service.plan = &dryRunPlan{}
+	service.amtCommand = dryRunAMTCommand{service.amtCommand, service.plan}
+	service.networker = dryRunNetworker{service.plan}
+	if client, ok := service.client.(*wsman.Client); ok {
+		client.Transport = &dryRunTransport{client.Transport, service.plan}
+	}
+}
+
+// standInPublicKey takes the place of a key pair AMT would generate, so
+// dry run can sign the certificates that use it
+func standInPublicKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&key.PublicKey)), nil
+}
+
+func (service *ProvisioningService) printPlan() {
+	changes := service.plan.changes
+	if changes == nil {
+		changes = []plannedChange{}
+	}
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{"dryRun": true, "plan": changes})
+		return
+	}
+	if len(changes) == 0 {
+		fmt.Println("dry run, AMT would not change")
+		return
+	}
+	fmt.Println("dry run, AMT was not changed. planned changes in order:")
+	for i, change := range changes {
+		fmt.Printf("%3d. %s\n", i+1, change)
+	}
+}
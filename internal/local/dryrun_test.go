@@ -0,0 +1,97 @@
+package local
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publicprivate"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunIntercept(t *testing.T) {
+	f := &flags.Flags{}
+	lps := setupService(f)
+	lps.enableDryRun()
+	plan := lps.plan
+
+	_, planned := plan.intercept([]byte(lps.amtMessages.GeneralSettings.Get()))
+	assert.False(t, planned)
+	_, planned = plan.intercept([]byte(lps.amtMessages.PublicKeyCertificate.Enumerate()))
+	assert.False(t, planned)
+	_, planned = plan.intercept([]byte(lps.amtMessages.TimeSynchronizationService.GetLowAccuracyTimeSynch()))
+	assert.False(t, planned)
+
+	_, planned = plan.intercept([]byte(lps.amtMessages.PublicKeyCertificate.Delete("Intel(r) AMT Certificate: Handle: 1")))
+	assert.True(t, planned)
+	rsp, planned := plan.intercept([]byte(lps.amtMessages.PublicKeyManagementService.AddTrustedRootCertificate("cert")))
+	assert.True(t, planned)
+	assert.Contains(t, rsp, `<h:AddTrustedRootCertificate_OUTPUT`)
+	assert.Contains(t, rsp, `<c:Selector Name="InstanceID">dry-run-handle-1</c:Selector>`)
+	rsp, planned = plan.intercept([]byte(lps.amtMessages.TLSCredentialContext.Create("dry-run-handle-1")))
+	assert.True(t, planned)
+	assert.Contains(t, rsp, "ResourceCreated")
+
+	assert.Equal(t, []plannedChange{
+		{Operation: "delete", Class: "AMT_PublicKeyCertificate", Instance: "InstanceID=Intel(r) AMT Certificate: Handle: 1"},
+		{Operation: "invoke", Class: "AMT_PublicKeyManagementService", Method: "AddTrustedRootCertificate", Handle: "dry-run-handle-1"},
+		{Operation: "create", Class: "AMT_TLSCredentialContext", Handle: "dry-run-handle-2", References: []string{"InstanceID=dry-run-handle-1", "ElementName=TLSProtocolEndpointInstances Collection"}},
+	}, plan.changes)
+	assert.Equal(t, "create AMT_TLSCredentialContext, creates dry-run-handle-2, references InstanceID=dry-run-handle-1, ElementName=TLSProtocolEndpointInstances Collection", plan.changes[2].String())
+}
+
+func TestDryRunConfigureTLS(t *testing.T) {
+	f := &flags.Flags{}
+	f.ConfigTLSInfo.DelayInSeconds = 0
+	responses := ResponseFuncArray{
+		respondMsgFunc(t, common.EnumerationResponse{}),
+		respondMsgFunc(t, publicprivate.PullResponseEnvelope{}),
+		respondStringFunc(t, getLowAccuracyTimeSynchXMLResponse),
+		respondMsgFunc(t, common.EnumerationResponse{}),
+		respondStringFunc(t, tlsSettingsXMLResponse),
+	}
+	reads := 0
+	for i, respond := range responses {
+		respond := respond
+		responses[i] = func(w http.ResponseWriter, r *http.Request) {
+			reads++
+			respond(w, r)
+		}
+	}
+	lps := setupWsmanResponses(t, f, responses)
+	lps.enableDryRun()
+	rc := lps.ConfigureTLS()
+	assert.Equal(t, utils.Success, rc)
+	// only the reads reach AMT
+	assert.Equal(t, 5, reads)
+	var planned []string
+	for _, change := range lps.plan.changes {
+		planned = append(planned, change.Operation+" "+change.Method+change.Handle)
+	}
+	assert.Equal(t, []string{
+		"invoke AddTrustedRootCertificatedry-run-handle-1",
+		"invoke GenerateKeyPairdry-run-handle-2",
+		"invoke AddCertificatedry-run-handle-3",
+		"create dry-run-handle-4",
+		"invoke SetHighAccuracyTimeSynch",
+		"change ",
+		"change ",
+		"invoke CommitChanges",
+	}, planned)
+	assert.Contains(t, lps.plan.changes[3].References, "InstanceID=dry-run-handle-3")
+}
+
+func TestDryRunDeactivate(t *testing.T) {
+	orig := mockControlMode
+	defer func() { mockControlMode = orig }()
+	mockControlMode = 1
+	f := &flags.Flags{Command: utils.CommandDeactivate, Local: true}
+	lps := setupService(f)
+	lps.enableDryRun()
+	rc := lps.Deactivate()
+	assert.Equal(t, utils.Success, rc)
+	assert.Equal(t, []plannedChange{{Operation: "invoke", Class: "HECI", Method: "Unprovision"}}, lps.plan.changes)
+}
@@ -0,0 +1,134 @@
+package local
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/internal/lm"
+	"github.com/jc-lab/intel-amt-host-api/pkg/heci/emulator"
+	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// emulatedDevice runs the local commands against the heci emulator, PTHI
+// calls go straight to it and WS-Man calls through an LMS server over APF
+type emulatedDevice struct {
+	firmware *emulator.Firmware
+	lmsPort  string
+	// statuses lists the HTTP status of every WS-Man response
+	statuses []int
+}
+
+func newEmulatedDevice(t *testing.T, state emulator.State) *emulatedDevice {
+	device := &emulatedDevice{firmware: emulator.NewFirmware(state)}
+	device.firmware.ReadTimeout = 10 * time.Millisecond
+	wsman := device.firmware.Handler
+	device.firmware.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httptest.NewRecorder()
+		wsman.ServeHTTP(recorder, r)
+		device.statuses = append(device.statuses, recorder.Code)
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(recorder.Code)
+		w.Write(recorder.Body.Bytes())
+	})
+	orig := pthi.NewHeciDriver
+	pthi.NewHeciDriver = device.firmware.NewDevice
+	t.Cleanup(func() { pthi.NewHeciDriver = orig })
+
+	server := &lm.LMSServer{
+		Command: pthi.NewCommand(),
+		Ports:   map[uint32]string{16992: "127.0.0.1:0"},
+	}
+	assert.NoError(t, server.Start())
+	t.Cleanup(func() { server.Close() })
+	_, device.lmsPort, _ = net.SplitHostPort(server.Addr(16992).String())
+	return device
+}
+
+// run parses args the way rpc does and executes the local command
+func (device *emulatedDevice) run(args ...string) utils.ReturnCode {
+	f := flags.NewFlags(append([]string{"rpc"}, args...))
+	if rc := f.ParseFlags(); rc != utils.Success {
+		return rc
+	}
+	f.LMSAddress = "127.0.0.1"
+	f.LMSPort = device.lmsPort
+	return ExecuteCommand(f)
+}
+
+func adminDigest(state emulator.State, password string) string {
+	sum := md5.Sum([]byte("admin:" + state.DigestRealm + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestEmulatedActivate(t *testing.T) {
+	device := newEmulatedDevice(t, emulator.DefaultState())
+
+	rc := device.run("activate", "-local", "-ccm", "-password", "P@ssw0rd")
+	assert.Equal(t, utils.Success, rc)
+	state := device.firmware.State()
+	assert.Equal(t, 1, state.ControlMode)
+	assert.Equal(t, adminDigest(state, "P@ssw0rd"), state.AdminDigest)
+	assert.Contains(t, device.statuses, http.StatusOK)
+
+	rc = device.run("activate", "-local", "-ccm", "-password", "P@ssw0rd")
+	assert.Equal(t, utils.UnableToActivate, rc)
+}
+
+func TestEmulatedAMTInfo(t *testing.T) {
+	state := emulator.DefaultState()
+	state.ControlMode = 1
+	state.AdminDigest = adminDigest(state, "P@ssw0rd")
+
+	t.Run("reads the redirection state over WS-Man", func(t *testing.T) {
+		device := newEmulatedDevice(t, state)
+		rc := device.run("amtinfo", "-mode", "-redirection", "-password", "P@ssw0rd")
+		assert.Equal(t, utils.Success, rc)
+		served := 0
+		for _, status := range device.statuses {
+			if status == http.StatusOK {
+				served++
+			}
+		}
+		assert.Equal(t, 4, served)
+	})
+	t.Run("keeps the PTHI output with a wrong password", func(t *testing.T) {
+		device := newEmulatedDevice(t, state)
+		rc := device.run("amtinfo", "-mode", "-redirection", "-password", "wrong")
+		assert.Equal(t, utils.Success, rc)
+		assert.NotContains(t, device.statuses, http.StatusOK)
+	})
+}
+
+func TestEmulatedDeactivate(t *testing.T) {
+	t.Run("deactivates CCM over PTHI", func(t *testing.T) {
+		state := emulator.DefaultState()
+		state.ControlMode = 1
+		state.AdminDigest = adminDigest(state, "P@ssw0rd")
+		device := newEmulatedDevice(t, state)
+		rc := device.run("deactivate", "-local")
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, 0, device.firmware.State().ControlMode)
+		assert.Empty(t, device.statuses)
+	})
+	t.Run("deactivates ACM over WS-Man", func(t *testing.T) {
+		state := emulator.DefaultState()
+		state.ControlMode = 2
+		state.AdminDigest = adminDigest(state, "P@ssw0rd")
+		device := newEmulatedDevice(t, state)
+		rc := device.run("deactivate", "-local", "-password", "P@ssw0rd")
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, 0, device.firmware.State().ControlMode)
+		assert.Equal(t, "", device.firmware.State().AdminDigest)
+	})
+}
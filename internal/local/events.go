@@ -0,0 +1,35 @@
+package local
+
+import (
+	"encoding/json"
+	"github.com/jc-lab/intel-amt-host-api/internal/lm"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// supports unit testing
+var newEventsServer = func(address string, onEvent func(event lm.Event)) lmsServer {
+	server := lm.NewLMSServer(address)
+	server.ChannelHandler = lm.EventHandler{OnEvent: onEvent}
+	return server
+}
+
+var eventsOutput io.Writer = os.Stdout
+
+// RunEventsListen prints the events AMT delivers as JSON lines until interrupted
+func (service *ProvisioningService) RunEventsListen() utils.ReturnCode {
+	var lock sync.Mutex
+	encoder := json.NewEncoder(eventsOutput)
+	onEvent := func(event lm.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		if err := encoder.Encode(event); err != nil {
+			log.Error("failed to write event: ", err)
+		}
+	}
+	return runLMSServer(newEventsServer(service.flags.LMSAddress, onEvent), "event listener")
+}
@@ -0,0 +1,65 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/internal/lm"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEvents(t *testing.T, server *mockLMSServer, interrupt chan os.Signal, events []lm.Event) *bytes.Buffer {
+	origServer, origInterrupt, origOutput := newEventsServer, lmsInterrupt, eventsOutput
+	output := &bytes.Buffer{}
+	newEventsServer = func(address string, onEvent func(event lm.Event)) lmsServer {
+		server.address = address
+		for _, event := range events {
+			onEvent(event)
+		}
+		return server
+	}
+	lmsInterrupt = func() <-chan os.Signal { return interrupt }
+	eventsOutput = output
+	t.Cleanup(func() {
+		newEventsServer, lmsInterrupt, eventsOutput = origServer, origInterrupt, origOutput
+	})
+	return output
+}
+
+func TestRunEventsListen(t *testing.T) {
+	f := &flags.Flags{}
+	f.Command = utils.CommandEvents
+	f.SubCommand = utils.SubCommandListen
+	f.LMSAddress = "127.0.0.1"
+
+	t.Run("prints events as JSON lines", func(t *testing.T) {
+		server := &mockLMSServer{done: make(chan struct{})}
+		interrupt := make(chan os.Signal, 1)
+		interrupt <- os.Interrupt
+		events := []lm.Event{
+			{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Address: "127.0.0.1:16997", Indication: "CIM_AlertIndication", Properties: map[string]interface{}{"MessageID": "iAMT0052"}},
+			{Time: time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC), Address: "127.0.0.1:16997", Indication: "CIM_AlertIndication", Properties: map[string]interface{}{}},
+		}
+		output := setupEvents(t, server, interrupt, events)
+		lps := setupService(f)
+		rc := lps.RunEventsListen()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "127.0.0.1", server.address)
+		assert.True(t, server.closed)
+		expected := `{"time":"2024-01-02T03:04:05Z","address":"127.0.0.1:16997","path":"","indication":"CIM_AlertIndication","properties":{"MessageID":"iAMT0052"}}` + "\n" +
+			`{"time":"2024-01-02T03:04:06Z","address":"127.0.0.1:16997","path":"","indication":"CIM_AlertIndication","properties":{}}` + "\n"
+		assert.Equal(t, expected, output.String())
+	})
+	t.Run("returns AMTConnectionFailed when start fails", func(t *testing.T) {
+		server := &mockLMSServer{done: make(chan struct{}), startErr: errors.New("no such device")}
+		setupEvents(t, server, make(chan os.Signal), nil)
+		lps := setupService(f)
+		rc := lps.RunEventsListen()
+		assert.Equal(t, utils.AMTConnectionFailed, rc)
+	})
+}
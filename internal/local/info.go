@@ -28,52 +28,64 @@ func (service *ProvisioningService) DisplayAMTInfo() utils.ReturnCode {
 	// has not been provisioned yet, then asking for the password is confusing
 	// do this check first so prompts and errors messages happen before
 	// any other displayed info
-	if service.flags.AmtInfo.UserCert && service.flags.Password == "" {
+	if (service.flags.AmtInfo.UserCert || service.flags.AmtInfo.Redirection) && service.flags.Password == "" {
 		result, err := cmd.GetControlMode()
 		if err != nil {
 			log.Error(err)
 			service.flags.AmtInfo.UserCert = false
+			service.flags.AmtInfo.Redirection = false
 		} else if result == 0 {
-			fmt.Println("Device is in pre-provisioning mode. User certificates are not available")
+			fmt.Println("Device is in pre-provisioning mode. User certificates and redirection state are not available")
 			service.flags.AmtInfo.UserCert = false
+			service.flags.AmtInfo.Redirection = false
 		} else {
 			if _, rc := service.flags.ReadPasswordFromUser(); rc != 0 {
 				fmt.Println("Invalid Entry")
 				return rc
 			}
 		}
-	}
-
-	if service.flags.AmtInfo.Ver {
-		result, err := cmd.GetVersionDataFromME("AMT", service.flags.AMTTimeoutDuration)
+	} else if service.flags.AmtInfo.Redirection {
+		// the redirection services do not answer before provisioning
+		result, err := cmd.GetControlMode()
 		if err != nil {
 			log.Error(err)
-		}
-		dataStruct["amt"] = result
-		if !service.flags.JsonOutput {
-			println("Version			: " + result)
+			service.flags.AmtInfo.Redirection = false
+		} else if result == 0 {
+			fmt.Println("Device is in pre-provisioning mode. Redirection state is not available")
+			service.flags.AmtInfo.Redirection = false
 		}
 	}
-	if service.flags.AmtInfo.Bld {
-		result, err := cmd.GetVersionDataFromME("Build Number", service.flags.AMTTimeoutDuration)
+
+	if service.flags.AmtInfo.Ver || service.flags.AmtInfo.Bld || service.flags.AmtInfo.Sku {
+		// a single HECI round trip returns every code version
+		versions, err := cmd.GetAllCodeVersions(service.flags.AMTTimeoutDuration)
 		if err != nil {
 			log.Error(err)
 		}
-		dataStruct["buildNumber"] = result
+		dataStruct["firmware"] = versions
 
-		if !service.flags.JsonOutput {
-			println("Build Number		: " + result)
+		if service.flags.AmtInfo.Ver {
+			result, _ := versions.Get("AMT")
+			dataStruct["amt"] = result
+			if !service.flags.JsonOutput {
+				println("Version			: " + result)
+			}
 		}
-	}
-	if service.flags.AmtInfo.Sku {
-		result, err := cmd.GetVersionDataFromME("Sku", service.flags.AMTTimeoutDuration)
-		if err != nil {
-			log.Error(err)
+		if service.flags.AmtInfo.Bld {
+			result, _ := versions.Get("Build Number")
+			dataStruct["buildNumber"] = result
+
+			if !service.flags.JsonOutput {
+				println("Build Number		: " + result)
+			}
 		}
-		dataStruct["sku"] = result
+		if service.flags.AmtInfo.Sku {
+			result, _ := versions.Get("Sku")
+			dataStruct["sku"] = result
 
-		if !service.flags.JsonOutput {
-			println("SKU			: " + result)
+			if !service.flags.JsonOutput {
+				println("SKU			: " + result)
+			}
 		}
 	}
 	if service.flags.AmtInfo.Ver && service.flags.AmtInfo.Sku {
@@ -121,6 +133,17 @@ func (service *ProvisioningService) DisplayAMTInfo() utils.ReturnCode {
 			}
 		}
 	}
+	if service.flags.AmtInfo.ProvState {
+		result, err := cmd.GetProvisioningState()
+		if err != nil {
+			log.Error(err)
+		}
+		dataStruct["provisioningState"] = utils.InterpretProvisioningState(result)
+
+		if !service.flags.JsonOutput {
+			println("Provisioning State	: " + utils.InterpretProvisioningState(result))
+		}
+	}
 	if service.flags.AmtInfo.DNS {
 		result, err := cmd.GetDNSSuffix()
 		if err != nil {
@@ -131,6 +154,15 @@ func (service *ProvisioningService) DisplayAMTInfo() utils.ReturnCode {
 		if !service.flags.JsonOutput {
 			println("DNS Suffix		: " + string(result))
 		}
+		suffixList, err := cmd.GetDNSSuffixList()
+		if err != nil {
+			log.Error(err)
+		}
+		dataStruct["dnsSuffixList"] = suffixList
+
+		if !service.flags.JsonOutput {
+			println("DNS Suffix List		: " + strings.Join(suffixList, ", "))
+		}
 		result, err = cmd.GetOSDNSSuffix()
 		if err != nil {
 			log.Error(err)
@@ -197,6 +229,33 @@ func (service *ProvisioningService) DisplayAMTInfo() utils.ReturnCode {
 			println("MAC Address  		: " + wireless.MACAddress)
 		}
 	}
+	if service.flags.AmtInfo.MAC {
+		result, err := cmd.GetMACAddresses()
+		if err != nil {
+			log.Error(err)
+		}
+		dataStruct["macAddresses"] = result
+
+		if !service.flags.JsonOutput {
+			println("Dedicated MAC		: " + result.DedicatedMAC)
+			println("Shared MAC		: " + result.HostMAC)
+		}
+	}
+	if service.flags.AmtInfo.Security {
+		result, err := cmd.GetSecurityParameters()
+		if err != nil {
+			log.Error(err)
+		}
+		dataStruct["securityParameters"] = result
+
+		if !service.flags.JsonOutput {
+			println("---Security Parameters---")
+			println("Enterprise Mode		: " + strconv.FormatBool(result.EnterpriseMode))
+			println("TLS Enabled		: " + strconv.FormatBool(result.TLSEnabled))
+			println("Network Interface	: " + strconv.FormatBool(result.NetworkInterfaceEnabled))
+			println("Link Is Up		: " + strconv.FormatBool(result.LinkIsUp))
+		}
+	}
 	if service.flags.AmtInfo.Cert {
 		result, err := cmd.GetCertificateHashes()
 		if err != nil {
@@ -264,6 +323,19 @@ func (service *ProvisioningService) DisplayAMTInfo() utils.ReturnCode {
 		}
 	}
 
+	if service.flags.AmtInfo.Redirection {
+		service.setupWsmanClient("admin", service.flags.Password)
+		state, rc := service.GetRedirectionState()
+		if rc != utils.Success {
+			log.Error("failed to read the redirection state")
+		} else {
+			dataStruct["redirection"] = state
+			if !service.flags.JsonOutput {
+				displayRedirectionState(state)
+			}
+		}
+	}
+
 	if service.flags.JsonOutput {
 		outBytes, err := json.MarshalIndent(dataStruct, "", "  ")
 		output := string(outBytes)
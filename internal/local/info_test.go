@@ -12,16 +12,19 @@ import (
 func TestDisplayAMTInfo(t *testing.T) {
 	//f := &flags.Flags{}
 	defaultFlags := flags.AmtInfoFlags{
-		Ver:      true,
-		Bld:      true,
-		Sku:      true,
-		UUID:     true,
-		Mode:     true,
-		DNS:      true,
-		Ras:      true,
-		Lan:      true,
-		Hostname: true,
-		OpState:  true,
+		Ver:       true,
+		Bld:       true,
+		Sku:       true,
+		UUID:      true,
+		Mode:      true,
+		DNS:       true,
+		Ras:       true,
+		Lan:       true,
+		Hostname:  true,
+		OpState:   true,
+		MAC:       true,
+		ProvState: true,
+		Security:  true,
 	}
 
 	t.Run("returns Success on happy path", func(t *testing.T) {
@@ -71,6 +74,10 @@ func TestDisplayAMTInfo(t *testing.T) {
 		mockRemoteAcessConnectionStatusErr = mockStandardErr
 		mockLANInterfaceSettingsErr = mockStandardErr
 		mockCertHashesErr = mockStandardErr
+		mockSecurityParametersErr = mockStandardErr
+		mockMACAddressesErr = mockStandardErr
+		mockProvisioningStateErr = mockStandardErr
+		mockDNSSuffixListErr = mockStandardErr
 
 		f := &flags.Flags{}
 		f.AmtInfo = defaultFlags
@@ -89,6 +96,10 @@ func TestDisplayAMTInfo(t *testing.T) {
 		mockRemoteAcessConnectionStatusErr = nil
 		mockLANInterfaceSettingsErr = nil
 		mockCertHashesErr = nil
+		mockSecurityParametersErr = nil
+		mockMACAddressesErr = nil
+		mockProvisioningStateErr = nil
+		mockDNSSuffixListErr = nil
 	})
 
 	t.Run("resets UserCert on GetControlMode failure", func(t *testing.T) {
@@ -114,6 +125,33 @@ func TestDisplayAMTInfo(t *testing.T) {
 		assert.False(t, f.AmtInfo.UserCert)
 		mockControlMode = orig
 	})
+	t.Run("returns Success without the redirection state on a wsman error", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.AmtInfo = defaultFlags
+		f.AmtInfo.Redirection = true
+		f.JsonOutput = true
+		f.Password = "testPassword"
+		orig := mockControlMode
+		mockControlMode = 2
+		rfa := ResponseFuncArray{respondServerErrFunc()}
+		lps := setupWsmanResponses(t, f, rfa)
+		resultCode := lps.DisplayAMTInfo()
+		assert.Equal(t, utils.Success, resultCode)
+		mockControlMode = orig
+	})
+	t.Run("resets Redirection with a password when control mode is preprovisioning", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.AmtInfo.Redirection = true
+		f.Password = "testPassword"
+		orig := mockControlMode
+		mockControlMode = 0
+		rfa := ResponseFuncArray{}
+		lps := setupWsmanResponses(t, f, rfa)
+		resultCode := lps.DisplayAMTInfo()
+		assert.Equal(t, utils.Success, resultCode)
+		assert.False(t, f.AmtInfo.Redirection)
+		mockControlMode = orig
+	})
 	t.Run("returns MissingOrIncorrectPassword on no password input from user", func(t *testing.T) {
 		f := &flags.Flags{}
 		f.AmtInfo.UserCert = true
@@ -0,0 +1,178 @@
+package local
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// go-wsman-messages models embed CIM_ManagedElement and do not unmarshal, so
+// every inventory class pulls into one response holding a slice per class
+type inventoryPullResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		PullResponse struct {
+			ComputerSystemPackages []computerSystemPackage `xml:"Items>CIM_ComputerSystemPackage"`
+			Chassis                []chassis               `xml:"Items>CIM_Chassis"`
+			Cards                  []physicalPackage       `xml:"Items>CIM_Card"`
+			BIOSElements           []biosElement           `xml:"Items>CIM_BIOSElement"`
+			Processors             []processor             `xml:"Items>CIM_Processor"`
+			PhysicalMemory         []physicalMemory        `xml:"Items>CIM_PhysicalMemory"`
+			MediaAccessDevices     []mediaAccessDevice     `xml:"Items>CIM_MediaAccessDevice"`
+		} `xml:"PullResponse"`
+	} `xml:"Body"`
+}
+
+type computerSystemPackage struct {
+	PlatformGUID string `xml:"PlatformGUID"`
+}
+
+type physicalPackage struct {
+	ElementName  string `xml:"ElementName" json:"elementName"`
+	Manufacturer string `xml:"Manufacturer" json:"manufacturer"`
+	Model        string `xml:"Model" json:"model"`
+	SerialNumber string `xml:"SerialNumber" json:"serialNumber"`
+	Version      string `xml:"Version" json:"version"`
+	Tag          string `xml:"Tag" json:"tag"`
+}
+
+type chassis struct {
+	physicalPackage
+	ChassisPackageType int `xml:"ChassisPackageType" json:"chassisPackageType"`
+}
+
+type biosElement struct {
+	ElementName       string `xml:"ElementName" json:"elementName"`
+	Manufacturer      string `xml:"Manufacturer" json:"manufacturer"`
+	Version           string `xml:"Version" json:"version"`
+	SoftwareElementID string `xml:"SoftwareElementID" json:"softwareElementId"`
+	PrimaryBIOS       bool   `xml:"PrimaryBIOS" json:"primaryBios"`
+	ReleaseDate       string `xml:"ReleaseDate>Datetime" json:"releaseDate"`
+}
+
+type processor struct {
+	DeviceID              string `xml:"DeviceID" json:"deviceId"`
+	ElementName           string `xml:"ElementName" json:"elementName"`
+	Family                int    `xml:"Family" json:"family"`
+	Stepping              string `xml:"Stepping" json:"stepping"`
+	MaxClockSpeed         int    `xml:"MaxClockSpeed" json:"maxClockSpeedMhz"`
+	CurrentClockSpeed     int    `xml:"CurrentClockSpeed" json:"currentClockSpeedMhz"`
+	ExternalBusClockSpeed int    `xml:"ExternalBusClockSpeed" json:"externalBusClockSpeedMhz"`
+	UpgradeMethod         int    `xml:"UpgradeMethod" json:"upgradeMethod"`
+	CPUStatus             int    `xml:"CPUStatus" json:"cpuStatus"`
+	HealthState           int    `xml:"HealthState" json:"healthState"`
+}
+
+type physicalMemory struct {
+	ElementName                string `xml:"ElementName" json:"elementName"`
+	Manufacturer               string `xml:"Manufacturer" json:"manufacturer"`
+	PartNumber                 string `xml:"PartNumber" json:"partNumber"`
+	SerialNumber               string `xml:"SerialNumber" json:"serialNumber"`
+	BankLabel                  string `xml:"BankLabel" json:"bankLabel"`
+	Tag                        string `xml:"Tag" json:"tag"`
+	Capacity                   int64  `xml:"Capacity" json:"capacityBytes"`
+	Speed                      int    `xml:"Speed" json:"speed"`
+	IsSpeedInMhz               bool   `xml:"IsSpeedInMhz" json:"isSpeedInMhz"`
+	ConfiguredMemoryClockSpeed int    `xml:"ConfiguredMemoryClockSpeed" json:"configuredMemoryClockSpeedMhz"`
+	MaxMemorySpeed             int    `xml:"MaxMemorySpeed" json:"maxMemorySpeedMhz"`
+	MemoryType                 int    `xml:"MemoryType" json:"memoryType"`
+	FormFactor                 int    `xml:"FormFactor" json:"formFactor"`
+}
+
+type mediaAccessDevice struct {
+	DeviceID          string `xml:"DeviceID" json:"deviceId"`
+	ElementName       string `xml:"ElementName" json:"elementName"`
+	Capabilities      []int  `xml:"Capabilities" json:"capabilities"`
+	MaxMediaSize      int64  `xml:"MaxMediaSize" json:"maxMediaSizeKb"`
+	Security          int    `xml:"Security" json:"security"`
+	EnabledState      int    `xml:"EnabledState" json:"enabledState"`
+	OperationalStatus []int  `xml:"OperationalStatus" json:"operationalStatus"`
+}
+
+// inventory is the normalized document; every list is present even when empty
+type inventory struct {
+	PlatformGUID string              `json:"platformGuid"`
+	Chassis      []chassis           `json:"chassis"`
+	Baseboards   []physicalPackage   `json:"baseboards"`
+	BIOS         []biosElement       `json:"bios"`
+	Processors   []processor         `json:"processors"`
+	Memory       []physicalMemory    `json:"memory"`
+	Storage      []mediaAccessDevice `json:"storage"`
+}
+
+func (service *ProvisioningService) RunInventory() utils.ReturnCode {
+	service.setupWsmanClient("admin", service.flags.Password)
+	inv, rc := service.GetInventory()
+	if rc != utils.Success {
+		return rc
+	}
+	outBytes, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		log.Error(err)
+		return utils.InventoryFailed
+	}
+	if service.flags.InventoryFile == "" {
+		fmt.Println(string(outBytes))
+		return utils.Success
+	}
+	if err = os.WriteFile(service.flags.InventoryFile, outBytes, 0644); err != nil {
+		log.Errorf("failed to write the inventory to %s: %s", service.flags.InventoryFile, err)
+		return utils.InventoryFailed
+	}
+	log.Infof("inventory written to %s", service.flags.InventoryFile)
+	return utils.Success
+}
+
+func (service *ProvisioningService) GetInventory() (inventory, utils.ReturnCode) {
+	inv := inventory{
+		Chassis:    []chassis{},
+		Baseboards: []physicalPackage{},
+		BIOS:       []biosElement{},
+		Processors: []processor{},
+		Memory:     []physicalMemory{},
+		Storage:    []mediaAccessDevice{},
+	}
+	classes := []struct {
+		enumFn  EnumMessageFunc
+		pullFn  PullMessageFunc
+		collect func(rsp *inventoryPullResponse)
+	}{
+		{service.cimMessages.ComputerSystemPackage.Enumerate, service.cimMessages.ComputerSystemPackage.Pull, func(rsp *inventoryPullResponse) {
+			if items := rsp.Body.PullResponse.ComputerSystemPackages; len(items) > 0 {
+				inv.PlatformGUID = items[0].PlatformGUID
+			}
+		}},
+		{service.cimMessages.Chassis.Enumerate, service.cimMessages.Chassis.Pull, func(rsp *inventoryPullResponse) {
+			inv.Chassis = append(inv.Chassis, rsp.Body.PullResponse.Chassis...)
+		}},
+		{service.cimMessages.Card.Enumerate, service.cimMessages.Card.Pull, func(rsp *inventoryPullResponse) {
+			inv.Baseboards = append(inv.Baseboards, rsp.Body.PullResponse.Cards...)
+		}},
+		{service.cimMessages.BIOSElement.Enumerate, service.cimMessages.BIOSElement.Pull, func(rsp *inventoryPullResponse) {
+			inv.BIOS = append(inv.BIOS, rsp.Body.PullResponse.BIOSElements...)
+		}},
+		{service.cimMessages.Processor.Enumerate, service.cimMessages.Processor.Pull, func(rsp *inventoryPullResponse) {
+			inv.Processors = append(inv.Processors, rsp.Body.PullResponse.Processors...)
+		}},
+		{service.cimMessages.PhysicalMemory.Enumerate, service.cimMessages.PhysicalMemory.Pull, func(rsp *inventoryPullResponse) {
+			inv.Memory = append(inv.Memory, rsp.Body.PullResponse.PhysicalMemory...)
+		}},
+		{service.cimMessages.MediaAccessDevice.Enumerate, service.cimMessages.MediaAccessDevice.Pull, func(rsp *inventoryPullResponse) {
+			inv.Storage = append(inv.Storage, rsp.Body.PullResponse.MediaAccessDevices...)
+		}},
+	}
+	for _, class := range classes {
+		var rsp inventoryPullResponse
+		rc := service.EnumPullUnmarshal(class.enumFn, class.pullFn, &rsp)
+		if rc != utils.Success {
+			return inv, rc
+		}
+		class.collect(&rsp)
+	}
+	return inv, utils.Success
+}
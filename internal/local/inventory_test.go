@@ -0,0 +1,119 @@
+package local
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func inventoryPullXMLResponse(items string) string {
+	return wsmanEnvelope("http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/", `<g:PullResponse><g:Items>`+items+`</g:Items><g:EndOfSequence></g:EndOfSequence></g:PullResponse>`)
+}
+
+var inventoryItemsXML = []string{
+	`<h:CIM_ComputerSystemPackage><h:PlatformGUID>4C4C4544004D3510804CB4C04F4A3732</h:PlatformGUID></h:CIM_ComputerSystemPackage>`,
+	`<h:CIM_Chassis><h:ChassisPackageType>3</h:ChassisPackageType><h:ElementName>Managed System Chassis</h:ElementName><h:Manufacturer>Dell Inc.</h:Manufacturer><h:Model>OptiPlex 7090</h:Model><h:SerialNumber>5M2JC73</h:SerialNumber><h:Tag>CIM_Chassis</h:Tag><h:Version></h:Version></h:CIM_Chassis>`,
+	`<h:CIM_Card><h:ElementName>Managed System Base Board</h:ElementName><h:Manufacturer>Dell Inc.</h:Manufacturer><h:Model>0J37VM</h:Model><h:SerialNumber>/5M2JC73/CNFCW0014R00NV/</h:SerialNumber><h:Tag>CIM_Card</h:Tag><h:Version>A00</h:Version></h:CIM_Card>`,
+	`<h:CIM_BIOSElement><h:ElementName>Primary BIOS</h:ElementName><h:Manufacturer>Dell Inc.</h:Manufacturer><h:PrimaryBIOS>true</h:PrimaryBIOS><h:ReleaseDate><h:Datetime>2023-05-10T00:00:00Z</h:Datetime></h:ReleaseDate><h:SoftwareElementID>1.17.0</h:SoftwareElementID><h:Version>1.17.0</h:Version></h:CIM_BIOSElement>`,
+	`<h:CIM_Processor><h:CPUStatus>1</h:CPUStatus><h:CurrentClockSpeed>2500</h:CurrentClockSpeed><h:DeviceID>CPU 0</h:DeviceID><h:ElementName>Managed System CPU</h:ElementName><h:Family>205</h:Family><h:HealthState>0</h:HealthState><h:MaxClockSpeed>8300</h:MaxClockSpeed><h:Stepping>1</h:Stepping><h:UpgradeMethod>52</h:UpgradeMethod></h:CIM_Processor>`,
+	`<h:CIM_PhysicalMemory><h:BankLabel>BANK 0</h:BankLabel><h:Capacity>8589934592</h:Capacity><h:ElementName>Managed System Memory Chip</h:ElementName><h:FormFactor>8</h:FormFactor><h:Manufacturer>80AD000080AD</h:Manufacturer><h:MemoryType>26</h:MemoryType><h:PartNumber>HMA81GU6DJR8N-XN</h:PartNumber><h:SerialNumber>9208A5FE</h:SerialNumber><h:Speed>0</h:Speed><h:Tag>9876543210</h:Tag></h:CIM_PhysicalMemory><h:CIM_PhysicalMemory><h:BankLabel>BANK 1</h:BankLabel><h:Capacity>8589934592</h:Capacity></h:CIM_PhysicalMemory>`,
+	`<h:CIM_MediaAccessDevice><h:Capabilities>4</h:Capabilities><h:Capabilities>10</h:Capabilities><h:DeviceID>MEDIA DEV 0</h:DeviceID><h:ElementName>Managed System Media Access Device</h:ElementName><h:EnabledState>0</h:EnabledState><h:MaxMediaSize>500107862</h:MaxMediaSize><h:OperationalStatus>0</h:OperationalStatus><h:Security>2</h:Security></h:CIM_MediaAccessDevice>`,
+}
+
+func inventoryResponses(t *testing.T) ResponseFuncArray {
+	var rfa ResponseFuncArray
+	for _, items := range inventoryItemsXML {
+		rfa = append(rfa,
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, inventoryPullXMLResponse(items)),
+		)
+	}
+	return rfa
+}
+
+func TestGetInventory(t *testing.T) {
+	t.Run("expect Success for every class", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, inventoryResponses(t))
+		inv, rc := lps.GetInventory()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "4C4C4544004D3510804CB4C04F4A3732", inv.PlatformGUID)
+		assert.Equal(t, "5M2JC73", inv.Chassis[0].SerialNumber)
+		assert.Equal(t, 3, inv.Chassis[0].ChassisPackageType)
+		assert.Equal(t, "0J37VM", inv.Baseboards[0].Model)
+		assert.Equal(t, "2023-05-10T00:00:00Z", inv.BIOS[0].ReleaseDate)
+		assert.Equal(t, 205, inv.Processors[0].Family)
+		assert.Len(t, inv.Memory, 2)
+		assert.Equal(t, int64(8589934592), inv.Memory[1].Capacity)
+		assert.Equal(t, []int{4, 10}, inv.Storage[0].Capabilities)
+	})
+	t.Run("expect empty lists when no items are returned", func(t *testing.T) {
+		f := &flags.Flags{}
+		var rfa ResponseFuncArray
+		for range inventoryItemsXML {
+			rfa = append(rfa,
+				respondMsgFunc(t, common.EnumerationResponse{}),
+				respondStringFunc(t, inventoryPullXMLResponse("")),
+			)
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		inv, rc := lps.GetInventory()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, []processor{}, inv.Processors)
+		assert.Equal(t, []mediaAccessDevice{}, inv.Storage)
+	})
+	t.Run("expect WSMANMessageError when a class fails", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, inventoryResponses(t)[:4])
+		_, rc := lps.GetInventory()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestRunInventory(t *testing.T) {
+	t.Run("expect Success writing the output file", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.InventoryFile = filepath.Join(t.TempDir(), "inventory.json")
+		lps := setupWsmanResponses(t, f, inventoryResponses(t))
+		rc := lps.RunInventory()
+		assert.Equal(t, utils.Success, rc)
+		content, err := os.ReadFile(f.InventoryFile)
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), `"platformGuid": "4C4C4544004D3510804CB4C04F4A3732"`)
+		assert.Contains(t, string(content), `"capacityBytes": 8589934592`)
+	})
+	t.Run("expect Success writing stdout", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		defer func() { os.Stdout = stdout }()
+		output := make(chan []byte)
+		go func() {
+			content, _ := io.ReadAll(r)
+			output <- content
+		}()
+		lps := setupWsmanResponses(t, &flags.Flags{}, inventoryResponses(t))
+		rc := lps.RunInventory()
+		os.Stdout = stdout
+		w.Close()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, string(<-output), `"platformGuid": "4C4C4544004D3510804CB4C04F4A3732"`)
+	})
+	t.Run("expect InventoryFailed for an unwritable file", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.InventoryFile = filepath.Join(t.TempDir(), "missing", "inventory.json")
+		lps := setupWsmanResponses(t, f, inventoryResponses(t))
+		rc := lps.RunInventory()
+		assert.Equal(t, utils.InventoryFailed, rc)
+	})
+}
@@ -0,0 +1,331 @@
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/wsman"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	journalCreate = "create"
+	journalDelete = "delete"
+)
+
+// methods with these prefixes create an instance when the output references one
+var createMethodPrefixes = []string{"Add", "Generate"}
+
+// journal records every WS-Man instance a command creates or deletes before
+// the command goes on, so rpc recover can undo a command that did not finish
+type journal struct {
+	path    string
+	written bool
+	Command []string       `json:"command"`
+	Started time.Time      `json:"started"`
+	Entries []journalEntry `json:"entries"`
+}
+
+// journalEntry is one created or deleted instance. Done is false while the
+// call is in flight, PriorState is the instance AMT returned before a delete.
+type journalEntry struct {
+	Operation   string            `json:"operation"`
+	ResourceURI string            `json:"resourceURI"`
+	Method      string            `json:"method,omitempty"`
+	Selectors   []journalSelector `json:"selectors,omitempty"`
+	PriorState  string            `json:"priorState,omitempty"`
+	Done        bool              `json:"done"`
+	Undone      bool              `json:"undone,omitempty"`
+}
+
+type journalSelector struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (entry journalEntry) String() string {
+	class := entry.ResourceURI[strings.LastIndex(entry.ResourceURI, "/")+1:]
+	var selectors []string
+	for _, selector := range entry.Selectors {
+		selectors = append(selectors, selector.Name+"="+selector.Value)
+	}
+	return strings.TrimSpace(class + " " + strings.Join(selectors, ","))
+}
+
+func defaultJournalPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "rpc", "journal.json")
+}
+
+func readJournal(path string) (*journal, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{path: path, written: true}
+	if err := json.Unmarshal(content, j); err != nil {
+		return nil, fmt.Errorf("journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// write replaces the journal file in one rename, so a power loss leaves
+// either the previous or the new journal
+func (j *journal) write() error {
+	content, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	tmpPath := j.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return err
+	}
+	j.written = true
+	return nil
+}
+
+func (j *journal) remove() {
+	if !j.written {
+		return
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("failed removing journal %s: %s", j.path, err)
+	}
+	j.written = false
+}
+
+// pending reports whether an entry still needs rpc recover
+func (j *journal) pending() bool {
+	for _, entry := range j.Entries {
+		if !entry.Undone {
+			return true
+		}
+	}
+	return false
+}
+
+// created finds the entry of an instance this command created
+func (j *journal) created(resourceURI string, selectors []journalSelector) *journalEntry {
+	for i := range j.Entries {
+		entry := &j.Entries[i]
+		if entry.Operation == journalCreate && !entry.Undone && entry.ResourceURI == resourceURI &&
+			fmt.Sprint(entry.Selectors) == fmt.Sprint(selectors) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// journalClient journals the calls that create or delete instances before
+// passing them to AMT
+type journalClient struct {
+	wsman.WSManClient
+	journal *journal
+}
+
+func (client journalClient) Post(msg string) ([]byte, error) {
+	var request wsmanRequest
+	if err := xml.Unmarshal([]byte(msg), &request); err != nil {
+		return client.WSManClient.Post(msg)
+	}
+	action := request.Header.Action
+	if action == wsTransferAction+"Delete" {
+		return client.postDelete(msg, request)
+	}
+	method := action[strings.LastIndex(action, "/")+1:]
+	if action == wsTransferAction+"Create" {
+		return client.postCreate(msg, request, "")
+	}
+	for _, prefix := range createMethodPrefixes {
+		if strings.HasPrefix(method, prefix) && !strings.HasPrefix(action, wsTransferAction) {
+			return client.postCreate(msg, request, method)
+		}
+	}
+	return client.WSManClient.Post(msg)
+}
+
+func (client journalClient) postCreate(msg string, request wsmanRequest, method string) ([]byte, error) {
+	j := client.journal
+	// written before the call, AMT may create the instance even if rpc stops before the response
+	j.Entries = append(j.Entries, journalEntry{Operation: journalCreate, ResourceURI: request.Header.ResourceURI, Method: method})
+	index := len(j.Entries) - 1
+	if err := j.write(); err != nil {
+		return nil, fmt.Errorf("journal %s: %w", j.path, err)
+	}
+	response, err := client.WSManClient.Post(msg)
+	resourceURI, selectors := firstReference(response)
+	if err != nil || len(selectors) == 0 {
+		// nothing was created
+		j.Entries = append(j.Entries[:index], j.Entries[index+1:]...)
+	} else {
+		entry := &j.Entries[index]
+		if resourceURI != "" {
+			entry.ResourceURI = resourceURI
+		}
+		entry.Selectors = selectors
+		entry.Done = true
+	}
+	if writeErr := j.write(); writeErr != nil && err == nil {
+		err = fmt.Errorf("journal %s: %w", j.path, writeErr)
+	}
+	return response, err
+}
+
+func (client journalClient) postDelete(msg string, request wsmanRequest) ([]byte, error) {
+	j := client.journal
+	selectors := requestSelectors(request)
+	// deleting what this command created, such as a rollback, leaves nothing to recover
+	if entry := j.created(request.Header.ResourceURI, selectors); entry != nil {
+		response, err := client.WSManClient.Post(msg)
+		if err == nil {
+			entry.Undone = true
+			if writeErr := j.write(); writeErr != nil {
+				log.Warnf("journal %s: %s", j.path, writeErr)
+			}
+		}
+		return response, err
+	}
+	entry := journalEntry{Operation: journalDelete, ResourceURI: request.Header.ResourceURI, Selectors: selectors}
+	priorState, err := client.WSManClient.Post(transferMessage(msg, wsTransferAction+"Get", request.Header.ResourceURI, selectors))
+	if err != nil {
+		log.Warnf("failed reading %s before deleting it: %s", entry, err)
+	}
+	entry.PriorState = string(priorState)
+	j.Entries = append(j.Entries, entry)
+	index := len(j.Entries) - 1
+	if err := j.write(); err != nil {
+		return nil, fmt.Errorf("journal %s: %w", j.path, err)
+	}
+	response, err := client.WSManClient.Post(msg)
+	if err == nil {
+		j.Entries[index].Done = true
+		if writeErr := j.write(); writeErr != nil {
+			log.Warnf("journal %s: %s", j.path, writeErr)
+		}
+	}
+	return response, err
+}
+
+func requestSelectors(request wsmanRequest) []journalSelector {
+	var selectors []journalSelector
+	for _, selector := range request.Header.Selectors {
+		selectors = append(selectors, journalSelector{selector.Name, selector.Value})
+	}
+	return selectors
+}
+
+// firstReference returns the first endpoint reference of a response, which
+// is the instance an Add or Create call made
+func firstReference(response []byte) (string, []journalSelector) {
+	decoder := xml.NewDecoder(bytes.NewReader(response))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", nil
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "ReferenceParameters" {
+			continue
+		}
+		var reference struct {
+			ResourceURI string `xml:"ResourceURI"`
+			Selectors   []struct {
+				Name  string `xml:"Name,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"SelectorSet>Selector"`
+		}
+		if err := decoder.DecodeElement(&reference, &start); err != nil {
+			return "", nil
+		}
+		var selectors []journalSelector
+		for _, selector := range reference.Selectors {
+			selectors = append(selectors, journalSelector{selector.Name, selector.Value})
+		}
+		return reference.ResourceURI, selectors
+	}
+}
+
+// transferMessage turns a go-wsman-messages message into a transfer action
+// on one instance, for the classes the journal has no message of its own
+func transferMessage(xmlMsg string, action string, resourceURI string, selectors []journalSelector) string {
+	replace := func(xmlMsg string, start string, end string, value string) string {
+		valueStart := strings.Index(xmlMsg, start) + len(start)
+		valueEnd := strings.Index(xmlMsg, end)
+		if valueStart < len(start) || valueEnd < valueStart {
+			return xmlMsg
+		}
+		return xmlMsg[:valueStart] + value + xmlMsg[valueEnd:]
+	}
+	xmlMsg = replace(xmlMsg, "<a:Action>", "</a:Action>", action)
+	xmlMsg = replace(xmlMsg, "<w:ResourceURI>", "</w:ResourceURI>", resourceURI)
+	if selectorStart := strings.Index(xmlMsg, "<w:SelectorSet>"); selectorStart >= 0 {
+		selectorEnd := strings.Index(xmlMsg, "</w:SelectorSet>") + len("</w:SelectorSet>")
+		xmlMsg = xmlMsg[:selectorStart] + xmlMsg[selectorEnd:]
+	}
+	selectorSet := "<w:SelectorSet>"
+	for _, selector := range selectors {
+		var value bytes.Buffer
+		xml.EscapeText(&value, []byte(selector.Value))
+		selectorSet = selectorSet + fmt.Sprintf(`<w:Selector Name="%s">%s</w:Selector>`, selector.Name, value.String())
+	}
+	xmlMsg = strings.Replace(xmlMsg, "</Header>", selectorSet+"</w:SelectorSet></Header>", 1)
+	return replace(xmlMsg, "<Body>", "</Body>", "")
+}
+
+// journaledCommands create and delete instances, the others only change settings
+var journaledCommands = []string{utils.CommandConfigure, utils.CommandApply, utils.CommandRestore}
+
+// startJournal refuses to change AMT while an earlier command waits for
+// rpc recover. The journal file is only written once AMT changes.
+func (service *ProvisioningService) startJournal() utils.ReturnCode {
+	path := service.flags.JournalFile
+	if path == "" {
+		path = defaultJournalPath()
+	}
+	if previous, err := readJournal(path); err == nil {
+		log.Errorf("%s did not finish, run rpc recover before changing AMT again (journal %s)", strings.Join(previous.Command, " "), path)
+		return utils.InterruptedOperation
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Error(err)
+		return utils.InterruptedOperation
+	}
+	service.journal = &journal{path: path, Command: service.flags.ReplayArgs(), Started: time.Now().UTC()}
+	return utils.Success
+}
+
+func (service *ProvisioningService) finishJournal(rc utils.ReturnCode) {
+	if rc == utils.Success || !service.journal.pending() {
+		service.journal.remove()
+		return
+	}
+	log.Warnf("the journal %s lists the AMT changes made before the failure, rpc recover undoes them", service.journal.path)
+}
@@ -0,0 +1,173 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rootCertificateGetXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate", `<h:AMT_PublicKeyCertificate><h:ElementName>Intel(r) AMT Certificate</h:ElementName><h:InstanceID>Intel(r) AMT Certificate: Handle: 1</h:InstanceID><h:ReadOnlyCertificate>false</h:ReadOnlyCertificate><h:TrustedRootCertficate>true</h:TrustedRootCertficate><h:X509Certificate>MIIBrootcert</h:X509Certificate></h:AMT_PublicKeyCertificate>`)
+
+var emptyBodyXMLResponse = wsmanEnvelope(publicKeyCertificateURI, "")
+
+func setupJournal(t *testing.T, lps *ProvisioningService) string {
+	lps.flags.JournalFile = filepath.Join(t.TempDir(), "journal.json")
+	rc := lps.startJournal()
+	assert.Equal(t, utils.Success, rc)
+	lps.setupWsmanClient("admin", "password")
+	return lps.flags.JournalFile
+}
+
+func TestJournal(t *testing.T) {
+	t.Run("records created and deleted instances", func(t *testing.T) {
+		f := &flags.Flags{}
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, trustedRootXMLResponse, &requests),
+			respondCaptureFunc(t, rootCertificateGetXMLResponse, &requests),
+			respondCaptureFunc(t, emptyBodyXMLResponse, &requests),
+		})
+		path := setupJournal(t, &lps)
+		handle, rc := lps.AddTrustedRootCert("MIIBnewcert")
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "Intel(r) AMT Certificate: Handle: 2", handle)
+		rc = lps.DeletePublicCert("Intel(r) AMT Certificate: Handle: 1")
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[1], "http://schemas.xmlsoap.org/ws/2004/09/transfer/Get")
+		assert.Contains(t, requests[1], `<w:Selector Name="InstanceID">Intel(r) AMT Certificate: Handle: 1</w:Selector>`)
+
+		j, err := readJournal(path)
+		assert.Nil(t, err)
+		assert.Equal(t, []journalEntry{{
+			Operation:   journalCreate,
+			ResourceURI: "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate",
+			Method:      "AddTrustedRootCertificate",
+			Selectors:   []journalSelector{{"InstanceID", "Intel(r) AMT Certificate: Handle: 2"}},
+			Done:        true,
+		}, {
+			Operation:   journalDelete,
+			ResourceURI: "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate",
+			Selectors:   []journalSelector{{"InstanceID", "Intel(r) AMT Certificate: Handle: 1"}},
+			PriorState:  rootCertificateGetXMLResponse,
+			Done:        true,
+		}}, j.Entries)
+
+		lps.finishJournal(utils.WSMANMessageError)
+		_, err = os.Stat(path)
+		assert.Nil(t, err)
+		lps.finishJournal(utils.Success)
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("a rollback leaves nothing to recover", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, trustedRootXMLResponse),
+			respondStringFunc(t, emptyBodyXMLResponse),
+		})
+		path := setupJournal(t, &lps)
+		handle, rc := lps.AddTrustedRootCert("MIIBnewcert")
+		assert.Equal(t, utils.Success, rc)
+		lps.RollbackAddedItems(&Handles{rootCertHandle: handle})
+		assert.False(t, lps.journal.pending())
+		lps.finishJournal(utils.WSMANMessageError)
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("nothing is recorded for a failed create", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		setupJournal(t, &lps)
+		_, rc := lps.AddTrustedRootCert("MIIBnewcert")
+		assert.Equal(t, utils.WSMANMessageError, rc)
+		assert.Empty(t, lps.journal.Entries)
+	})
+	t.Run("expect InterruptedOperation while a journal waits for recover", func(t *testing.T) {
+		f := &flags.Flags{JournalFile: filepath.Join(t.TempDir(), "journal.json")}
+		interrupted := &journal{path: f.JournalFile, Command: []string{"rpc", "configure", "tls"}}
+		assert.Nil(t, interrupted.write())
+		lps := setupService(f)
+		rc := lps.startJournal()
+		assert.Equal(t, utils.InterruptedOperation, rc)
+	})
+}
+
+func TestTransferMessage(t *testing.T) {
+	lps := setupService(&flags.Flags{})
+	xmlMsg := transferMessage(lps.cimMessages.WiFiEndpointSettings.Delete("Intel(r) AMT:WiFi Endpoint Settings home"),
+		wsTransferAction+"Get",
+		"http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate",
+		[]journalSelector{{"InstanceID", "Intel(r) AMT Certificate: Handle: 1"}})
+	assert.Contains(t, xmlMsg, "<a:Action>http://schemas.xmlsoap.org/ws/2004/09/transfer/Get</a:Action>")
+	assert.Contains(t, xmlMsg, "<w:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate</w:ResourceURI>")
+	assert.Contains(t, xmlMsg, `<w:SelectorSet><w:Selector Name="InstanceID">Intel(r) AMT Certificate: Handle: 1</w:Selector></w:SelectorSet></Header><Body></Body>`)
+	assert.NotContains(t, xmlMsg, "WiFi Endpoint Settings")
+}
+
+func TestRecover(t *testing.T) {
+	interrupted := func(t *testing.T, f *flags.Flags) {
+		f.JournalFile = filepath.Join(t.TempDir(), "journal.json")
+		j := &journal{path: f.JournalFile, Command: []string{"rpc", "configure", "wireless"}, Entries: []journalEntry{{
+			Operation:   journalCreate,
+			ResourceURI: "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate",
+			Method:      "AddTrustedRootCertificate",
+			Selectors:   []journalSelector{{"InstanceID", "Intel(r) AMT Certificate: Handle: 2"}},
+			Done:        true,
+		}, {
+			Operation:   journalDelete,
+			ResourceURI: "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate",
+			Selectors:   []journalSelector{{"InstanceID", "Intel(r) AMT Certificate: Handle: 1"}},
+			PriorState:  rootCertificateGetXMLResponse,
+			Done:        true,
+		}, {
+			Operation:   journalDelete,
+			ResourceURI: "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicPrivateKeyPair",
+			Selectors:   []journalSelector{{"InstanceID", "Intel(r) AMT Key: Handle: 0"}},
+			Done:        true,
+		}}}
+		assert.Nil(t, j.write())
+	}
+	t.Run("expect Success with nothing to recover", func(t *testing.T) {
+		f := &flags.Flags{JournalFile: filepath.Join(t.TempDir(), "journal.json")}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.Recover()
+		assert.Equal(t, utils.Success, rc)
+	})
+	t.Run("expect RecoveryFailed when a private key cannot be restored", func(t *testing.T) {
+		f := &flags.Flags{}
+		interrupted(t, f)
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, trustedRootXMLResponse, &requests),
+			respondCaptureFunc(t, rootCertificateGetXMLResponse, &requests),
+			respondCaptureFunc(t, emptyBodyXMLResponse, &requests),
+		})
+		rc := lps.Recover()
+		assert.Equal(t, utils.RecoveryFailed, rc)
+		assert.Contains(t, requests[0], "<h:CertificateBlob>MIIBrootcert</h:CertificateBlob>")
+		assert.Contains(t, requests[1], "http://schemas.xmlsoap.org/ws/2004/09/transfer/Get")
+		assert.Contains(t, requests[2], "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete")
+		assert.Contains(t, requests[2], "Intel(r) AMT Certificate: Handle: 2")
+		_, err := os.Stat(f.JournalFile)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("expect RecoveryFailed and the journal kept on errors", func(t *testing.T) {
+		f := &flags.Flags{}
+		interrupted(t, f)
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, trustedRootXMLResponse),
+			respondStringFunc(t, rootCertificateGetXMLResponse),
+			respondServerErrFunc(),
+		})
+		rc := lps.Recover()
+		assert.Equal(t, utils.RecoveryFailed, rc)
+		j, err := readJournal(f.JournalFile)
+		assert.Nil(t, err)
+		assert.Equal(t, []bool{false, true, true}, []bool{j.Entries[0].Undone, j.Entries[1].Undone, j.Entries[2].Undone})
+	})
+}
@@ -0,0 +1,52 @@
+package local
+
+import (
+	"github.com/jc-lab/intel-amt-host-api/internal/lm"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type lmsServer interface {
+	Start() error
+	Done() <-chan struct{}
+	Close() error
+}
+
+// supports unit testing
+var newLMSServer = func(address string) lmsServer {
+	return lm.NewLMSServer(address)
+}
+
+var lmsInterrupt = func() <-chan os.Signal {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	return stop
+}
+
+// RunLMS serves the local AMT ports over the LME until interrupted
+func (service *ProvisioningService) RunLMS() utils.ReturnCode {
+	return runLMSServer(newLMSServer(service.flags.LMSAddress), "lms")
+}
+
+// runLMSServer starts the server and keeps it running until interrupted
+func runLMSServer(server lmsServer, name string) utils.ReturnCode {
+	err := server.Start()
+	if err != nil {
+		log.Error("failed to start ", name, ": ", err)
+		return utils.AMTConnectionFailed
+	}
+	log.Info(name, " is running, press Ctrl+C to stop")
+	select {
+	case <-lmsInterrupt():
+		log.Info("stopping ", name)
+	case <-server.Done():
+		log.Error(name, " stopped unexpectedly")
+		return utils.AMTConnectionFailed
+	}
+	server.Close()
+	return utils.Success
+}
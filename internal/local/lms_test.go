@@ -0,0 +1,70 @@
+package local
+
+import (
+	"errors"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLMSServer struct {
+	address  string
+	startErr error
+	done     chan struct{}
+	closed   bool
+}
+
+func (m *mockLMSServer) Start() error          { return m.startErr }
+func (m *mockLMSServer) Done() <-chan struct{} { return m.done }
+func (m *mockLMSServer) Close() error {
+	m.closed = true
+	return nil
+}
+
+func setupLMS(t *testing.T, server *mockLMSServer, interrupt chan os.Signal) {
+	origServer, origInterrupt := newLMSServer, lmsInterrupt
+	newLMSServer = func(address string) lmsServer {
+		server.address = address
+		return server
+	}
+	lmsInterrupt = func() <-chan os.Signal { return interrupt }
+	t.Cleanup(func() {
+		newLMSServer, lmsInterrupt = origServer, origInterrupt
+	})
+}
+
+func TestRunLMS(t *testing.T) {
+	f := &flags.Flags{}
+	f.Command = utils.CommandLMS
+	f.LMSAddress = "127.0.0.1"
+
+	t.Run("returns Success when interrupted", func(t *testing.T) {
+		server := &mockLMSServer{done: make(chan struct{})}
+		interrupt := make(chan os.Signal, 1)
+		interrupt <- os.Interrupt
+		setupLMS(t, server, interrupt)
+		lps := setupService(f)
+		rc := lps.RunLMS()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "127.0.0.1", server.address)
+		assert.True(t, server.closed)
+	})
+	t.Run("returns AMTConnectionFailed when start fails", func(t *testing.T) {
+		server := &mockLMSServer{done: make(chan struct{}), startErr: errors.New("no such device")}
+		setupLMS(t, server, make(chan os.Signal))
+		lps := setupService(f)
+		rc := lps.RunLMS()
+		assert.Equal(t, utils.AMTConnectionFailed, rc)
+	})
+	t.Run("returns AMTConnectionFailed when the LME connection is lost", func(t *testing.T) {
+		server := &mockLMSServer{done: make(chan struct{})}
+		close(server.done)
+		setupLMS(t, server, make(chan os.Signal))
+		lps := setupService(f)
+		rc := lps.RunLMS()
+		assert.Equal(t, utils.AMTConnectionFailed, rc)
+	})
+}
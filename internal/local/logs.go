@@ -0,0 +1,512 @@
+package local
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var auditAppNames = map[int]string{
+	16: "Security Admin",
+	17: "RCO",
+	18: "Redirection Manager",
+	19: "Firmware Update Manager",
+	20: "Security Audit Log",
+	21: "Network Time",
+	22: "Network Administration",
+	23: "Storage Administration",
+	24: "Event Manager",
+	25: "Circuit Breaker Manager",
+	26: "Agent Presence Manager",
+	27: "Wireless Configuration",
+	28: "EAC",
+	29: "KVM",
+	30: "User Opt-In",
+	32: "Screen Blanking",
+	33: "Watchdog",
+}
+
+// audit events are keyed by AuditAppID * 100 + EventID
+var auditEventNames = map[int]string{
+	1600: "Provisioning Started",
+	1601: "Provisioning Completed",
+	1602: "ACL Entry Added",
+	1603: "ACL Entry Modified",
+	1604: "ACL Entry Removed",
+	1605: "ACL Access with Invalid Credentials",
+	1606: "ACL Entry State",
+	1607: "TLS State Changed",
+	1608: "TLS Server Certificate Set",
+	1609: "TLS Server Certificate Removed",
+	1610: "TLS Trusted Root Certificate Added",
+	1611: "TLS Trusted Root Certificate Removed",
+	1612: "TLS Preshared Key Set",
+	1613: "Kerberos Settings Modified",
+	1614: "Kerberos Main Key Modified",
+	1615: "Flash Wear Out Counters Reset",
+	1616: "Power Package Modified",
+	1617: "Set Realm Authentication Mode",
+	1618: "Upgrade Client to Admin Control Mode",
+	1619: "Unprovisioning Started",
+	1700: "Performed Power Up",
+	1701: "Performed Power Down",
+	1702: "Performed Power Cycle",
+	1703: "Performed Reset",
+	1704: "Set Boot Options",
+	1800: "IDER Session Opened",
+	1801: "IDER Session Closed",
+	1802: "IDER Enabled",
+	1803: "IDER Disabled",
+	1804: "SoL Session Opened",
+	1805: "SoL Session Closed",
+	1806: "SoL Enabled",
+	1807: "SoL Disabled",
+	1808: "KVM Session Started",
+	1809: "KVM Session Ended",
+	1810: "KVM Enabled",
+	1811: "KVM Disabled",
+	1812: "VNC Password Failed 3 Times",
+	1900: "Firmware Updated",
+	1901: "Firmware Update Failed",
+	2000: "Security Audit Log Cleared",
+	2001: "Security Audit Policy Modified",
+	2002: "Security Audit Log Disabled",
+	2003: "Security Audit Log Enabled",
+	2004: "Security Audit Log Exported",
+	2005: "Security Audit Log Recovered",
+	2100: "AMT Time Set",
+	3000: "Opt-In Policy Changed",
+	3001: "Send Consent Code Event",
+	3002: "Start Opt-In Blocked Event",
+}
+
+var auditInitiatorTypes = map[int]string{
+	0: "HTTP Digest",
+	1: "Kerberos",
+	2: "Local",
+	3: "KVM Default Port",
+}
+
+var eventSeverityNames = map[int]string{
+	0:  "Unspecified",
+	1:  "Monitor",
+	2:  "Information",
+	4:  "OK",
+	8:  "Non-critical",
+	16: "Critical",
+	32: "Non-recoverable",
+}
+
+// AuditLogRecord is a decoded AMT_AuditLog record
+type AuditLogRecord struct {
+	Time          time.Time `json:"time"`
+	AuditAppID    int       `json:"auditAppId"`
+	AuditApp      string    `json:"auditApp"`
+	EventID       int       `json:"eventId"`
+	Event         string    `json:"event"`
+	InitiatorType int       `json:"initiatorType"`
+	Initiator     string    `json:"initiator"`
+	LocationType  int       `json:"locationType"`
+	NetAddress    string    `json:"netAddress"`
+	ExtendedData  string    `json:"extendedData"`
+}
+
+// EventLogRecord is a decoded AMT_MessageLog record in the PET event format
+type EventLogRecord struct {
+	Time            time.Time `json:"time"`
+	DeviceAddress   int       `json:"deviceAddress"`
+	EventSensorType int       `json:"eventSensorType"`
+	EventType       int       `json:"eventType"`
+	EventOffset     int       `json:"eventOffset"`
+	EventSourceType int       `json:"eventSourceType"`
+	EventSeverity   int       `json:"eventSeverity"`
+	Severity        string    `json:"severity"`
+	SensorNumber    int       `json:"sensorNumber"`
+	Entity          int       `json:"entity"`
+	EntityInstance  int       `json:"entityInstance"`
+	EventData       string    `json:"eventData"`
+}
+
+// go-wsman-messages has no response types for AMT_AuditLog and AMT_MessageLog
+type readRecordsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		ReadRecords_OUTPUT struct {
+			TotalRecordCount int      `xml:"TotalRecordCount"`
+			RecordsReturned  int      `xml:"RecordsReturned"`
+			EventRecords     []string `xml:"EventRecords"`
+			ReturnValue      int      `xml:"ReturnValue"`
+		} `xml:"ReadRecords_OUTPUT"`
+	} `xml:"Body"`
+}
+
+type positionToFirstRecordResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		PositionToFirstRecord_OUTPUT struct {
+			IterationIdentifier int `xml:"IterationIdentifier"`
+			ReturnValue         int `xml:"ReturnValue"`
+		} `xml:"PositionToFirstRecord_OUTPUT"`
+	} `xml:"Body"`
+}
+
+type getRecordsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetRecords_OUTPUT struct {
+			IterationIdentifier int      `xml:"IterationIdentifier"`
+			NoMoreRecords       bool     `xml:"NoMoreRecords"`
+			RecordArray         []string `xml:"RecordArray"`
+			ReturnValue         int      `xml:"ReturnValue"`
+		} `xml:"GetRecords_OUTPUT"`
+	} `xml:"Body"`
+}
+
+type clearLogInput struct {
+	XMLName xml.Name `xml:"h:ClearLog_INPUT"`
+	H       string   `xml:"xmlns:h,attr"`
+}
+
+type clearLogResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		ClearLog_OUTPUT struct {
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:"ClearLog_OUTPUT"`
+	} `xml:"Body"`
+}
+
+func (service *ProvisioningService) RunLogs() utils.ReturnCode {
+	if service.flags.Logs.Clear {
+		controlMode, err := service.amtCommand.GetControlMode()
+		if err != nil {
+			log.Error(err)
+			return utils.AMTConnectionFailed
+		}
+		if controlMode != 2 {
+			log.Error("clearing the log requires admin control mode. Device control mode: " + utils.InterpretControlMode(controlMode))
+			return utils.ClearLogFailed
+		}
+	}
+	service.setupWsmanClient("admin", service.flags.Password)
+	var rc utils.ReturnCode
+	if service.flags.SubCommand == utils.SubCommandLogsAudit {
+		var records []AuditLogRecord
+		if records, rc = service.GetAuditLogRecords(); rc != utils.Success {
+			return rc
+		}
+		records = filterAuditLogRecords(records, service.flags.Logs.Since)
+		if rc = writeLogRecords(os.Stdout, service.flags.Logs.Format, auditLogRows(records), records); rc != utils.Success {
+			return rc
+		}
+		if service.flags.Logs.Clear {
+			return service.ClearAuditLog()
+		}
+		return utils.Success
+	}
+	var records []EventLogRecord
+	if records, rc = service.GetEventLogRecords(); rc != utils.Success {
+		return rc
+	}
+	records = filterEventLogRecords(records, service.flags.Logs.Since)
+	if rc = writeLogRecords(os.Stdout, service.flags.Logs.Format, eventLogRows(records), records); rc != utils.Success {
+		return rc
+	}
+	if service.flags.Logs.Clear {
+		return service.ClearEventLog()
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) GetAuditLogRecords() ([]AuditLogRecord, utils.ReturnCode) {
+	var records []AuditLogRecord
+	for startIndex := 1; ; {
+		var rsp readRecordsResponse
+		rc := service.PostAndUnmarshal(service.amtMessages.AuditLog.ReadRecords(startIndex), &rsp)
+		if rc != utils.Success {
+			return records, rc
+		}
+		output := rsp.Body.ReadRecords_OUTPUT
+		if output.ReturnValue != 0 {
+			log.Errorf("failed ReadRecords with ReturnValue: %d", output.ReturnValue)
+			return records, utils.AmtPtStatusCodeBase + utils.ReturnCode(output.ReturnValue)
+		}
+		for _, encoded := range output.EventRecords {
+			record, err := decodeAuditLogRecord(encoded)
+			if err != nil {
+				log.Errorf("failed to decode audit log record %d: %s", startIndex+len(records), err)
+				return records, utils.ReadLogFailed
+			}
+			records = append(records, record)
+		}
+		startIndex += output.RecordsReturned
+		if output.RecordsReturned == 0 || startIndex > output.TotalRecordCount {
+			break
+		}
+	}
+	return records, utils.Success
+}
+
+func (service *ProvisioningService) GetEventLogRecords() ([]EventLogRecord, utils.ReturnCode) {
+	var records []EventLogRecord
+	var positionRsp positionToFirstRecordResponse
+	rc := service.PostAndUnmarshal(service.amtMessages.MessageLog.PositionToFirstRecord(), &positionRsp)
+	if rc != utils.Success {
+		return records, rc
+	}
+	if returnValue := positionRsp.Body.PositionToFirstRecord_OUTPUT.ReturnValue; returnValue != 0 {
+		log.Errorf("failed PositionToFirstRecord with ReturnValue: %d", returnValue)
+		return records, utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+	}
+	identifier := positionRsp.Body.PositionToFirstRecord_OUTPUT.IterationIdentifier
+	for {
+		var rsp getRecordsResponse
+		rc = service.PostAndUnmarshal(service.amtMessages.MessageLog.GetRecords(identifier), &rsp)
+		if rc != utils.Success {
+			return records, rc
+		}
+		output := rsp.Body.GetRecords_OUTPUT
+		if output.ReturnValue != 0 {
+			log.Errorf("failed GetRecords with ReturnValue: %d", output.ReturnValue)
+			return records, utils.AmtPtStatusCodeBase + utils.ReturnCode(output.ReturnValue)
+		}
+		for _, encoded := range output.RecordArray {
+			record, err := decodeEventLogRecord(encoded)
+			if err != nil {
+				log.Errorf("failed to decode event log record %d: %s", len(records)+1, err)
+				return records, utils.ReadLogFailed
+			}
+			records = append(records, record)
+		}
+		if output.NoMoreRecords || len(output.RecordArray) == 0 {
+			break
+		}
+		identifier = output.IterationIdentifier
+	}
+	return records, utils.Success
+}
+
+func (service *ProvisioningService) ClearAuditLog() utils.ReturnCode {
+	input := clearLogInput{H: "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuditLog"}
+	xmlMsg, err := methodMessage(service.amtMessages.AuditLog.ReadRecords(1), "ClearLog", input)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	return service.clearLog(xmlMsg)
+}
+
+func (service *ProvisioningService) ClearEventLog() utils.ReturnCode {
+	input := clearLogInput{H: "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_MessageLog"}
+	xmlMsg, err := methodMessage(service.amtMessages.MessageLog.PositionToFirstRecord(), "ClearLog", input)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	return service.clearLog(xmlMsg)
+}
+
+func (service *ProvisioningService) clearLog(xmlMsg string) utils.ReturnCode {
+	var rsp clearLogResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rsp)
+	if rc != utils.Success {
+		return utils.ClearLogFailed
+	}
+	if returnValue := rsp.Body.ClearLog_OUTPUT.ReturnValue; returnValue != 0 {
+		log.Errorf("failed ClearLog with ReturnValue: %d", returnValue)
+		return utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+	}
+	log.Info("log cleared successfully")
+	return utils.Success
+}
+
+// decodeAuditLogRecord decodes the binary audit record format: app id, event id,
+// initiator, timestamp, network access and extended data. Numbers are big endian.
+func decodeAuditLogRecord(encoded string) (AuditLogRecord, error) {
+	var record AuditLogRecord
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return record, err
+	}
+	errShort := errors.New("record is too short")
+	if len(data) < 5 {
+		return record, errShort
+	}
+	record.AuditAppID = int(binary.BigEndian.Uint16(data[0:2]))
+	record.EventID = int(binary.BigEndian.Uint16(data[2:4]))
+	record.AuditApp = auditAppNames[record.AuditAppID]
+	record.Event = auditEventNames[record.AuditAppID*100+record.EventID]
+	if record.Event == "" {
+		record.Event = "Event " + strconv.Itoa(record.EventID)
+	}
+	record.InitiatorType = int(data[4])
+	ptr := 5
+	switch record.InitiatorType {
+	case 0:
+		if len(data) < ptr+1 || len(data) < ptr+1+int(data[ptr]) {
+			return record, errShort
+		}
+		userLen := int(data[ptr])
+		record.Initiator = string(data[ptr+1 : ptr+1+userLen])
+		ptr += 1 + userLen
+	case 1:
+		// 4 bytes of user in domain flag, then the SID
+		if len(data) < ptr+5 || len(data) < ptr+5+int(data[ptr+4]) {
+			return record, errShort
+		}
+		sidLen := int(data[ptr+4])
+		record.Initiator = sidString(data[ptr+5 : ptr+5+sidLen])
+		ptr += 5 + sidLen
+	default:
+		record.Initiator = auditInitiatorTypes[record.InitiatorType]
+	}
+	if len(data) < ptr+6 {
+		return record, errShort
+	}
+	record.Time = time.Unix(int64(binary.BigEndian.Uint32(data[ptr:ptr+4])), 0).UTC()
+	ptr += 4
+	record.LocationType = int(data[ptr])
+	netLen := int(data[ptr+1])
+	ptr += 2
+	if len(data) < ptr+netLen+1 {
+		return record, errShort
+	}
+	record.NetAddress = strings.TrimRight(string(data[ptr:ptr+netLen]), "\x00")
+	ptr += netLen
+	exLen := int(data[ptr])
+	ptr++
+	if len(data) < ptr+exLen {
+		return record, errShort
+	}
+	record.ExtendedData = hex.EncodeToString(data[ptr : ptr+exLen])
+	return record, nil
+}
+
+// decodeEventLogRecord decodes a 21 byte PET event record. The timestamp is little endian.
+func decodeEventLogRecord(encoded string) (EventLogRecord, error) {
+	var record EventLogRecord
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return record, err
+	}
+	if len(data) < 21 {
+		return record, errors.New("record is too short")
+	}
+	record.Time = time.Unix(int64(binary.LittleEndian.Uint32(data[0:4])), 0).UTC()
+	record.DeviceAddress = int(data[4])
+	record.EventSensorType = int(data[5])
+	record.EventType = int(data[6])
+	record.EventOffset = int(data[7])
+	record.EventSourceType = int(data[8])
+	record.EventSeverity = int(data[9])
+	record.Severity = eventSeverityNames[record.EventSeverity]
+	record.SensorNumber = int(data[10])
+	record.Entity = int(data[11])
+	record.EntityInstance = int(data[12])
+	record.EventData = hex.EncodeToString(data[13:21])
+	return record, nil
+}
+
+func sidString(sid []byte) string {
+	if len(sid) < 8 {
+		return hex.EncodeToString(sid)
+	}
+	var authority uint64
+	for _, b := range sid[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+	s := fmt.Sprintf("S-%d-%d", sid[0], authority)
+	for i := 8; i+4 <= len(sid); i += 4 {
+		s += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(sid[i:i+4]))
+	}
+	return s
+}
+
+func filterAuditLogRecords(records []AuditLogRecord, since time.Time) []AuditLogRecord {
+	var filtered []AuditLogRecord
+	for _, record := range records {
+		if !record.Time.Before(since) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+func filterEventLogRecords(records []EventLogRecord, since time.Time) []EventLogRecord {
+	var filtered []EventLogRecord
+	for _, record := range records {
+		if !record.Time.Before(since) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+func auditLogRows(records []AuditLogRecord) [][]string {
+	rows := [][]string{{"Time", "AuditApp", "Event", "Initiator", "NetAddress", "ExtendedData"}}
+	for _, r := range records {
+		rows = append(rows, []string{r.Time.Format(time.RFC3339), r.AuditApp, r.Event, r.Initiator, r.NetAddress, r.ExtendedData})
+	}
+	return rows
+}
+
+func eventLogRows(records []EventLogRecord) [][]string {
+	rows := [][]string{{"Time", "Severity", "SensorType", "EventType", "EventOffset", "SensorNumber", "Entity", "EventData"}}
+	for _, r := range records {
+		rows = append(rows, []string{
+			r.Time.Format(time.RFC3339),
+			r.Severity,
+			strconv.Itoa(r.EventSensorType),
+			strconv.Itoa(r.EventType),
+			strconv.Itoa(r.EventOffset),
+			strconv.Itoa(r.SensorNumber),
+			strconv.Itoa(r.Entity),
+			r.EventData,
+		})
+	}
+	return rows
+}
+
+// writeLogRecords writes rows, with the header first, as text or CSV and the
+// records as JSON lines
+func writeLogRecords[T any](w io.Writer, format string, rows [][]string, records []T) utils.ReturnCode {
+	switch format {
+	case flags.LogsFormatJSON:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				log.Error(err)
+				return utils.ReadLogFailed
+			}
+		}
+	case flags.LogsFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.WriteAll(rows); err != nil {
+			log.Error(err)
+			return utils.ReadLogFailed
+		}
+	default:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, row := range rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		writer.Flush()
+	}
+	return utils.Success
+}
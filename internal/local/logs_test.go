@@ -0,0 +1,256 @@
+package local
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var auditLogTime = time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+
+// auditLogRecordData builds an audit record of Security Admin: Provisioning Started
+// by the HTTP digest user admin
+func auditLogRecordData() string {
+	data := []byte{0, 16, 0, 0, 0, 5}
+	data = append(data, "admin"...)
+	data = binary.BigEndian.AppendUint32(data, uint32(auditLogTime.Unix()))
+	data = append(data, 0, 9)
+	data = append(data, "10.0.0.1\x00"...)
+	data = append(data, 2, 0xab, 0xcd)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func eventLogRecordData(timestamp time.Time) string {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(timestamp.Unix()))
+	data = append(data, 104, 15, 111, 2, 104, 16, 1, 34, 0, 170, 1, 2, 3, 4, 5, 6, 7)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func readRecordsXMLResponse(total int, records ...string) string {
+	body := fmt.Sprintf(`<h:ReadRecords_OUTPUT><h:TotalRecordCount>%d</h:TotalRecordCount><h:RecordsReturned>%d</h:RecordsReturned>`, total, len(records))
+	for _, record := range records {
+		body += `<h:EventRecords>` + record + `</h:EventRecords>`
+	}
+	body += `<h:ReturnValue>0</h:ReturnValue></h:ReadRecords_OUTPUT>`
+	return wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuditLog", body)
+}
+
+func getRecordsXMLResponse(noMoreRecords bool, records ...string) string {
+	body := fmt.Sprintf(`<h:GetRecords_OUTPUT><h:IterationIdentifier>2</h:IterationIdentifier><h:NoMoreRecords>%t</h:NoMoreRecords>`, noMoreRecords)
+	for _, record := range records {
+		body += `<h:RecordArray>` + record + `</h:RecordArray>`
+	}
+	body += `<h:ReturnValue>0</h:ReturnValue></h:GetRecords_OUTPUT>`
+	return wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuditLog", body)
+}
+
+var positionToFirstRecordXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_MessageLog", `<h:PositionToFirstRecord_OUTPUT><h:IterationIdentifier>1</h:IterationIdentifier><h:ReturnValue>0</h:ReturnValue></h:PositionToFirstRecord_OUTPUT>`)
+var clearLogXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuditLog", `<h:ClearLog_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:ClearLog_OUTPUT>`)
+
+func TestDecodeAuditLogRecord(t *testing.T) {
+	t.Run("expect digest initiator", func(t *testing.T) {
+		record, err := decodeAuditLogRecord(auditLogRecordData())
+		assert.NoError(t, err)
+		assert.Equal(t, AuditLogRecord{
+			Time:          auditLogTime,
+			AuditAppID:    16,
+			AuditApp:      "Security Admin",
+			EventID:       0,
+			Event:         "Provisioning Started",
+			InitiatorType: 0,
+			Initiator:     "admin",
+			NetAddress:    "10.0.0.1",
+			ExtendedData:  "abcd",
+		}, record)
+	})
+	t.Run("expect kerberos initiator", func(t *testing.T) {
+		data := []byte{0, 18, 0, 8, 1, 0, 0, 0, 0, 12, 1, 1, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0}
+		data = binary.BigEndian.AppendUint32(data, uint32(auditLogTime.Unix()))
+		data = append(data, 0, 0, 0)
+		record, err := decodeAuditLogRecord(base64.StdEncoding.EncodeToString(data))
+		assert.NoError(t, err)
+		assert.Equal(t, "S-1-5-21", record.Initiator)
+		assert.Equal(t, "KVM Session Started", record.Event)
+	})
+	t.Run("expect local initiator and unknown event", func(t *testing.T) {
+		data := []byte{0, 99, 0, 7, 2}
+		data = binary.BigEndian.AppendUint32(data, uint32(auditLogTime.Unix()))
+		data = append(data, 0, 0, 0)
+		record, err := decodeAuditLogRecord(base64.StdEncoding.EncodeToString(data))
+		assert.NoError(t, err)
+		assert.Equal(t, "Local", record.Initiator)
+		assert.Equal(t, "", record.AuditApp)
+		assert.Equal(t, "Event 7", record.Event)
+	})
+	t.Run("expect error for a short record", func(t *testing.T) {
+		_, err := decodeAuditLogRecord(base64.StdEncoding.EncodeToString([]byte{0, 16, 0, 0, 0, 5, 'a'}))
+		assert.Error(t, err)
+	})
+	t.Run("expect error for bad base64", func(t *testing.T) {
+		_, err := decodeAuditLogRecord("!!")
+		assert.Error(t, err)
+	})
+}
+
+func TestDecodeEventLogRecord(t *testing.T) {
+	record, err := decodeEventLogRecord(eventLogRecordData(auditLogTime))
+	assert.NoError(t, err)
+	assert.Equal(t, EventLogRecord{
+		Time:            auditLogTime,
+		DeviceAddress:   104,
+		EventSensorType: 15,
+		EventType:       111,
+		EventOffset:     2,
+		EventSourceType: 104,
+		EventSeverity:   16,
+		Severity:        "Critical",
+		SensorNumber:    1,
+		Entity:          34,
+		EntityInstance:  0,
+		EventData:       "aa01020304050607",
+	}, record)
+	_, err = decodeEventLogRecord(base64.StdEncoding.EncodeToString([]byte{1, 2, 3}))
+	assert.Error(t, err)
+}
+
+func TestGetAuditLogRecords(t *testing.T) {
+	t.Run("expect Success reading every page", func(t *testing.T) {
+		f := &flags.Flags{}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondCaptureFunc(t, readRecordsXMLResponse(2, auditLogRecordData()), &requests),
+			respondCaptureFunc(t, readRecordsXMLResponse(2, auditLogRecordData()), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		records, rc := lps.GetAuditLogRecords()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, records, 2)
+		assert.Contains(t, requests[0], "<h:StartIndex>1</h:StartIndex>")
+		assert.Contains(t, requests[1], "<h:StartIndex>2</h:StartIndex>")
+	})
+	t.Run("expect ReadLogFailed for a bad record", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, readRecordsXMLResponse(1, "AAAA")),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		_, rc := lps.GetAuditLogRecords()
+		assert.Equal(t, utils.ReadLogFailed, rc)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		_, rc := lps.GetAuditLogRecords()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestGetEventLogRecords(t *testing.T) {
+	t.Run("expect Success reading every page", func(t *testing.T) {
+		f := &flags.Flags{}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, positionToFirstRecordXMLResponse),
+			respondCaptureFunc(t, getRecordsXMLResponse(false, eventLogRecordData(auditLogTime)), &requests),
+			respondCaptureFunc(t, getRecordsXMLResponse(true, eventLogRecordData(auditLogTime)), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		records, rc := lps.GetEventLogRecords()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, records, 2)
+		assert.Contains(t, requests[0], "<h:IterationIdentifier>1</h:IterationIdentifier>")
+		assert.Contains(t, requests[1], "<h:IterationIdentifier>2</h:IterationIdentifier>")
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		_, rc := lps.GetEventLogRecords()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestRunLogs(t *testing.T) {
+	t.Run("expect ClearLogFailed to clear outside of admin control mode", func(t *testing.T) {
+		orig := mockControlMode
+		mockControlMode = 1
+		defer func() { mockControlMode = orig }()
+		f := &flags.Flags{SubCommand: utils.SubCommandLogsAudit}
+		f.Logs.Clear = true
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.RunLogs()
+		assert.Equal(t, utils.ClearLogFailed, rc)
+	})
+	t.Run("expect Success to read and clear the audit log", func(t *testing.T) {
+		orig := mockControlMode
+		mockControlMode = 2
+		defer func() { mockControlMode = orig }()
+		f := &flags.Flags{SubCommand: utils.SubCommandLogsAudit}
+		f.Logs = flags.LogsFlags{Format: flags.LogsFormatJSON, Clear: true}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, readRecordsXMLResponse(1, auditLogRecordData())),
+			respondCaptureFunc(t, fmt.Sprintf(clearLogXMLResponse, 0), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunLogs()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[0], "<a:Action>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuditLog/ClearLog</a:Action>")
+		assert.Contains(t, requests[0], `<h:ClearLog_INPUT xmlns:h="http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuditLog">`)
+	})
+	t.Run("expect ReturnValue from clearing the event log", func(t *testing.T) {
+		orig := mockControlMode
+		mockControlMode = 2
+		defer func() { mockControlMode = orig }()
+		f := &flags.Flags{SubCommand: utils.SubCommandLogsEvents}
+		f.Logs = flags.LogsFlags{Format: flags.LogsFormatCSV, Clear: true}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, positionToFirstRecordXMLResponse),
+			respondStringFunc(t, getRecordsXMLResponse(true)),
+			respondCaptureFunc(t, fmt.Sprintf(clearLogXMLResponse, 1), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunLogs()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+1, rc)
+		assert.Contains(t, requests[0], "AMT_MessageLog/ClearLog</a:Action>")
+	})
+}
+
+func TestFilterLogRecords(t *testing.T) {
+	audit := []AuditLogRecord{{Time: auditLogTime}, {Time: auditLogTime.Add(-time.Hour)}}
+	assert.Len(t, filterAuditLogRecords(audit, time.Time{}), 2)
+	assert.Len(t, filterAuditLogRecords(audit, auditLogTime), 1)
+	events := []EventLogRecord{{Time: auditLogTime}, {Time: auditLogTime.Add(-time.Hour)}}
+	assert.Len(t, filterEventLogRecords(events, auditLogTime.Add(time.Second)), 0)
+}
+
+func TestWriteLogRecords(t *testing.T) {
+	record, _ := decodeAuditLogRecord(auditLogRecordData())
+	records := []AuditLogRecord{record}
+	t.Run("expect json lines", func(t *testing.T) {
+		var b bytes.Buffer
+		rc := writeLogRecords(&b, flags.LogsFormatJSON, auditLogRows(records), records)
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, `{"time":"2024-03-04T05:06:07Z","auditAppId":16,"auditApp":"Security Admin","eventId":0,"event":"Provisioning Started","initiatorType":0,"initiator":"admin","locationType":0,"netAddress":"10.0.0.1","extendedData":"abcd"}`+"\n", b.String())
+	})
+	t.Run("expect csv with a header", func(t *testing.T) {
+		var b bytes.Buffer
+		rc := writeLogRecords(&b, flags.LogsFormatCSV, auditLogRows(records), records)
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "Time,AuditApp,Event,Initiator,NetAddress,ExtendedData\n2024-03-04T05:06:07Z,Security Admin,Provisioning Started,admin,10.0.0.1,abcd\n", b.String())
+	})
+	t.Run("expect aligned text", func(t *testing.T) {
+		var b bytes.Buffer
+		rc := writeLogRecords(&b, flags.LogsFormatText, eventLogRows(nil), []EventLogRecord{})
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, "Time  Severity  SensorType  EventType  EventOffset  SensorNumber  Entity  EventData\n", b.String())
+	})
+}
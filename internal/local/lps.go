@@ -1,6 +1,10 @@
 package local
 
 import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
 	internalAMT "github.com/jc-lab/intel-amt-host-api/internal/amt"
 	"github.com/jc-lab/intel-amt-host-api/internal/config"
 	"github.com/jc-lab/intel-amt-host-api/internal/flags"
@@ -21,7 +25,8 @@ type RealOSNetworker struct{}
 type ProvisioningService struct {
 	flags            *flags.Flags
 	serverURL        string
-	client           *wsman.Client
+	tlsServerURL     string
+	client           wsman.WSManClient
 	config           *config.Config
 	amtCommand       internalAMT.Interface
 	amtMessages      amt.Messages
@@ -29,15 +34,27 @@ type ProvisioningService struct {
 	ipsMessages      ips.Messages
 	handlesWithCerts map[string]string
 	networker        OSNetworker
+	plan             *dryRunPlan
+	journal          *journal
 }
 
 func NewProvisioningService(flags *flags.Flags) ProvisioningService {
 	// supports unit testing
-	serverURL := "http://" + utils.LMSAddress + ":" + utils.LMSPort + "/wsman"
+	lmsAddress := utils.LMSAddress
+	if flags.LMSAddress != "" {
+		lmsAddress = flags.LMSAddress
+	}
+	lmsPort := utils.LMSPort
+	if flags.LMSPort != "" {
+		lmsPort = flags.LMSPort
+	}
+	serverURL := "http://" + net.JoinHostPort(lmsAddress, lmsPort) + "/wsman"
+	tlsServerURL := "https://" + net.JoinHostPort(lmsAddress, utils.LMSTLSPort) + "/wsman"
 	return ProvisioningService{
 		flags:            flags,
 		client:           nil,
 		serverURL:        serverURL,
+		tlsServerURL:     tlsServerURL,
 		config:           &flags.LocalConfig,
 		amtCommand:       internalAMT.NewAMTCommand(),
 		amtMessages:      amt.NewMessages(),
@@ -51,6 +68,13 @@ func NewProvisioningService(flags *flags.Flags) ProvisioningService {
 func ExecuteCommand(flags *flags.Flags) utils.ReturnCode {
 	rc := utils.Success
 	service := NewProvisioningService(flags)
+	if flags.DryRun {
+		service.enableDryRun()
+	} else if containsString(journaledCommands, flags.Command) {
+		if rc = service.startJournal(); rc != utils.Success {
+			return rc
+		}
+	}
 	switch flags.Command {
 	case utils.CommandActivate:
 		rc = service.Activate()
@@ -64,13 +88,75 @@ func ExecuteCommand(flags *flags.Flags) utils.ReturnCode {
 	case utils.CommandConfigure:
 		rc = service.Configure()
 		break
+	case utils.CommandMaintenance:
+		rc = service.RunMaintenance()
+		break
 	case utils.CommandVersion:
 		rc = service.DisplayVersion()
 		break
+	case utils.CommandLMS:
+		rc = service.RunLMS()
+		break
+	case utils.CommandEvents:
+		rc = service.RunEventsListen()
+		break
+	case utils.CommandPower:
+		rc = service.RunPower()
+		break
+	case utils.CommandBoot:
+		rc = service.RunBoot()
+		break
+	case utils.CommandLogs:
+		rc = service.RunLogs()
+		break
+	case utils.CommandInventory:
+		rc = service.RunInventory()
+		break
+	case utils.CommandConsent:
+		rc = service.RunConsent()
+		break
+	case utils.CommandUsers:
+		rc = service.RunUsers()
+		break
+	case utils.CommandApply:
+		rc = service.Apply()
+		break
+	case utils.CommandRecover:
+		rc = service.Recover()
+		break
+	case utils.CommandBackup:
+		rc = service.Backup()
+		break
+	case utils.CommandRestore:
+		rc = service.Restore()
+		break
+	}
+	if service.journal != nil {
+		service.finishJournal(rc)
+	}
+	if flags.DryRun {
+		service.printPlan()
 	}
 	return rc
 }
 
 func (service *ProvisioningService) setupWsmanClient(username string, password string) {
-	service.client = wsman.NewClient(service.serverURL, username, password, true, service.flags.Verbose)
+	service.useClient(wsman.NewClient(service.serverURL, username, password, true, service.flags.Verbose))
+}
+
+func (service *ProvisioningService) setupTLSWsmanClient(username string, password string, tlsConfig *tls.Config) {
+	client := wsman.NewClient(service.tlsServerURL, username, password, true, service.flags.Verbose)
+	client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	service.useClient(client)
+}
+
+// useClient puts dry run or the journal between the commands and AMT
+func (service *ProvisioningService) useClient(client *wsman.Client) {
+	if service.plan != nil {
+		client.Transport = &dryRunTransport{client.Transport, service.plan}
+	}
+	service.client = client
+	if service.journal != nil {
+		service.client = journalClient{client, service.journal}
+	}
 }
@@ -45,6 +45,19 @@ var mockVersionDataErr error = nil
 func (c MockAMT) GetVersionDataFromME(key string, amtTimeout time.Duration) (string, error) {
 	return "Version", mockVersionDataErr
 }
+
+var mockCodeVersions = amt2.FirmwareVersions{
+	BiosVersion: "Bios",
+	Versions: []amt2.FirmwareVersion{
+		{Description: "AMT", Version: "Version"},
+		{Description: "Build Number", Version: "Version"},
+		{Description: "Sku", Version: "Version"},
+	},
+}
+
+func (c MockAMT) GetAllCodeVersions(amtTimeout time.Duration) (amt2.FirmwareVersions, error) {
+	return mockCodeVersions, mockVersionDataErr
+}
 func (c MockAMT) GetChangeEnabled() (amt2.ChangeEnabledResponse, error) {
 	return mockChangeEnabledResponse, mockChangeEnabledErr
 }
@@ -130,6 +143,81 @@ var mockUnprovisionErr error = nil
 
 func (c MockAMT) Unprovision() (int, error) { return mockUnprovisionCode, mockUnprovisionErr }
 
+var mockSecurityParameters = amt2.SecurityParameters{EnterpriseMode: true, ProvisioningState: "post-provisioning"}
+var mockSecurityParametersErr error = nil
+
+func (c MockAMT) GetSecurityParameters() (amt2.SecurityParameters, error) {
+	return mockSecurityParameters, mockSecurityParametersErr
+}
+
+var mockMACAddresses = amt2.MACAddresses{DedicatedMAC: "00:00:00:00:00:00", HostMAC: "01:02:03:04:05:06"}
+var mockMACAddressesErr error = nil
+
+func (c MockAMT) GetMACAddresses() (amt2.MACAddresses, error) {
+	return mockMACAddresses, mockMACAddressesErr
+}
+
+var mockProvisioningState = 2
+var mockProvisioningStateErr error = nil
+
+func (c MockAMT) GetProvisioningState() (int, error) {
+	return mockProvisioningState, mockProvisioningStateErr
+}
+
+var mockDNSSuffixList = []string{"dns.org", "other.org"}
+var mockDNSSuffixListErr error = nil
+
+func (c MockAMT) GetDNSSuffixList() ([]string, error) {
+	return mockDNSSuffixList, mockDNSSuffixListErr
+}
+
+var mockEnterpriseAccessErr error = nil
+
+func (c MockAMT) SetEnterpriseAccess(hostIPAddress string, enterpriseAccess bool) error {
+	return mockEnterpriseAccessErr
+}
+
+var mockGenerateRNGSeedErr error = nil
+
+func (c MockAMT) GenerateRNGSeed() error {
+	mockRNGSeedStatus = amt2.RNGSeedExists
+	return mockGenerateRNGSeedErr
+}
+
+var mockRNGSeedStatus = amt2.RNGSeedExists
+var mockRNGSeedStatusErr error = nil
+
+func (c MockAMT) GetRNGSeedStatus() (amt2.RNGSeedStatus, error) {
+	return mockRNGSeedStatus, mockRNGSeedStatusErr
+}
+
+var mockPkiFQDNSuffix = ""
+var mockSetPkiFQDNSuffixErr error = nil
+
+func (c MockAMT) SetPkiFQDNSuffix(suffix string) error {
+	if mockSetPkiFQDNSuffixErr == nil {
+		mockPkiFQDNSuffix = suffix
+	}
+	return mockSetPkiFQDNSuffixErr
+}
+
+var mockAMTCertHash = amt2.CertHashEntry{}
+var mockStartConfigurationHBasedErr error = nil
+var mockHBasedDNSSuffixes []string
+
+func (c MockAMT) StartConfigurationHBased(serverCertHash []byte, dnsSuffixes []string) (amt2.CertHashEntry, error) {
+	mockHBasedDNSSuffixes = dnsSuffixes
+	return mockAMTCertHash, mockStartConfigurationHBasedErr
+}
+
+var mockStopConfigurationCalls = 0
+var mockStopConfigurationErr error = nil
+
+func (c MockAMT) StopConfiguration() error {
+	mockStopConfigurationCalls++
+	return mockStopConfigurationErr
+}
+
 type ResponseFuncArray []func(w http.ResponseWriter, r *http.Request)
 
 func setupWsmanResponses(t *testing.T, f *flags.Flags, responses ResponseFuncArray) ProvisioningService {
@@ -182,6 +270,15 @@ func respondStringFunc(t *testing.T, msg string) func(w http.ResponseWriter, r *
 	}
 }
 
+// wsmanEnvelope wraps a response body the way AMT does, h: is the class
+// namespace ns, g: the enumeration and b: and c: the endpoint references
+func wsmanEnvelope(ns string, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><a:Envelope xmlns:a="http://www.w3.org/2003/05/soap-envelope"` +
+		` xmlns:b="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:c="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"` +
+		` xmlns:g="http://schemas.xmlsoap.org/ws/2004/09/enumeration" xmlns:h="` + ns + `">` +
+		`<a:Header></a:Header><a:Body>` + body + `</a:Body></a:Envelope>`
+}
+
 func setupService(f *flags.Flags) ProvisioningService {
 	service := NewProvisioningService(f)
 	service.amtCommand = MockAMT{}
@@ -0,0 +1,292 @@
+package local
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/general"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	randomPasswordLength = 16
+	passwordLower        = "abcdefghijklmnopqrstuvwxyz"
+	passwordUpper        = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordDigits       = "0123456789"
+	passwordSpecial      = "!@#$%^*-_=+"
+)
+
+// the library GeneralSettings marshals to a ManagedElement and does not
+// unmarshal its element name and instance, see putMessage
+type generalSettingsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GeneralSettings generalSettings `xml:"AMT_GeneralSettings"`
+	} `xml:"Body"`
+}
+
+type generalSettings struct {
+	XMLName                       xml.Name `xml:"AMT_GeneralSettings"`
+	H                             string   `xml:"-"`
+	ElementName                   string   `xml:"ElementName"`
+	InstanceID                    string   `xml:"InstanceID"`
+	NetworkInterfaceEnabled       bool     `xml:"NetworkInterfaceEnabled"`
+	DigestRealm                   string   `xml:"DigestRealm"`
+	IdleWakeTimeout               int      `xml:"IdleWakeTimeout"`
+	HostName                      string   `xml:"HostName"`
+	DomainName                    string   `xml:"DomainName"`
+	PingResponseEnabled           bool     `xml:"PingResponseEnabled"`
+	WsmanOnlyMode                 bool     `xml:"WsmanOnlyMode"`
+	PreferredAddressFamily        int      `xml:"PreferredAddressFamily"`
+	DHCPv6ConfigurationTimeout    int      `xml:"DHCPv6ConfigurationTimeout"`
+	DDNSUpdateEnabled             bool     `xml:"DDNSUpdateEnabled"`
+	DDNSUpdateByDHCPServerEnabled bool     `xml:"DDNSUpdateByDHCPServerEnabled"`
+	SharedFQDN                    bool     `xml:"SharedFQDN"`
+	DDNSTTL                       int      `xml:"DDNSTTL"`
+	AMTNetworkEnabled             int      `xml:"AMTNetworkEnabled"`
+	RmcpPingResponseEnabled       bool     `xml:"RmcpPingResponseEnabled"`
+	DDNSPeriodicUpdateInterval    int      `xml:"DDNSPeriodicUpdateInterval"`
+	PresenceNotificationInterval  int      `xml:"PresenceNotificationInterval"`
+	PrivacyLevel                  int      `xml:"PrivacyLevel"`
+	PowerSource                   int      `xml:"PowerSource"`
+}
+
+type generalSettingsPut struct {
+	XMLName                       xml.Name `xml:"h:AMT_GeneralSettings"`
+	H                             string   `xml:"xmlns:h,attr"`
+	ElementName                   string   `xml:"h:ElementName"`
+	InstanceID                    string   `xml:"h:InstanceID"`
+	NetworkInterfaceEnabled       bool     `xml:"h:NetworkInterfaceEnabled"`
+	DigestRealm                   string   `xml:"h:DigestRealm"`
+	IdleWakeTimeout               int      `xml:"h:IdleWakeTimeout"`
+	HostName                      string   `xml:"h:HostName"`
+	DomainName                    string   `xml:"h:DomainName"`
+	PingResponseEnabled           bool     `xml:"h:PingResponseEnabled"`
+	WsmanOnlyMode                 bool     `xml:"h:WsmanOnlyMode"`
+	PreferredAddressFamily        int      `xml:"h:PreferredAddressFamily"`
+	DHCPv6ConfigurationTimeout    int      `xml:"h:DHCPv6ConfigurationTimeout"`
+	DDNSUpdateEnabled             bool     `xml:"h:DDNSUpdateEnabled"`
+	DDNSUpdateByDHCPServerEnabled bool     `xml:"h:DDNSUpdateByDHCPServerEnabled"`
+	SharedFQDN                    bool     `xml:"h:SharedFQDN"`
+	DDNSTTL                       int      `xml:"h:DDNSTTL"`
+	AMTNetworkEnabled             int      `xml:"h:AMTNetworkEnabled"`
+	RmcpPingResponseEnabled       bool     `xml:"h:RmcpPingResponseEnabled"`
+	DDNSPeriodicUpdateInterval    int      `xml:"h:DDNSPeriodicUpdateInterval"`
+	PresenceNotificationInterval  int      `xml:"h:PresenceNotificationInterval"`
+	PrivacyLevel                  int      `xml:"h:PrivacyLevel"`
+	PowerSource                   int      `xml:"h:PowerSource"`
+}
+
+// the library sends SetAdminACLEntryEx_INPUT, AMT expects SetAdminAclEntryEx_INPUT
+type setAdminAclEntryInput struct {
+	XMLName        xml.Name `xml:"h:SetAdminAclEntryEx_INPUT"`
+	H              string   `xml:"xmlns:h,attr"`
+	Username       string   `xml:"h:Username"`
+	DigestPassword string   `xml:"h:DigestPassword"`
+}
+
+func (service *ProvisioningService) RunMaintenance() utils.ReturnCode {
+	service.setupWsmanClient("admin", service.flags.Password)
+	var rc utils.ReturnCode
+	switch service.flags.SubCommand {
+	case utils.SubCommandSyncClock:
+		rc = service.SynchronizeTime()
+	case utils.SubCommandSyncHostname:
+		rc = service.SyncHostname()
+	case utils.SubCommandSyncIP:
+		rc = service.SyncIP()
+	case utils.SubCommandChangePassword:
+		rc = service.ChangePassword()
+	case utils.SubCommandSyncDeviceInfo:
+		rc = service.SyncDeviceInfo()
+	default:
+		log.Errorf("maintenance %s cannot run locally", service.flags.SubCommand)
+		return utils.IncorrectCommandLineParameters
+	}
+	if rc == utils.Success {
+		log.Infof("successfully completed maintenance %s", service.flags.SubCommand)
+	}
+	return rc
+}
+
+func (service *ProvisioningService) SyncHostname() utils.ReturnCode {
+	hostnameInfo := service.flags.HostnameInfo
+	return service.PutHostname(hostnameInfo.Hostname, hostnameInfo.DnsSuffixOS)
+}
+
+func (service *ProvisioningService) getGeneralSettings() (generalSettings, utils.ReturnCode) {
+	var getRsp generalSettingsResponse
+	rc := service.PostAndUnmarshal(service.amtMessages.GeneralSettings.Get(), &getRsp)
+	return getRsp.Body.GeneralSettings, rc
+}
+
+func (service *ProvisioningService) PutHostname(hostname string, domainName string) utils.ReturnCode {
+	current, rc := service.getGeneralSettings()
+	if rc != utils.Success {
+		return rc
+	}
+	putData := generalSettingsPut(current)
+	putData.H = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_GeneralSettings"
+	putData.HostName = hostname
+	putData.DomainName = domainName
+	log.Infof("setting AMT hostname %s and domain name %s", putData.HostName, putData.DomainName)
+	xmlMsg, err := putMessage(service.amtMessages.GeneralSettings.Put(general.GeneralSettings{}), putData, putData.InstanceID)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	var putRsp generalSettingsResponse
+	rc = service.PostAndUnmarshal(xmlMsg, &putRsp)
+	if rc != utils.Success {
+		return rc
+	}
+	updated := putRsp.Body.GeneralSettings
+	if updated.HostName != putData.HostName || updated.DomainName != putData.DomainName {
+		log.Error("AMT did not apply the hostname")
+		return utils.SyncHostnameFailed
+	}
+	return utils.Success
+}
+
+// SyncIP sets the static address of the OS in AMT, like RPS it refuses to
+// turn a wired port that uses DHCP into a static one
+func (service *ProvisioningService) SyncIP() utils.ReturnCode {
+	current, rc := service.getEthernetPortSettings()
+	if rc != utils.Success {
+		return rc
+	}
+	if current.DHCPEnabled {
+		log.Error("AMT wired network uses DHCP, syncip only sets a static IP address")
+		return utils.SyncIpFailed
+	}
+	ipConfiguration := service.flags.IpConfiguration
+	rc = service.putEthernetPortSettings(current, config.WiredConfig{
+		IPAddress:    ipConfiguration.IpAddress,
+		SubnetMask:   ipConfiguration.Netmask,
+		Gateway:      ipConfiguration.Gateway,
+		PrimaryDNS:   ipConfiguration.PrimaryDns,
+		SecondaryDNS: ipConfiguration.SecondaryDns,
+	})
+	if rc == utils.NetworkConfigurationFailed {
+		return utils.SyncIpFailed
+	}
+	return rc
+}
+
+// ChangePassword sets a new admin password, a random one unless -static is given
+func (service *ProvisioningService) ChangePassword() utils.ReturnCode {
+	newPassword := service.flags.StaticPassword
+	if newPassword == "" {
+		var err error
+		newPassword, err = generateRandomPassword(randomPasswordLength)
+		if err != nil {
+			log.Error(err)
+			return utils.ChangePasswordFailed
+		}
+	}
+	generalSettings, err := service.GetGeneralSettings()
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	digestRealm := generalSettings.Body.AMTGeneralSettings.DigestRealm
+	input := setAdminAclEntryInput{
+		H:              authorizationServiceURI,
+		Username:       "admin",
+		DigestPassword: digestPassword("admin", digestRealm, newPassword),
+	}
+	log.Info("changing the AMT admin password")
+	xmlMsg, err := methodMessage(service.amtMessages.AuthorizationService.RemoveUserAclEntry(0), "SetAdminAclEntryEx", input)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	rc := service.userAclAction("SetAdminAclEntryEx", xmlMsg)
+	if rc != utils.Success {
+		return rc
+	}
+	// a generated password is lost unless it is shown
+	if service.flags.StaticPassword == "" {
+		if service.flags.JsonOutput {
+			printJson(map[string]interface{}{"password": newPassword})
+		} else {
+			fmt.Println("New AMT Password: " + newPassword)
+		}
+	}
+	return utils.Success
+}
+
+// SyncDeviceInfo prints the firmware details RPS stores for the device on
+// syncdeviceinfo, without RPS there is nowhere else to sync them to
+func (service *ProvisioningService) SyncDeviceInfo() utils.ReturnCode {
+	versions, err := service.amtCommand.GetAllCodeVersions(service.flags.AMTTimeoutDuration)
+	if err != nil {
+		log.Error(err)
+		return utils.SyncDeviceInfoFailed
+	}
+	info := map[string]interface{}{}
+	for _, field := range []struct{ key, name string }{{"AMT", "fwVersion"}, {"Build Number", "fwBuild"}, {"Sku", "fwSku"}} {
+		version, ok := versions.Get(field.key)
+		if !ok {
+			log.Errorf("%s not found in the AMT code versions", field.key)
+			return utils.SyncDeviceInfoFailed
+		}
+		info[field.name] = version
+	}
+	info["features"] = DecodeAMT(info["fwVersion"].(string), info["fwSku"].(string))
+	controlMode, err := service.amtCommand.GetControlMode()
+	if err != nil {
+		log.Error(err)
+		return utils.SyncDeviceInfoFailed
+	}
+	info["currentMode"] = controlMode
+	uuid, err := service.amtCommand.GetUUID()
+	if err != nil {
+		log.Error(err)
+		return utils.SyncDeviceInfoFailed
+	}
+	info["uuid"] = uuid
+	// the IP address is informational, a missing wired port is not an error
+	info["ipAddress"] = ""
+	if wired, err := service.amtCommand.GetLANInterfaceSettings(false); err == nil {
+		info["ipAddress"] = wired.IPAddress
+	}
+	info["lastUpdated"] = time.Now().UTC().Format(time.RFC3339)
+	printJson(info)
+	return utils.Success
+}
+
+// generateRandomPassword meets the AMT strong password rules with at least
+// one lower case letter, upper case letter, digit and special character
+func generateRandomPassword(length int) (string, error) {
+	charSets := []string{passwordLower, passwordUpper, passwordDigits, passwordSpecial}
+	all := passwordLower + passwordUpper + passwordDigits + passwordSpecial
+	password := make([]byte, length)
+	for i := range password {
+		chars := all
+		if i < len(charSets) {
+			chars = charSets[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = chars[n.Int64()]
+	}
+	// shuffle so the required characters are not always first
+	for i := len(password) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
@@ -0,0 +1,174 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var generalSettingsHostnameXML = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_GeneralSettings", `<h:AMT_GeneralSettings><h:DigestRealm>Digest:A3829B3827DE4D33D4449B366831FD01</h:DigestRealm><h:DomainName>%s</h:DomainName><h:ElementName>Intel(r) AMT: General Settings</h:ElementName><h:HostName>%s</h:HostName><h:InstanceID>Intel(r) AMT: General Settings</h:InstanceID><h:PingResponseEnabled>true</h:PingResponseEnabled></h:AMT_GeneralSettings>`)
+
+func generalSettingsHostnameXMLResponse(hostname string, domainName string) string {
+	return fmt.Sprintf(generalSettingsHostnameXML, domainName, hostname)
+}
+
+func TestRunMaintenance(t *testing.T) {
+	t.Run("expect Success for syncclock", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandSyncClock}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, getLowAccuracyTimeSynchXMLResponse),
+			respondStringFunc(t, setHighAccuracyTimeSynchXMLResponse),
+		})
+		rc := lps.RunMaintenance()
+		assert.Equal(t, utils.Success, rc)
+	})
+	t.Run("expect Success for syncdeviceinfo without any WS-Man call", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandSyncDeviceInfo, JsonOutput: true}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.RunMaintenance()
+		assert.Equal(t, utils.Success, rc)
+	})
+	t.Run("expect SyncDeviceInfoFailed when the code versions cannot be read", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandSyncDeviceInfo}
+		mockVersionDataErr = mockStandardErr
+		defer func() { mockVersionDataErr = nil }()
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.RunMaintenance()
+		assert.Equal(t, utils.SyncDeviceInfoFailed, rc)
+	})
+	t.Run("expect IncorrectCommandLineParameters for an unknown task", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: "nope"}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.RunMaintenance()
+		assert.Equal(t, utils.IncorrectCommandLineParameters, rc)
+	})
+}
+
+func TestSyncHostname(t *testing.T) {
+	t.Run("expect Success", func(t *testing.T) {
+		f := &flags.Flags{HostnameInfo: flags.HostnameInfo{Hostname: "client01", DnsSuffixOS: "vprodemo.com"}}
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, generalSettingsHostnameXMLResponse("", ""), &requests),
+			respondCaptureFunc(t, generalSettingsHostnameXMLResponse("client01", "vprodemo.com"), &requests),
+		})
+		rc := lps.SyncHostname()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[1], `<h:AMT_GeneralSettings xmlns:h="http://intel.com/wbem/wscim/1/amt-schema/1/AMT_GeneralSettings">`)
+		assert.Contains(t, requests[1], `<w:Selector Name="InstanceID">Intel(r) AMT: General Settings</w:Selector>`)
+		assert.Contains(t, requests[1], "<h:HostName>client01</h:HostName><h:DomainName>vprodemo.com</h:DomainName><h:PingResponseEnabled>true</h:PingResponseEnabled>")
+	})
+	t.Run("expect SyncHostnameFailed when not applied", func(t *testing.T) {
+		f := &flags.Flags{HostnameInfo: flags.HostnameInfo{Hostname: "client01"}}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, generalSettingsHostnameXMLResponse("", "")),
+			respondStringFunc(t, generalSettingsHostnameXMLResponse("", "")),
+		})
+		rc := lps.SyncHostname()
+		assert.Equal(t, utils.SyncHostnameFailed, rc)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		rc := lps.SyncHostname()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestSyncIP(t *testing.T) {
+	ipConfiguration := flags.IPConfiguration{
+		IpAddress:  "192.168.1.10",
+		Netmask:    "255.255.255.0",
+		Gateway:    "192.168.1.1",
+		PrimaryDns: "192.168.1.2",
+	}
+	t.Run("expect Success", func(t *testing.T) {
+		f := &flags.Flags{IpConfiguration: ipConfiguration}
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false), &requests),
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false), &requests),
+		})
+		rc := lps.SyncIP()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[1], "<h:IPAddress>192.168.1.10</h:IPAddress><h:SubnetMask>255.255.255.0</h:SubnetMask><h:DefaultGateway>192.168.1.1</h:DefaultGateway><h:PrimaryDNS>192.168.1.2</h:PrimaryDNS>")
+	})
+	t.Run("expect SyncIpFailed when not applied", func(t *testing.T) {
+		f := &flags.Flags{IpConfiguration: ipConfiguration}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false)),
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+		})
+		rc := lps.SyncIP()
+		assert.Equal(t, utils.SyncIpFailed, rc)
+	})
+	t.Run("expect SyncIpFailed without a Put when AMT uses DHCP", func(t *testing.T) {
+		f := &flags.Flags{IpConfiguration: ipConfiguration}
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true), &requests),
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false), &requests),
+		})
+		rc := lps.SyncIP()
+		assert.Equal(t, utils.SyncIpFailed, rc)
+		assert.Len(t, requests, 1)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	for _, jsonOutput := range []bool{false, true} {
+		t.Run(fmt.Sprintf("expect Success for a random password with json %t", jsonOutput), func(t *testing.T) {
+			f := &flags.Flags{JsonOutput: jsonOutput}
+			var requests []string
+			lps := setupWsmanResponses(t, f, ResponseFuncArray{
+				respondCaptureFunc(t, generalSettingsXML, &requests),
+				respondCaptureFunc(t, userAclOutputResponseXML("SetAdminAclEntryEx", 0, 0), &requests),
+			})
+			rc := lps.ChangePassword()
+			assert.Equal(t, utils.Success, rc)
+			assert.Contains(t, requests[1], "AMT_AuthorizationService/SetAdminAclEntryEx</a:Action>")
+			assert.Contains(t, requests[1], "<h:SetAdminAclEntryEx_INPUT")
+			assert.Contains(t, requests[1], "<h:Username>admin</h:Username>")
+		})
+	}
+	t.Run("expect Success for a static password", func(t *testing.T) {
+		f := &flags.Flags{StaticPassword: "P@ssw0rd"}
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, generalSettingsXML, &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("SetAdminAclEntryEx", 0, 0), &requests),
+		})
+		rc := lps.ChangePassword()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[1], "<h:DigestPassword>ZlTOuVM90P1tPlo8PoSZ1w==</h:DigestPassword>")
+	})
+	t.Run("expect AmtPtStatusCodeBase for a rejected password", func(t *testing.T) {
+		f := &flags.Flags{StaticPassword: "password"}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, generalSettingsXML),
+			respondStringFunc(t, userAclOutputResponseXML("SetAdminAclEntryEx", 0, 2054)),
+		})
+		rc := lps.ChangePassword()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+2054, rc)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{StaticPassword: "P@ssw0rd"}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		rc := lps.ChangePassword()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestGenerateRandomPassword(t *testing.T) {
+	password, err := generateRandomPassword(randomPasswordLength)
+	assert.NoError(t, err)
+	assert.Len(t, password, randomPasswordLength)
+	for _, chars := range []string{passwordLower, passwordUpper, passwordDigits, passwordSpecial} {
+		assert.True(t, strings.ContainsAny(password, chars))
+	}
+}
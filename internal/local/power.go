@@ -0,0 +1,147 @@
+package local
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/power"
+	log "github.com/sirupsen/logrus"
+)
+
+var powerActions = map[string]power.PowerState{
+	utils.SubCommandPowerOn:        power.PowerOn,
+	utils.SubCommandPowerOff:       power.PowerOffSoft,
+	utils.SubCommandPowerCycle:     power.PowerCycleOffSoft,
+	utils.SubCommandPowerReset:     power.MasterBusReset,
+	utils.SubCommandPowerSleep:     power.SleepDeep,
+	utils.SubCommandPowerHibernate: power.Hibernate,
+	utils.SubCommandPowerSoftOff:   power.PowerOffSoftGraceful,
+}
+
+var powerStateNames = map[int]string{
+	1:  "Other",
+	2:  "On",
+	3:  "Sleep - Light",
+	4:  "Sleep - Deep",
+	5:  "Power Cycle (Off - Soft)",
+	6:  "Off - Hard",
+	7:  "Hibernate (Off - Soft)",
+	8:  "Off - Soft",
+	9:  "Power Cycle (Off - Hard)",
+	10: "Master Bus Reset",
+	11: "Diagnostic Interrupt (NMI)",
+	12: "Off - Soft Graceful",
+	13: "Off - Hard Graceful",
+	14: "Master Bus Reset Graceful",
+	15: "Power Cycle (Off - Soft Graceful)",
+	16: "Power Cycle (Off - Hard Graceful)",
+}
+
+func powerStateName(state int) string {
+	if name, ok := powerStateNames[state]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// go-wsman-messages has no response types for CIM_AssociatedPowerManagementService
+// and CIM_PowerManagementService
+type associatedPowerManagementServiceResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		PullResponse struct {
+			Items []associatedPowerManagementService `xml:"Items>CIM_AssociatedPowerManagementService"`
+		} `xml:"PullResponse"`
+	} `xml:"Body"`
+}
+
+type associatedPowerManagementService struct {
+	PowerState                    int   `xml:"PowerState"`
+	AvailableRequestedPowerStates []int `xml:"AvailableRequestedPowerStates"`
+}
+
+type requestPowerStateChangeResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		RequestPowerStateChange_OUTPUT struct {
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:"RequestPowerStateChange_OUTPUT"`
+	} `xml:"Body"`
+}
+
+func (service *ProvisioningService) RunPower() utils.ReturnCode {
+	service.setupWsmanClient("admin", service.flags.Password)
+	if service.flags.SubCommand == utils.SubCommandPowerState {
+		return service.DisplayPowerState()
+	}
+	return service.RequestPowerAction(service.flags.SubCommand)
+}
+
+func (service *ProvisioningService) GetPowerState() (associatedPowerManagementService, utils.ReturnCode) {
+	var pullRspEnv associatedPowerManagementServiceResponse
+	rc := service.EnumPullUnmarshal(
+		service.cimMessages.ServiceAvailableToElement.Enumerate,
+		service.cimMessages.ServiceAvailableToElement.Pull,
+		&pullRspEnv,
+	)
+	if rc != utils.Success {
+		return associatedPowerManagementService{}, rc
+	}
+	items := pullRspEnv.Body.PullResponse.Items
+	if len(items) == 0 {
+		log.Error("AMT did not report a power state")
+		return associatedPowerManagementService{}, utils.PowerManagementFailed
+	}
+	return items[0], utils.Success
+}
+
+func (service *ProvisioningService) DisplayPowerState() utils.ReturnCode {
+	state, rc := service.GetPowerState()
+	if rc != utils.Success {
+		return rc
+	}
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{
+			"powerState":                    state.PowerState,
+			"powerStateName":                powerStateName(state.PowerState),
+			"availableRequestedPowerStates": state.AvailableRequestedPowerStates,
+		})
+		return utils.Success
+	}
+	fmt.Printf("Power State		: %s (%d)\n", powerStateName(state.PowerState), state.PowerState)
+	return utils.Success
+}
+
+func (service *ProvisioningService) RequestPowerAction(action string) utils.ReturnCode {
+	powerState, ok := powerActions[action]
+	if !ok {
+		log.Errorf("unsupported power action: %s", action)
+		return utils.IncorrectCommandLineParameters
+	}
+	log.Infof("requesting power action %s", action)
+	xmlMsg := service.cimMessages.PowerManagementService.RequestPowerStateChange(powerState)
+	var rsp requestPowerStateChangeResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rsp)
+	if rc != utils.Success {
+		return rc
+	}
+	returnValue := rsp.Body.RequestPowerStateChange_OUTPUT.ReturnValue
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{
+			"action":      action,
+			"powerState":  int(powerState),
+			"returnValue": returnValue,
+		})
+	}
+	if returnValue != 0 {
+		// AMT returns 2 when the device is already in the requested state
+		log.Errorf("failed RequestPowerStateChange with ReturnValue: %d", returnValue)
+		return utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+	}
+	if !service.flags.JsonOutput {
+		fmt.Printf("Power action %s requested: %s\n", action, powerStateName(int(powerState)))
+	}
+	return utils.Success
+}
@@ -0,0 +1,144 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var powerStatePullXMLResponse = wsmanEnvelope("http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_AssociatedPowerManagementService", `<g:PullResponse><g:Items>%s</g:Items><g:EndOfSequence></g:EndOfSequence></g:PullResponse>`)
+
+const powerStateItemXML = `<h:CIM_AssociatedPowerManagementService><h:AvailableRequestedPowerStates>8</h:AvailableRequestedPowerStates><h:AvailableRequestedPowerStates>10</h:AvailableRequestedPowerStates><h:PowerState>%d</h:PowerState></h:CIM_AssociatedPowerManagementService>`
+
+var requestPowerStateChangeXMLResponse = wsmanEnvelope("http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_PowerManagementService", `<h:RequestPowerStateChange_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:RequestPowerStateChange_OUTPUT>`)
+
+func TestGetPowerState(t *testing.T) {
+	f := &flags.Flags{}
+	t.Run("expect Success", func(t *testing.T) {
+		rfa := ResponseFuncArray{
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, fmt.Sprintf(powerStatePullXMLResponse, fmt.Sprintf(powerStateItemXML, 2))),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		state, rc := lps.GetPowerState()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, 2, state.PowerState)
+		assert.Equal(t, []int{8, 10}, state.AvailableRequestedPowerStates)
+	})
+	t.Run("expect PowerManagementFailed with no items", func(t *testing.T) {
+		rfa := ResponseFuncArray{
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, fmt.Sprintf(powerStatePullXMLResponse, "")),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		_, rc := lps.GetPowerState()
+		assert.Equal(t, utils.PowerManagementFailed, rc)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		rfa := ResponseFuncArray{
+			respondServerErrFunc(),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		_, rc := lps.GetPowerState()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestDisplayPowerState(t *testing.T) {
+	for _, jsonOutput := range []bool{false, true} {
+		t.Run(fmt.Sprintf("expect Success with json %t", jsonOutput), func(t *testing.T) {
+			f := &flags.Flags{JsonOutput: jsonOutput}
+			rfa := ResponseFuncArray{
+				respondMsgFunc(t, common.EnumerationResponse{}),
+				respondStringFunc(t, fmt.Sprintf(powerStatePullXMLResponse, fmt.Sprintf(powerStateItemXML, 8))),
+			}
+			lps := setupWsmanResponses(t, f, rfa)
+			rc := lps.DisplayPowerState()
+			assert.Equal(t, utils.Success, rc)
+		})
+	}
+}
+
+func TestRequestPowerAction(t *testing.T) {
+	for action, powerState := range powerActions {
+		t.Run(fmt.Sprintf("expect Success for %s", action), func(t *testing.T) {
+			f := &flags.Flags{}
+			var requests []string
+			rfa := ResponseFuncArray{
+				respondCaptureFunc(t, fmt.Sprintf(requestPowerStateChangeXMLResponse, 0), &requests),
+			}
+			lps := setupWsmanResponses(t, f, rfa)
+			rc := lps.RequestPowerAction(action)
+			assert.Equal(t, utils.Success, rc)
+			assert.Contains(t, requests[0], fmt.Sprintf("<h:PowerState>%d</h:PowerState>", powerState))
+		})
+	}
+	t.Run("expect Success with json output", func(t *testing.T) {
+		f := &flags.Flags{JsonOutput: true}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, fmt.Sprintf(requestPowerStateChangeXMLResponse, 0)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RequestPowerAction(utils.SubCommandPowerReset)
+		assert.Equal(t, utils.Success, rc)
+	})
+	t.Run("expect AmtPtStatusCodeBase for a failed state change", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, fmt.Sprintf(requestPowerStateChangeXMLResponse, 2)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RequestPowerAction(utils.SubCommandPowerOn)
+		assert.Equal(t, utils.AmtPtStatusCodeBase+2, rc)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondServerErrFunc(),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RequestPowerAction(utils.SubCommandPowerOn)
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+	t.Run("expect IncorrectCommandLineParameters for unknown action", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.RequestPowerAction("explode")
+		assert.Equal(t, utils.IncorrectCommandLineParameters, rc)
+	})
+}
+
+func TestRunPower(t *testing.T) {
+	t.Run("expect state", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandPowerState}
+		rfa := ResponseFuncArray{
+			respondMsgFunc(t, common.EnumerationResponse{}),
+			respondStringFunc(t, fmt.Sprintf(powerStatePullXMLResponse, fmt.Sprintf(powerStateItemXML, 2))),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunPower()
+		assert.Equal(t, utils.Success, rc)
+	})
+	t.Run("expect action", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandPowerCycle}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, fmt.Sprintf(requestPowerStateChangeXMLResponse, 0)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunPower()
+		assert.Equal(t, utils.Success, rc)
+	})
+}
+
+func TestNewProvisioningServiceLMSAddress(t *testing.T) {
+	f := &flags.Flags{}
+	assert.Equal(t, "http://localhost:16992/wsman", NewProvisioningService(f).serverURL)
+	f.LMSAddress = "fe80::1"
+	f.LMSPort = "16993"
+	assert.Equal(t, "http://[fe80::1]:16993/wsman", NewProvisioningService(f).serverURL)
+}
@@ -0,0 +1,192 @@
+package local
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publickey"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/models"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/wifi"
+	log "github.com/sirupsen/logrus"
+)
+
+// priorStateResponse holds the instances recover can add again
+type priorStateResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Certificate publickey.PublicKeyCertificate `xml:"AMT_PublicKeyCertificate"`
+		WiFiSetting wifi.CIMWiFiEndpointSettings   `xml:"CIM_WiFiEndpointSettings"`
+	} `xml:"Body"`
+}
+
+// errCannotRestore marks an instance AMT does not let recover read back in full
+var errCannotRestore = errors.New("cannot be restored")
+
+// Recover undoes the journal of a command that did not finish, newest
+// change first, and runs the command again when asked to
+func (service *ProvisioningService) Recover() utils.ReturnCode {
+	path := service.flags.JournalFile
+	if path == "" {
+		path = defaultJournalPath()
+	}
+	j, err := readJournal(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info("no interrupted command to recover")
+		return utils.Success
+	}
+	if err != nil {
+		log.Error(err)
+		return utils.RecoveryFailed
+	}
+	log.Infof("recovering %s started %s", strings.Join(j.Command, " "), j.Started.Format("2006-01-02T15:04:05Z"))
+	service.setupWsmanClient("admin", service.flags.Password)
+	var failed, lost []string
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		entry := &j.Entries[i]
+		if entry.Undone {
+			continue
+		}
+		var rc utils.ReturnCode
+		switch entry.Operation {
+		case journalCreate:
+			rc = service.undoCreate(*entry)
+		case journalDelete:
+			rc, err = service.undoDelete(*entry)
+			if errors.Is(err, errCannotRestore) {
+				log.Errorf("%s %s, add it again from its source", entry, err)
+				lost = append(lost, entry.String())
+				rc = utils.Success
+			}
+		}
+		if rc != utils.Success {
+			failed = append(failed, entry.String())
+			continue
+		}
+		entry.Undone = true
+		if service.plan == nil {
+			if err := j.write(); err != nil {
+				log.Error(err)
+				return utils.RecoveryFailed
+			}
+		}
+	}
+	if len(failed) > 0 {
+		log.Errorf("failed undoing %s, the journal %s keeps them for the next rpc recover", strings.Join(failed, ", "), path)
+		return utils.RecoveryFailed
+	}
+	if service.plan != nil {
+		return utils.Success
+	}
+	j.remove()
+	log.Info("recovered the interrupted command")
+	if service.flags.Replay {
+		return service.replay(j.Command)
+	}
+	if len(lost) > 0 {
+		return utils.RecoveryFailed
+	}
+	return utils.Success
+}
+
+// replay runs the command of the journal again, it reads its config files
+// from the same paths
+func (service *ProvisioningService) replay(command []string) utils.ReturnCode {
+	log.Infof("running %s again", strings.Join(command, " "))
+	replayFlags := flags.NewFlags(append(command, "-password", service.flags.Password))
+	rc := replayFlags.ParseFlags()
+	if rc != utils.Success {
+		return rc
+	}
+	return ExecuteCommand(replayFlags)
+}
+
+func (service *ProvisioningService) instanceExists(entry journalEntry) bool {
+	xmlMsg := transferMessage(service.amtMessages.GeneralSettings.Get(), wsTransferAction+"Get", entry.ResourceURI, entry.Selectors)
+	_, err := service.client.Post(xmlMsg)
+	return err == nil
+}
+
+func (service *ProvisioningService) undoCreate(entry journalEntry) utils.ReturnCode {
+	if len(entry.Selectors) == 0 {
+		// rpc stopped before AMT answered
+		log.Warnf("%s may have created an instance of %s that the journal has no handle for", entry.Method, entry)
+		return utils.Success
+	}
+	if !service.instanceExists(entry) {
+		log.Infof("%s is already removed", entry)
+		return utils.Success
+	}
+	log.Infof("removing %s", entry)
+	xmlMsg := transferMessage(service.amtMessages.GeneralSettings.Get(), wsTransferAction+"Delete", entry.ResourceURI, entry.Selectors)
+	if _, err := service.client.Post(xmlMsg); err != nil {
+		log.Errorf("failed removing %s: %s", entry, err)
+		return utils.WSMANMessageError
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) undoDelete(entry journalEntry) (utils.ReturnCode, error) {
+	if !entry.Done && service.instanceExists(entry) {
+		log.Infof("%s was not deleted", entry)
+		return utils.Success, nil
+	}
+	if entry.PriorState == "" {
+		return utils.Success, errCannotRestore
+	}
+	var prior priorStateResponse
+	if err := xml.Unmarshal([]byte(entry.PriorState), &prior); err != nil {
+		log.Error(err)
+		return utils.Success, errCannotRestore
+	}
+	class := entry.ResourceURI[strings.LastIndex(entry.ResourceURI, "/")+1:]
+	switch class {
+	case "AMT_PublicKeyCertificate":
+		certificate := prior.Body.Certificate
+		log.Infof("adding %s again", entry)
+		var rc utils.ReturnCode
+		if certificate.TrustedRootCertficate {
+			_, rc = service.AddTrustedRootCert(certificate.X509Certificate)
+		} else {
+			_, rc = service.AddClientCert(certificate.X509Certificate)
+		}
+		return rc, nil
+	case wifi.CIM_WiFiEndpointSettings:
+		return service.restoreWifiSetting(prior.Body.WiFiSetting)
+	}
+	return utils.Success, errCannotRestore
+}
+
+// restoreWifiSetting adds a deleted wifi profile again, AMT never returns
+// the passphrase so it comes from the secrets file
+func (service *ProvisioningService) restoreWifiSetting(setting wifi.CIMWiFiEndpointSettings) (utils.ReturnCode, error) {
+	authenticationMethod := models.AuthenticationMethod(setting.AuthenticationMethod)
+	if authenticationMethod == models.AuthenticationMethod_WPA_IEEE8021x ||
+		authenticationMethod == models.AuthenticationMethod_WPA2_IEEE8021x {
+		return utils.Success, errCannotRestore
+	}
+	wifiCfg := config.WifiConfig{
+		ProfileName:          setting.ElementName,
+		SSID:                 setting.SSID,
+		Priority:             setting.Priority,
+		AuthenticationMethod: setting.AuthenticationMethod,
+		EncryptionMethod:     setting.EncryptionMethod,
+	}
+	for _, secret := range service.flags.LocalConfig.WifiConfigs {
+		if secret.ProfileName == wifiCfg.ProfileName {
+			wifiCfg.PskPassphrase = secret.PskPassphrase
+		}
+	}
+	if wifiCfg.PskPassphrase == "" && (authenticationMethod == models.AuthenticationMethod_WPA_PSK ||
+		authenticationMethod == models.AuthenticationMethod_WPA2_PSK || authenticationMethod == models.AuthenticationMethod_WPA3_SAE) {
+		log.Errorf("missing pskPassphrase of wifi profile %s, add it to the -secrets file", wifiCfg.ProfileName)
+		return utils.MissingOrInvalidConfiguration, nil
+	}
+	log.Infof("adding wifi profile %s again", wifiCfg.ProfileName)
+	return service.ProcessWifiConfig(&wifiCfg), nil
+}
@@ -0,0 +1,322 @@
+package local
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/redirection"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	kvmEnabled           = 2
+	kvmDisabled          = 3
+	kvmEnabledButOffline = 6
+)
+
+var userConsentPolicies = map[string]uint32{
+	"none": 0,
+	"kvm":  1,
+	"all":  4294967295,
+}
+
+func userConsentName(optInRequired uint32) string {
+	for name, value := range userConsentPolicies {
+		if value == optInRequired {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// go-wsman-messages has no response types for AMT_RedirectionService, CIM_KVMRedirectionSAP,
+// IPS_KVMRedirectionSettingData and IPS_OptInService
+type redirectionServiceResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		RedirectionService redirectionService `xml:"AMT_RedirectionService"`
+	} `xml:"Body"`
+}
+
+type redirectionService struct {
+	XMLName                 xml.Name `xml:"AMT_RedirectionService"`
+	H                       string   `xml:"-"`
+	Name                    string   `xml:"Name"`
+	CreationClassName       string   `xml:"CreationClassName"`
+	SystemName              string   `xml:"SystemName"`
+	SystemCreationClassName string   `xml:"SystemCreationClassName"`
+	ElementName             string   `xml:"ElementName"`
+	EnabledState            int      `xml:"EnabledState"`
+	ListenerEnabled         bool     `xml:"ListenerEnabled"`
+}
+
+type redirectionServicePut struct {
+	XMLName                 xml.Name `xml:"h:AMT_RedirectionService"`
+	H                       string   `xml:"xmlns:h,attr"`
+	Name                    string   `xml:"h:Name"`
+	CreationClassName       string   `xml:"h:CreationClassName"`
+	SystemName              string   `xml:"h:SystemName"`
+	SystemCreationClassName string   `xml:"h:SystemCreationClassName"`
+	ElementName             string   `xml:"h:ElementName"`
+	EnabledState            int      `xml:"h:EnabledState"`
+	ListenerEnabled         bool     `xml:"h:ListenerEnabled"`
+}
+
+type kvmRedirectionSAPResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		KVMRedirectionSAP struct {
+			EnabledState int `xml:"EnabledState"`
+		} `xml:"CIM_KVMRedirectionSAP"`
+	} `xml:"Body"`
+}
+
+type kvmRedirectionSettingDataResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		KVMRedirectionSettingData struct {
+			EnabledByMEBx     bool `xml:"EnabledByMEBx"`
+			Is5900PortEnabled bool `xml:"Is5900PortEnabled"`
+		} `xml:"IPS_KVMRedirectionSettingData"`
+	} `xml:"Body"`
+}
+
+type optInServiceResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		OptInService optInService `xml:"IPS_OptInService"`
+	} `xml:"Body"`
+}
+
+type optInService struct {
+	XMLName                 xml.Name `xml:"IPS_OptInService"`
+	H                       string   `xml:"-"`
+	Name                    string   `xml:"Name"`
+	CreationClassName       string   `xml:"CreationClassName"`
+	SystemName              string   `xml:"SystemName"`
+	SystemCreationClassName string   `xml:"SystemCreationClassName"`
+	ElementName             string   `xml:"ElementName"`
+	OptInCodeTimeout        int      `xml:"OptInCodeTimeout"`
+	OptInDisplayTimeout     int      `xml:"OptInDisplayTimeout"`
+	OptInRequired           uint32   `xml:"OptInRequired"`
+	OptInState              int      `xml:"OptInState"`
+	CanModifyOptInPolicy    int      `xml:"CanModifyOptInPolicy"`
+}
+
+// optInServicePut converts from optInService and leaves out the read only properties
+type optInServicePut struct {
+	XMLName                 xml.Name `xml:"h:IPS_OptInService"`
+	H                       string   `xml:"xmlns:h,attr"`
+	Name                    string   `xml:"h:Name"`
+	CreationClassName       string   `xml:"h:CreationClassName"`
+	SystemName              string   `xml:"h:SystemName"`
+	SystemCreationClassName string   `xml:"h:SystemCreationClassName"`
+	ElementName             string   `xml:"h:ElementName"`
+	OptInCodeTimeout        int      `xml:"h:OptInCodeTimeout"`
+	OptInDisplayTimeout     int      `xml:"h:OptInDisplayTimeout"`
+	OptInRequired           uint32   `xml:"h:OptInRequired"`
+	OptInState              int      `xml:"-"`
+	CanModifyOptInPolicy    int      `xml:"-"`
+}
+
+type redirectionState struct {
+	SOL              bool   `json:"sol"`
+	IDER             bool   `json:"ider"`
+	KVM              bool   `json:"kvm"`
+	KVMEnabledByMEBx bool   `json:"kvmEnabledByMEBx"`
+	ListenerEnabled  bool   `json:"listenerEnabled"`
+	UserConsent      string `json:"userConsent"`
+}
+
+// redirectionEnabledState combines SOL and IDER into the AMT_RedirectionService
+// EnabledState: 32768 plus 1 for IDER and 2 for SOL
+func redirectionEnabledState(sol, ider bool) int {
+	state := int(redirection.IDERAndSOLAreDisabled)
+	if ider {
+		state += 1
+	}
+	if sol {
+		state += 2
+	}
+	return state
+}
+
+func redirectionFeatures(enabledState int) (sol, ider bool) {
+	if enabledState < int(redirection.IDERAndSOLAreDisabled) {
+		return false, false
+	}
+	bits := enabledState - int(redirection.IDERAndSOLAreDisabled)
+	return bits&2 != 0, bits&1 != 0
+}
+
+func (service *ProvisioningService) getRedirectionService() (redirectionService, utils.ReturnCode) {
+	var rsp redirectionServiceResponse
+	rc := service.PostAndUnmarshal(service.amtMessages.RedirectionService.Get(), &rsp)
+	return rsp.Body.RedirectionService, rc
+}
+
+func (service *ProvisioningService) getKVMEnabledState() (int, utils.ReturnCode) {
+	var rsp kvmRedirectionSAPResponse
+	rc := service.PostAndUnmarshal(service.cimMessages.KVMRedirectionSAP.Get(), &rsp)
+	return rsp.Body.KVMRedirectionSAP.EnabledState, rc
+}
+
+func (service *ProvisioningService) getKVMEnabledByMEBx() (bool, utils.ReturnCode) {
+	// the IPS_KVMRedirectionSettingData Get only differs from IPS_OptInService by the resource
+	xmlMsg := strings.Replace(service.ipsMessages.OptInService.Get(), "IPS_OptInService", "IPS_KVMRedirectionSettingData", 1)
+	var rsp kvmRedirectionSettingDataResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rsp)
+	return rsp.Body.KVMRedirectionSettingData.EnabledByMEBx, rc
+}
+
+func (service *ProvisioningService) getOptInService() (optInService, utils.ReturnCode) {
+	var rsp optInServiceResponse
+	rc := service.PostAndUnmarshal(service.ipsMessages.OptInService.Get(), &rsp)
+	return rsp.Body.OptInService, rc
+}
+
+func (service *ProvisioningService) GetRedirectionState() (redirectionState, utils.ReturnCode) {
+	var state redirectionState
+	redirectionSvc, rc := service.getRedirectionService()
+	if rc != utils.Success {
+		return state, rc
+	}
+	state.SOL, state.IDER = redirectionFeatures(redirectionSvc.EnabledState)
+	state.ListenerEnabled = redirectionSvc.ListenerEnabled
+	kvmState, rc := service.getKVMEnabledState()
+	if rc != utils.Success {
+		return state, rc
+	}
+	state.KVM = kvmState == kvmEnabled || kvmState == kvmEnabledButOffline
+	if state.KVMEnabledByMEBx, rc = service.getKVMEnabledByMEBx(); rc != utils.Success {
+		return state, rc
+	}
+	optIn, rc := service.getOptInService()
+	if rc != utils.Success {
+		return state, rc
+	}
+	state.UserConsent = userConsentName(optIn.OptInRequired)
+	return state, utils.Success
+}
+
+func (service *ProvisioningService) ConfigureRedirection() utils.ReturnCode {
+	cfg := service.flags.LocalConfig.Redirection
+	current, rc := service.GetRedirectionState()
+	if rc != utils.Success {
+		return rc
+	}
+	sol, ider, kvm := current.SOL, current.IDER, current.KVM
+	for _, setting := range []struct {
+		value  *bool
+		config *bool
+	}{{&sol, cfg.SOL}, {&ider, cfg.IDER}, {&kvm, cfg.KVM}} {
+		if setting.config != nil {
+			*setting.value = *setting.config
+		}
+	}
+	if kvm && !current.KVM && !current.KVMEnabledByMEBx {
+		log.Error("KVM is disabled in MEBx and cannot be enabled")
+		return utils.AMTFeaturesConfigurationFailed
+	}
+	if cfg.UserConsent != "" && cfg.UserConsent != current.UserConsent {
+		controlMode, err := service.amtCommand.GetControlMode()
+		if err != nil {
+			log.Error(err)
+			return utils.AMTConnectionFailed
+		}
+		if controlMode != 2 {
+			log.Error("changing user consent requires admin control mode. Device control mode: " + utils.InterpretControlMode(controlMode))
+			return utils.AMTFeaturesConfigurationFailed
+		}
+	}
+
+	if sol != current.SOL || ider != current.IDER {
+		log.Infof("setting SOL: %t IDER: %t", sol, ider)
+		xmlMsg := service.amtMessages.RedirectionService.RequestStateChange(redirection.RequestedState(redirectionEnabledState(sol, ider)))
+		if rc = service.requestStateChange(xmlMsg); rc != utils.Success {
+			return rc
+		}
+	}
+	if kvm != current.KVM {
+		log.Infof("setting KVM: %t", kvm)
+		requestedState := kvmDisabled
+		if kvm {
+			requestedState = kvmEnabled
+		}
+		if rc = service.requestStateChange(service.cimMessages.KVMRedirectionSAP.RequestStateChange(requestedState)); rc != utils.Success {
+			return rc
+		}
+	}
+	// the redirection listener serves SOL, IDER and KVM sessions
+	listenerEnabled := sol || ider || kvm
+	if listenerEnabled != current.ListenerEnabled {
+		redirectionSvc, rc := service.getRedirectionService()
+		if rc != utils.Success {
+			return rc
+		}
+		putData := redirectionServicePut(redirectionSvc)
+		putData.H = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RedirectionService"
+		putData.ListenerEnabled = listenerEnabled
+		xmlMsg, err := putMessage(service.amtMessages.RedirectionService.Put(redirection.RedirectionService{}), putData, "")
+		if err != nil {
+			log.Error(err)
+			return utils.WSMANMessageError
+		}
+		var rsp redirectionServiceResponse
+		if rc = service.PostAndUnmarshal(xmlMsg, &rsp); rc != utils.Success {
+			return rc
+		}
+	}
+	if cfg.UserConsent != "" && cfg.UserConsent != current.UserConsent {
+		log.Infof("setting user consent: %s", cfg.UserConsent)
+		optIn, rc := service.getOptInService()
+		if rc != utils.Success {
+			return rc
+		}
+		putData := optInServicePut(optIn)
+		putData.H = "http://intel.com/wbem/wscim/1/ips-schema/1/IPS_OptInService"
+		putData.OptInRequired = userConsentPolicies[cfg.UserConsent]
+		// go-wsman-messages has no IPS_OptInService Put, the Get differs only by the action and body
+		xmlMsg, err := methodMessage(service.ipsMessages.OptInService.Get(), "Put", putData)
+		if err != nil {
+			log.Error(err)
+			return utils.WSMANMessageError
+		}
+		var rsp optInServiceResponse
+		if rc = service.PostAndUnmarshal(xmlMsg, &rsp); rc != utils.Success {
+			return rc
+		}
+		if rsp.Body.OptInService.OptInRequired != putData.OptInRequired {
+			log.Error("user consent policy was not applied")
+			return utils.AMTFeaturesConfigurationFailed
+		}
+	}
+	log.Info("successfully configured redirection")
+	return utils.Success
+}
+
+func (service *ProvisioningService) requestStateChange(xmlMsg string) utils.ReturnCode {
+	var rsp requestStateChangeResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rsp)
+	if rc != utils.Success {
+		return rc
+	}
+	if returnValue := rsp.Body.RequestStateChange_OUTPUT.ReturnValue; returnValue != 0 {
+		log.Errorf("failed RequestStateChange with ReturnValue: %d", returnValue)
+		return utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+	}
+	return utils.Success
+}
+
+func displayRedirectionState(state redirectionState) {
+	fmt.Println("---Redirection---")
+	fmt.Printf("SOL			: %t\n", state.SOL)
+	fmt.Printf("IDER			: %t\n", state.IDER)
+	fmt.Printf("KVM			: %t\n", state.KVM)
+	fmt.Printf("KVM Enabled By MEBx	: %t\n", state.KVMEnabledByMEBx)
+	fmt.Printf("Listener Enabled	: %t\n", state.ListenerEnabled)
+	fmt.Printf("User Consent		: %s\n", state.UserConsent)
+}
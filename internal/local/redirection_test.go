@@ -0,0 +1,151 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const redirectionServiceXML = `<h:AMT_RedirectionService><h:CreationClassName>AMT_RedirectionService</h:CreationClassName><h:ElementName>Intel(r) AMT Redirection Service</h:ElementName><h:EnabledState>%d</h:EnabledState><h:ListenerEnabled>%t</h:ListenerEnabled><h:Name>Intel(r) AMT Redirection Service</h:Name><h:SystemCreationClassName>CIM_ComputerSystem</h:SystemCreationClassName><h:SystemName>Intel(r) AMT</h:SystemName></h:AMT_RedirectionService>`
+const kvmRedirectionSAPXML = `<h:CIM_KVMRedirectionSAP><h:CreationClassName>CIM_KVMRedirectionSAP</h:CreationClassName><h:EnabledState>%d</h:EnabledState><h:Name>KVM Redirection Service Access Point</h:Name></h:CIM_KVMRedirectionSAP>`
+const kvmRedirectionSettingDataXML = `<h:IPS_KVMRedirectionSettingData><h:EnabledByMEBx>%t</h:EnabledByMEBx><h:InstanceID>Intel(r) KVM Redirection Settings</h:InstanceID><h:Is5900PortEnabled>false</h:Is5900PortEnabled></h:IPS_KVMRedirectionSettingData>`
+const optInServiceXML = `<h:IPS_OptInService><h:CanModifyOptInPolicy>1</h:CanModifyOptInPolicy><h:CreationClassName>IPS_OptInService</h:CreationClassName><h:ElementName>Intel(r) AMT OptIn Service</h:ElementName><h:Name>Intel(r) AMT OptIn Service</h:Name><h:OptInCodeTimeout>120</h:OptInCodeTimeout><h:OptInDisplayTimeout>300</h:OptInDisplayTimeout><h:OptInRequired>%d</h:OptInRequired><h:OptInState>0</h:OptInState><h:SystemCreationClassName>CIM_ComputerSystem</h:SystemCreationClassName><h:SystemName>Intel(r) AMT</h:SystemName></h:IPS_OptInService>`
+const requestStateChangeXML = `<h:RequestStateChange_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:RequestStateChange_OUTPUT>`
+
+func redirectionXMLResponse(format string, a ...any) string {
+	return wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RedirectionService", fmt.Sprintf(format, a...))
+}
+
+// redirectionStateResponses answers the four Gets of GetRedirectionState
+func redirectionStateResponses(t *testing.T, enabledState int, listener bool, kvmState int, kvmByMEBx bool, optIn uint32, requests *[]string) ResponseFuncArray {
+	return ResponseFuncArray{
+		respondCaptureFunc(t, redirectionXMLResponse(redirectionServiceXML, enabledState, listener), requests),
+		respondCaptureFunc(t, redirectionXMLResponse(kvmRedirectionSAPXML, kvmState), requests),
+		respondCaptureFunc(t, redirectionXMLResponse(kvmRedirectionSettingDataXML, kvmByMEBx), requests),
+		respondCaptureFunc(t, redirectionXMLResponse(optInServiceXML, optIn), requests),
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestRedirectionEnabledState(t *testing.T) {
+	assert.Equal(t, 32768, redirectionEnabledState(false, false))
+	assert.Equal(t, 32769, redirectionEnabledState(false, true))
+	assert.Equal(t, 32770, redirectionEnabledState(true, false))
+	assert.Equal(t, 32771, redirectionEnabledState(true, true))
+	sol, ider := redirectionFeatures(32770)
+	assert.True(t, sol)
+	assert.False(t, ider)
+	sol, ider = redirectionFeatures(2)
+	assert.False(t, sol)
+	assert.False(t, ider)
+}
+
+func TestGetRedirectionState(t *testing.T) {
+	t.Run("expect Success", func(t *testing.T) {
+		f := &flags.Flags{}
+		var requests []string
+		lps := setupWsmanResponses(t, f, redirectionStateResponses(t, 32771, true, kvmEnabledButOffline, true, 1, &requests))
+		state, rc := lps.GetRedirectionState()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, redirectionState{SOL: true, IDER: true, KVM: true, KVMEnabledByMEBx: true, ListenerEnabled: true, UserConsent: "kvm"}, state)
+		assert.Contains(t, requests[2], "IPS_KVMRedirectionSettingData")
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		_, rc := lps.GetRedirectionState()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestConfigureRedirection(t *testing.T) {
+	orig := mockControlMode
+	defer func() { mockControlMode = orig }()
+
+	t.Run("expect Success enabling SOL, IDER and KVM", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Redirection.SOL = boolPtr(true)
+		f.LocalConfig.Redirection.IDER = boolPtr(true)
+		f.LocalConfig.Redirection.KVM = boolPtr(true)
+		var requests []string
+		rfa := redirectionStateResponses(t, 32768, false, kvmDisabled, true, 4294967295, &requests)
+		rfa = append(rfa,
+			respondCaptureFunc(t, redirectionXMLResponse(requestStateChangeXML, 0), &requests),
+			respondCaptureFunc(t, redirectionXMLResponse(requestStateChangeXML, 0), &requests),
+			respondCaptureFunc(t, redirectionXMLResponse(redirectionServiceXML, 32771, false), &requests),
+			respondCaptureFunc(t, redirectionXMLResponse(redirectionServiceXML, 32771, true), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureRedirection()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, requests, 8)
+		assert.Contains(t, requests[4], "<h:RequestedState>32771</h:RequestedState>")
+		assert.Contains(t, requests[5], "CIM_KVMRedirectionSAP")
+		assert.Contains(t, requests[5], "<h:RequestedState>2</h:RequestedState>")
+		assert.Contains(t, requests[7], "transfer/Put")
+		assert.Contains(t, requests[7], "<h:ListenerEnabled>true</h:ListenerEnabled>")
+	})
+	t.Run("expect Success without changes", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Redirection.SOL = boolPtr(true)
+		f.LocalConfig.Redirection.UserConsent = "all"
+		var requests []string
+		lps := setupWsmanResponses(t, f, redirectionStateResponses(t, 32770, true, kvmDisabled, true, 4294967295, &requests))
+		rc := lps.ConfigureRedirection()
+		assert.Equal(t, utils.Success, rc)
+		assert.Len(t, requests, 4)
+	})
+	t.Run("expect Success setting user consent in admin control mode", func(t *testing.T) {
+		mockControlMode = 2
+		f := &flags.Flags{}
+		f.LocalConfig.Redirection.UserConsent = "none"
+		var requests []string
+		rfa := redirectionStateResponses(t, 32770, true, kvmDisabled, true, 1, &requests)
+		rfa = append(rfa,
+			respondCaptureFunc(t, redirectionXMLResponse(optInServiceXML, 1), &requests),
+			respondCaptureFunc(t, redirectionXMLResponse(optInServiceXML, 0), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureRedirection()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[5], "transfer/Put")
+		assert.Contains(t, requests[5], "<h:OptInRequired>0</h:OptInRequired>")
+		assert.NotContains(t, requests[5], "OptInState")
+	})
+	t.Run("expect AMTFeaturesConfigurationFailed setting user consent in client control mode", func(t *testing.T) {
+		mockControlMode = 1
+		f := &flags.Flags{}
+		f.LocalConfig.Redirection.UserConsent = "none"
+		var requests []string
+		lps := setupWsmanResponses(t, f, redirectionStateResponses(t, 32770, true, kvmDisabled, true, 4294967295, &requests))
+		rc := lps.ConfigureRedirection()
+		assert.Equal(t, utils.AMTFeaturesConfigurationFailed, rc)
+		assert.Len(t, requests, 4)
+	})
+	t.Run("expect AMTFeaturesConfigurationFailed enabling KVM disabled in MEBx", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Redirection.KVM = boolPtr(true)
+		var requests []string
+		lps := setupWsmanResponses(t, f, redirectionStateResponses(t, 32768, false, kvmDisabled, false, 1, &requests))
+		rc := lps.ConfigureRedirection()
+		assert.Equal(t, utils.AMTFeaturesConfigurationFailed, rc)
+	})
+	t.Run("expect AmtPtStatusCodeBase for a failed state change", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Redirection.IDER = boolPtr(false)
+		var requests []string
+		rfa := redirectionStateResponses(t, 32771, true, kvmDisabled, true, 1, &requests)
+		rfa = append(rfa, respondCaptureFunc(t, redirectionXMLResponse(requestStateChangeXML, 2), &requests))
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureRedirection()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+2, rc)
+		assert.Contains(t, requests[4], "<h:RequestedState>32770</h:RequestedState>")
+	})
+}
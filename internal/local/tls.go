@@ -1,6 +1,21 @@
 package local
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"os"
+
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publickey"
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publicprivate"
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/setupandconfiguration"
@@ -16,6 +31,95 @@ import (
 const RemoteTLSInstanceId = `Intel(r) AMT 802.3 TLS Settings`
 const LocalTLSInstanceId = `Intel(r) AMT LMS TLS Settings`
 
+const (
+	publicKeyManagementServiceURI    = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyManagementService"
+	tlsProtocolEndpointCollectionURI = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_TLSProtocolEndpointCollection"
+)
+
+// pkcs10RequestInput is GeneratePKCS10RequestEx_INPUT with the key pair as an
+// endpoint reference, go-wsman-messages sends the key pair as text
+type pkcs10RequestInput struct {
+	XMLName                      xml.Name                   `xml:"h:GeneratePKCS10RequestEx_INPUT"`
+	H                            string                     `xml:"xmlns:h,attr"`
+	KeyPair                      keyPairReference           `xml:"h:KeyPair"`
+	NullSignedCertificateRequest string                     `xml:"h:NullSignedCertificateRequest"`
+	SigningAlgorithm             publickey.SigningAlgorithm `xml:"h:SigningAlgorithm"`
+}
+
+type keyPairReference struct {
+	Address     string `xml:"a:Address"`
+	ResourceURI string `xml:"a:ReferenceParameters>w:ResourceURI"`
+	Selector    struct {
+		Name  string `xml:"Name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"a:ReferenceParameters>w:SelectorSet>w:Selector"`
+}
+
+type pkcs10RequestResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Output struct {
+			SignedCertificateRequest string `xml:"SignedCertificateRequest"`
+			ReturnValue              int    `xml:"ReturnValue"`
+		} `xml:"GeneratePKCS10RequestEx_OUTPUT"`
+	} `xml:"Body"`
+}
+
+// certificationRequest and its info are the PKCS#10 structures, AMT signs
+// a request with a null signature over its own public key
+type certificationRequest struct {
+	Info               asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type certificationRequestInfo struct {
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+var oidSHA256WithRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+
+// nullSignedRequest builds the request with a throwaway key, as crypto/x509
+// verifies what it signs, then swaps in the AMT public key and a null
+// signature that AMT replaces
+func nullSignedRequest(template *x509.CertificateRequest, publicKey *rsa.PublicKey) ([]byte, error) {
+	throwaway, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	request := *template
+	request.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	der, err := x509.CreateCertificateRequest(rand.Reader, &request, throwaway)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	var info certificationRequestInfo
+	if _, err := asn1.Unmarshal(parsed.RawTBSCertificateRequest, &info); err != nil {
+		return nil, err
+	}
+	spki, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	info.PublicKey = asn1.RawValue{FullBytes: spki}
+	infoDER, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(certificationRequest{
+		Info:               asn1.RawValue{FullBytes: infoDER},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue},
+		Signature:          asn1.BitString{Bytes: make([]byte, publicKey.Size()), BitLength: publicKey.Size() * 8},
+	})
+}
+
 //type TLSContext struct {
 //	RootComp   certs.Composite
 //	ClientComp certs.Composite
@@ -60,6 +164,13 @@ func (service *ProvisioningService) ConfigureTLS() utils.ReturnCode {
 			break
 		}
 	}
+	if derKey == "" && service.plan != nil {
+		derKey, err = standInPublicKey()
+		if err != nil {
+			log.Error(err)
+			return utils.TLSConfigurationFailed
+		}
+	}
 	if derKey == "" {
 		log.Errorf("failed matching new amtKeyPairHandle: %s", handles.keyPairHandle)
 		return utils.TLSConfigurationFailed
@@ -206,3 +317,321 @@ func getTLSSettingsPutData(setting *tls.TlsSetting, tlsMode flags.TLSMode) tls.T
 	}
 	return data
 }
+
+// GenerateTLSCSR has AMT generate a key pair and sign a certificate signing
+// request with it, the private key never leaves AMT
+func (service *ProvisioningService) GenerateTLSCSR() utils.ReturnCode {
+	tlsInfo := service.flags.ConfigTLSInfo
+	commonName := tlsInfo.CommonName
+	if commonName == "" {
+		current, rc := service.getGeneralSettings()
+		if rc != utils.Success {
+			return rc
+		}
+		if current.HostName == "" {
+			log.Error("AMT has no host name, set the name of the certificate with -commonName")
+			return utils.MissingOrInvalidConfiguration
+		}
+		commonName = current.HostName
+		if current.DomainName != "" {
+			commonName = commonName + "." + current.DomainName
+		}
+	}
+	log.Infof("generating a certificate signing request for %s", commonName)
+	var handles Handles
+	var rc utils.ReturnCode
+	defer func() {
+		if rc != utils.Success {
+			service.RollbackAddedItems(&handles)
+		}
+	}()
+
+	handles.privateKeyHandle, rc = service.GenerateKeyPair()
+	if rc != utils.Success {
+		return rc
+	}
+	var publicKeys map[string]*rsa.PublicKey
+	publicKeys, rc = service.GetAMTPublicKeys()
+	if rc != utils.Success {
+		return rc
+	}
+	publicKey := publicKeys[handles.privateKeyHandle]
+	if publicKey == nil && service.plan != nil {
+		derKey, err := standInPublicKey()
+		if err == nil {
+			publicKey, err = parseAMTPublicKey(derKey)
+		}
+		if err != nil {
+			log.Error(err)
+			rc = utils.TLSConfigurationFailed
+			return rc
+		}
+	}
+	if publicKey == nil {
+		log.Errorf("failed matching new amtKeyPairHandle: %s", handles.privateKeyHandle)
+		rc = utils.TLSConfigurationFailed
+		return rc
+	}
+
+	template := x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}
+	if ip := net.ParseIP(commonName); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{commonName}
+	}
+	nullSigned, err := nullSignedRequest(&template, publicKey)
+	if err != nil {
+		log.Error(err)
+		rc = utils.TLSConfigurationFailed
+		return rc
+	}
+	input := pkcs10RequestInput{
+		H:                            publicKeyManagementServiceURI,
+		NullSignedCertificateRequest: base64.StdEncoding.EncodeToString(nullSigned),
+		SigningAlgorithm:             publickey.SHA256RSA,
+	}
+	input.KeyPair.Address = "/wsman"
+	input.KeyPair.ResourceURI = publicPrivateKeyPairURI
+	input.KeyPair.Selector.Name = "InstanceID"
+	input.KeyPair.Selector.Value = handles.privateKeyHandle
+	xmlMsg, err := putMessage(service.amtMessages.PublicKeyManagementService.GeneratePKCS10RequestEx(publickey.PKCS10Request{}), input, "")
+	if err != nil {
+		log.Error(err)
+		rc = utils.WSMANMessageError
+		return rc
+	}
+	var pkcs10Rsp pkcs10RequestResponse
+	rc = service.PostAndUnmarshal(xmlMsg, &pkcs10Rsp)
+	if rc != utils.Success {
+		return rc
+	}
+	if returnValue := pkcs10Rsp.Body.Output.ReturnValue; returnValue != 0 {
+		log.Errorf("GeneratePKCS10RequestEx.ReturnValue: %d", returnValue)
+		rc = utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+		return rc
+	}
+	if service.plan != nil {
+		// dry run has no request signed by AMT to write
+		return utils.Success
+	}
+
+	der, err := base64.StdEncoding.DecodeString(pkcs10Rsp.Body.Output.SignedCertificateRequest)
+	var csr *x509.CertificateRequest
+	if err == nil {
+		csr, err = x509.ParseCertificateRequest(der)
+	}
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		log.Errorf("AMT returned an invalid certificate signing request: %s", err)
+		rc = utils.TLSConfigurationFailed
+		return rc
+	}
+	csrPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	if tlsInfo.CSRFile != "" {
+		if err := os.WriteFile(tlsInfo.CSRFile, []byte(csrPem), 0644); err != nil {
+			log.Error(err)
+			rc = utils.TLSConfigurationFailed
+			return rc
+		}
+		log.Infof("wrote the certificate signing request to %s", tlsInfo.CSRFile)
+	}
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{
+			"keyPair":    handles.privateKeyHandle,
+			"commonName": commonName,
+			"csr":        csrPem,
+		})
+	} else if tlsInfo.CSRFile == "" {
+		fmt.Print(csrPem)
+	}
+	log.Infof("AMT keeps the private key in %s, run configure tls -cert with the certificate your CA issues", handles.privateKeyHandle)
+	return utils.Success
+}
+
+// ConfigureTLSWithCertChain adds the certificate a CA issued for a
+// GenerateTLSCSR request and its CA certificates, binds TLS to it and
+// enables TLS
+func (service *ProvisioningService) ConfigureTLSWithCertChain() utils.ReturnCode {
+	log.Info("configuring TLS with the CA issued certificate")
+	chain := service.flags.ConfigTLSInfo.CertChain
+	publicKeys, rc := service.GetAMTPublicKeys()
+	if rc != utils.Success {
+		return rc
+	}
+	parsed := make([]*x509.Certificate, len(chain))
+	leaf := -1
+	for i, encoded := range chain {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err == nil {
+			parsed[i], err = x509.ParseCertificate(der)
+		}
+		if err != nil {
+			log.Error(err)
+			return utils.TLSConfigurationFailed
+		}
+		for _, publicKey := range publicKeys {
+			if publicKey.Equal(parsed[i].PublicKey) {
+				leaf = i
+			}
+		}
+	}
+	if leaf < 0 {
+		log.Error("no certificate matches a key pair in AMT, the CA must issue it for the configure tls -csr request")
+		return utils.TLSConfigurationFailed
+	}
+
+	// certificates AMT already holds are not added again
+	var current []publickey.PublicKeyCertificate
+	rc = service.GetPublicKeyCerts(&current)
+	if rc != utils.Success {
+		return rc
+	}
+	service.handlesWithCerts = make(map[string]string)
+	for _, cert := range current {
+		service.handlesWithCerts[cert.InstanceID] = cert.X509Certificate
+	}
+	boundHandle, rc := service.GetTLSCertificateHandle()
+	if rc != utils.Success {
+		return rc
+	}
+
+	var added []string
+	defer func() {
+		if rc != utils.Success {
+			for i := len(added) - 1; i >= 0; i-- {
+				service.DeletePublicCert(added[i])
+			}
+		}
+	}()
+	add := func(cert string, trustedRoot bool) (handle string, addRc utils.ReturnCode) {
+		count := len(service.handlesWithCerts)
+		if trustedRoot {
+			handle, addRc = service.AddTrustedRootCert(cert)
+		} else {
+			handle, addRc = service.AddClientCert(cert)
+		}
+		if len(service.handlesWithCerts) > count {
+			added = append(added, handle)
+		}
+		return handle, addRc
+	}
+	for i := range chain {
+		if i == leaf {
+			continue
+		}
+		selfSigned := bytes.Equal(parsed[i].RawSubject, parsed[i].RawIssuer) && parsed[i].CheckSignatureFrom(parsed[i]) == nil
+		if _, rc = add(chain[i], selfSigned); rc != utils.Success {
+			return rc
+		}
+	}
+	var leafHandle string
+	leafHandle, rc = add(chain[leaf], false)
+	if rc != utils.Success {
+		return rc
+	}
+	log.Debug("TLS clientCertHandle:", leafHandle)
+
+	if boundHandle != leafHandle {
+		if boundHandle != "" {
+			log.Infof("replacing TLS certificate %s", boundHandle)
+			rc = service.DeleteTLSCredentialContext(boundHandle)
+			if rc != utils.Success {
+				return rc
+			}
+		}
+		rc = service.CreateTLSCredentialContext(leafHandle)
+		if rc != utils.Success {
+			if boundHandle != "" {
+				log.Warnf("binding TLS to certificate %s again", boundHandle)
+				service.CreateTLSCredentialContext(boundHandle)
+			}
+			return rc
+		}
+	}
+
+	rc = service.SynchronizeTime()
+	if rc != utils.Success {
+		return rc
+	}
+	rc = service.EnableTLS()
+	if rc == utils.Success {
+		log.Info("configuring TLS completed successfully")
+	}
+	return rc
+}
+
+// GetAMTPublicKeys returns the public keys of the key pairs in AMT by InstanceID
+func (service *ProvisioningService) GetAMTPublicKeys() (map[string]*rsa.PublicKey, utils.ReturnCode) {
+	var keyPairs []publicprivate.PublicPrivateKeyPair
+	rc := service.GetPublicPrivateKeyPairs(&keyPairs)
+	if rc != utils.Success {
+		return nil, rc
+	}
+	publicKeys := make(map[string]*rsa.PublicKey)
+	for _, keyPair := range keyPairs {
+		publicKey, err := parseAMTPublicKey(keyPair.DERKey)
+		if err != nil {
+			log.Warnf("skipping key pair %s: %s", keyPair.InstanceID, err)
+			continue
+		}
+		publicKeys[keyPair.InstanceID] = publicKey
+	}
+	return publicKeys, utils.Success
+}
+
+func parseAMTPublicKey(derKey string) (*rsa.PublicKey, error) {
+	// certs.ParseAMTPublicKey panics on a key that is not base64
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(derKey), ""))
+	if err != nil || len(der) == 0 {
+		return nil, fmt.Errorf("invalid DER key %q", derKey)
+	}
+	publicKey, err := certs.ParseAMTPublicKey(derKey)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key %T", publicKey)
+	}
+	return rsaKey, nil
+}
+
+// GetTLSCertificateHandle returns the certificate TLS is bound to, or an
+// empty handle without a TLS credential context
+func (service *ProvisioningService) GetTLSCertificateHandle() (string, utils.ReturnCode) {
+	credentials, rc := service.GetCredentialRelationships()
+	if rc != utils.Success {
+		return "", rc
+	}
+	for i := range credentials {
+		if credentials[i].ElementProvidingContext.ReferenceParameters.ResourceURI == tlsProtocolEndpointCollectionURI {
+			return credentials[i].ElementInContext.ReferenceParameters.GetSelectorValue("InstanceID"), utils.Success
+		}
+	}
+	return "", utils.Success
+}
+
+// DeleteTLSCredentialContext unbinds TLS from a certificate. The association
+// is selected by the references of both ends, go-wsman-messages selects it by
+// a Name it does not have.
+func (service *ProvisioningService) DeleteTLSCredentialContext(certHandle string) utils.ReturnCode {
+	reference := func(resourceURI string, name string, value string) string {
+		return fmt.Sprintf(`<a:EndpointReference><a:Address>/wsman</a:Address><a:ReferenceParameters><w:ResourceURI>%s</w:ResourceURI><w:SelectorSet><w:Selector Name="%s">%s</w:Selector></w:SelectorSet></a:ReferenceParameters></a:EndpointReference>`, resourceURI, name, value)
+	}
+	selectorSet := `<w:SelectorSet><w:Selector Name="ElementInContext">` + reference(publicKeyCertificateURI, "InstanceID", certHandle) +
+		`</w:Selector><w:Selector Name="ElementProvidingContext">` + reference(tlsProtocolEndpointCollectionURI, "ElementName", "TLSProtocolEndpointInstances Collection") +
+		`</w:Selector></w:SelectorSet>`
+	xmlMsg := service.amtMessages.TLSCredentialContext.Delete("")
+	selectorStart := strings.Index(xmlMsg, "<w:SelectorSet>")
+	selectorEnd := strings.Index(xmlMsg, "</w:SelectorSet>") + len("</w:SelectorSet>")
+	if selectorStart >= 0 && selectorEnd > selectorStart {
+		xmlMsg = xmlMsg[:selectorStart] + selectorSet + xmlMsg[selectorEnd:]
+	}
+	if _, err := service.client.Post(xmlMsg); err != nil {
+		log.Errorf("failed deleting the TLS credential context of %s: %s", certHandle, err)
+		return utils.WSMANMessageError
+	}
+	return utils.Success
+}
@@ -1,6 +1,16 @@
 package local
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/certs"
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publickey"
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publicprivate"
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/tls"
@@ -101,6 +111,174 @@ func TestConfigureTLS(t *testing.T) {
 	})
 }
 
+var pkcs10RequestXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyManagementService", `<h:GeneratePKCS10RequestEx_OUTPUT><h:SignedCertificateRequest>%s</h:SignedCertificateRequest><h:ReturnValue>%d</h:ReturnValue></h:GeneratePKCS10RequestEx_OUTPUT>`)
+
+var tlsCredentialContextXMLResponse = wsmanEnvelope("http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_CredentialContext", `<g:PullResponse><g:Items><h:CIM_CredentialContext><h:ElementInContext><b:Address>/wsman</b:Address><b:ReferenceParameters><c:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate</c:ResourceURI><c:SelectorSet><c:Selector Name="InstanceID">%s</c:Selector></c:SelectorSet></b:ReferenceParameters></h:ElementInContext><h:ElementProvidingContext><b:Address>/wsman</b:Address><b:ReferenceParameters><c:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_TLSProtocolEndpointCollection</c:ResourceURI><c:SelectorSet><c:Selector Name="ElementName">TLSProtocolEndpointInstances Collection</c:Selector></c:SelectorSet></b:ReferenceParameters></h:ElementProvidingContext></h:CIM_CredentialContext></g:Items><g:EndOfSequence></g:EndOfSequence></g:PullResponse>`)
+
+// amtKeyPair stands in for the key pair generateKeyPairXMLResponse creates
+func amtKeyPair(t *testing.T) (*rsa.PrivateKey, publicprivate.PullResponseEnvelope) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	pullRspEnv := publicprivate.PullResponseEnvelope{}
+	pullRspEnv.Body.PullResponse.Items = []publicprivate.PublicPrivateKeyPair{{
+		InstanceID: "Intel(r) AMT Key: Handle: 3",
+		DERKey:     base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&key.PublicKey)),
+	}}
+	return key, pullRspEnv
+}
+
+func xmlElementText(xmlMsg string, element string) string {
+	start := strings.Index(xmlMsg, "<"+element+">") + len(element) + 2
+	end := strings.Index(xmlMsg, "</"+element+">")
+	if start < len(element)+2 || end < start {
+		return ""
+	}
+	return xmlMsg[start:end]
+}
+
+func TestGenerateTLSCSR(t *testing.T) {
+	enumRsp := common.EnumerationResponse{}
+	key, keyPairs := amtKeyPair(t)
+	signed, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device01.vprodemo.com"}}, key)
+	assert.Nil(t, err)
+
+	t.Run("expect Success writing the request AMT signed", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.ConfigTLSInfo.CSR = true
+		f.ConfigTLSInfo.CSRFile = filepath.Join(t.TempDir(), "amt.csr")
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, generalSettingsHostnameXMLResponse("device01", "vprodemo.com"), &requests),
+			respondCaptureFunc(t, generateKeyPairXMLResponse, &requests),
+			respondMsgFunc(t, enumRsp),
+			respondMsgFunc(t, keyPairs),
+			respondCaptureFunc(t, fmt.Sprintf(pkcs10RequestXMLResponse, base64.StdEncoding.EncodeToString(signed), 0), &requests),
+		})
+		rc := lps.GenerateTLSCSR()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[2], "AMT_PublicKeyManagementService/GeneratePKCS10RequestEx</a:Action>")
+		assert.Contains(t, requests[2], `<h:KeyPair><a:Address>/wsman</a:Address><a:ReferenceParameters><w:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicPrivateKeyPair</w:ResourceURI><w:SelectorSet><w:Selector Name="InstanceID">Intel(r) AMT Key: Handle: 3</w:Selector></w:SelectorSet></a:ReferenceParameters></h:KeyPair>`)
+		assert.Contains(t, requests[2], "<h:SigningAlgorithm>1</h:SigningAlgorithm>")
+		der, err := base64.StdEncoding.DecodeString(xmlElementText(requests[2], "h:NullSignedCertificateRequest"))
+		assert.Nil(t, err)
+		nullSigned, err := x509.ParseCertificateRequest(der)
+		assert.Nil(t, err)
+		assert.Equal(t, "device01.vprodemo.com", nullSigned.Subject.CommonName)
+		assert.Equal(t, []string{"device01.vprodemo.com"}, nullSigned.DNSNames)
+		assert.True(t, key.PublicKey.Equal(nullSigned.PublicKey))
+
+		content, err := os.ReadFile(f.ConfigTLSInfo.CSRFile)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(string(content), "-----BEGIN CERTIFICATE REQUEST-----"))
+	})
+	t.Run("expect the key pair rolled back on a non-success return code", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.ConfigTLSInfo.CSR = true
+		f.ConfigTLSInfo.CommonName = "192.168.1.10"
+		var requests []string
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondCaptureFunc(t, generateKeyPairXMLResponse, &requests),
+			respondMsgFunc(t, enumRsp),
+			respondMsgFunc(t, keyPairs),
+			respondCaptureFunc(t, fmt.Sprintf(pkcs10RequestXMLResponse, "", 1), &requests),
+			respondCaptureFunc(t, emptyBodyXMLResponse, &requests),
+		})
+		rc := lps.GenerateTLSCSR()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+1, rc)
+		der, _ := base64.StdEncoding.DecodeString(xmlElementText(requests[1], "h:NullSignedCertificateRequest"))
+		nullSigned, err := x509.ParseCertificateRequest(der)
+		assert.Nil(t, err)
+		assert.Equal(t, "192.168.1.10", nullSigned.IPAddresses[0].String())
+		assert.Contains(t, requests[2], "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete")
+		assert.Contains(t, requests[2], "Intel(r) AMT Key: Handle: 3")
+	})
+	t.Run("expect MissingOrInvalidConfiguration without a host name", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.ConfigTLSInfo.CSR = true
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, generalSettingsHostnameXMLResponse("", "")),
+		})
+		rc := lps.GenerateTLSCSR()
+		assert.Equal(t, utils.MissingOrInvalidConfiguration, rc)
+	})
+}
+
+func TestConfigureTLSWithCertChain(t *testing.T) {
+	enumRsp := common.EnumerationResponse{}
+	_, keyPairs := amtKeyPair(t)
+	root, err := certs.NewRootComposite()
+	assert.Nil(t, err)
+	leaf, err := certs.NewSignedAMTComposite(keyPairs.Body.PullResponse.Items[0].DERKey, &root)
+	assert.Nil(t, err)
+	selfSigned := publickey.PublicKeyCertificate{InstanceID: "Intel(r) AMT Certificate: Handle: 0", X509Certificate: "MIIBselfsigned"}
+	chainResponses := func(requests *[]string) ResponseFuncArray {
+		return ResponseFuncArray{
+			respondMsgFunc(t, enumRsp),
+			respondMsgFunc(t, keyPairs),
+			respondMsgFunc(t, enumRsp),
+			respondMsgFunc(t, publicKeyCertsResponse(selfSigned)),
+			respondMsgFunc(t, enumRsp),
+			respondStringFunc(t, fmt.Sprintf(tlsCredentialContextXMLResponse, selfSigned.InstanceID)),
+			respondCaptureFunc(t, trustedRootXMLResponse, requests),
+			respondCaptureFunc(t, clientCertXMLResponse, requests),
+			respondCaptureFunc(t, emptyBodyXMLResponse, requests),
+		}
+	}
+
+	t.Run("expect Success replacing the self-signed certificate", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.ConfigTLSInfo.CertChain = []string{leaf.StripPem(), root.StripPem()}
+		var requests []string
+		lps := setupWsmanResponses(t, f, append(chainResponses(&requests),
+			respondCaptureFunc(t, emptyBodyXMLResponse, &requests),
+			respondStringFunc(t, getLowAccuracyTimeSynchXMLResponse),
+			respondStringFunc(t, setHighAccuracyTimeSynchXMLResponse),
+			respondMsgFunc(t, enumRsp),
+			respondStringFunc(t, tlsSettingsXMLResponse),
+			respondStringFunc(t, putTLSSettingsXMLResponse),
+			respondStringFunc(t, putTLSSettingsXMLResponse),
+			respondStringFunc(t, commitChangesXMLResponse),
+		))
+		rc := lps.ConfigureTLSWithCertChain()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[0], "AddTrustedRootCertificate</a:Action>")
+		assert.Contains(t, requests[0], root.StripPem())
+		assert.Contains(t, requests[1], "AddCertificate</a:Action>")
+		assert.Contains(t, requests[1], leaf.StripPem())
+		assert.Contains(t, requests[2], "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete")
+		assert.Contains(t, requests[2], `<w:Selector Name="ElementInContext"><a:EndpointReference><a:Address>/wsman</a:Address><a:ReferenceParameters><w:ResourceURI>http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate</w:ResourceURI><w:SelectorSet><w:Selector Name="InstanceID">Intel(r) AMT Certificate: Handle: 0</w:Selector>`)
+		assert.Contains(t, requests[3], "http://schemas.xmlsoap.org/ws/2004/09/transfer/Create")
+		assert.Contains(t, requests[3], "Intel(r) AMT Certificate: Handle: 1")
+	})
+	t.Run("expect the certificates rolled back when TLS cannot be bound", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.ConfigTLSInfo.CertChain = []string{root.StripPem(), leaf.StripPem()}
+		var requests []string
+		lps := setupWsmanResponses(t, f, append(chainResponses(&requests),
+			respondServerErrFunc(),
+			respondCaptureFunc(t, emptyBodyXMLResponse, &requests),
+			respondCaptureFunc(t, emptyBodyXMLResponse, &requests),
+			respondCaptureFunc(t, emptyBodyXMLResponse, &requests),
+		))
+		rc := lps.ConfigureTLSWithCertChain()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+		assert.Contains(t, requests[3], "http://schemas.xmlsoap.org/ws/2004/09/transfer/Create")
+		assert.Contains(t, requests[3], "Intel(r) AMT Certificate: Handle: 0")
+		assert.Contains(t, requests[4], "Intel(r) AMT Certificate: Handle: 1")
+		assert.Contains(t, requests[5], "Intel(r) AMT Certificate: Handle: 2")
+	})
+	t.Run("expect TLSConfigurationFailed for a certificate of another key", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.ConfigTLSInfo.CertChain = []string{root.StripPem()}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondMsgFunc(t, enumRsp),
+			respondMsgFunc(t, keyPairs),
+		})
+		rc := lps.ConfigureTLSWithCertChain()
+		assert.Equal(t, utils.TLSConfigurationFailed, rc)
+	})
+}
+
 func runGenerateKeyPairTest(t *testing.T, expectedHandle string, expectedCode utils.ReturnCode, responsers ResponseFuncArray) {
 	f := &flags.Flags{}
 	lps := setupWsmanResponses(t, f, responsers)
@@ -0,0 +1,297 @@
+package local
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/authorization"
+	log "github.com/sirupsen/logrus"
+)
+
+const authorizationServiceURI = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuthorizationService"
+
+// go-wsman-messages has no AddUserAclEntryEx and UpdateUserAclEntryEx messages, and its
+// input types nest the realms, AMT expects one Realms element per realm
+type addUserAclEntryInput struct {
+	XMLName          xml.Name                       `xml:"h:AddUserAclEntryEx_INPUT"`
+	H                string                         `xml:"xmlns:h,attr"`
+	DigestUsername   string                         `xml:"h:DigestUsername"`
+	DigestPassword   string                         `xml:"h:DigestPassword"`
+	AccessPermission authorization.AccessPermission `xml:"h:AccessPermission"`
+	Realms           []authorization.RealmValues    `xml:"h:Realms"`
+}
+
+// updateUserAclEntryInput keeps the password when DigestPassword is empty
+type updateUserAclEntryInput struct {
+	XMLName          xml.Name                       `xml:"h:UpdateUserAclEntryEx_INPUT"`
+	H                string                         `xml:"xmlns:h,attr"`
+	Handle           int                            `xml:"h:Handle"`
+	DigestUsername   string                         `xml:"h:DigestUsername"`
+	DigestPassword   string                         `xml:"h:DigestPassword,omitempty"`
+	AccessPermission authorization.AccessPermission `xml:"h:AccessPermission"`
+	Realms           []authorization.RealmValues    `xml:"h:Realms"`
+}
+
+type enumerateUserAclEntriesResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Output struct {
+			TotalCount   int   `xml:"TotalCount"`
+			HandlesCount int   `xml:"HandlesCount"`
+			Handles      []int `xml:"Handles"`
+			ReturnValue  int   `xml:"ReturnValue"`
+		} `xml:"EnumerateUserAclEntries_OUTPUT"`
+	} `xml:"Body"`
+}
+
+type getUserAclEntryExResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Output struct {
+			DigestUsername   string `xml:"DigestUsername"`
+			KerberosUserSid  string `xml:"KerberosUserSid"`
+			AccessPermission int    `xml:"AccessPermission"`
+			Realms           []int  `xml:"Realms"`
+			ReturnValue      int    `xml:"ReturnValue"`
+		} `xml:"GetUserAclEntryEx_OUTPUT"`
+	} `xml:"Body"`
+}
+
+// userAclOutputResponse holds the AddUserAclEntryEx, UpdateUserAclEntryEx or RemoveUserAclEntry output
+type userAclOutputResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Output struct {
+			XMLName     xml.Name
+			Handle      int `xml:"Handle"`
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+type userAclEntry struct {
+	Handle           int      `json:"handle"`
+	Username         string   `json:"username"`
+	KerberosUserSid  string   `json:"kerberosUserSid,omitempty"`
+	AccessPermission string   `json:"accessPermission"`
+	Realms           []string `json:"realms"`
+}
+
+func accessPermissionName(value int) string {
+	for name, permission := range flags.UserAccessPermissions {
+		if int(permission) == value {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown (%d)", value)
+}
+
+func realmName(value int) string {
+	for name, realm := range flags.UserRealms {
+		if int(realm) == value {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", value)
+}
+
+// digestPassword is the base64 encoded MD5 of username:realm:password that AMT stores
+func digestPassword(username, digestRealm, password string) string {
+	hash := md5.Sum([]byte(username + ":" + digestRealm + ":" + password))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func (service *ProvisioningService) RunUsers() utils.ReturnCode {
+	service.setupWsmanClient("admin", service.flags.Password)
+	entries, rc := service.GetUserAclEntries()
+	if rc != utils.Success {
+		return rc
+	}
+	if service.flags.SubCommand == utils.SubCommandUsersList {
+		service.displayUserAclEntries(entries)
+		return utils.Success
+	}
+	handles := make(map[string]int)
+	for _, entry := range entries {
+		handles[entry.Username] = entry.Handle
+	}
+	var digestRealm string
+	if service.flags.SubCommand != utils.SubCommandUsersRemove {
+		generalSettings, err := service.GetGeneralSettings()
+		if err != nil {
+			log.Error(err)
+			return utils.WSMANMessageError
+		}
+		digestRealm = generalSettings.Body.AMTGeneralSettings.DigestRealm
+	}
+	for _, user := range service.flags.LocalConfig.Users {
+		handle, exists := handles[user.Username]
+		switch service.flags.SubCommand {
+		case utils.SubCommandUsersAdd:
+			if exists {
+				log.Errorf("user %s already exists", user.Username)
+				return utils.UserManagementFailed
+			}
+			rc = service.AddUser(user, digestRealm)
+		case utils.SubCommandUsersUpdate:
+			if !exists {
+				log.Errorf("user %s does not exist", user.Username)
+				return utils.UserManagementFailed
+			}
+			rc = service.UpdateUser(handle, user, digestRealm)
+		case utils.SubCommandUsersRemove:
+			if !exists {
+				log.Errorf("user %s does not exist", user.Username)
+				return utils.UserManagementFailed
+			}
+			log.Infof("removing user %s", user.Username)
+			rc = service.userAclAction("RemoveUserAclEntry", service.amtMessages.AuthorizationService.RemoveUserAclEntry(handle))
+		}
+		if rc != utils.Success {
+			return rc
+		}
+	}
+	log.Infof("successfully completed users %s", service.flags.SubCommand)
+	return utils.Success
+}
+
+func (service *ProvisioningService) GetUserAclEntries() ([]userAclEntry, utils.ReturnCode) {
+	var handles []int
+	for {
+		var rsp enumerateUserAclEntriesResponse
+		// the start index is one based
+		xmlMsg := service.amtMessages.AuthorizationService.EnumerateUserAclEntries(len(handles) + 1)
+		rc := service.PostAndUnmarshal(xmlMsg, &rsp)
+		if rc != utils.Success {
+			return nil, rc
+		}
+		output := rsp.Body.Output
+		if output.ReturnValue != 0 {
+			log.Errorf("failed EnumerateUserAclEntries with ReturnValue: %d", output.ReturnValue)
+			return nil, utils.AmtPtStatusCodeBase + utils.ReturnCode(output.ReturnValue)
+		}
+		handles = append(handles, output.Handles...)
+		if len(output.Handles) == 0 || len(handles) >= output.TotalCount {
+			break
+		}
+	}
+	entries := []userAclEntry{}
+	for _, handle := range handles {
+		var rsp getUserAclEntryExResponse
+		rc := service.PostAndUnmarshal(service.amtMessages.AuthorizationService.GetUserAclEntryEx(handle), &rsp)
+		if rc != utils.Success {
+			return nil, rc
+		}
+		output := rsp.Body.Output
+		if output.ReturnValue != 0 {
+			log.Errorf("failed GetUserAclEntryEx with ReturnValue: %d", output.ReturnValue)
+			return nil, utils.AmtPtStatusCodeBase + utils.ReturnCode(output.ReturnValue)
+		}
+		entry := userAclEntry{
+			Handle:           handle,
+			Username:         output.DigestUsername,
+			KerberosUserSid:  output.KerberosUserSid,
+			AccessPermission: accessPermissionName(output.AccessPermission),
+			Realms:           []string{},
+		}
+		for _, realm := range output.Realms {
+			entry.Realms = append(entry.Realms, realmName(realm))
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Handle < entries[j].Handle })
+	return entries, utils.Success
+}
+
+func userRealmValues(user config.UserConfig) []authorization.RealmValues {
+	var realms []authorization.RealmValues
+	for _, realm := range user.Realms {
+		realms = append(realms, flags.UserRealms[realm])
+	}
+	return realms
+}
+
+func (service *ProvisioningService) AddUser(user config.UserConfig, digestRealm string) utils.ReturnCode {
+	log.Infof("adding user %s", user.Username)
+	input := addUserAclEntryInput{
+		H:                authorizationServiceURI,
+		DigestUsername:   user.Username,
+		DigestPassword:   digestPassword(user.Username, digestRealm, user.Password),
+		AccessPermission: flags.UserAccessPermissions[user.AccessPermission],
+		Realms:           userRealmValues(user),
+	}
+	xmlMsg, err := methodMessage(service.amtMessages.AuthorizationService.RemoveUserAclEntry(0), "AddUserAclEntryEx", input)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	return service.userAclAction("AddUserAclEntryEx", xmlMsg)
+}
+
+func (service *ProvisioningService) UpdateUser(handle int, user config.UserConfig, digestRealm string) utils.ReturnCode {
+	log.Infof("updating user %s", user.Username)
+	input := updateUserAclEntryInput{
+		H:                authorizationServiceURI,
+		Handle:           handle,
+		DigestUsername:   user.Username,
+		AccessPermission: flags.UserAccessPermissions[user.AccessPermission],
+		Realms:           userRealmValues(user),
+	}
+	if user.Password != "" {
+		input.DigestPassword = digestPassword(user.Username, digestRealm, user.Password)
+	}
+	xmlMsg, err := methodMessage(service.amtMessages.AuthorizationService.RemoveUserAclEntry(0), "UpdateUserAclEntryEx", input)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	return service.userAclAction("UpdateUserAclEntryEx", xmlMsg)
+}
+
+func (service *ProvisioningService) userAclAction(method string, xmlMsg string) utils.ReturnCode {
+	var rsp userAclOutputResponse
+	rc := service.PostAndUnmarshal(xmlMsg, &rsp)
+	if rc != utils.Success {
+		return rc
+	}
+	if rsp.Body.Output.XMLName.Local != method+"_OUTPUT" {
+		log.Errorf("unexpected %s response: %s", method, rsp.Body.Output.XMLName.Local)
+		return utils.UnmarshalMessageFailed
+	}
+	if returnValue := rsp.Body.Output.ReturnValue; returnValue != 0 {
+		log.Errorf("failed %s with ReturnValue: %d", method, returnValue)
+		return utils.AmtPtStatusCodeBase + utils.ReturnCode(returnValue)
+	}
+	return utils.Success
+}
+
+func (service *ProvisioningService) displayUserAclEntries(entries []userAclEntry) {
+	if service.flags.JsonOutput {
+		printJson(map[string]interface{}{"users": entries})
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("---No Users Found---")
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "HANDLE\tUSERNAME\tACCESS\tREALMS")
+	for _, entry := range entries {
+		username := entry.Username
+		if username == "" {
+			username = entry.KerberosUserSid
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", entry.Handle, username, entry.AccessPermission, strings.Join(entry.Realms, ","))
+	}
+	writer.Flush()
+}
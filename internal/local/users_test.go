@@ -0,0 +1,164 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const enumerateUserAclEntriesXML = `<h:EnumerateUserAclEntries_OUTPUT><h:TotalCount>%d</h:TotalCount><h:HandlesCount>%d</h:HandlesCount>%s<h:ReturnValue>0</h:ReturnValue></h:EnumerateUserAclEntries_OUTPUT>`
+const getUserAclEntryExXML = `<h:GetUserAclEntryEx_OUTPUT><h:AccessPermission>%d</h:AccessPermission><h:DigestUsername>%s</h:DigestUsername><h:Realms>4</h:Realms><h:Realms>13</h:Realms><h:ReturnValue>0</h:ReturnValue></h:GetUserAclEntryEx_OUTPUT>`
+const userAclOutputXML = `<h:%s_OUTPUT><h:Handle>%d</h:Handle><h:ReturnValue>%d</h:ReturnValue></h:%s_OUTPUT>`
+
+var generalSettingsXML = wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_GeneralSettings", `<h:AMT_GeneralSettings><h:DigestRealm>Digest:A3829B3827DE4D33D4449B366831FD01</h:DigestRealm></h:AMT_GeneralSettings>`)
+
+func authorizationXMLResponse(format string, a ...any) string {
+	return wsmanEnvelope(authorizationServiceURI, fmt.Sprintf(format, a...))
+}
+
+func userAclOutputResponseXML(method string, handle int, returnValue int) string {
+	return authorizationXMLResponse(userAclOutputXML, method, handle, returnValue, method)
+}
+
+// userAclEntriesResponses lists a single digest user named monitor with handle 7
+func userAclEntriesResponses(t *testing.T, requests *[]string) ResponseFuncArray {
+	return ResponseFuncArray{
+		respondCaptureFunc(t, authorizationXMLResponse(enumerateUserAclEntriesXML, 1, 1, "<h:Handles>7</h:Handles>"), requests),
+		respondCaptureFunc(t, authorizationXMLResponse(getUserAclEntryExXML, 1, "monitor"), requests),
+	}
+}
+
+func TestDigestPassword(t *testing.T) {
+	// base64 of md5("admin:Digest:A3829B3827DE4D33D4449B366831FD01:P@ssw0rd")
+	assert.Equal(t, "ZlTOuVM90P1tPlo8PoSZ1w==", digestPassword("admin", "Digest:A3829B3827DE4D33D4449B366831FD01", "P@ssw0rd"))
+}
+
+func TestGetUserAclEntries(t *testing.T) {
+	t.Run("expect Success across pages", func(t *testing.T) {
+		f := &flags.Flags{}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondCaptureFunc(t, authorizationXMLResponse(enumerateUserAclEntriesXML, 2, 1, "<h:Handles>9</h:Handles>"), &requests),
+			respondCaptureFunc(t, authorizationXMLResponse(enumerateUserAclEntriesXML, 2, 1, "<h:Handles>3</h:Handles>"), &requests),
+			respondCaptureFunc(t, authorizationXMLResponse(getUserAclEntryExXML, 2, "operator"), &requests),
+			respondCaptureFunc(t, authorizationXMLResponse(getUserAclEntryExXML, 1, "monitor"), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		entries, rc := lps.GetUserAclEntries()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[1], "<h:StartIndex>2</h:StartIndex>")
+		assert.Equal(t, []userAclEntry{
+			{Handle: 3, Username: "monitor", AccessPermission: "network", Realms: []string{"hardwareAsset", "generalInfo"}},
+			{Handle: 9, Username: "operator", AccessPermission: "any", Realms: []string{"hardwareAsset", "generalInfo"}},
+		}, entries)
+	})
+	t.Run("expect Success without users", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{
+			respondStringFunc(t, authorizationXMLResponse(enumerateUserAclEntriesXML, 0, 0, "")),
+		})
+		entries, rc := lps.GetUserAclEntries()
+		assert.Equal(t, utils.Success, rc)
+		assert.Equal(t, []userAclEntry{}, entries)
+	})
+	t.Run("expect WSMANMessageError", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{respondServerErrFunc()})
+		_, rc := lps.GetUserAclEntries()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+}
+
+func TestRunUsers(t *testing.T) {
+	monitor := config.UserConfig{Username: "monitor", Password: "Us3r!Pass", AccessPermission: "local", Realms: []string{"redirection", "auditLog"}}
+	for _, jsonOutput := range []bool{false, true} {
+		t.Run(fmt.Sprintf("expect Success for list with json %t", jsonOutput), func(t *testing.T) {
+			f := &flags.Flags{JsonOutput: jsonOutput, SubCommand: utils.SubCommandUsersList}
+			var requests []string
+			lps := setupWsmanResponses(t, f, userAclEntriesResponses(t, &requests))
+			rc := lps.RunUsers()
+			assert.Equal(t, utils.Success, rc)
+		})
+	}
+	t.Run("expect Success for add", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandUsersAdd}
+		operator := monitor
+		operator.Username = "operator"
+		f.LocalConfig.Users = config.UserConfigs{operator}
+		var requests []string
+		rfa := append(userAclEntriesResponses(t, &requests),
+			respondCaptureFunc(t, generalSettingsXML, &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("AddUserAclEntryEx", 8, 0), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunUsers()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[3], "AMT_AuthorizationService/AddUserAclEntryEx</a:Action>")
+		assert.Contains(t, requests[3], "<h:DigestUsername>operator</h:DigestUsername>")
+		assert.Contains(t, requests[3], "<h:DigestPassword>"+digestPassword("operator", "Digest:A3829B3827DE4D33D4449B366831FD01", "Us3r!Pass")+"</h:DigestPassword>")
+		assert.Contains(t, requests[3], "<h:AccessPermission>0</h:AccessPermission><h:Realms>2</h:Realms><h:Realms>20</h:Realms>")
+	})
+	t.Run("expect UserManagementFailed adding an existing user", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandUsersAdd}
+		f.LocalConfig.Users = config.UserConfigs{monitor}
+		var requests []string
+		rfa := append(userAclEntriesResponses(t, &requests), respondCaptureFunc(t, generalSettingsXML, &requests))
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunUsers()
+		assert.Equal(t, utils.UserManagementFailed, rc)
+		assert.Len(t, requests, 3)
+	})
+	t.Run("expect Success for update keeping the password", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandUsersUpdate}
+		user := monitor
+		user.Password = ""
+		f.LocalConfig.Users = config.UserConfigs{user}
+		var requests []string
+		rfa := append(userAclEntriesResponses(t, &requests),
+			respondCaptureFunc(t, generalSettingsXML, &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("UpdateUserAclEntryEx", 7, 0), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunUsers()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[3], "AMT_AuthorizationService/UpdateUserAclEntryEx</a:Action>")
+		assert.Contains(t, requests[3], "<h:Handle>7</h:Handle>")
+		assert.NotContains(t, requests[3], "DigestPassword")
+	})
+	t.Run("expect Success for remove", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandUsersRemove}
+		f.LocalConfig.Users = config.UserConfigs{{Username: "monitor"}}
+		var requests []string
+		rfa := append(userAclEntriesResponses(t, &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("RemoveUserAclEntry", 0, 0), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunUsers()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[2], "<h:Handle>7</h:Handle>")
+	})
+	t.Run("expect UserManagementFailed removing a missing user", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandUsersRemove}
+		f.LocalConfig.Users = config.UserConfigs{{Username: "operator"}}
+		var requests []string
+		lps := setupWsmanResponses(t, f, userAclEntriesResponses(t, &requests))
+		rc := lps.RunUsers()
+		assert.Equal(t, utils.UserManagementFailed, rc)
+	})
+	t.Run("expect AmtPtStatusCodeBase for a failed remove", func(t *testing.T) {
+		f := &flags.Flags{SubCommand: utils.SubCommandUsersRemove}
+		f.LocalConfig.Users = config.UserConfigs{{Username: "monitor"}}
+		var requests []string
+		rfa := append(userAclEntriesResponses(t, &requests),
+			respondCaptureFunc(t, userAclOutputResponseXML("RemoveUserAclEntry", 0, 16), &requests),
+		)
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.RunUsers()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+16, rc)
+	})
+}
@@ -1,7 +1,10 @@
 package local
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"time"
 
 	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/publickey"
@@ -65,6 +68,52 @@ func (service *ProvisioningService) PostAndUnmarshal(xmlMsg string, outObj any)
 	return utils.Success
 }
 
+// putMessage replaces the body of a go-wsman-messages Put with data and
+// selects the instance in the header. The library structs of some classes
+// marshal to a ManagedElement instead of the class and Put has no selector.
+func putMessage(xmlMsg string, data any, instanceID string) (string, error) {
+	body, err := xml.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("marshal call for %s: %w", reflectObjectName(data), err)
+	}
+	bodyStart := strings.Index(xmlMsg, "<Body>") + len("<Body>")
+	bodyEnd := strings.LastIndex(xmlMsg, "</Body>")
+	if bodyStart < len("<Body>") || bodyEnd < bodyStart {
+		return "", fmt.Errorf("no body to replace with %s", reflectObjectName(data))
+	}
+	xmlMsg = xmlMsg[:bodyStart] + string(body) + xmlMsg[bodyEnd:]
+	if instanceID != "" {
+		var value bytes.Buffer
+		xml.EscapeText(&value, []byte(instanceID))
+		selector := fmt.Sprintf(`<w:SelectorSet><w:Selector Name="InstanceID">%s</w:Selector></w:SelectorSet></Header>`, value.String())
+		xmlMsg = strings.Replace(xmlMsg, "</Header>", selector, 1)
+	}
+	return xmlMsg, nil
+}
+
+// methodMessage turns a go-wsman-messages method call into a call of another
+// method of the same class with data as input, for methods the library lacks.
+func methodMessage(xmlMsg string, method string, data any) (string, error) {
+	actionStart := strings.Index(xmlMsg, "<a:Action>") + len("<a:Action>")
+	actionEnd := strings.Index(xmlMsg, "</a:Action>")
+	if actionStart < len("<a:Action>") || actionEnd < actionStart {
+		return "", fmt.Errorf("no action to replace with %s", method)
+	}
+	action := xmlMsg[actionStart:actionEnd]
+	action = action[:strings.LastIndex(action, "/")+1] + method
+	xmlMsg = xmlMsg[:actionStart] + action + xmlMsg[actionEnd:]
+	return putMessage(xmlMsg, data, "")
+}
+
+func printJson(dataStruct map[string]interface{}) {
+	outBytes, err := json.MarshalIndent(dataStruct, "", "  ")
+	output := string(outBytes)
+	if err != nil {
+		output = err.Error()
+	}
+	fmt.Println(output)
+}
+
 func GetTokenFromKeyValuePairs(kvList string, token string) string {
 	attributes := strings.Split(kvList, ",")
 	tokenMap := make(map[string]string)
@@ -1,6 +1,7 @@
 package local
 
 import (
+	"encoding/xml"
 	"regexp"
 	"github.com/jc-lab/intel-amt-host-api/internal/flags"
 	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
@@ -402,3 +403,52 @@ var concreteDependencyPullRspString = `
   </a:Body>
 </a:Envelope>
 `
+
+func TestPutMessage(t *testing.T) {
+	data := struct {
+		XMLName xml.Name `xml:"h:AMT_Test"`
+		H       string   `xml:"xmlns:h,attr"`
+		Value   int      `xml:"h:Value"`
+	}{H: "http://test", Value: 1}
+	xmlMsg := `<Envelope><Header><a:To>/wsman</a:To></Header><Body><h:ManagedElement></h:ManagedElement></Body></Envelope>`
+	t.Run("expect body and selector replaced", func(t *testing.T) {
+		result, err := putMessage(xmlMsg, data, "Instance 0")
+		assert.Nil(t, err)
+		assert.Equal(t, `<Envelope><Header><a:To>/wsman</a:To><w:SelectorSet><w:Selector Name="InstanceID">Instance 0</w:Selector></w:SelectorSet></Header><Body><h:AMT_Test xmlns:h="http://test"><h:Value>1</h:Value></h:AMT_Test></Body></Envelope>`, result)
+	})
+	t.Run("expect selector value escaped", func(t *testing.T) {
+		result, err := putMessage(xmlMsg, data, "Instance <0> & 1")
+		assert.Nil(t, err)
+		assert.Contains(t, result, `<w:Selector Name="InstanceID">Instance &lt;0&gt; &amp; 1</w:Selector>`)
+	})
+	t.Run("expect no selector without instance", func(t *testing.T) {
+		result, err := putMessage(xmlMsg, data, "")
+		assert.Nil(t, err)
+		assert.Equal(t, `<Envelope><Header><a:To>/wsman</a:To></Header><Body><h:AMT_Test xmlns:h="http://test"><h:Value>1</h:Value></h:AMT_Test></Body></Envelope>`, result)
+	})
+	t.Run("expect error without a body", func(t *testing.T) {
+		_, err := putMessage(`<Envelope></Envelope>`, data, "Instance 0")
+		assert.NotNil(t, err)
+	})
+	t.Run("expect error when the data does not marshal", func(t *testing.T) {
+		_, err := putMessage(xmlMsg, make(chan int), "Instance 0")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestMethodMessage(t *testing.T) {
+	data := struct {
+		XMLName xml.Name `xml:"h:ClearLog_INPUT"`
+		H       string   `xml:"xmlns:h,attr"`
+	}{H: "http://test/AMT_Test"}
+	t.Run("expect action and body replaced", func(t *testing.T) {
+		xmlMsg := `<Envelope><Header><a:Action>http://test/AMT_Test/ReadRecords</a:Action></Header><Body><h:ReadRecords_INPUT></h:ReadRecords_INPUT></Body></Envelope>`
+		result, err := methodMessage(xmlMsg, "ClearLog", data)
+		assert.Nil(t, err)
+		assert.Equal(t, `<Envelope><Header><a:Action>http://test/AMT_Test/ClearLog</a:Action></Header><Body><h:ClearLog_INPUT xmlns:h="http://test/AMT_Test"></h:ClearLog_INPUT></Body></Envelope>`, result)
+	})
+	t.Run("expect error without an action", func(t *testing.T) {
+		_, err := methodMessage(`<Envelope></Envelope>`, "ClearLog", data)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,226 @@
+package local
+
+import (
+	"encoding/xml"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/amt/ethernetport"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/cim/models"
+	"github.com/open-amt-cloud-toolkit/go-wsman-messages/pkg/ips/ieee8021x"
+	log "github.com/sirupsen/logrus"
+)
+
+const WiredInstanceId = `Intel(r) AMT Ethernet Port Settings 0`
+
+// go-wsman-messages has no response types for AMT_EthernetPortSettings and
+// the IPS_IEEE8021xSettings methods
+type ethernetPortSettingsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		EthernetPortSettings ethernetPortSettings `xml:"AMT_EthernetPortSettings"`
+	} `xml:"Body"`
+}
+
+type ethernetPortSettings struct {
+	ElementName    string `xml:"ElementName"`
+	InstanceID     string `xml:"InstanceID"`
+	SharedMAC      bool   `xml:"SharedMAC"`
+	SharedStaticIp bool   `xml:"SharedStaticIp"`
+	IpSyncEnabled  bool   `xml:"IpSyncEnabled"`
+	DHCPEnabled    bool   `xml:"DHCPEnabled"`
+	IPAddress      string `xml:"IPAddress"`
+	SubnetMask     string `xml:"SubnetMask"`
+	DefaultGateway string `xml:"DefaultGateway"`
+	PrimaryDNS     string `xml:"PrimaryDNS"`
+	SecondaryDNS   string `xml:"SecondaryDNS"`
+}
+
+// the library structs marshal to a ManagedElement, see putMessage
+type ethernetPortSettingsPut struct {
+	XMLName        xml.Name `xml:"h:AMT_EthernetPortSettings"`
+	H              string   `xml:"xmlns:h,attr"`
+	ElementName    string   `xml:"h:ElementName"`
+	InstanceID     string   `xml:"h:InstanceID"`
+	SharedMAC      bool     `xml:"h:SharedMAC"`
+	SharedStaticIp bool     `xml:"h:SharedStaticIp"`
+	IpSyncEnabled  bool     `xml:"h:IpSyncEnabled"`
+	DHCPEnabled    bool     `xml:"h:DHCPEnabled"`
+	IPAddress      string   `xml:"h:IPAddress,omitempty"`
+	SubnetMask     string   `xml:"h:SubnetMask,omitempty"`
+	DefaultGateway string   `xml:"h:DefaultGateway,omitempty"`
+	PrimaryDNS     string   `xml:"h:PrimaryDNS,omitempty"`
+	SecondaryDNS   string   `xml:"h:SecondaryDNS,omitempty"`
+}
+
+type ieee8021xSettingsResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		IEEE8021xSettings struct {
+			ElementName            string `xml:"ElementName"`
+			InstanceID             string `xml:"InstanceID"`
+			Enabled                int    `xml:"Enabled"`
+			AuthenticationProtocol int    `xml:"AuthenticationProtocol"`
+			Username               string `xml:"Username"`
+		} `xml:"IPS_IEEE8021xSettings"`
+		SetCertificates_OUTPUT struct {
+			ReturnValue int `xml:"ReturnValue"`
+		} `xml:"SetCertificates_OUTPUT"`
+	} `xml:"Body"`
+}
+
+type ieee8021xSettingsPut struct {
+	XMLName                xml.Name                           `xml:"h:IPS_IEEE8021xSettings"`
+	H                      string                             `xml:"xmlns:h,attr"`
+	ElementName            string                             `xml:"h:ElementName"`
+	InstanceID             string                             `xml:"h:InstanceID"`
+	Enabled                ieee8021x.IEEE8021xSettingsEnabled `xml:"h:Enabled"`
+	AvailableInS0          bool                               `xml:"h:AvailableInS0"`
+	AuthenticationProtocol models.AuthenticationProtocol      `xml:"h:AuthenticationProtocol"`
+	Username               string                             `xml:"h:Username,omitempty"`
+	Password               string                             `xml:"h:Password,omitempty"`
+}
+
+func (service *ProvisioningService) ConfigureWired() utils.ReturnCode {
+	log.Info("configuring wired network settings")
+	cfg := service.flags.LocalConfig.Wired
+	rc := service.PutEthernetPortSettings(cfg)
+	if rc != utils.Success {
+		return rc
+	}
+	if cfg.Ieee8021xProfileName != "" {
+		rc = service.ConfigureWiredIeee8021x(cfg.Ieee8021xProfileName)
+		if rc != utils.Success {
+			return rc
+		}
+	}
+	log.Info("configuring wired network settings completed successfully")
+	return utils.Success
+}
+
+func (service *ProvisioningService) getEthernetPortSettings() (ethernetPortSettings, utils.ReturnCode) {
+	var getRsp ethernetPortSettingsResponse
+	rc := service.PostAndUnmarshal(service.amtMessages.EthernetPortSettings.Get(), &getRsp)
+	if rc != utils.Success {
+		return ethernetPortSettings{}, rc
+	}
+	current := getRsp.Body.EthernetPortSettings
+	if current.InstanceID != WiredInstanceId {
+		log.Errorf("unexpected ethernet port settings: %s", current.InstanceID)
+		return current, utils.NetworkConfigurationFailed
+	}
+	return current, utils.Success
+}
+
+func (service *ProvisioningService) PutEthernetPortSettings(cfg config.WiredConfig) utils.ReturnCode {
+	current, rc := service.getEthernetPortSettings()
+	if rc != utils.Success {
+		return rc
+	}
+	return service.putEthernetPortSettings(current, cfg)
+}
+
+func (service *ProvisioningService) putEthernetPortSettings(current ethernetPortSettings, cfg config.WiredConfig) utils.ReturnCode {
+	settings := getEthernetPortSettingsPutData(current, cfg)
+	if cfg.DHCP {
+		log.Info("configuring wired IP address from DHCP")
+	} else if cfg.IPSync {
+		log.Info("configuring wired static IP address synchronized with the OS")
+	} else {
+		log.Infof("configuring wired static IP address %s", cfg.IPAddress)
+	}
+	var putRsp ethernetPortSettingsResponse
+	xmlMsg, err := putMessage(service.amtMessages.EthernetPortSettings.Put(ethernetport.EthernetPortSettings{}), settings, settings.InstanceID)
+	if err != nil {
+		log.Error(err)
+		return utils.WSMANMessageError
+	}
+	rc := service.PostAndUnmarshal(xmlMsg, &putRsp)
+	if rc != utils.Success {
+		return rc
+	}
+	updated := putRsp.Body.EthernetPortSettings
+	if updated.DHCPEnabled != settings.DHCPEnabled || updated.IpSyncEnabled != settings.IpSyncEnabled {
+		log.Error("AMT did not apply the wired network settings")
+		return utils.NetworkConfigurationFailed
+	}
+	return utils.Success
+}
+
+func getEthernetPortSettingsPutData(current ethernetPortSettings, cfg config.WiredConfig) ethernetPortSettingsPut {
+	settings := ethernetPortSettingsPut{
+		H:             "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EthernetPortSettings",
+		ElementName:   current.ElementName,
+		InstanceID:    current.InstanceID,
+		SharedMAC:     current.SharedMAC,
+		DHCPEnabled:   cfg.DHCP,
+		IpSyncEnabled: cfg.DHCP || cfg.IPSync,
+	}
+	// a static address shared with the OS comes from the OS, otherwise it is set here
+	if !cfg.DHCP {
+		settings.SharedStaticIp = cfg.IPSync
+		if !cfg.IPSync {
+			settings.IPAddress = cfg.IPAddress
+			settings.SubnetMask = cfg.SubnetMask
+			settings.DefaultGateway = cfg.Gateway
+			settings.PrimaryDNS = cfg.PrimaryDNS
+			settings.SecondaryDNS = cfg.SecondaryDNS
+		}
+	}
+	return settings
+}
+
+func (service *ProvisioningService) ConfigureWiredIeee8021x(profileName string) utils.ReturnCode {
+	log.Info("configuring wired 802.1x profile: ", profileName)
+	handles := Handles{}
+	settings := models.IEEE8021xSettings{}
+	rc := service.ProcessIeee8012xConfig(profileName, &settings, &handles)
+	if rc != utils.Success {
+		service.RollbackAddedItems(&handles)
+		return rc
+	}
+	var getRsp ieee8021xSettingsResponse
+	rc = service.PostAndUnmarshal(service.ipsMessages.IEEE8021xSettings.Get(), &getRsp)
+	if rc != utils.Success {
+		service.RollbackAddedItems(&handles)
+		return rc
+	}
+	current := getRsp.Body.IEEE8021xSettings
+	putData := ieee8021xSettingsPut{
+		H:                      "http://intel.com/wbem/wscim/1/ips-schema/1/IPS_IEEE8021xSettings",
+		ElementName:            current.ElementName,
+		InstanceID:             current.InstanceID,
+		Enabled:                ieee8021x.EnabledWithCertificates,
+		AvailableInS0:          true,
+		AuthenticationProtocol: settings.AuthenticationProtocol,
+		Username:               settings.Username,
+		Password:               settings.Password,
+	}
+	xmlMsg, err := putMessage(service.ipsMessages.IEEE8021xSettings.Put(ieee8021x.IEEE8021xSettings{}), putData, current.InstanceID)
+	if err != nil {
+		log.Error(err)
+		service.RollbackAddedItems(&handles)
+		return utils.WSMANMessageError
+	}
+	var putRsp ieee8021xSettingsResponse
+	rc = service.PostAndUnmarshal(xmlMsg, &putRsp)
+	if rc != utils.Success {
+		service.RollbackAddedItems(&handles)
+		return rc
+	}
+	xmlMsg = service.ipsMessages.IEEE8021xSettings.SetCertificates(handles.rootCertHandle, handles.clientCertHandle)
+	var certsRsp ieee8021xSettingsResponse
+	rc = service.PostAndUnmarshal(xmlMsg, &certsRsp)
+	if rc != utils.Success {
+		service.RollbackAddedItems(&handles)
+		return rc
+	}
+	rc = utils.ReturnCode(certsRsp.Body.SetCertificates_OUTPUT.ReturnValue)
+	if rc != utils.Success {
+		service.RollbackAddedItems(&handles)
+		log.Errorf("SetCertificates_OUTPUT.ReturnValue: %d", rc)
+		return utils.AmtPtStatusCodeBase + rc
+	}
+	return utils.Success
+}
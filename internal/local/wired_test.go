@@ -0,0 +1,186 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/config"
+	"github.com/jc-lab/intel-amt-host-api/internal/flags"
+	"github.com/jc-lab/intel-amt-host-api/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const ethernetPortSettingsXML = `<h:AMT_EthernetPortSettings><h:DHCPEnabled>%t</h:DHCPEnabled><h:ElementName>Intel(r) AMT Ethernet Port Settings</h:ElementName><h:InstanceID>%s</h:InstanceID><h:IpSyncEnabled>%t</h:IpSyncEnabled><h:SharedMAC>true</h:SharedMAC></h:AMT_EthernetPortSettings>`
+
+func ethernetPortSettingsXMLResponse(instanceID string, dhcp bool, ipSync bool) string {
+	return wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EthernetPortSettings", fmt.Sprintf(ethernetPortSettingsXML, dhcp, instanceID, ipSync))
+}
+
+var ieee8021xSettingsXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/ips-schema/1/IPS_IEEE8021xSettings", `<h:IPS_IEEE8021xSettings><h:ElementName>Intel(r) AMT: IEEE 802.1x Settings</h:ElementName><h:InstanceID>Intel(r) AMT: IEEE 802.1x Settings</h:InstanceID></h:IPS_IEEE8021xSettings>`)
+
+var setCertificatesXMLResponse = wsmanEnvelope("http://intel.com/wbem/wscim/1/ips-schema/1/IPS_IEEE8021xSettings", `<h:SetCertificates_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:SetCertificates_OUTPUT>`)
+
+var wiredCfgStatic = config.WiredConfig{
+	IPAddress:  "192.168.1.10",
+	SubnetMask: "255.255.255.0",
+	Gateway:    "192.168.1.1",
+	PrimaryDNS: "192.168.1.2",
+}
+
+func TestConfigureWired(t *testing.T) {
+	t.Run("expect Success for dhcp", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Wired = config.WiredConfig{DHCP: true, IPSync: true}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false), &requests),
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[1], `<h:AMT_EthernetPortSettings xmlns:h="http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EthernetPortSettings">`)
+		assert.Contains(t, requests[1], `<w:Selector Name="InstanceID">Intel(r) AMT Ethernet Port Settings 0</w:Selector>`)
+		assert.Contains(t, requests[1], "<h:DHCPEnabled>true</h:DHCPEnabled>")
+		assert.Contains(t, requests[1], "<h:IpSyncEnabled>true</h:IpSyncEnabled>")
+		assert.NotContains(t, requests[1], "IPAddress")
+	})
+	t.Run("expect Success for static", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Wired = wiredCfgStatic
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true), &requests),
+			respondCaptureFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[1], "<h:IPAddress>192.168.1.10</h:IPAddress>")
+		assert.Contains(t, requests[1], "<h:DefaultGateway>192.168.1.1</h:DefaultGateway>")
+	})
+	t.Run("expect error at Get", func(t *testing.T) {
+		f := &flags.Flags{}
+		lps := setupWsmanResponses(t, f, ResponseFuncArray{})
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.WSMANMessageError, rc)
+	})
+	t.Run("expect NetworkConfigurationFailed for a wireless port", func(t *testing.T) {
+		f := &flags.Flags{}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, ethernetPortSettingsXMLResponse("Intel(r) AMT Ethernet Port Settings 1", true, true)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.NetworkConfigurationFailed, rc)
+	})
+	t.Run("expect NetworkConfigurationFailed when the settings are not applied", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Wired = config.WiredConfig{DHCP: true, IPSync: true}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false)),
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, false, false)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.NetworkConfigurationFailed, rc)
+	})
+	t.Run("expect Success with 802.1x profile", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Wired = config.WiredConfig{DHCP: true, IPSync: true, Ieee8021xProfileName: ieee8021xCfgEAPTLS.ProfileName}
+		f.LocalConfig.Ieee8021xConfigs = config.Ieee8021xConfigs{ieee8021xCfgEAPTLS}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+			respondStringFunc(t, addKeyXMLResponse),
+			respondStringFunc(t, clientCertXMLResponse),
+			respondStringFunc(t, trustedRootXMLResponse),
+			respondStringFunc(t, ieee8021xSettingsXMLResponse),
+			respondCaptureFunc(t, wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EthernetPortSettings", ""), &requests),
+			respondCaptureFunc(t, fmt.Sprintf(setCertificatesXMLResponse, 0), &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.Success, rc)
+		assert.Contains(t, requests[0], `<h:IPS_IEEE8021xSettings xmlns:h="http://intel.com/wbem/wscim/1/ips-schema/1/IPS_IEEE8021xSettings">`)
+		assert.Contains(t, requests[0], `<w:Selector Name="InstanceID">Intel(r) AMT: IEEE 802.1x Settings</w:Selector>`)
+		assert.Contains(t, requests[0], "<h:Enabled>2</h:Enabled>")
+		assert.Contains(t, requests[0], "<h:Username>"+ieee8021xCfgEAPTLS.Username+"</h:Username>")
+		assert.Contains(t, requests[1], "<h:ServerCertificateIssuer>Intel(r) AMT Certificate: Handle: 2</h:ServerCertificateIssuer>")
+		assert.Contains(t, requests[1], "<h:ClientCertificate>Intel(r) AMT Certificate: Handle: 1</h:ClientCertificate>")
+	})
+	t.Run("expect rollback when SetCertificates fails", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Wired = config.WiredConfig{DHCP: true, IPSync: true, Ieee8021xProfileName: ieee8021xCfgEAPTLS.ProfileName}
+		f.LocalConfig.Ieee8021xConfigs = config.Ieee8021xConfigs{ieee8021xCfgEAPTLS}
+		var requests []string
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+			respondStringFunc(t, addKeyXMLResponse),
+			respondStringFunc(t, clientCertXMLResponse),
+			respondStringFunc(t, trustedRootXMLResponse),
+			respondStringFunc(t, ieee8021xSettingsXMLResponse),
+			respondStringFunc(t, wsmanEnvelope("http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EthernetPortSettings", "")),
+			respondStringFunc(t, fmt.Sprintf(setCertificatesXMLResponse, 1)),
+			respondCaptureFunc(t, "", &requests),
+			respondCaptureFunc(t, "", &requests),
+			respondCaptureFunc(t, "", &requests),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.AmtPtStatusCodeBase+1, rc)
+		assert.Len(t, requests, 3)
+		assert.Contains(t, requests[0], "Intel(r) AMT Key: Handle: 0")
+		assert.Contains(t, requests[1], "Intel(r) AMT Certificate: Handle: 1")
+		assert.Contains(t, requests[2], "Intel(r) AMT Certificate: Handle: 2")
+	})
+	t.Run("expect MissingIeee8021xConfiguration for unknown profile", func(t *testing.T) {
+		f := &flags.Flags{}
+		f.LocalConfig.Wired = config.WiredConfig{DHCP: true, IPSync: true, Ieee8021xProfileName: "unknown"}
+		rfa := ResponseFuncArray{
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+			respondStringFunc(t, ethernetPortSettingsXMLResponse(WiredInstanceId, true, true)),
+		}
+		lps := setupWsmanResponses(t, f, rfa)
+		rc := lps.ConfigureWired()
+		assert.Equal(t, utils.MissingIeee8021xConfiguration, rc)
+	})
+}
+
+func TestGetEthernetPortSettingsPutData(t *testing.T) {
+	current := ethernetPortSettings{
+		ElementName: "Intel(r) AMT Ethernet Port Settings",
+		InstanceID:  WiredInstanceId,
+		SharedMAC:   true,
+		IPAddress:   "10.0.0.5",
+	}
+	t.Run("expect ip sync for dhcp", func(t *testing.T) {
+		settings := getEthernetPortSettingsPutData(current, config.WiredConfig{DHCP: true})
+		assert.True(t, settings.DHCPEnabled)
+		assert.True(t, settings.IpSyncEnabled)
+		assert.False(t, settings.SharedStaticIp)
+		assert.Equal(t, "", settings.IPAddress)
+		assert.Equal(t, WiredInstanceId, settings.InstanceID)
+		assert.True(t, settings.SharedMAC)
+	})
+	t.Run("expect shared static ip for static with ip sync", func(t *testing.T) {
+		settings := getEthernetPortSettingsPutData(current, config.WiredConfig{IPSync: true, IPAddress: "192.168.1.10"})
+		assert.False(t, settings.DHCPEnabled)
+		assert.True(t, settings.IpSyncEnabled)
+		assert.True(t, settings.SharedStaticIp)
+		assert.Equal(t, "", settings.IPAddress)
+	})
+	t.Run("expect addresses for static", func(t *testing.T) {
+		settings := getEthernetPortSettingsPutData(current, wiredCfgStatic)
+		assert.False(t, settings.DHCPEnabled)
+		assert.False(t, settings.IpSyncEnabled)
+		assert.False(t, settings.SharedStaticIp)
+		assert.Equal(t, "192.168.1.10", settings.IPAddress)
+		assert.Equal(t, "255.255.255.0", settings.SubnetMask)
+		assert.Equal(t, "192.168.1.1", settings.DefaultGateway)
+		assert.Equal(t, "192.168.1.2", settings.PrimaryDNS)
+	})
+}
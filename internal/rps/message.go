@@ -7,6 +7,7 @@ package rps
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"github.com/jc-lab/intel-amt-host-api/internal/amt"
@@ -76,17 +77,19 @@ func (p Payload) createPayload(dnsSuffix string, hostname string, amtTimeout tim
 	if wired.LinkStatus != "up" {
 		log.Warn("link status is down, unable to activate AMT in Admin Control Mode (ACM)")
 	}
-	payload.Version, err = p.AMT.GetVersionDataFromME("AMT", amtTimeout)
+	versions, err := p.AMT.GetAllCodeVersions(amtTimeout)
 	if err != nil {
 		return payload, err
 	}
-	payload.Build, err = p.AMT.GetVersionDataFromME("Build Number", amtTimeout)
-	if err != nil {
-		return payload, err
-	}
-	payload.SKU, err = p.AMT.GetVersionDataFromME("Sku", amtTimeout)
-	if err != nil {
-		return payload, err
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{{"AMT", &payload.Version}, {"Build Number", &payload.Build}, {"Sku", &payload.SKU}} {
+		version, ok := versions.Get(field.key)
+		if !ok {
+			return payload, errors.New(field.key + " Not Found")
+		}
+		*field.value = version
 	}
 
 	payload.Features = local.DecodeAMT(payload.Version, payload.SKU)
@@ -26,6 +26,7 @@ var osDNSSuffix string = "osdns"
 var controlMode int = 0
 var err error = nil
 var mode int = 0
+var codeVersionsCalls int
 
 func (c MockAMT) Initialize() (utils.ReturnCode, error) {
 	return utils.Success, nil
@@ -33,6 +34,14 @@ func (c MockAMT) Initialize() (utils.ReturnCode, error) {
 func (c MockAMT) GetVersionDataFromME(key string, amtTimeout time.Duration) (string, error) {
 	return "Version", nil
 }
+func (c MockAMT) GetAllCodeVersions(amtTimeout time.Duration) (amt.FirmwareVersions, error) {
+	codeVersionsCalls++
+	return amt.FirmwareVersions{Versions: []amt.FirmwareVersion{
+		{Description: "AMT", Version: "Version"},
+		{Description: "Build Number", Version: "Version"},
+		{Description: "Sku", Version: "Version"},
+	}}, nil
+}
 func (c MockAMT) GetChangeEnabled() (amt.ChangeEnabledResponse, error) {
 	return amt.ChangeEnabledResponse(0x01), nil
 }
@@ -59,6 +68,26 @@ func (c MockAMT) GetLocalSystemAccount() (amt.LocalSystemAccount, error) {
 func (c MockAMT) Unprovision() (int, error) {
 	return mode, nil
 }
+func (c MockAMT) GetSecurityParameters() (amt.SecurityParameters, error) {
+	return amt.SecurityParameters{}, nil
+}
+func (c MockAMT) GetMACAddresses() (amt.MACAddresses, error) {
+	return amt.MACAddresses{}, nil
+}
+func (c MockAMT) GetProvisioningState() (int, error) { return 0, nil }
+func (c MockAMT) GetDNSSuffixList() ([]string, error) { return []string{}, nil }
+func (c MockAMT) SetEnterpriseAccess(hostIPAddress string, enterpriseAccess bool) error {
+	return nil
+}
+func (c MockAMT) GenerateRNGSeed() error { return nil }
+func (c MockAMT) GetRNGSeedStatus() (amt.RNGSeedStatus, error) {
+	return amt.RNGSeedExists, nil
+}
+func (c MockAMT) SetPkiFQDNSuffix(suffix string) error { return nil }
+func (c MockAMT) StartConfigurationHBased(serverCertHash []byte, dnsSuffixes []string) (amt.CertHashEntry, error) {
+	return amt.CertHashEntry{}, nil
+}
+func (c MockAMT) StopConfiguration() error { return nil }
 
 var p Payload
 
@@ -71,7 +100,9 @@ func init() {
 }
 func TestCreatePayload(t *testing.T) {
 	mebxDNSSuffix = "mebxdns"
+	calls := codeVersionsCalls
 	result, err := p.createPayload("", "", 0)
+	assert.Equal(t, calls+1, codeVersionsCalls)
 	assert.Equal(t, "Version", result.Version)
 	assert.Equal(t, "Version", result.Build)
 	assert.Equal(t, "Version", result.SKU)
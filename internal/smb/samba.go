@@ -49,7 +49,7 @@ func (s *Service) FetchFileContents(url string) ([]byte, error) {
 	log.Infof("fetching remote file server: %s:%s, user: %s, pwd: %s, domain: %s, share: %s, path: %s",
 		p.Host, p.Port, p.User, pwdOutput, p.Domain, p.ShareName, p.FilePath)
 
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%s", p.Host, p.Port))
+	conn, err := net.Dial("tcp", net.JoinHostPort(p.Host, p.Port))
 	if err != nil {
 		return contents, err
 	}
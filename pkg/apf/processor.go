@@ -9,7 +9,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -23,6 +22,13 @@ func Process(data []byte, session *LMESession) bytes.Buffer {
 		dataToSend = ProcessGlobalRequest(data)
 	case APF_CHANNEL_OPEN: // (90) Sent by Intel AMT when a channel needs to be open from Intel AMT. This is not common, but WSMAN events are a good example of channel coming from AMT.
 		log.Debug("received APF_CHANNEL_OPEN")
+		// a session only relays our own requests, channels from AMT are served by the lms command
+		request, err := ParseChannelOpen(data)
+		if err != nil {
+			log.Warn(err)
+			break
+		}
+		dataToSend = ChannelOpenReplyFailure(request.SenderChannel, OPEN_FAILURE_REASON_ADMINISTRATIVELY_PROHIBITED)
 	case APF_DISCONNECT: // (1) Intel AMT wants to completely disconnect. Not sure when this happens.
 		log.Debug("received APF_DISCONNECT")
 	case APF_SERVICE_REQUEST: // (5)
@@ -38,7 +44,10 @@ func Process(data []byte, session *LMESession) bytes.Buffer {
 		log.Debug("received APF_CHANNEL_CLOSE")
 		ProcessChannelClose(data, session)
 	case APF_CHANNEL_DATA: // (94) Intel AMT is sending data that we must relay into an LMS TCP connection.
-		ProcessChannelData(data, session)
+		windowAdjust := ProcessChannelData(data, session)
+		if windowAdjust.BytesToAdd > 0 {
+			dataToSend = windowAdjust
+		}
 	case APF_CHANNEL_WINDOW_ADJUST: // 93
 		log.Debug("received APF_CHANNEL_WINDOW_ADJUST")
 		ProcessChannelWindowAdjust(data, session)
@@ -59,6 +68,9 @@ func ProcessChannelWindowAdjust(data []byte, session *LMESession) {
 	dataBuffer := bytes.NewBuffer(data)
 	binary.Read(dataBuffer, binary.BigEndian, &adjustMessage)
 	session.TXWindow += adjustMessage.BytesToAdd
+	if channel := session.channel(adjustMessage.RecipientChannel); channel != nil {
+		channel.AddTXWindow(adjustMessage.BytesToAdd)
+	}
 	log.Tracef("%+v", adjustMessage)
 }
 func ProcessChannelClose(data []byte, session *LMESession) APF_CHANNEL_CLOSE_MESSAGE {
@@ -66,28 +78,45 @@ func ProcessChannelClose(data []byte, session *LMESession) APF_CHANNEL_CLOSE_MES
 	dataBuffer := bytes.NewBuffer(data)
 	binary.Read(dataBuffer, binary.BigEndian, &closeMessage)
 	log.Tracef("%+v", closeMessage)
-	// session.DataBuffer <- session.Tempdata
-	// session.Tempdata = []byte{}
+	if session.Channels != nil {
+		session.Channels.Remove(closeMessage.RecipientChannel)
+	}
 	close := ChannelClose(closeMessage.RecipientChannel)
 	return close
 }
 func ProcessGlobalRequest(data []byte) interface{} {
+	genericHeader, tcpForwardRequest := ParseGlobalRequest(data)
+
+	var reply interface{}
+	if genericHeader.String == APF_GLOBAL_REQUEST_STR_TCP_FORWARD_REQUEST {
+		if tcpForwardRequest.Port == 16992 || tcpForwardRequest.Port == 16993 {
+			reply = TcpForwardReplySuccess(tcpForwardRequest.Port)
+		} else {
+			reply = uint8(APF_REQUEST_FAILURE)
+		}
+	} else if genericHeader.String == APF_GLOBAL_REQUEST_STR_TCP_FORWARD_CANCEL_REQUEST {
+		reply = uint8(APF_REQUEST_SUCCESS)
+	}
+	return reply
+}
+
+// ParseGlobalRequest decodes the request string of an APF_GLOBAL_REQUEST and,
+// for tcpip-forward and cancel-tcpip-forward, the address and port to forward.
+func ParseGlobalRequest(data []byte) (APF_GENERIC_HEADER, APF_TCP_FORWARD_REQUEST) {
 	genericHeader := APF_GENERIC_HEADER{}
+	tcpForwardRequest := APF_TCP_FORWARD_REQUEST{}
 	dataBuffer := bytes.NewBuffer(data)
 
 	binary.Read(dataBuffer, binary.BigEndian, &genericHeader.MessageType)
 	binary.Read(dataBuffer, binary.BigEndian, &genericHeader.StringLength)
 
-	var reply interface{}
-	if int(genericHeader.StringLength) > 0 {
+	if int(genericHeader.StringLength) > 0 && int(genericHeader.StringLength) <= dataBuffer.Len() {
 		stringBuffer := make([]byte, genericHeader.StringLength)
-		tcpForwardRequest := APF_TCP_FORWARD_REQUEST{}
-
 		binary.Read(dataBuffer, binary.BigEndian, &stringBuffer)
 		genericHeader.String = string(stringBuffer[:int(genericHeader.StringLength)])
 		binary.Read(dataBuffer, binary.BigEndian, &tcpForwardRequest.WantReply)
 		binary.Read(dataBuffer, binary.BigEndian, &tcpForwardRequest.AddressLength)
-		if int(tcpForwardRequest.AddressLength) > 0 {
+		if int(tcpForwardRequest.AddressLength) > 0 && int(tcpForwardRequest.AddressLength) <= dataBuffer.Len() {
 			addressBuffer := make([]byte, tcpForwardRequest.AddressLength)
 			binary.Read(dataBuffer, binary.BigEndian, &addressBuffer)
 			tcpForwardRequest.Address = string(addressBuffer[:int(tcpForwardRequest.AddressLength)])
@@ -95,47 +124,40 @@ func ProcessGlobalRequest(data []byte) interface{} {
 		binary.Read(dataBuffer, binary.BigEndian, &tcpForwardRequest.Port)
 		log.Tracef("%+v", genericHeader)
 		log.Tracef("%+v", tcpForwardRequest)
-
-		if genericHeader.String == APF_GLOBAL_REQUEST_STR_TCP_FORWARD_REQUEST {
-			if tcpForwardRequest.Port == 16992 || tcpForwardRequest.Port == 16993 {
-				reply = TcpForwardReplySuccess(tcpForwardRequest.Port)
-			} else {
-				reply = APF_REQUEST_FAILURE
-			}
-		} else if genericHeader.String == APF_GLOBAL_REQUEST_STR_TCP_FORWARD_CANCEL_REQUEST {
-			reply = APF_REQUEST_SUCCESS
-		}
 	}
-	return reply
+	return genericHeader, tcpForwardRequest
 }
-func ProcessChannelData(data []byte, session *LMESession) {
+
+// ProcessChannelData buffers the data AMT sent and returns the window adjust
+// to send back, which is empty while no adjust is due
+func ProcessChannelData(data []byte, session *LMESession) APF_CHANNEL_WINDOW_ADJUST_MESSAGE {
 	channelData := APF_CHANNEL_DATA_MESSAGE{}
 	buf2 := bytes.NewBuffer(data)
 
 	binary.Read(buf2, binary.BigEndian, &channelData.MessageType)
 	binary.Read(buf2, binary.BigEndian, &channelData.RecipientChannel)
 	binary.Read(buf2, binary.BigEndian, &channelData.DataLength)
+	if int(channelData.DataLength) > buf2.Len() {
+		log.Warn("truncated APF_CHANNEL_DATA message")
+		channelData.DataLength = uint32(buf2.Len())
+	}
 	session.RXWindow = channelData.DataLength
 	dataBuffer := make([]byte, channelData.DataLength)
 	binary.Read(buf2, binary.BigEndian, &dataBuffer)
-	//log.Debug("received APF_CHANNEL_DATA - " + fmt.Sprint(channelData.DataLength))
-	//log.Tracef("%+v", channelData)
 
 	session.Tempdata = append(session.Tempdata, dataBuffer[:channelData.DataLength]...)
-	// var windowAdjust APF_CHANNEL_WINDOW_ADJUST_MESSAGE
-	// if session.RXWindow > 1024 { // TODO: Check this
-	// 	windowAdjust = ChannelWindowAdjust(channelData.RecipientChannel, session.RXWindow)
-	// 	session.RXWindow = 0
-	// }
-	session.Timer.Reset(3 * time.Second)
-	// var windowAdjust APF_CHANNEL_WINDOW_ADJUST_MESSAGE
-	// if session.RXWindow > 1024 { // TODO: Check this
-	// 	windowAdjust = ChannelWindowAdjust(channelData.RecipientChannel, session.RXWindow)
-	// 	session.RXWindow = 0
-	// }
-	// // log.Tracef("%+v", session)
-	// return windowAdjust
-	//return windowAdjust
+
+	// the data is consumed as soon as it is buffered, so the window can be returned right away
+	var windowAdjust APF_CHANNEL_WINDOW_ADJUST_MESSAGE
+	if channel := session.channel(channelData.RecipientChannel); channel != nil {
+		if !channel.Received(channelData.DataLength) {
+			log.Warn("AMT exceeded the receive window on channel ", channelData.RecipientChannel)
+		}
+		if bytesToAdd := channel.Consumed(channelData.DataLength); bytesToAdd > 0 {
+			windowAdjust = ChannelWindowAdjust(channel.RemoteChannel(), bytesToAdd)
+		}
+	}
+	return windowAdjust
 }
 func ProcessServiceRequest(data []byte) APF_SERVICE_ACCEPT_MESSAGE {
 	service := 0
@@ -176,6 +198,9 @@ func ProcessChannelOpenConfirmation(data []byte, session *LMESession) {
 	session.SenderChannel = confirmationMessage.SenderChannel
 	session.RecipientChannel = confirmationMessage.RecipientChannel
 	session.TXWindow = confirmationMessage.InitialWindowSize
+	if channel := session.channel(confirmationMessage.RecipientChannel); channel != nil {
+		channel.Confirm(confirmationMessage.SenderChannel, confirmationMessage.InitialWindowSize)
+	}
 	session.Status <- true
 }
 func ProcessChannelOpenFailure(data []byte, session *LMESession) {
@@ -199,7 +224,7 @@ func ProcessProtocolVersion(data []byte) APF_PROTOCOL_VERSION_MESSAGE {
 func ServiceAccept(serviceName string) APF_SERVICE_ACCEPT_MESSAGE {
 	log.Debug("sending APF_SERVICE_ACCEPT_MESSAGE")
 	var test [18]byte
-	copy(test[:], []byte(serviceName)[:18])
+	copy(test[:], serviceName)
 	serviceAcceptMessage := APF_SERVICE_ACCEPT_MESSAGE{
 		MessageType:       APF_SERVICE_ACCEPT,
 		ServiceNameLength: 18,
@@ -231,6 +256,11 @@ func TcpForwardReplySuccess(port uint32) APF_TCP_FORWARD_REPLY_MESSAGE {
 }
 
 func ChannelOpen(senderChannel int) bytes.Buffer {
+	return ChannelOpenPort(senderChannel, 16992)
+}
+
+// ChannelOpenPort opens a forwarded-tcpip channel to the given AMT port
+func ChannelOpenPort(senderChannel int, port uint32) bytes.Buffer {
 	var channelType [15]byte
 	copy(channelType[:], []byte(APF_OPEN_CHANNEL_REQUEST_FORWARDED)[:15])
 	var address [3]byte
@@ -244,7 +274,7 @@ func ChannelOpen(senderChannel int) bytes.Buffer {
 		InitialWindowSize:         LME_RX_WINDOW_SIZE,
 		ConnectedAddressLength:    3,
 		ConnectedAddress:          address,
-		ConnectedPort:             16992,
+		ConnectedPort:             port,
 		OriginatorIPAddressLength: 3,
 		OriginatorIPAddress:       address,
 		OriginatorPort:            123,
@@ -255,6 +285,73 @@ func ChannelOpen(senderChannel int) bytes.Buffer {
 	return bin_buf
 }
 
+// ParseChannelOpen parses an APF_CHANNEL_OPEN sent by AMT
+func ParseChannelOpen(data []byte) (ChannelOpenRequest, error) {
+	request := ChannelOpenRequest{}
+	buf := bytes.NewBuffer(data)
+	var messageType uint8
+	if err := binary.Read(buf, binary.BigEndian, &messageType); err != nil || messageType != APF_CHANNEL_OPEN {
+		return request, errors.New("not an APF_CHANNEL_OPEN message")
+	}
+	readString := func() (string, error) {
+		var length uint32
+		if err := binary.Read(buf, binary.BigEndian, &length); err != nil {
+			return "", err
+		}
+		if int(length) > buf.Len() {
+			return "", errors.New("string exceeds message length")
+		}
+		return string(buf.Next(int(length))), nil
+	}
+	var err error
+	var reserved uint32
+	if request.ChannelType, err = readString(); err == nil {
+		err = binary.Read(buf, binary.BigEndian, &request.SenderChannel)
+	}
+	if err == nil {
+		err = binary.Read(buf, binary.BigEndian, &request.InitialWindowSize)
+	}
+	if err == nil {
+		err = binary.Read(buf, binary.BigEndian, &reserved)
+	}
+	if err == nil {
+		request.ConnectedAddress, err = readString()
+	}
+	if err == nil {
+		err = binary.Read(buf, binary.BigEndian, &request.ConnectedPort)
+	}
+	if err == nil {
+		request.OriginatorAddress, err = readString()
+	}
+	if err == nil {
+		err = binary.Read(buf, binary.BigEndian, &request.OriginatorPort)
+	}
+	if err != nil {
+		return request, fmt.Errorf("malformed APF_CHANNEL_OPEN message: %w", err)
+	}
+	log.Tracef("%+v", request)
+	return request, nil
+}
+
+// EncodeChannelOpen serializes an APF_CHANNEL_OPEN with addresses of any length
+func EncodeChannelOpen(request ChannelOpenRequest) []byte {
+	var bin_buf bytes.Buffer
+	writeString := func(value string) {
+		binary.Write(&bin_buf, binary.BigEndian, uint32(len(value)))
+		bin_buf.WriteString(value)
+	}
+	binary.Write(&bin_buf, binary.BigEndian, uint8(APF_CHANNEL_OPEN))
+	writeString(request.ChannelType)
+	binary.Write(&bin_buf, binary.BigEndian, request.SenderChannel)
+	binary.Write(&bin_buf, binary.BigEndian, request.InitialWindowSize)
+	binary.Write(&bin_buf, binary.BigEndian, uint32(0xFFFFFFFF))
+	writeString(request.ConnectedAddress)
+	binary.Write(&bin_buf, binary.BigEndian, request.ConnectedPort)
+	writeString(request.OriginatorAddress)
+	binary.Write(&bin_buf, binary.BigEndian, request.OriginatorPort)
+	return bin_buf.Bytes()
+}
+
 func ChannelOpenReplySuccess(recipientChannel uint32, senderChannel uint32) APF_CHANNEL_OPEN_CONFIRMATION_MESSAGE {
 	log.Debug("sending APF_CHANNEL_OPEN_CONFIRMATION")
 	message := APF_CHANNEL_OPEN_CONFIRMATION_MESSAGE{}
@@ -5,6 +5,7 @@
 package apf
 
 import (
+	"encoding/binary"
 	"testing"
 	"time"
 
@@ -60,6 +61,32 @@ func TestProcessGlobalRequest(t *testing.T) {
 	result := ProcessGlobalRequest(data)
 	assert.NotNil(t, result)
 }
+func TestParseGlobalRequest(t *testing.T) {
+	data := []byte{0x50,
+		0x00, 0x00, 0x00, 0x0D,
+		0x74, 0x63, 0x70, 0x69, 0x70, 0x2d, 0x66, 0x6f, 0x72, 0x77, 0x61, 0x72, 0x64,
+		0x01,
+		0x00, 0x00, 0x00, 0x07,
+		0x30, 0x2e, 0x30, 0x2e, 0x30, 0x2e, 0x30,
+		0x00, 0x00, 0x42, 0x61}
+
+	header, request := ParseGlobalRequest(data)
+	assert.Equal(t, APF_GLOBAL_REQUEST_STR_TCP_FORWARD_REQUEST, header.String)
+	assert.Equal(t, uint8(1), request.WantReply)
+	assert.Equal(t, "0.0.0.0", request.Address)
+	assert.Equal(t, uint32(16993), request.Port)
+}
+func TestProcessGlobalRequestUnsupportedPort(t *testing.T) {
+	data := []byte{0x50,
+		0x00, 0x00, 0x00, 0x0D,
+		0x74, 0x63, 0x70, 0x69, 0x70, 0x2d, 0x66, 0x6f, 0x72, 0x77, 0x61, 0x72, 0x64,
+		0x01,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x02, 0x6f}
+
+	result := ProcessGlobalRequest(data)
+	assert.Equal(t, uint8(APF_REQUEST_FAILURE), result)
+}
 func TestProcessChannelData(t *testing.T) {
 	data := []byte{0x01,
 		0x00, 0x00, 0x00, 0x00,
@@ -120,6 +147,12 @@ func TestServiceAccept(t *testing.T) {
 	result := ServiceAccept(serviceName)
 	assert.NotNil(t, result)
 }
+func TestServiceAcceptShortName(t *testing.T) {
+	result := ServiceAccept("pfwd@amt.com")
+	assert.Equal(t, uint32(18), result.ServiceNameLength)
+	assert.Equal(t, "pfwd@amt.com", string(result.ServiceName[:12]))
+	assert.Equal(t, make([]byte, 6), result.ServiceName[12:])
+}
 func TestProtocolVersion(t *testing.T) {
 	result := ProtocolVersion(1, 0, 9)
 	assert.NotNil(t, result)
@@ -132,6 +165,50 @@ func TestChannelOpen(t *testing.T) {
 	result := ChannelOpen(1)
 	assert.NotNil(t, result)
 }
+func TestChannelOpenPort(t *testing.T) {
+	result := ChannelOpenPort(1, 16993)
+	message := APF_CHANNEL_OPEN_MESSAGE{}
+	binary.Read(&result, binary.BigEndian, &message)
+	assert.Equal(t, uint32(1), message.SenderChannel)
+	assert.Equal(t, uint32(16993), message.ConnectedPort)
+}
+func TestParseChannelOpen(t *testing.T) {
+	request := ChannelOpenRequest{
+		ChannelType:       APF_OPEN_CHANNEL_REQUEST_FORWARDED,
+		SenderChannel:     3,
+		InitialWindowSize: 2048,
+		ConnectedAddress:  "127.0.0.1",
+		ConnectedPort:     16997,
+		OriginatorAddress: "0.0.0.0",
+		OriginatorPort:    1234,
+	}
+	message := EncodeChannelOpen(request)
+	result, err := ParseChannelOpen(message)
+	assert.NoError(t, err)
+	assert.Equal(t, request, result)
+
+	// ChannelOpenPort uses the same layout
+	open := ChannelOpenPort(5, 16993)
+	result, err = ParseChannelOpen(open.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(5), result.SenderChannel)
+	assert.Equal(t, "::1", result.ConnectedAddress)
+	assert.Equal(t, uint32(16993), result.ConnectedPort)
+
+	_, err = ParseChannelOpen(message[:len(message)-1])
+	assert.Error(t, err)
+	_, err = ParseChannelOpen([]byte{APF_CHANNEL_CLOSE, 0, 0, 0, 1})
+	assert.Error(t, err)
+}
+func TestProcessChannelOpenFromAMT(t *testing.T) {
+	message := EncodeChannelOpen(ChannelOpenRequest{ChannelType: APF_OPEN_CHANNEL_REQUEST_FORWARDED, SenderChannel: 3})
+	result := Process(message, &LMESession{})
+	failure := APF_CHANNEL_OPEN_FAILURE_MESSAGE{}
+	binary.Read(&result, binary.BigEndian, &failure)
+	assert.Equal(t, uint8(APF_CHANNEL_OPEN_FAILURE), failure.MessageType)
+	assert.Equal(t, uint32(3), failure.RecipientChannel)
+	assert.Equal(t, uint32(OPEN_FAILURE_REASON_ADMINISTRATIVELY_PROHIBITED), failure.ReasonCode)
+}
 func TestChannelOpenReplySuccess(t *testing.T) {
 	result := ChannelOpenReplySuccess(0, 1)
 	assert.NotNil(t, result)
@@ -0,0 +1,229 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package apf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// APF_CHANNEL_DATA_HEADER_SIZE is the size of an APF_CHANNEL_DATA message without its data
+const APF_CHANNEL_DATA_HEADER_SIZE = 9
+
+var ErrChannelClosed = errors.New("APF channel closed")
+
+// Channel holds the flow control state of one APF channel. AMT may only
+// send as much data as we granted in our receive window and we may only
+// send as much as AMT granted in its window.
+type Channel struct {
+	ID       uint32 // channel number assigned by us
+	RemoteID uint32 // channel number assigned by AMT
+
+	lock           sync.Mutex
+	txWindow       uint32
+	rxWindow       uint32
+	rxConsumed     uint32
+	windowAdjusted chan struct{}
+	closed         chan struct{}
+	closeOnce      sync.Once
+}
+
+func newChannel(id uint32) *Channel {
+	return &Channel{
+		ID:             id,
+		rxWindow:       LME_RX_WINDOW_SIZE,
+		windowAdjusted: make(chan struct{}, 1),
+		closed:         make(chan struct{}),
+	}
+}
+
+// Confirm records AMT's channel number and initial window from APF_CHANNEL_OPEN_CONFIRMATION
+func (c *Channel) Confirm(remoteID uint32, initialWindowSize uint32) {
+	c.lock.Lock()
+	c.RemoteID = remoteID
+	c.lock.Unlock()
+	c.AddTXWindow(initialWindowSize)
+}
+
+// RemoteChannel returns AMT's channel number once the channel is confirmed
+func (c *Channel) RemoteChannel() uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.RemoteID
+}
+
+// TXWindow is the number of bytes AMT will currently accept
+func (c *Channel) TXWindow() uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.txWindow
+}
+
+// RXWindow is the number of bytes AMT may currently send us
+func (c *Channel) RXWindow() uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.rxWindow
+}
+
+// AddTXWindow applies an APF_CHANNEL_WINDOW_ADJUST from AMT and wakes a blocked sender
+func (c *Channel) AddTXWindow(bytesToAdd uint32) {
+	c.lock.Lock()
+	c.txWindow += bytesToAdd
+	c.lock.Unlock()
+	select {
+	case c.windowAdjusted <- struct{}{}:
+	default:
+	}
+}
+
+// Reserve waits until AMT has granted window and takes up to max bytes of it.
+// It fails when the channel is closed or cancel is closed.
+func (c *Channel) Reserve(max uint32, cancel <-chan struct{}) (uint32, error) {
+	for {
+		c.lock.Lock()
+		window := c.txWindow
+		if window > 0 {
+			if max > window {
+				max = window
+			}
+			c.txWindow -= max
+			c.lock.Unlock()
+			return max, nil
+		}
+		c.lock.Unlock()
+		select {
+		case <-c.windowAdjusted:
+		case <-c.closed:
+			return 0, ErrChannelClosed
+		case <-cancel:
+			return 0, ErrChannelClosed
+		}
+	}
+}
+
+// Send splits data into APF_CHANNEL_DATA messages that fit both AMT's window
+// and maxPayload, waiting for window adjusts as needed, and passes each
+// encoded message to send.
+func (c *Channel) Send(data []byte, maxPayload int, cancel <-chan struct{}, send func(message []byte) error) error {
+	if maxPayload <= 0 {
+		maxPayload = LME_RX_WINDOW_SIZE
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxPayload {
+			n = maxPayload
+		}
+		reserved, err := c.Reserve(uint32(n), cancel)
+		if err != nil {
+			return err
+		}
+		err = send(EncodeChannelData(ChannelData(c.RemoteChannel(), data[:reserved])))
+		if err != nil {
+			return err
+		}
+		data = data[reserved:]
+	}
+	return nil
+}
+
+// Received accounts for data AMT sent on the channel. It returns false if
+// AMT sent more than the window we granted.
+func (c *Channel) Received(n uint32) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if n > c.rxWindow {
+		c.rxWindow = 0
+		return false
+	}
+	c.rxWindow -= n
+	return true
+}
+
+// Consumed marks n received bytes as delivered and returns how many bytes
+// to give back to AMT in an APF_CHANNEL_WINDOW_ADJUST. Adjusts are batched
+// until half the window has been consumed, so zero means none is due yet.
+func (c *Channel) Consumed(n uint32) uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.rxConsumed += n
+	if c.rxConsumed < LME_RX_WINDOW_SIZE/2 {
+		return 0
+	}
+	bytesToAdd := c.rxConsumed
+	c.rxConsumed = 0
+	c.rxWindow += bytesToAdd
+	return bytesToAdd
+}
+
+// Closed is closed once the channel has been removed from its session table
+func (c *Channel) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// SessionTable tracks the open APF channels of an LME session keyed by our channel number
+type SessionTable struct {
+	lock        sync.Mutex
+	channels    map[uint32]*Channel
+	nextChannel uint32
+}
+
+func NewSessionTable() *SessionTable {
+	return &SessionTable{
+		channels:    make(map[uint32]*Channel),
+		nextChannel: 1,
+	}
+}
+
+// Open allocates an unused channel number and starts tracking the channel
+func (t *SessionTable) Open() *Channel {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for t.nextChannel == 0 || t.channels[t.nextChannel] != nil {
+		t.nextChannel++
+	}
+	channel := newChannel(t.nextChannel)
+	t.nextChannel++
+	t.channels[channel.ID] = channel
+	return channel
+}
+
+// Get returns the channel with our channel number id, or nil if it is not open
+func (t *SessionTable) Get(id uint32) *Channel {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.channels[id]
+}
+
+// Remove stops tracking the channel and wakes anything waiting on it
+func (t *SessionTable) Remove(id uint32) {
+	t.lock.Lock()
+	channel, ok := t.channels[id]
+	delete(t.channels, id)
+	t.lock.Unlock()
+	if ok {
+		channel.closeOnce.Do(func() { close(channel.closed) })
+	}
+}
+
+// Len returns the number of open channels
+func (t *SessionTable) Len() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.channels)
+}
+
+// EncodeChannelData serializes an APF_CHANNEL_DATA message, which binary.Write
+// cannot do directly because of its variable length data
+func EncodeChannelData(channelData APF_CHANNEL_DATA_MESSAGE) []byte {
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.BigEndian, channelData.MessageType)
+	binary.Write(&bin_buf, binary.BigEndian, channelData.RecipientChannel)
+	binary.Write(&bin_buf, binary.BigEndian, channelData.DataLength)
+	bin_buf.Write(channelData.Data)
+	return bin_buf.Bytes()
+}
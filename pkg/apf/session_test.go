@@ -0,0 +1,106 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package apf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionTable(t *testing.T) {
+	table := NewSessionTable()
+	first := table.Open()
+	second := table.Open()
+	assert.Equal(t, uint32(1), first.ID)
+	assert.Equal(t, uint32(2), second.ID)
+	assert.Equal(t, 2, table.Len())
+	assert.Equal(t, first, table.Get(1))
+
+	table.Remove(1)
+	assert.Nil(t, table.Get(1))
+	assert.Equal(t, 1, table.Len())
+	select {
+	case <-first.Closed():
+	default:
+		t.Error("expected removed channel to be closed")
+	}
+	assert.Equal(t, uint32(3), table.Open().ID)
+}
+
+func TestChannelSend(t *testing.T) {
+	t.Run("splits data by payload size and window", func(t *testing.T) {
+		channel := NewSessionTable().Open()
+		channel.Confirm(7, 10)
+		messages := [][]byte{}
+		send := func(message []byte) error {
+			messages = append(messages, message)
+			if len(messages) == 2 {
+				channel.AddTXWindow(10)
+			}
+			return nil
+		}
+		err := channel.Send(bytes.Repeat([]byte("x"), 14), 4, nil, send)
+		assert.NoError(t, err)
+		lengths := []uint32{}
+		for _, message := range messages {
+			assert.Equal(t, uint32(7), binary.BigEndian.Uint32(message[1:5]))
+			lengths = append(lengths, binary.BigEndian.Uint32(message[5:9]))
+		}
+		assert.Equal(t, []uint32{4, 4, 4, 2}, lengths)
+		assert.Equal(t, uint32(6), channel.TXWindow())
+	})
+	t.Run("blocks until AMT adjusts the window", func(t *testing.T) {
+		channel := NewSessionTable().Open()
+		channel.Confirm(7, 0)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			channel.AddTXWindow(5)
+		}()
+		sent := 0
+		err := channel.Send([]byte("hello"), 100, nil, func(message []byte) error {
+			sent += len(message) - APF_CHANNEL_DATA_HEADER_SIZE
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, sent)
+	})
+	t.Run("fails when the channel is closed while waiting", func(t *testing.T) {
+		table := NewSessionTable()
+		channel := table.Open()
+		go table.Remove(channel.ID)
+		err := channel.Send([]byte("hello"), 100, nil, func(message []byte) error { return nil })
+		assert.Equal(t, ErrChannelClosed, err)
+	})
+}
+
+func TestChannelReceiveWindow(t *testing.T) {
+	channel := NewSessionTable().Open()
+	assert.True(t, channel.Received(1000))
+	assert.Equal(t, uint32(0), channel.Consumed(1000))
+	assert.True(t, channel.Received(3000))
+	assert.Equal(t, uint32(96), channel.RXWindow())
+	assert.Equal(t, uint32(4000), channel.Consumed(3000))
+	assert.Equal(t, uint32(LME_RX_WINDOW_SIZE), channel.RXWindow())
+	assert.False(t, channel.Received(LME_RX_WINDOW_SIZE+1))
+}
+
+func TestProcessChannelDataWindowAdjust(t *testing.T) {
+	session := &LMESession{Channels: NewSessionTable()}
+	channel := session.Channels.Open()
+	channel.Confirm(9, LME_RX_WINDOW_SIZE)
+	payload := bytes.Repeat([]byte("x"), LME_RX_WINDOW_SIZE)
+
+	result := Process(EncodeChannelData(ChannelData(channel.ID, payload)), session)
+	adjust := APF_CHANNEL_WINDOW_ADJUST_MESSAGE{}
+	binary.Read(&result, binary.BigEndian, &adjust)
+	assert.Equal(t, uint8(APF_CHANNEL_WINDOW_ADJUST), adjust.MessageType)
+	assert.Equal(t, uint32(9), adjust.RecipientChannel)
+	assert.Equal(t, uint32(LME_RX_WINDOW_SIZE), adjust.BytesToAdd)
+	assert.Equal(t, payload, session.Tempdata)
+}
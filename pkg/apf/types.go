@@ -241,6 +241,18 @@ type APF_CHANNEL_OPEN_MESSAGE struct {
 	OriginatorPort            uint32
 }
 
+// ChannelOpenRequest is a parsed APF_CHANNEL_OPEN, which unlike the fixed
+// size APF_CHANNEL_OPEN_MESSAGE carries addresses of any length
+type ChannelOpenRequest struct {
+	ChannelType       string
+	SenderChannel     uint32
+	InitialWindowSize uint32
+	ConnectedAddress  string
+	ConnectedPort     uint32
+	OriginatorAddress string
+	OriginatorPort    uint32
+}
+
 type LMESession struct {
 	SenderChannel    uint32
 	RecipientChannel uint32
@@ -251,4 +263,14 @@ type LMESession struct {
 	ErrorBuffer      chan error
 	Status           chan bool
 	Timer            *time.Timer
+	// Channels holds the flow control state of every open channel
+	Channels *SessionTable
+}
+
+// channel returns the tracked channel with our channel number id, if any
+func (session *LMESession) channel(id uint32) *Channel {
+	if session.Channels == nil {
+		return nil
+	}
+	return session.Channels.Get(id)
 }
@@ -0,0 +1,255 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+// Package emulator provides a software MEI that implements heci.Interface.
+// It simulates the PTHI, watchdog and LME firmware clients so that the pthi,
+// amt and lm packages can be exercised without /dev/mei0.
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/heci"
+)
+
+const (
+	PTHIBufferSize     = 5120
+	LMEBufferSize      = 8192
+	WatchdogBufferSize = 512
+)
+
+type client int
+
+const (
+	clientNone client = iota
+	clientPTHI
+	clientLME
+	clientWatchdog
+)
+
+// Firmware is the state shared by every Device opened against it, the same
+// way every handle to /dev/mei0 talks to a single ME.
+type Firmware struct {
+	mu        sync.Mutex
+	state     State
+	statePath string
+	// Handler serves the HTTP requests sent over LME channels, which is
+	// where WS-Man traffic ends up on real hardware. Defaults to a WS-Man
+	// responder for the activate, amtinfo and deactivate calls.
+	Handler http.Handler
+	// ReadTimeout is how long ReceiveMessage waits for data on an LME
+	// connection before returning zero bytes. Zero returns immediately.
+	ReadTimeout time.Duration
+
+	lmeDevices map[*Device]struct{}
+}
+
+// NewFirmware creates firmware that holds state in memory only.
+func NewFirmware(state State) *Firmware {
+	fw := &Firmware{
+		state: state,
+	}
+	fw.Handler = &wsmanHandler{firmware: fw}
+	return fw
+}
+
+// NewFirmwareFromFile loads state from path and writes every change back to
+// it, so state survives across separate processes.
+func NewFirmwareFromFile(path string) (*Firmware, error) {
+	state, err := LoadState(path)
+	if err != nil {
+		return nil, err
+	}
+	fw := NewFirmware(state)
+	fw.statePath = path
+	return fw, nil
+}
+
+// State returns a copy of the current firmware state.
+func (fw *Firmware) State() State {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.state
+}
+
+// Update applies fn to the firmware state and persists the result.
+func (fw *Firmware) Update(fn func(s *State)) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fn(&fw.state)
+	if fw.statePath == "" {
+		return nil
+	}
+	return SaveState(fw.statePath, fw.state)
+}
+
+// NewDevice returns a new handle to the firmware.
+func (fw *Firmware) NewDevice() heci.Interface {
+	return &Device{
+		firmware: fw,
+	}
+}
+
+// Device is a single open handle to the emulated MEI. Like the real driver
+// it may be closed while another goroutine is blocked in ReceiveMessage.
+type Device struct {
+	mu        sync.Mutex
+	firmware  *Firmware
+	client    client
+	responses chan []byte
+	closed    chan struct{}
+	lme       *lmeClient
+}
+
+func (d *Device) GetHardwareId() string {
+	return "EMULATED"
+}
+
+func (d *Device) Init(useLME bool, useWD bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.client = clientPTHI
+	if useLME {
+		d.client = clientLME
+		d.lme = newLMEClient(d.firmware)
+		d.firmware.mu.Lock()
+		if d.firmware.lmeDevices == nil {
+			d.firmware.lmeDevices = map[*Device]struct{}{}
+		}
+		d.firmware.lmeDevices[d] = struct{}{}
+		d.firmware.mu.Unlock()
+	} else if useWD {
+		d.client = clientWatchdog
+	}
+	d.responses = make(chan []byte, 1024)
+	d.closed = make(chan struct{})
+	return nil
+}
+
+func (d *Device) GetBufferSize() uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch d.client {
+	case clientLME:
+		return LMEBufferSize
+	case clientWatchdog:
+		return WatchdogBufferSize
+	default:
+		return PTHIBufferSize
+	}
+}
+
+func (d *Device) SendMessage(buffer []byte, done *uint32) (bytesWritten uint32, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == clientNone {
+		return 0, errors.New("no such device")
+	}
+	size := int(*done)
+	if size > len(buffer) {
+		size = len(buffer)
+	}
+	message := make([]byte, size)
+	copy(message, buffer[:size])
+
+	var replies [][]byte
+	switch d.client {
+	case clientPTHI:
+		replies = [][]byte{d.firmware.handlePTHI(message)}
+	case clientWatchdog:
+		replies = [][]byte{d.firmware.handleWatchdog(message)}
+	case clientLME:
+		replies = d.lme.handle(message)
+	}
+	for _, reply := range replies {
+		if len(reply) > 0 {
+			d.responses <- reply
+		}
+	}
+	return uint32(len(buffer)), nil
+}
+
+func (d *Device) ReceiveMessage(buffer []byte, done *uint32) (bytesRead uint32, err error) {
+	d.mu.Lock()
+	current, responses, closed := d.client, d.responses, d.closed
+	d.mu.Unlock()
+	if current == clientNone {
+		return 0, errors.New("no such device")
+	}
+	var reply []byte
+	if current == clientLME && d.firmware.ReadTimeout > 0 {
+		select {
+		case reply = <-responses:
+		case <-closed:
+			return 0, errors.New("no such device")
+		case <-time.After(d.firmware.ReadTimeout):
+			return 0, nil
+		}
+	} else {
+		select {
+		case reply = <-responses:
+		default:
+			return 0, nil
+		}
+	}
+	n := copy(buffer, reply)
+	return uint32(n), nil
+}
+
+func (d *Device) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != clientNone {
+		close(d.closed)
+	}
+	if d.client == clientLME {
+		d.firmware.mu.Lock()
+		delete(d.firmware.lmeDevices, d)
+		d.firmware.mu.Unlock()
+	}
+	d.client = clientNone
+	d.lme = nil
+}
+
+// DeliverEvent posts body to deliveryURL over every open LME connection,
+// the way AMT delivers WS-Man events to a subscription on the host. The
+// firmware opens a channel to the URL's address and closes it once the host
+// has answered.
+func (fw *Firmware) DeliverEvent(deliveryURL string, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, deliveryURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(request.URL.Port(), 10, 32)
+	if err != nil {
+		return fmt.Errorf("delivery address %s has no port", deliveryURL)
+	}
+	request.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	var data bytes.Buffer
+	request.Write(&data)
+
+	fw.mu.Lock()
+	devices := make([]*Device, 0, len(fw.lmeDevices))
+	for device := range fw.lmeDevices {
+		devices = append(devices, device)
+	}
+	fw.mu.Unlock()
+	if len(devices) == 0 {
+		return errors.New("no LME connection to deliver the event over")
+	}
+	for _, device := range devices {
+		device.mu.Lock()
+		if device.client == clientLME {
+			device.responses <- device.lme.openHostChannel(request.URL.Hostname(), uint32(port), data.Bytes())
+		}
+		device.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jc-lab/intel-amt-host-api/internal/amt"
+	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
+	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAMTCommand(fw *Firmware) amt.AMTCommand {
+	return amt.AMTCommand{
+		PTHI: pthi.Command{Heci: fw.NewDevice()},
+	}
+}
+
+func TestPTHI(t *testing.T) {
+	fw := NewFirmware(DefaultState())
+	amtCommand := newAMTCommand(fw)
+
+	t.Run("GetVersionDataFromME returns the AMT version", func(t *testing.T) {
+		version, err := amtCommand.GetVersionDataFromME("AMT", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "16.1.27", version)
+	})
+	t.Run("GetUUID round trips the configured uuid", func(t *testing.T) {
+		uuid, err := amtCommand.GetUUID()
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultState().UUID, uuid)
+	})
+	t.Run("GetControlMode returns pre-provisioning", func(t *testing.T) {
+		mode, err := amtCommand.GetControlMode()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, mode)
+	})
+	t.Run("GetCertificateHashes returns every hash", func(t *testing.T) {
+		hashes, err := amtCommand.GetCertificateHashes()
+		assert.NoError(t, err)
+		assert.Len(t, hashes, len(DefaultState().CertHashes))
+		assert.Equal(t, DefaultState().CertHashes[0].Hash, hashes[0].Hash)
+		assert.Equal(t, DefaultState().CertHashes[0].Name, hashes[0].Name)
+		assert.Equal(t, "SHA256", hashes[0].Algorithm)
+		assert.True(t, hashes[0].IsDefault)
+	})
+	t.Run("GetLANInterfaceSettings returns the wired interface", func(t *testing.T) {
+		settings, err := amtCommand.GetLANInterfaceSettings(false)
+		assert.NoError(t, err)
+		assert.True(t, settings.IsEnabled)
+		assert.Equal(t, "192.168.1.100", settings.IPAddress)
+		assert.Equal(t, "00:11:22:33:44:55", settings.MACAddress)
+		assert.Equal(t, "up", settings.LinkStatus)
+	})
+	t.Run("GetMACAddresses returns dedicated and host addresses", func(t *testing.T) {
+		addresses, err := amtCommand.GetMACAddresses()
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultState().Wired.MACAddress, addresses.DedicatedMAC)
+		assert.Equal(t, DefaultState().HostMACAddress, addresses.HostMAC)
+	})
+	t.Run("GetSecurityParameters reflects the state", func(t *testing.T) {
+		params, err := amtCommand.GetSecurityParameters()
+		assert.NoError(t, err)
+		assert.True(t, params.EnterpriseMode)
+		assert.False(t, params.TLSEnabled)
+		assert.Equal(t, "pre-provisioning", params.ProvisioningState)
+		assert.True(t, params.LinkIsUp)
+	})
+	t.Run("GetLocalSystemAccount returns the account", func(t *testing.T) {
+		account, err := amtCommand.GetLocalSystemAccount()
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultState().LocalSystemAccount.Username, account.Username)
+	})
+	t.Run("SetPkiFQDNSuffix updates GetDNSSuffix", func(t *testing.T) {
+		command := pthi.Command{Heci: fw.NewDevice()}
+		assert.NoError(t, command.Open(false))
+		status, err := command.SetPkiFQDNSuffix("vprodemo.com")
+		command.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, pthi.AMT_STATUS_SUCCESS, status)
+		suffix, err := amtCommand.GetDNSSuffix()
+		assert.NoError(t, err)
+		assert.Equal(t, "vprodemo.com", suffix)
+	})
+	t.Run("GetDNSSuffixList returns the configured suffixes", func(t *testing.T) {
+		fw.Update(func(s *State) { s.DNSSuffixList = []string{"vprodemo.com", "intel.com"} })
+		suffixes, err := amtCommand.GetDNSSuffixList()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"vprodemo.com", "intel.com"}, suffixes)
+	})
+	t.Run("GenerateRNGSeed makes the seed available", func(t *testing.T) {
+		fw.Update(func(s *State) { s.RNGSeedStatus = uint32(pthi.RNG_STATUS_NOT_EXIST) })
+		status, err := amtCommand.GetRNGSeedStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, amt.RNGSeedNotExists, status)
+		assert.NoError(t, amtCommand.GenerateRNGSeed())
+		status, err = amtCommand.GetRNGSeedStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, amt.RNGSeedExists, status)
+	})
+	t.Run("Unprovision resets the control mode", func(t *testing.T) {
+		fw.Update(func(s *State) { s.ControlMode = 2 })
+		_, err := amtCommand.Unprovision()
+		assert.NoError(t, err)
+		mode, _ := amtCommand.GetControlMode()
+		assert.Equal(t, 0, mode)
+		provisioningState, _ := amtCommand.GetProvisioningState()
+		assert.Equal(t, 0, provisioningState)
+	})
+	t.Run("unknown commands return an internal error", func(t *testing.T) {
+		response := fw.handlePTHI(make([]byte, pthi.GET_REQUEST_SIZE))
+		status := binary.LittleEndian.Uint32(response[12:16])
+		assert.Equal(t, uint32(pthi.AMT_STATUS_INTERNAL_ERROR), status)
+	})
+}
+
+func TestWatchdog(t *testing.T) {
+	fw := NewFirmware(DefaultState())
+	amtCommand := newAMTCommand(fw)
+
+	changeEnabled, err := amtCommand.GetChangeEnabled()
+	assert.NoError(t, err)
+	assert.True(t, changeEnabled.IsAMTEnabled())
+	assert.True(t, changeEnabled.IsNewInterfaceVersion())
+
+	assert.NoError(t, amtCommand.DisableAMT())
+	changeEnabled, _ = amtCommand.GetChangeEnabled()
+	assert.False(t, changeEnabled.IsAMTEnabled())
+
+	assert.NoError(t, amtCommand.EnableAMT())
+	changeEnabled, _ = amtCommand.GetChangeEnabled()
+	assert.True(t, changeEnabled.IsAMTEnabled())
+}
+
+func TestStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.yaml")
+	fw, err := NewFirmwareFromFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, fw.Update(func(s *State) { s.ControlMode = 1 }))
+
+	reloaded, err := NewFirmwareFromFile(path)
+	assert.NoError(t, err)
+	mode, err := newAMTCommand(reloaded).GetControlMode()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mode)
+}
+
+func TestClosedDevice(t *testing.T) {
+	device := NewFirmware(DefaultState()).NewDevice()
+	size := uint32(1)
+	_, err := device.SendMessage([]byte{0}, &size)
+	assert.Error(t, err)
+}
+
+// call sends an APF message and returns the first reply, if any.
+func call(t *testing.T, command pthi.Command, message []byte) []byte {
+	assert.NoError(t, command.Send(message, uint32(len(message))))
+	result, bytesRead, err := command.Receive()
+	assert.NoError(t, err)
+	return result[:bytesRead]
+}
+
+// readChannelData collects the data of queued APF_CHANNEL_DATA messages for host channel 2
+func readChannelData(t *testing.T, command pthi.Command) []byte {
+	data := []byte{}
+	for {
+		result, bytesRead, err := command.Receive()
+		assert.NoError(t, err)
+		if bytesRead == 0 {
+			return data
+		}
+		assert.Equal(t, uint8(apf.APF_CHANNEL_DATA), result[0])
+		assert.Equal(t, uint32(2), binary.BigEndian.Uint32(result[1:5]))
+		length := binary.BigEndian.Uint32(result[5:9])
+		data = append(data, result[9:9+length]...)
+	}
+}
+
+func TestLME(t *testing.T) {
+	fw := NewFirmware(DefaultState())
+	fw.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 5000))
+	})
+	command := pthi.Command{Heci: fw.NewDevice()}
+	assert.NoError(t, command.Open(true))
+	defer command.Close()
+	session := &apf.LMESession{Status: make(chan bool, 1)}
+
+	t.Run("handshake registers both forwarded ports", func(t *testing.T) {
+		var bin_buf bytes.Buffer
+		binary.Write(&bin_buf, binary.BigEndian, apf.ProtocolVersion(1, 0, 9))
+		ports := []uint32{}
+		for bin_buf.Len() > 0 {
+			result := call(t, command, bin_buf.Bytes())
+			if len(result) == 0 {
+				break
+			}
+			if result[0] == apf.APF_GLOBAL_REQUEST {
+				ports = append(ports, binary.BigEndian.Uint32(result[len(result)-4:]))
+			}
+			bin_buf = apf.Process(result, session)
+		}
+		assert.Equal(t, []uint32{16992, 16993}, ports)
+	})
+	t.Run("channel serves an http request", func(t *testing.T) {
+		open := apf.ChannelOpen(2)
+		apf.Process(call(t, command, open.Bytes()), session)
+		assert.True(t, <-session.Status)
+		assert.Equal(t, uint32(2), session.RecipientChannel)
+
+		request := []byte("POST /wsman HTTP/1.1\r\nHost: localhost:16992\r\nContent-Length: 4\r\n\r\ntest")
+		data := apf.EncodeChannelData(apf.ChannelData(session.SenderChannel, request))
+		windowAdjust := call(t, command, data)
+		assert.Equal(t, uint8(apf.APF_CHANNEL_WINDOW_ADJUST), windowAdjust[0])
+
+		response := readChannelData(t, command)
+		// the rest is held back until the host returns the window
+		assert.Len(t, response, apf.LME_RX_WINDOW_SIZE)
+		adjust := encode(apf.ChannelWindowAdjust(session.SenderChannel, uint32(len(response))))
+		assert.NoError(t, command.Send(adjust, uint32(len(adjust))))
+		response = append(response, readChannelData(t, command)...)
+		assert.True(t, bytes.HasPrefix(response, []byte("HTTP/1.1 200 OK")))
+		assert.True(t, bytes.HasSuffix(response, []byte(strings.Repeat("x", 5000))))
+
+		closeMessage := encode(apf.ChannelClose(session.SenderChannel))
+		reply := call(t, command, closeMessage)
+		assert.Equal(t, encode(apf.ChannelClose(2)), reply)
+	})
+}
+
+func TestWSManHandler(t *testing.T) {
+	fw := NewFirmware(DefaultState())
+	t.Run("challenges requests without a digest", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		fw.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/wsman", strings.NewReader("")))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), DefaultState().DigestRealm)
+	})
+	t.Run("rejects the admin account before provisioning", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/wsman", strings.NewReader(""))
+		request.Header.Set("Authorization", `Digest username="admin", realm="`+DefaultState().DigestRealm+`", nonce="`+wsmanNonce+`", uri="/wsman", response=""`)
+		recorder := httptest.NewRecorder()
+		fw.Handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
@@ -0,0 +1,273 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/apf"
+)
+
+// lmeClient plays the firmware side of the APF handshake and serves the
+// channels opened by the host.
+type lmeClient struct {
+	mu               sync.Mutex
+	firmware         *Firmware
+	versionSent      bool
+	serviceRequested bool
+	nextChannel      uint32
+	channels         map[uint32]*lmeChannel
+}
+
+type lmeChannel struct {
+	hostChannel uint32
+	data        []byte
+	// window is how much the host will accept, pending waits for it
+	window  uint32
+	pending []byte
+	// toHost is set on channels the firmware opened, which carry a request
+	// to the host instead of one from it
+	toHost bool
+}
+
+func newLMEClient(fw *Firmware) *lmeClient {
+	return &lmeClient{
+		firmware:    fw,
+		nextChannel: 1,
+		channels:    map[uint32]*lmeChannel{},
+	}
+}
+
+func (c *lmeClient) handle(message []byte) [][]byte {
+	if len(message) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch message[0] {
+	case apf.APF_PROTOCOLVERSION:
+		if !c.versionSent {
+			c.versionSent = true
+			return [][]byte{c.protocolVersion()}
+		}
+		if !c.serviceRequested {
+			c.serviceRequested = true
+			return [][]byte{serviceRequest(apf.APF_SERVICE_PFWD)}
+		}
+	case apf.APF_SERVICE_ACCEPT:
+		return [][]byte{tcpForwardRequest(16992)}
+	case apf.APF_REQUEST_SUCCESS:
+		reply := apf.APF_TCP_FORWARD_REPLY_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &reply)
+		if reply.PortBound == 16992 {
+			return [][]byte{tcpForwardRequest(16993)}
+		}
+	case apf.APF_CHANNEL_OPEN:
+		return [][]byte{c.openChannel(message)}
+	case apf.APF_CHANNEL_OPEN_CONFIRMATION:
+		confirmation := apf.APF_CHANNEL_OPEN_CONFIRMATION_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &confirmation)
+		channel, ok := c.channels[confirmation.RecipientChannel]
+		if !ok || !channel.toHost {
+			return nil
+		}
+		channel.hostChannel = confirmation.SenderChannel
+		channel.window = confirmation.InitialWindowSize
+		return channel.flush()
+	case apf.APF_CHANNEL_OPEN_FAILURE:
+		failure := apf.APF_CHANNEL_OPEN_FAILURE_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &failure)
+		delete(c.channels, failure.RecipientChannel)
+	case apf.APF_CHANNEL_DATA:
+		return c.channelData(message)
+	case apf.APF_CHANNEL_WINDOW_ADJUST:
+		adjust := apf.APF_CHANNEL_WINDOW_ADJUST_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &adjust)
+		channel, ok := c.channels[adjust.RecipientChannel]
+		if !ok {
+			return nil
+		}
+		channel.window += adjust.BytesToAdd
+		return channel.flush()
+	case apf.APF_CHANNEL_CLOSE:
+		closeMessage := apf.APF_CHANNEL_CLOSE_MESSAGE{}
+		binary.Read(bytes.NewBuffer(message), binary.BigEndian, &closeMessage)
+		channel, ok := c.channels[closeMessage.RecipientChannel]
+		if !ok {
+			return nil
+		}
+		delete(c.channels, closeMessage.RecipientChannel)
+		return [][]byte{encode(apf.ChannelClose(channel.hostChannel))}
+	}
+	return nil
+}
+
+func (c *lmeClient) protocolVersion() []byte {
+	message := apf.APF_PROTOCOL_VERSION_MESSAGE{
+		MessageType:   apf.APF_PROTOCOLVERSION,
+		MajorVersion:  1,
+		MinorVersion:  0,
+		TriggerReason: apf.APF_TRIGGER_REASON_LME_REQUEST,
+		UUID:          uuidBytes(c.firmware.State().UUID),
+	}
+	return encode(message)
+}
+
+func (c *lmeClient) openChannel(message []byte) []byte {
+	buf := bytes.NewBuffer(message)
+	var messageType uint8
+	var channelTypeLength, senderChannel, windowSize uint32
+	binary.Read(buf, binary.BigEndian, &messageType)
+	binary.Read(buf, binary.BigEndian, &channelTypeLength)
+	buf.Next(int(channelTypeLength))
+	binary.Read(buf, binary.BigEndian, &senderChannel)
+	binary.Read(buf, binary.BigEndian, &windowSize)
+
+	ourChannel := c.nextChannel
+	c.nextChannel++
+	c.channels[ourChannel] = &lmeChannel{hostChannel: senderChannel, window: windowSize}
+	confirmation := apf.APF_CHANNEL_OPEN_CONFIRMATION_MESSAGE{
+		MessageType:       apf.APF_CHANNEL_OPEN_CONFIRMATION,
+		RecipientChannel:  senderChannel,
+		SenderChannel:     ourChannel,
+		InitialWindowSize: apf.LME_RX_WINDOW_SIZE,
+		Reserved:          0xFFFFFFFF,
+	}
+	return encode(confirmation)
+}
+
+func (c *lmeClient) channelData(message []byte) [][]byte {
+	buf := bytes.NewBuffer(message)
+	var messageType uint8
+	var recipientChannel, dataLength uint32
+	binary.Read(buf, binary.BigEndian, &messageType)
+	binary.Read(buf, binary.BigEndian, &recipientChannel)
+	binary.Read(buf, binary.BigEndian, &dataLength)
+	channel, ok := c.channels[recipientChannel]
+	if !ok {
+		return nil
+	}
+	channel.data = append(channel.data, buf.Next(int(dataLength))...)
+
+	replies := [][]byte{encode(apf.ChannelWindowAdjust(channel.hostChannel, dataLength))}
+	if channel.toHost {
+		// close the channel once the host has answered
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(channel.data)), nil)
+		if err != nil {
+			return replies
+		}
+		_, err = io.ReadAll(response.Body)
+		if err != nil {
+			return replies
+		}
+		delete(c.channels, recipientChannel)
+		return append(replies, encode(apf.ChannelClose(channel.hostChannel)))
+	}
+	response, err := c.serve(channel.data)
+	if err != nil {
+		// wait for the rest of the request
+		return replies
+	}
+	channel.data = nil
+	channel.pending = append(channel.pending, response...)
+	return append(replies, channel.flush()...)
+}
+
+// openHostChannel opens a channel to address:port on the host that sends
+// request once the host confirms it
+func (c *lmeClient) openHostChannel(address string, port uint32, request []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ourChannel := c.nextChannel
+	c.nextChannel++
+	c.channels[ourChannel] = &lmeChannel{pending: request, toHost: true}
+	return apf.EncodeChannelOpen(apf.ChannelOpenRequest{
+		ChannelType:       apf.APF_OPEN_CHANNEL_REQUEST_FORWARDED,
+		SenderChannel:     ourChannel,
+		InitialWindowSize: apf.LME_RX_WINDOW_SIZE,
+		ConnectedAddress:  address,
+		ConnectedPort:     port,
+		OriginatorAddress: "127.0.0.1",
+		OriginatorPort:    16992,
+	})
+}
+
+// flush sends as much pending data as the host's window allows
+func (channel *lmeChannel) flush() [][]byte {
+	replies := [][]byte{}
+	for len(channel.pending) > 0 && channel.window > 0 {
+		n := len(channel.pending)
+		if n > apf.LME_RX_WINDOW_SIZE {
+			n = apf.LME_RX_WINDOW_SIZE
+		}
+		if uint32(n) > channel.window {
+			n = int(channel.window)
+		}
+		replies = append(replies, apf.EncodeChannelData(apf.ChannelData(channel.hostChannel, channel.pending[:n])))
+		channel.pending = channel.pending[n:]
+		channel.window -= uint32(n)
+	}
+	return replies
+}
+
+// serve runs a complete HTTP request through the firmware handler. An error
+// is returned while the request is still incomplete.
+func (c *lmeClient) serve(data []byte) ([]byte, error) {
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if request.ContentLength > 0 && int64(len(body)) < request.ContentLength {
+		return nil, errors.New("incomplete request body")
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	recorder := httptest.NewRecorder()
+	c.firmware.Handler.ServeHTTP(recorder, request)
+	response := recorder.Result()
+	response.ContentLength = int64(recorder.Body.Len())
+	var out bytes.Buffer
+	err = response.Write(&out)
+	return out.Bytes(), err
+}
+
+func serviceRequest(service string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint8(apf.APF_SERVICE_REQUEST))
+	binary.Write(&buf, binary.BigEndian, uint32(len(service)))
+	buf.WriteString(service)
+	return buf.Bytes()
+}
+
+func tcpForwardRequest(port uint32) []byte {
+	address := "0.0.0.0"
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint8(apf.APF_GLOBAL_REQUEST))
+	binary.Write(&buf, binary.BigEndian, uint32(len(apf.APF_GLOBAL_REQUEST_STR_TCP_FORWARD_REQUEST)))
+	buf.WriteString(apf.APF_GLOBAL_REQUEST_STR_TCP_FORWARD_REQUEST)
+	binary.Write(&buf, binary.BigEndian, uint8(1))
+	binary.Write(&buf, binary.BigEndian, uint32(len(address)))
+	buf.WriteString(address)
+	binary.Write(&buf, binary.BigEndian, port)
+	return buf.Bytes()
+}
+
+func encode(message interface{}) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, message)
+	return buf.Bytes()
+}
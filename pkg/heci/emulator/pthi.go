@@ -0,0 +1,293 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package emulator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+)
+
+const pthiResponseBit = 0x00800000
+
+type pthiRequest struct {
+	command uint32
+	body    *bytes.Buffer
+}
+
+func parsePTHIRequest(message []byte) (pthiRequest, bool) {
+	if len(message) < int(pthi.GET_REQUEST_SIZE) {
+		return pthiRequest{}, false
+	}
+	return pthiRequest{
+		command: binary.LittleEndian.Uint32(message[4:8]),
+		body:    bytes.NewBuffer(message[pthi.GET_REQUEST_SIZE:]),
+	}, true
+}
+
+// pthiResponse encodes the response header followed by the given body
+// fields. The header is written by hand because pthi.CommandFormat does not
+// export its value.
+func pthiResponse(command uint32, status pthi.Status, fields ...interface{}) []byte {
+	var body bytes.Buffer
+	for _, field := range fields {
+		binary.Write(&body, binary.LittleEndian, field)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, pthi.Version{MajorNumber: pthi.MAJOR_VERSION, MinorNumber: pthi.MINOR_VERSION})
+	binary.Write(&buf, binary.LittleEndian, uint16(0))
+	binary.Write(&buf, binary.LittleEndian, command|pthiResponseBit)
+	binary.Write(&buf, binary.LittleEndian, uint32(body.Len()+4))
+	binary.Write(&buf, binary.LittleEndian, status)
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func (fw *Firmware) handlePTHI(message []byte) []byte {
+	request, ok := parsePTHIRequest(message)
+	if !ok {
+		return pthiResponse(0, pthi.AMT_STATUS_INVALID_MESSAGE_LENGTH)
+	}
+	state := fw.State()
+
+	switch request.command {
+	case pthi.CODE_VERSIONS_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, codeVersions(state))
+	case pthi.GET_UUID_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, uuidBytes(state.UUID))
+	case pthi.GET_CONTROL_MODE_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, uint32(state.ControlMode))
+	case pthi.GET_PKI_FQDN_SUFFIX_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, ansiString(state.DNSSuffix))
+	case pthi.SET_PKI_FQDN_SUFFIX_REQUEST:
+		suffix := pthi.AMTANSIString{}
+		binary.Read(request.body, binary.LittleEndian, &suffix)
+		if int(suffix.Length) > len(suffix.Buffer) {
+			return pthiResponse(request.command, pthi.AMT_STATUS_INVALID_PARAMETER)
+		}
+		fw.Update(func(s *State) {
+			s.DNSSuffix = string(suffix.Buffer[:suffix.Length])
+		})
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS)
+	case pthi.ENUMERATE_HASH_HANDLES_REQUEST:
+		handles := pthi.AMTHashHandles{}
+		for i := range state.CertHashes {
+			if i == pthi.CERT_HASH_MAX_NUMBER {
+				break
+			}
+			handles.Handles[i] = uint32(i)
+			handles.Length++
+		}
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, handles)
+	case pthi.GET_CERTHASH_ENTRY_REQUEST:
+		var handle uint32
+		binary.Read(request.body, binary.LittleEndian, &handle)
+		if int(handle) >= len(state.CertHashes) {
+			return pthiResponse(request.command, pthi.AMT_STATUS_INVALID_HANDLE)
+		}
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, certHashEntry(state.CertHashes[handle]))
+	case pthi.GET_REMOTE_ACCESS_CONNECTION_STATUS_REQUEST:
+		ra := state.RemoteAccess
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, ra.NetworkStatus, ra.RemoteStatus, ra.RemoteTrigger, ansiString(ra.MPSHostname))
+	case pthi.GET_LAN_INTERFACE_SETTINGS_REQUEST:
+		var index uint32
+		binary.Read(request.body, binary.LittleEndian, &index)
+		lan := state.Wired
+		if index == 1 {
+			lan = state.Wireless
+		}
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, lanInterfaceSettings(lan)...)
+	case pthi.GET_LOCAL_SYSTEM_ACCOUNT_REQUEST:
+		account := pthi.LocalSystemAccount{}
+		copy(account.Username[:], state.LocalSystemAccount.Username)
+		copy(account.Password[:], state.LocalSystemAccount.Password)
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, account)
+	case pthi.PROVISIONING_STATE_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, provisioningState(state))
+	case pthi.GET_SECURITY_PARAMETERS_REQUEST:
+		params := pthi.AMTSecurityParameters{
+			EnterpriseMode:          1,
+			TLSEnabled:              boolByte(state.TLSEnabled),
+			HWCryptoEnabled:         1,
+			ProvisioningState:       provisioningState(state),
+			NetworkInterfaceEnabled: boolByte(state.Wired.Enabled),
+			SOLEnabled:              1,
+			IDEREnabled:             1,
+			FWUpdateEnabled:         1,
+			LinkIsUp:                boolByte(state.Wired.LinkUp),
+		}
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, params)
+	case pthi.GET_MAC_ADDRESSES_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, macBytes(state.Wired.MACAddress), macBytes(state.HostMACAddress))
+	case pthi.GET_DNS_SUFFIX_LIST_REQUEST:
+		var data bytes.Buffer
+		for _, suffix := range state.DNSSuffixList {
+			data.WriteString(suffix)
+			data.WriteByte(0)
+		}
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, uint16(data.Len()), data.Bytes())
+	case pthi.SET_ENTERPRISE_ACCESS_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS)
+	case pthi.GENERATE_RNG_SEED_REQUEST:
+		fw.Update(func(s *State) {
+			s.RNGSeedStatus = uint32(pthi.RNG_STATUS_EXIST)
+		})
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS)
+	case pthi.GET_RNG_SEED_STATUS_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, state.RNGSeedStatus)
+	case pthi.UNPROVISION_REQUEST:
+		fw.Update(func(s *State) {
+			s.ControlMode = 0
+			s.AdminDigest = ""
+		})
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, uint32(0))
+	case pthi.STOP_CONFIGURATION_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS)
+	case pthi.START_CONFIGURATION_HBASED_REQUEST:
+		if state.ControlMode != 0 {
+			return pthiResponse(request.command, pthi.AMT_STATUS_INVALID_AMT_MODE)
+		}
+		hash := sha256.Sum256([]byte(state.UUID))
+		var amtCertHash [pthi.SHA_512_KEY_SIZE]byte
+		copy(amtCertHash[:], hash[:])
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS, pthi.CERT_HASH_ALGORITHM_SHA256, amtCertHash)
+	case pthi.OPEN_USER_INITIATED_CONNECTION_REQUEST, pthi.CLOSE_USER_INITIATED_CONNECTION_REQUEST:
+		return pthiResponse(request.command, pthi.AMT_STATUS_SUCCESS)
+	default:
+		return pthiResponse(request.command, pthi.AMT_STATUS_INTERNAL_ERROR)
+	}
+}
+
+// handleWatchdog answers the state independence requests used to read and
+// change the AMT operational state.
+func (fw *Firmware) handleWatchdog(message []byte) []byte {
+	if len(message) < 4 || message[0] != pthi.STATE_INDEPENNDENCE_IsChangeToAMTEnabled_CMD {
+		return []byte{}
+	}
+	switch message[2] {
+	case pthi.STATE_INDEPENNDENCE_IsChangeToAMTEnabled_SUBCMD:
+		// new interface version, transition allowed, bit 1 set when enabled
+		response := uint8(0x81)
+		if fw.State().AMTEnabled {
+			response |= 0x02
+		}
+		return []byte{response}
+	case pthi.STATE_INDEPENNDENCE_SetAmtOperationalState_SUBCMD:
+		if len(message) < 5 {
+			return []byte{}
+		}
+		fw.Update(func(s *State) {
+			s.AMTEnabled = pthi.AMTOperationalState(message[4]) == pthi.AmtEnabled
+		})
+		var buf bytes.Buffer
+		buf.Write(message[:4])
+		binary.Write(&buf, binary.LittleEndian, pthi.AMT_STATUS_SUCCESS)
+		return buf.Bytes()
+	}
+	return []byte{}
+}
+
+func codeVersions(state State) pthi.CodeVersions {
+	versions := pthi.CodeVersions{}
+	copy(versions.BiosVersion[:], state.BiosVersion)
+	for i, v := range state.CodeVersions {
+		if i == pthi.VERSIONS_NUMBER {
+			break
+		}
+		versions.Versions[i].Description = unicodeString(v.Description)
+		versions.Versions[i].Version = unicodeString(v.Version)
+		versions.VersionsCount++
+	}
+	return versions
+}
+
+func unicodeString(s string) pthi.AMTUnicodeString {
+	u := pthi.AMTUnicodeString{}
+	u.Length = uint16(copy(u.String[:], s))
+	return u
+}
+
+func ansiString(s string) pthi.AMTANSIString {
+	a := pthi.AMTANSIString{}
+	a.Length = uint16(copy(a.Buffer[:], s))
+	return a
+}
+
+// uuidBytes encodes a canonical UUID string in the mixed endian layout
+// returned by the firmware.
+func uuidBytes(uuid string) [16]uint8 {
+	var result [16]uint8
+	raw, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil || len(raw) != 16 {
+		return result
+	}
+	copy(result[:], raw)
+	result[0], result[1], result[2], result[3] = raw[3], raw[2], raw[1], raw[0]
+	result[4], result[5] = raw[5], raw[4]
+	result[6], result[7] = raw[7], raw[6]
+	return result
+}
+
+func certHashEntry(hash CertHash) pthi.CertHashEntry {
+	entry := pthi.CertHashEntry{
+		HashAlgorithm: hash.Algorithm,
+		Name:          ansiString(hash.Name),
+	}
+	copy(entry.CertificateHash[:], hash.bytes())
+	if hash.IsDefault {
+		entry.IsDefault = 1
+	}
+	if hash.IsActive {
+		entry.IsActive = 1
+	}
+	return entry
+}
+
+func lanInterfaceSettings(lan LANInterface) []interface{} {
+	var enabled, dhcpEnabled uint32
+	var linkStatus uint8
+	if lan.Enabled {
+		enabled = 1
+	}
+	if lan.DHCPEnabled {
+		dhcpEnabled = 1
+	}
+	if lan.LinkUp {
+		linkStatus = 1
+	}
+	var ipv4 uint32
+	if ip := net.ParseIP(lan.IPAddress).To4(); ip != nil {
+		ipv4 = binary.BigEndian.Uint32(ip)
+	}
+	return []interface{}{enabled, ipv4, dhcpEnabled, lan.DHCPMode, linkStatus, macBytes(lan.MACAddress)}
+}
+
+func macBytes(address string) [6]uint8 {
+	var mac [6]uint8
+	if hw, err := net.ParseMAC(address); err == nil {
+		copy(mac[:], hw)
+	}
+	return mac
+}
+
+// provisioningState reports post-provisioning once any control mode is set.
+func provisioningState(state State) uint32 {
+	if state.ControlMode == 0 {
+		return 0
+	}
+	return 2
+}
+
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package emulator
+
+import (
+	"encoding/hex"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// State is the simulated firmware state. It can be loaded from and saved to
+// a yaml file so that separate rpc invocations share the same device.
+type State struct {
+	BiosVersion        string             `yaml:"biosVersion"`
+	CodeVersions       []CodeVersion      `yaml:"codeVersions"`
+	UUID               string             `yaml:"uuid"`
+	ControlMode        int                `yaml:"controlMode"`
+	AMTEnabled         bool               `yaml:"amtEnabled"`
+	DNSSuffix          string             `yaml:"dnsSuffix"`
+	DNSSuffixList      []string           `yaml:"dnsSuffixList"`
+	RNGSeedStatus      uint32             `yaml:"rngSeedStatus"`
+	CertHashes         []CertHash         `yaml:"certHashes"`
+	Wired              LANInterface       `yaml:"wired"`
+	Wireless           LANInterface       `yaml:"wireless"`
+	HostMACAddress     string             `yaml:"hostMacAddress"`
+	TLSEnabled         bool               `yaml:"tlsEnabled"`
+	LocalSystemAccount LocalSystemAccount `yaml:"localSystemAccount"`
+	DigestRealm        string             `yaml:"digestRealm"`
+	AdminDigest        string             `yaml:"adminDigest"` // hex MD5 of admin:realm:password
+	RemoteAccess       RemoteAccessStatus `yaml:"remoteAccess"`
+}
+
+type CodeVersion struct {
+	Description string `yaml:"description"`
+	Version     string `yaml:"version"`
+}
+
+type CertHash struct {
+	Name      string `yaml:"name"`
+	Algorithm uint8  `yaml:"algorithm"`
+	Hash      string `yaml:"hash"` // hex encoded
+	IsDefault bool   `yaml:"isDefault"`
+	IsActive  bool   `yaml:"isActive"`
+}
+
+type LANInterface struct {
+	Enabled     bool   `yaml:"enabled"`
+	IPAddress   string `yaml:"ipAddress"`
+	DHCPEnabled bool   `yaml:"dhcpEnabled"`
+	DHCPMode    uint8  `yaml:"dhcpMode"`
+	LinkUp      bool   `yaml:"linkUp"`
+	MACAddress  string `yaml:"macAddress"`
+}
+
+type LocalSystemAccount struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type RemoteAccessStatus struct {
+	NetworkStatus uint32 `yaml:"networkStatus"`
+	RemoteStatus  uint32 `yaml:"remoteStatus"`
+	RemoteTrigger uint32 `yaml:"remoteTrigger"`
+	MPSHostname   string `yaml:"mpsHostname"`
+}
+
+// DefaultState returns a pre-provisioned AMT 16 device with one wired
+// interface and the Intel default trusted root hashes enabled.
+func DefaultState() State {
+	return State{
+		BiosVersion: "EMULATED.0001.2024",
+		CodeVersions: []CodeVersion{
+			{Description: "Flash", Version: "16.1.27"},
+			{Description: "Netstack", Version: "16.1.27"},
+			{Description: "AMTApps", Version: "16.1.27"},
+			{Description: "AMT", Version: "16.1.27"},
+			{Description: "Sku", Version: "16392"},
+			{Description: "VendorID", Version: "8086"},
+			{Description: "Build Number", Version: "2225"},
+			{Description: "Recovery Version", Version: "16.1.27"},
+			{Description: "Recovery Build Num", Version: "2225"},
+			{Description: "Legacy Mode", Version: "False"},
+		},
+		UUID:        "4c4c4544-0038-4710-8052-b4c04f313233",
+		ControlMode: 0,
+		AMTEnabled:  true,
+		DNSSuffix:   "",
+		CertHashes: []CertHash{
+			{
+				Name:      "VeriSign Class 3 Primary CA-G5",
+				Algorithm: 2,
+				Hash:      "9acfab7e43c8d880d06b262a94deeee4b4659989c3d0caf19baf6405e41ab7df",
+				IsDefault: true,
+				IsActive:  true,
+			},
+			{
+				Name:      "Go Daddy Class 2 CA",
+				Algorithm: 2,
+				Hash:      "c3846bf24b9e93ca64274c0ec67c1ecc5e024ffcacd2d74019350e81fe546ae4",
+				IsDefault: true,
+				IsActive:  true,
+			},
+		},
+		Wired: LANInterface{
+			Enabled:     true,
+			IPAddress:   "192.168.1.100",
+			DHCPEnabled: true,
+			DHCPMode:    2,
+			LinkUp:      true,
+			MACAddress:  "00:11:22:33:44:55",
+		},
+		HostMACAddress: "00:11:22:33:44:56",
+		LocalSystemAccount: LocalSystemAccount{
+			Username: "$$OsAdmin",
+			Password: "emulatedLocalSystemAccountPasswd",
+		},
+		DigestRealm: "Digest:4C4C4544003847108052B4C04F313233",
+	}
+}
+
+// LoadState reads a yaml state file. A missing file yields DefaultState.
+func LoadState(path string) (State, error) {
+	state := DefaultState()
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = yaml.Unmarshal(content, &state)
+	return state, err
+}
+
+// SaveState writes the state to a yaml file.
+func SaveState(path string, state State) error {
+	content, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
+
+func (h CertHash) bytes() []byte {
+	b, _ := hex.DecodeString(h.Hash)
+	return b
+}
@@ -0,0 +1,146 @@
+/*********************************************************************
+ * Copyright (c) Intel Corporation 2024
+ * SPDX-License-Identifier: Apache-2.0
+ **********************************************************************/
+package emulator
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+
+	"github.com/jc-lab/intel-amt-host-api/pkg/pthi"
+)
+
+// wsmanNonce is the digest nonce of every challenge, the wsman client
+// reuses the challenge for each request it sends
+const wsmanNonce = "00000000000000000000000000000000"
+
+var digestParam = regexp.MustCompile(`(\w+)="?([^",]*)"?`)
+
+// wsmanHandler answers the WS-Man calls of local activate, amtinfo and
+// deactivate. Other calls get the fault AMT returns for unknown actions.
+type wsmanHandler struct {
+	firmware *Firmware
+}
+
+type wsmanRequest struct {
+	Header struct {
+		Action      string `xml:"Action"`
+		ResourceURI string `xml:"ResourceURI"`
+	} `xml:"Header"`
+	Body struct {
+		Setup struct {
+			NetworkAdminPassword string `xml:"NetworkAdminPassword"`
+		} `xml:"Setup_INPUT"`
+	} `xml:"Body"`
+}
+
+func (h *wsmanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := h.firmware.State()
+	if !authorized(r, state) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s"`, state.DigestRealm, wsmanNonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var request wsmanRequest
+	if err := xml.Unmarshal(body, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resourceURI := request.Header.ResourceURI
+	response, ok := h.respond(path.Base(resourceURI), path.Base(request.Header.Action), request, state)
+	w.Header().Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, wsmanEnvelope("http://schemas.xmlsoap.org/ws/2004/08/addressing",
+			`<a:Fault><a:Code><a:Value>a:Sender</a:Value></a:Code><a:Reason><a:Text xml:lang="en-US">The action is not supported by the service.</a:Text></a:Reason></a:Fault>`))
+		return
+	}
+	fmt.Fprint(w, wsmanEnvelope(resourceURI, response))
+}
+
+func (h *wsmanHandler) respond(class, action string, request wsmanRequest, state State) (string, bool) {
+	switch class + "/" + action {
+	case "AMT_GeneralSettings/Get":
+		return fmt.Sprintf(`<h:AMT_GeneralSettings><h:DigestRealm>%s</h:DigestRealm><h:DomainName>%s</h:DomainName><h:ElementName>Intel(r) AMT: General Settings</h:ElementName><h:InstanceID>Intel(r) AMT: General Settings</h:InstanceID><h:NetworkInterfaceEnabled>true</h:NetworkInterfaceEnabled></h:AMT_GeneralSettings>`,
+			state.DigestRealm, state.DNSSuffix), true
+	case "IPS_HostBasedSetupService/Setup":
+		if state.ControlMode != 0 {
+			return returnValue("Setup", pthi.AMT_STATUS_INVALID_AMT_MODE), true
+		}
+		h.firmware.Update(func(s *State) {
+			s.ControlMode = 1
+			s.AdminDigest = request.Body.Setup.NetworkAdminPassword
+		})
+		return returnValue("Setup", pthi.AMT_STATUS_SUCCESS), true
+	case "AMT_SetupAndConfigurationService/Unprovision":
+		if state.ControlMode == 0 {
+			return returnValue("Unprovision", pthi.AMT_STATUS_INVALID_AMT_MODE), true
+		}
+		h.firmware.Update(func(s *State) {
+			s.ControlMode = 0
+			s.AdminDigest = ""
+		})
+		return returnValue("Unprovision", pthi.AMT_STATUS_SUCCESS), true
+	case "AMT_RedirectionService/Get":
+		return `<h:AMT_RedirectionService><h:CreationClassName>AMT_RedirectionService</h:CreationClassName><h:ElementName>Intel(r) AMT Redirection Service</h:ElementName><h:EnabledState>32768</h:EnabledState><h:ListenerEnabled>false</h:ListenerEnabled><h:Name>Intel(r) AMT Redirection Service</h:Name><h:SystemCreationClassName>CIM_ComputerSystem</h:SystemCreationClassName><h:SystemName>Intel(r) AMT</h:SystemName></h:AMT_RedirectionService>`, true
+	case "CIM_KVMRedirectionSAP/Get":
+		return `<h:CIM_KVMRedirectionSAP><h:CreationClassName>CIM_KVMRedirectionSAP</h:CreationClassName><h:EnabledState>3</h:EnabledState><h:Name>KVM Redirection Service Access Point</h:Name></h:CIM_KVMRedirectionSAP>`, true
+	case "IPS_KVMRedirectionSettingData/Get":
+		return `<h:IPS_KVMRedirectionSettingData><h:EnabledByMEBx>true</h:EnabledByMEBx><h:InstanceID>Intel(r) KVM Redirection Settings</h:InstanceID><h:Is5900PortEnabled>false</h:Is5900PortEnabled></h:IPS_KVMRedirectionSettingData>`, true
+	case "IPS_OptInService/Get":
+		return `<h:IPS_OptInService><h:CanModifyOptInPolicy>1</h:CanModifyOptInPolicy><h:CreationClassName>IPS_OptInService</h:CreationClassName><h:ElementName>Intel(r) AMT OptIn Service</h:ElementName><h:Name>Intel(r) AMT OptIn Service</h:Name><h:OptInCodeTimeout>120</h:OptInCodeTimeout><h:OptInDisplayTimeout>300</h:OptInDisplayTimeout><h:OptInRequired>4294967295</h:OptInRequired><h:OptInState>0</h:OptInState><h:SystemCreationClassName>CIM_ComputerSystem</h:SystemCreationClassName><h:SystemName>Intel(r) AMT</h:SystemName></h:IPS_OptInService>`, true
+	}
+	return "", false
+}
+
+// authorized checks the HTTP digest of the request against the local system
+// account and, once provisioned, the admin password hash set by Setup
+func authorized(r *http.Request, state State) bool {
+	params := map[string]string{}
+	for _, match := range digestParam.FindAllStringSubmatch(r.Header.Get("Authorization"), -1) {
+		params[match[1]] = match[2]
+	}
+	var credentials string
+	switch params["username"] {
+	case "":
+		return false
+	case state.LocalSystemAccount.Username:
+		credentials = md5Hex(state.LocalSystemAccount.Username + ":" + state.DigestRealm + ":" + state.LocalSystemAccount.Password)
+	case "admin":
+		credentials = state.AdminDigest
+	}
+	if credentials == "" || params["realm"] != state.DigestRealm || params["nonce"] != wsmanNonce {
+		return false
+	}
+	uri := md5Hex(r.Method + ":" + params["uri"])
+	return params["response"] == md5Hex(credentials+":"+wsmanNonce+":"+uri)
+}
+
+func returnValue(method string, status pthi.Status) string {
+	return fmt.Sprintf(`<h:%s_OUTPUT><h:ReturnValue>%d</h:ReturnValue></h:%s_OUTPUT>`, method, status, method)
+}
+
+// wsmanEnvelope wraps a response body the way AMT does, h: is the class
+// namespace ns
+func wsmanEnvelope(ns string, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><a:Envelope xmlns:a="http://www.w3.org/2003/05/soap-envelope"` +
+		` xmlns:b="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:c="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"` +
+		` xmlns:h="` + ns + `"><a:Header></a:Header><a:Body>` + body + `</a:Body></a:Envelope>`
+}
+
+func md5Hex(data string) string {
+	sum := md5.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
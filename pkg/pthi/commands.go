@@ -37,11 +37,24 @@ type Interface interface {
 	SetPkiFQDNSuffix(suffix string) (status Status, err error)
 	OpenUserInitiatedConnection() (status Status, err error)
 	CloseUserInitiatedConnection() (status Status, err error)
+	GetSecurityParameters() (response GetSecurityParametersResponse, err error)
+	GetMACAddresses() (response GetMACAddressesResponse, err error)
+	GetProvisioningState() (state int, err error)
+	GetDNSSuffixList() (suffixes []string, err error)
+	SetEnterpriseAccess(flags uint8, hostIPAddress [16]uint8, enterpriseAccess uint8) (status Status, err error)
+	GenerateRNGSeed() (status Status, err error)
+	GetRNGSeedStatus() (status AMT_RNG_STATUS, err error)
+}
+
+// NewHeciDriver creates the heci.Interface used by NewCommand. It is a
+// variable so that builds without MEI hardware can swap in an emulator.
+var NewHeciDriver = func() heci.Interface {
+	return heci.NewDriver()
 }
 
 func NewCommand() Command {
 	return Command{
-		Heci: heci.NewDriver(),
+		Heci: NewHeciDriver(),
 	}
 }
 
@@ -204,7 +217,7 @@ func (pthi Command) SetAmtOperationalState(state AMTOperationalState) (Status, e
 	command := SetAmtOperationalState{
 		Command:       0x5,
 		ByteCount:     0x3,
-		SubCommand:    0x53,
+		SubCommand:    STATE_INDEPENNDENCE_SetAmtOperationalState_SUBCMD,
 		VersionNumber: 0x10,
 		Enabled:       state,
 	}
@@ -519,3 +532,140 @@ func (pthi Command) CloseUserInitiatedConnection() (status Status, err error) {
 
 	return response.Status, nil
 }
+
+func (pthi Command) GetSecurityParameters() (response GetSecurityParametersResponse, err error) {
+	command := GetRequest{
+		Header: CreateRequestHeader(GET_SECURITY_PARAMETERS_REQUEST, 0),
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, command)
+	result, err := pthi.Call(bin_buf.Bytes(), GET_REQUEST_SIZE)
+	if err != nil {
+		return GetSecurityParametersResponse{}, err
+	}
+	buf2 := bytes.NewBuffer(result)
+	response = GetSecurityParametersResponse{
+		Header: readHeaderResponse(buf2),
+	}
+	binary.Read(buf2, binary.LittleEndian, &response.Parameters)
+
+	return response, nil
+}
+
+func (pthi Command) GetMACAddresses() (response GetMACAddressesResponse, err error) {
+	command := GetRequest{
+		Header: CreateRequestHeader(GET_MAC_ADDRESSES_REQUEST, 0),
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, command)
+	result, err := pthi.Call(bin_buf.Bytes(), GET_REQUEST_SIZE)
+	if err != nil {
+		return GetMACAddressesResponse{}, err
+	}
+	buf2 := bytes.NewBuffer(result)
+	response = GetMACAddressesResponse{
+		Header: readHeaderResponse(buf2),
+	}
+	binary.Read(buf2, binary.LittleEndian, &response.DedicatedMAC)
+	binary.Read(buf2, binary.LittleEndian, &response.HostMAC)
+
+	return response, nil
+}
+
+func (pthi Command) GetProvisioningState() (state int, err error) {
+	command := GetRequest{
+		Header: CreateRequestHeader(PROVISIONING_STATE_REQUEST, 0),
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, command)
+	result, err := pthi.Call(bin_buf.Bytes(), GET_REQUEST_SIZE)
+	if err != nil {
+		return -1, err
+	}
+	buf2 := bytes.NewBuffer(result)
+	response := GetProvisioningStateResponse{
+		Header: readHeaderResponse(buf2),
+	}
+
+	binary.Read(buf2, binary.LittleEndian, &response.ProvisioningState)
+	return int(response.ProvisioningState), nil
+}
+
+func (pthi Command) GetDNSSuffixList() (suffixes []string, err error) {
+	command := GetRequest{
+		Header: CreateRequestHeader(GET_DNS_SUFFIX_LIST_REQUEST, 0),
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, command)
+	result, err := pthi.Call(bin_buf.Bytes(), GET_REQUEST_SIZE)
+	if err != nil {
+		return []string{}, err
+	}
+	buf2 := bytes.NewBuffer(result)
+	response := GetDNSSuffixListResponse{
+		Header: readHeaderResponse(buf2),
+	}
+	binary.Read(buf2, binary.LittleEndian, &response.DataLength)
+	if int(response.DataLength) > buf2.Len() {
+		return []string{}, errors.New("invalid DNS suffix list length")
+	}
+	response.Data = buf2.Next(int(response.DataLength))
+
+	// the list is a sequence of null terminated strings
+	suffixes = []string{}
+	for _, suffix := range bytes.Split(response.Data, []byte{0}) {
+		if len(suffix) > 0 {
+			suffixes = append(suffixes, string(suffix))
+		}
+	}
+	return suffixes, nil
+}
+
+func (pthi Command) SetEnterpriseAccess(flags uint8, hostIPAddress [16]uint8, enterpriseAccess uint8) (status Status, err error) {
+	command := SetEnterpriseAccessRequest{
+		Header:           CreateRequestHeader(SET_ENTERPRISE_ACCESS_REQUEST, 18),
+		Flags:            flags,
+		HostIPAddress:    hostIPAddress,
+		EnterpriseAccess: enterpriseAccess,
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, command)
+	result, err := pthi.Call(bin_buf.Bytes(), GET_REQUEST_SIZE+18)
+	if err != nil {
+		return AMT_STATUS_INTERNAL_ERROR, err
+	}
+	buf2 := bytes.NewBuffer(result)
+	response := readHeaderResponse(buf2)
+	return response.Status, nil
+}
+
+func (pthi Command) GenerateRNGSeed() (status Status, err error) {
+	header := CreateRequestHeader(GENERATE_RNG_SEED_REQUEST, 0)
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, header)
+	result, err := pthi.Call(bin_buf.Bytes(), GET_REQUEST_SIZE)
+	if err != nil {
+		return AMT_STATUS_INTERNAL_ERROR, err
+	}
+	buf2 := bytes.NewBuffer(result)
+	response := readHeaderResponse(buf2)
+	return response.Status, nil
+}
+
+func (pthi Command) GetRNGSeedStatus() (status AMT_RNG_STATUS, err error) {
+	command := GetRequest{
+		Header: CreateRequestHeader(GET_RNG_SEED_STATUS_REQUEST, 0),
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, command)
+	result, err := pthi.Call(bin_buf.Bytes(), GET_REQUEST_SIZE)
+	if err != nil {
+		return RNG_STATUS_NOT_EXIST, err
+	}
+	buf2 := bytes.NewBuffer(result)
+	response := GetRNGSeedStatusResponse{
+		Header: readHeaderResponse(buf2),
+	}
+	binary.Read(buf2, binary.LittleEndian, &response.RngStatus)
+	return response.RngStatus, nil
+}
@@ -346,3 +346,127 @@ func TestSetAmtOperationalState(t *testing.T) {
 	assert.NotEmpty(t, result)
 	assert.Equal(t, AMT_STATUS_INVALID_AMT_MODE, result)
 }
+
+func TestGetSecurityParameters(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE
+	prepareMessage := GetSecurityParametersResponse{
+		Header: ResponseMessageHeader{},
+		Parameters: AMTSecurityParameters{
+			EnterpriseMode:          1,
+			TLSEnabled:              1,
+			ProvisioningState:       2,
+			NetworkInterfaceEnabled: 1,
+		},
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, prepareMessage)
+	message = bin_buf.Bytes()
+
+	result, err := pthi.GetSecurityParameters()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(1), result.Parameters.EnterpriseMode)
+	assert.Equal(t, uint8(1), result.Parameters.TLSEnabled)
+	assert.Equal(t, uint8(0), result.Parameters.HWCryptoEnabled)
+	assert.Equal(t, uint32(2), result.Parameters.ProvisioningState)
+	assert.Equal(t, uint8(1), result.Parameters.NetworkInterfaceEnabled)
+}
+
+func TestGetMACAddresses(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE
+	prepareMessage := GetMACAddressesResponse{
+		Header:       ResponseMessageHeader{},
+		DedicatedMAC: [6]uint8{1, 2, 3, 4, 5, 6},
+		HostMAC:      [6]uint8{6, 5, 4, 3, 2, 1},
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, prepareMessage)
+	message = bin_buf.Bytes()
+
+	result, err := pthi.GetMACAddresses()
+	assert.NoError(t, err)
+	assert.Equal(t, [6]uint8{1, 2, 3, 4, 5, 6}, result.DedicatedMAC)
+	assert.Equal(t, [6]uint8{6, 5, 4, 3, 2, 1}, result.HostMAC)
+}
+
+func TestGetProvisioningState(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE
+	prepareMessage := GetProvisioningStateResponse{
+		Header:            ResponseMessageHeader{},
+		ProvisioningState: 1,
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, prepareMessage)
+	message = bin_buf.Bytes()
+
+	result, err := pthi.GetProvisioningState()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+}
+
+func TestGetDNSSuffixList(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE
+	suffixes := []byte("vprodemo.com\x00intel.com\x00")
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, ResponseMessageHeader{})
+	binary.Write(&bin_buf, binary.LittleEndian, uint16(len(suffixes)))
+	bin_buf.Write(suffixes)
+	message = bin_buf.Bytes()
+
+	result, err := pthi.GetDNSSuffixList()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vprodemo.com", "intel.com"}, result)
+}
+
+func TestGetDNSSuffixListInvalidLength(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, ResponseMessageHeader{})
+	binary.Write(&bin_buf, binary.LittleEndian, uint16(0xFFFF))
+	message = bin_buf.Bytes()
+
+	_, err := pthi.GetDNSSuffixList()
+	assert.Error(t, err)
+}
+
+func TestSetEnterpriseAccess(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE + 18
+	prepareMessage := ResponseMessageHeader{
+		Status: AMT_STATUS_SUCCESS,
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, prepareMessage)
+	message = bin_buf.Bytes()
+
+	result, err := pthi.SetEnterpriseAccess(ENTERPRISE_ACCESS_FLAG_IPV4, [16]uint8{192, 168, 1, 1}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, AMT_STATUS_SUCCESS, result)
+}
+
+func TestGenerateRNGSeed(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE
+	prepareMessage := ResponseMessageHeader{
+		Status: AMT_STATUS_RNG_GENERATION_IN_PROGRESS,
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, prepareMessage)
+	message = bin_buf.Bytes()
+
+	result, err := pthi.GenerateRNGSeed()
+	assert.NoError(t, err)
+	assert.Equal(t, AMT_STATUS_RNG_GENERATION_IN_PROGRESS, result)
+}
+
+func TestGetRNGSeedStatus(t *testing.T) {
+	numBytes = GET_REQUEST_SIZE
+	prepareMessage := GetRNGSeedStatusResponse{
+		Header:    ResponseMessageHeader{},
+		RngStatus: RNG_STATUS_IN_PROGRESS,
+	}
+	var bin_buf bytes.Buffer
+	binary.Write(&bin_buf, binary.LittleEndian, prepareMessage)
+	message = bin_buf.Bytes()
+
+	result, err := pthi.GetRNGSeedStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, RNG_STATUS_IN_PROGRESS, result)
+}
@@ -132,6 +132,7 @@ const SET_PKI_FQDN_SUFFIX_RESPOSNE = 0x0480002f
 
 const STATE_INDEPENNDENCE_IsChangeToAMTEnabled_CMD = 0x5
 const STATE_INDEPENNDENCE_IsChangeToAMTEnabled_SUBCMD = 0x51
+const STATE_INDEPENNDENCE_SetAmtOperationalState_SUBCMD = 0x53
 
 type AMTUnicodeString struct {
 	Length uint16
@@ -354,3 +355,65 @@ type SetPkiFQDNSuffix struct {
 	Header MessageHeader
 	Suffix AMTANSIString
 }
+
+// AMTSecurityParameters fields are single byte booleans, unlike AMT_BOOLEAN
+type AMTSecurityParameters struct {
+	EnterpriseMode          uint8
+	TLSEnabled              uint8
+	HWCryptoEnabled         uint8
+	ProvisioningState       uint32
+	NetworkInterfaceEnabled uint8
+	SOLEnabled              uint8
+	IDEREnabled             uint8
+	FWUpdateEnabled         uint8
+	LinkIsUp                uint8
+	Reserved                [8]uint8
+}
+
+type GetSecurityParametersResponse struct {
+	Header     ResponseMessageHeader
+	Parameters AMTSecurityParameters
+}
+
+type GetMACAddressesResponse struct {
+	Header       ResponseMessageHeader
+	DedicatedMAC [6]uint8
+	HostMAC      [6]uint8
+}
+
+type GetProvisioningStateResponse struct {
+	Header            ResponseMessageHeader
+	ProvisioningState uint32
+}
+
+type GetDNSSuffixListResponse struct {
+	Header     ResponseMessageHeader
+	DataLength uint16
+	Data       []uint8
+}
+
+type SetEnterpriseAccessRequest struct {
+	Header           MessageHeader
+	Flags            uint8
+	HostIPAddress    [16]uint8
+	EnterpriseAccess uint8
+}
+
+// Flags for SetEnterpriseAccessRequest
+const (
+	ENTERPRISE_ACCESS_FLAG_IPV4 = 0
+	ENTERPRISE_ACCESS_FLAG_IPV6 = 1
+)
+
+type AMT_RNG_STATUS uint32
+
+const (
+	RNG_STATUS_EXIST       AMT_RNG_STATUS = 0
+	RNG_STATUS_IN_PROGRESS AMT_RNG_STATUS = 1
+	RNG_STATUS_NOT_EXIST   AMT_RNG_STATUS = 2
+)
+
+type GetRNGSeedStatusResponse struct {
+	Header    ResponseMessageHeader
+	RngStatus AMT_RNG_STATUS
+}
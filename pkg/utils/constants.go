@@ -19,6 +19,8 @@ const (
 	LMSAddress = "localhost"
 	// LMSPort is used for determining what port to connect to LMS on
 	LMSPort = "16992"
+	// LMSTLSPort is used for determining what port to connect to LMS on with TLS
+	LMSTLSPort = "16993"
 
 	// MPSServerMaxLength is the max length of the servername
 	MPSServerMaxLength = 256
@@ -29,15 +31,52 @@ const (
 	CommandMaintenance = "maintenance"
 	CommandVersion     = "version"
 	CommandConfigure   = "configure"
+	CommandLMS         = "lms"
+	CommandEvents      = "events"
+	CommandPower       = "power"
+	CommandBoot        = "boot"
+	CommandLogs        = "logs"
+	CommandInventory   = "inventory"
+	CommandConsent     = "consent"
+	CommandUsers       = "users"
+	CommandApply       = "apply"
+	CommandRecover     = "recover"
+	CommandBackup      = "backup"
+	CommandRestore     = "restore"
 
 	SubCommandAddWifiSettings = "addwifisettings"
 	SubCommandEnableWifiPort  = "enablewifiport"
 	SubCommandConfigureTLS    = "tls"
+	SubCommandConfigureCIRA   = "cira"
+	SubCommandConfigureWired  = "wired"
+	SubCommandRedirection     = "redirection"
 	SubCommandChangePassword  = "changepassword"
 	SubCommandSyncDeviceInfo  = "syncdeviceinfo"
 	SubCommandSyncClock       = "syncclock"
 	SubCommandSyncHostname    = "synchostname"
 	SubCommandSyncIP          = "syncip"
+	SubCommandListen          = "listen"
+	SubCommandPowerState      = "state"
+	SubCommandPowerOn         = "on"
+	SubCommandPowerOff        = "off"
+	SubCommandPowerCycle      = "cycle"
+	SubCommandPowerReset      = "reset"
+	SubCommandPowerSleep      = "sleep"
+	SubCommandPowerHibernate  = "hibernate"
+	SubCommandPowerSoftOff    = "soft-off"
+	SubCommandBootList        = "list"
+	SubCommandBootStatus      = "status"
+	SubCommandBootSet         = "set"
+	SubCommandLogsAudit       = "audit"
+	SubCommandLogsEvents      = "events"
+	SubCommandConsentStart    = "start"
+	SubCommandConsentSend     = "send"
+	SubCommandConsentCancel   = "cancel"
+	SubCommandConsentStatus   = "status"
+	SubCommandUsersList       = "list"
+	SubCommandUsersAdd        = "add"
+	SubCommandUsersRemove     = "remove"
+	SubCommandUsersUpdate     = "update"
 
 	// Return Codes
 	Success ReturnCode = 0
@@ -93,6 +132,19 @@ const (
 	DeleteWifiConfigFailed            ReturnCode = 114
 	MissingOrIncorrectWifiProfileName ReturnCode = 116
 	MissingIeee8021xConfiguration     ReturnCode = 117
+	PowerManagementFailed             ReturnCode = 118
+	BootConfigurationFailed           ReturnCode = 119
+	ReadLogFailed                     ReturnCode = 120
+	ClearLogFailed                    ReturnCode = 121
+	InventoryFailed                   ReturnCode = 122
+	UserManagementFailed              ReturnCode = 123
+	UntrustedProvisioningCertificate  ReturnCode = 124
+	PkiDNSSuffixMismatch              ReturnCode = 125
+	ControlModeMismatch               ReturnCode = 126
+	InterruptedOperation              ReturnCode = 127
+	RecoveryFailed                    ReturnCode = 128
+	BackupFailed                      ReturnCode = 129
+	RestoreFailed                     ReturnCode = 130
 
 	// (150-199) Maintenance Errors
 	SyncClockFailed      ReturnCode = 150